@@ -1,34 +1,98 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 
 	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/api"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/collector"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/config"
 	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/daemon"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/debugserver"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/inuse"
 	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/version"
 )
 
 func main() {
+	// Printed before the logger starts, so the output is only the version line
+	if len(os.Args) >= 2 && (os.Args[1] == "version" || os.Args[1] == "--version") {
+		build := version.Get()
+		fmt.Printf("profiler-sidecar %s (commit %s, built %s, %s)\n", build.Version, build.Commit, build.BuildDate, build.GoVersion)
+		return
+	}
+
 	// Initialize logger
 	logger.Init()
+	defer logger.Shutdown()
 
 	if len(os.Args) < 2 {
-		fmt.Println("Usage: profiler-sidecar [sidecar|daemon]")
+		fmt.Println("Usage: profiler-sidecar [sidecar|daemon|standalone|collector|version] [flags]")
 		os.Exit(1)
 	}
 
 	mode := os.Args[1]
 
+	cfg, err := config.Load(os.Args[2:])
+	if err != nil {
+		logger.Log.WithError(err).Fatal("Invalid configuration")
+	}
+	debugserver.Start()
+
+	build := version.Get()
+	startup := logger.Log.WithFields(map[string]any{
+		"version":   build.Version,
+		"commit":    build.Commit,
+		"buildDate": build.BuildDate,
+	})
+
 	switch mode {
 	case "sidecar":
-		logger.Log.WithField("mode", "sidecar").Info("Starting in Sidecar mode (API server)")
-		api.Start()
+		startup.WithField("mode", "sidecar").Info("Starting in Sidecar mode (API server)")
+		api.Start(cfg)
 	case "daemon":
-		logger.Log.WithField("mode", "daemon").Info("Starting in DaemonSet mode (File scanner)")
-		daemon.Start()
+		startup.WithField("mode", "daemon").Info("Starting in DaemonSet mode (File scanner)")
+		daemon.Start(cfg)
+	case "standalone":
+		startup.WithField("mode", "standalone").Info("Starting in Standalone mode (API server and file scanner)")
+		runStandalone(cfg)
+	case "collector":
+		startup.WithField("mode", "collector").Info("Starting in Collector mode (upload relay)")
+		collector.Start(cfg)
 	default:
-		logger.Log.WithField("mode", mode).Error("Unknown mode. Use 'sidecar' or 'daemon'")
+		logger.Log.WithField("mode", mode).Error("Unknown mode. Use 'sidecar', 'daemon', 'standalone', 'collector' or 'version'")
 		os.Exit(1)
 	}
 }
+
+// runStandalone serves the API and uploads its own profile directory from one process, for
+// single VMs and docker-compose setups without a DaemonSet. Both halves share a file tracker so
+// recordings are not uploaded while the JVM writes them, nor deleted while they are in use.
+// The scanner watches the API's profile directory.
+func runStandalone(cfg *config.Config) {
+	// Without a pod, recordings are uploaded under the host name
+	if os.Getenv("POD_NAME") == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			logger.Log.WithError(err).Fatal("POD_NAME is unset and the host name is unavailable")
+		}
+		os.Setenv("POD_NAME", host)
+	}
+
+	files := inuse.New()
+	ctx, cancel := context.WithCancel(context.Background())
+	scannerDone := make(chan struct{})
+	go func() {
+		defer close(scannerDone)
+		scannerCfg := *cfg
+		scannerCfg.ProfileRoot = cfg.ProfileDir
+		daemon.StartWith(ctx, daemon.Deps{Config: &scannerCfg, Pod: os.Getenv("POD_NAME"), Files: files})
+	}()
+
+	api.StartWith(api.Deps{Config: cfg, Files: files})
+
+	// Recordings stopped during shutdown stay on disk and are uploaded on the next start
+	cancel()
+	<-scannerDone
+}
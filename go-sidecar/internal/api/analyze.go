@@ -0,0 +1,316 @@
+package api
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/jfr"
+)
+
+const (
+	// defaultAnalysisTop is how many stacks and allocation sites /analyze returns without "top"
+	defaultAnalysisTop = 10
+	// analysisStackDepth bounds the frames shown per CPU stack, innermost first
+	analysisStackDepth = 16
+)
+
+// Analysis summarizes a recording: what it holds, where CPU time and allocations went and how
+// long GC paused the application
+type Analysis struct {
+	Name           string           `json:"name"`
+	Start          time.Time        `json:"start"`
+	Duration       string           `json:"duration"`
+	Events         int              `json:"events"`
+	EventCounts    map[string]int   `json:"eventCounts"` // JFR event type -> events
+	CPUSamples     int              `json:"cpuSamples"`
+	TopCPUStacks   []StackSamples   `json:"topCpuStacks"`
+	AllocatedBytes int64            `json:"allocatedBytes"` // estimated from allocation samples
+	TopAllocations []AllocationSite `json:"topAllocationSites"`
+	GC             GCPauses         `json:"gc"`
+}
+
+// StackSamples is a CPU stack and the share of execution samples it received
+type StackSamples struct {
+	Frames  []string `json:"frames"` // innermost first, e.g. "java.util.HashMap.resize:676"
+	Samples int      `json:"samples"`
+	Percent float64  `json:"percent"`
+}
+
+// AllocationSite is the frame that allocated and the bytes attributed to it
+type AllocationSite struct {
+	Frame   string  `json:"frame"`
+	Class   string  `json:"class"` // the class of the objects allocated most at this site
+	Bytes   int64   `json:"bytes"`
+	Samples int     `json:"samples"`
+	Percent float64 `json:"percent"`
+}
+
+// GCPauses is the distribution of the application pauses of each garbage collection
+type GCPauses struct {
+	Collections int            `json:"collections"`
+	ByCollector map[string]int `json:"byCollector"` // e.g. "G1New" -> collections
+	TotalMs     float64        `json:"totalMs"`
+	P50Ms       float64        `json:"p50Ms"`
+	P90Ms       float64        `json:"p90Ms"`
+	P99Ms       float64        `json:"p99Ms"`
+	MaxMs       float64        `json:"maxMs"`
+}
+
+// analyzeHandler parses a recording on the volume and summarizes it, for a first look without
+// downloading it into JMC. name is the file as shown by /list; "top" bounds the stacks and
+// allocation sites returned.
+func (s *Server) analyzeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendJSON(w, http.StatusMethodNotAllowed, Response{
+			Success: false,
+			Message: "Method not allowed",
+		})
+		return
+	}
+
+	name := cmp.Or(r.PathValue("name"), r.URL.Query().Get("name"))
+	if err := validRecordingFile(name); err != nil {
+		sendJSON(w, http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("Invalid name: %v", err),
+		})
+		return
+	}
+	top := defaultAnalysisTop
+	if v := r.URL.Query().Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			sendJSON(w, http.StatusBadRequest, Response{
+				Success: false,
+				Message: fmt.Sprintf("Invalid request: top must be a positive number, got %q", v),
+			})
+			return
+		}
+		top = n
+	}
+
+	root, err := s.recordingDir(r.Context())
+	if err != nil {
+		sendJSON(w, http.StatusInternalServerError, Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to open recording directory: %v", err),
+		})
+		return
+	}
+	filePath := filepath.Join(root, filepath.FromSlash(name))
+	if s.files != nil {
+		defer s.files.Acquire(filePath)()
+	}
+
+	f, err := s.fs.Open(filePath)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, fs.ErrNotExist) {
+			status = http.StatusNotFound
+		}
+		sendJSON(w, status, Response{
+			Success: false,
+			Message: fmt.Sprintf("Recording '%s' not found", name),
+		})
+		return
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil {
+		s.extendWriteDeadline(w, info.Size()) // parsing a large recording outlasts the write timeout
+	}
+
+	a := newAnalyzer()
+	recording, err := openRecording(f, name)
+	if err == nil {
+		err = jfr.Parse(recording, a.add)
+	}
+	if err != nil {
+		sendJSON(w, http.StatusUnprocessableEntity, Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to parse recording '%s': %v", name, err),
+		})
+		return
+	}
+	analysis := a.result(top)
+	analysis.Name = name
+	sendJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("Recording analyzed: %d events", analysis.Events),
+		Data:    analysis,
+	})
+}
+
+// analyzer accumulates the events of a recording
+type analyzer struct {
+	counts     map[string]int
+	events     int
+	start, end time.Time
+
+	cpuSamples int
+	stacks     map[string]*StackSamples
+
+	allocated   int64
+	sites       map[string]*AllocationSite
+	siteClasses map[string]map[string]int64 // site -> class -> bytes
+
+	pauses     []time.Duration
+	collectors map[string]int
+}
+
+func newAnalyzer() *analyzer {
+	return &analyzer{
+		counts:      map[string]int{},
+		stacks:      map[string]*StackSamples{},
+		sites:       map[string]*AllocationSite{},
+		siteClasses: map[string]map[string]int64{},
+		collectors:  map[string]int{},
+	}
+}
+
+// add records one event; it never fails, so a recording is always analyzed in full
+func (a *analyzer) add(e *jfr.Event) error {
+	a.counts[e.Type()]++
+	a.events++
+	if t := e.StartTime(); !t.IsZero() {
+		if a.start.IsZero() || t.Before(a.start) {
+			a.start = t
+		}
+		if t.After(a.end) {
+			a.end = t
+		}
+	}
+
+	switch e.Type() {
+	case "jdk.ExecutionSample":
+		frames := stackFrames(e.Object("stackTrace"), analysisStackDepth)
+		key := strings.Join(frames, "\n")
+		stack, ok := a.stacks[key]
+		if !ok {
+			stack = &StackSamples{Frames: frames}
+			a.stacks[key] = stack
+		}
+		stack.Samples++
+		a.cpuSamples++
+	case "jdk.ObjectAllocationSample":
+		a.allocation(e, e.Int("weight"))
+	case "jdk.ObjectAllocationInNewTLAB":
+		a.allocation(e, e.Int("tlabSize"))
+	case "jdk.ObjectAllocationOutsideTLAB":
+		a.allocation(e, e.Int("allocationSize"))
+	case "jdk.GarbageCollection":
+		a.pauses = append(a.pauses, e.Duration("sumOfPauses"))
+		a.collectors[e.String("name")]++
+	}
+	return nil
+}
+
+// allocation attributes bytes to the top frame of an allocation event's stack
+func (a *analyzer) allocation(e *jfr.Event, bytes int64) {
+	frames := stackFrames(e.Object("stackTrace"), 1)
+	site := "(no stack trace)"
+	if len(frames) > 0 {
+		site = frames[0]
+	}
+	as, ok := a.sites[site]
+	if !ok {
+		as = &AllocationSite{Frame: site}
+		a.sites[site] = as
+		a.siteClasses[site] = map[string]int64{}
+	}
+	as.Bytes += bytes
+	as.Samples++
+	a.allocated += bytes
+	if class := javaName(e.Object("objectClass").String("name")); class != "" {
+		a.siteClasses[site][class] += bytes
+	}
+}
+
+// result builds the analysis with the top stacks and allocation sites
+func (a *analyzer) result(top int) Analysis {
+	result := Analysis{
+		Start:          a.start,
+		Duration:       a.end.Sub(a.start).String(),
+		Events:         a.events,
+		EventCounts:    a.counts,
+		CPUSamples:     a.cpuSamples,
+		TopCPUStacks:   []StackSamples{},
+		AllocatedBytes: a.allocated,
+		TopAllocations: []AllocationSite{},
+		GC:             GCPauses{Collections: len(a.pauses), ByCollector: a.collectors},
+	}
+
+	for _, stack := range a.stacks {
+		stack.Percent = percentOf(int64(stack.Samples), int64(a.cpuSamples))
+		result.TopCPUStacks = append(result.TopCPUStacks, *stack)
+	}
+	slices.SortFunc(result.TopCPUStacks, func(x, y StackSamples) int {
+		return cmp.Or(cmp.Compare(y.Samples, x.Samples), slices.Compare(x.Frames, y.Frames))
+	})
+	result.TopCPUStacks = result.TopCPUStacks[:min(top, len(result.TopCPUStacks))]
+
+	for site, as := range a.sites {
+		as.Percent = percentOf(as.Bytes, a.allocated)
+		var classBytes int64
+		for class, bytes := range a.siteClasses[site] {
+			if bytes > classBytes || (bytes == classBytes && class < as.Class) {
+				as.Class, classBytes = class, bytes
+			}
+		}
+		result.TopAllocations = append(result.TopAllocations, *as)
+	}
+	slices.SortFunc(result.TopAllocations, func(x, y AllocationSite) int {
+		return cmp.Or(cmp.Compare(y.Bytes, x.Bytes), strings.Compare(x.Frame, y.Frame))
+	})
+	result.TopAllocations = result.TopAllocations[:min(top, len(result.TopAllocations))]
+
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	var total time.Duration
+	for _, p := range a.pauses {
+		total += p
+	}
+	result.GC.TotalMs = ms(total)
+	result.GC.P50Ms = ms(percentile(a.pauses, 0.50))
+	result.GC.P90Ms = ms(percentile(a.pauses, 0.90))
+	result.GC.P99Ms = ms(percentile(a.pauses, 0.99))
+	result.GC.MaxMs = ms(percentile(a.pauses, 1))
+	return result
+}
+
+// stackFrames formats up to depth frames of a JFR stack trace, innermost first
+func stackFrames(trace *jfr.Object, depth int) []string {
+	var frames []string
+	for _, f := range trace.Array("frames") {
+		frame, ok := f.(*jfr.Object)
+		if !ok || len(frames) == depth {
+			break
+		}
+		method := frame.Object("method")
+		name := javaName(method.Object("type").String("name")) + "." + method.String("name")
+		if line := frame.Int("lineNumber"); line > 0 {
+			name += ":" + strconv.FormatInt(line, 10)
+		}
+		frames = append(frames, name)
+	}
+	return frames
+}
+
+// javaName turns a class name as JFR stores it ("java/util/HashMap") into its binary name
+func javaName(name string) string {
+	return strings.ReplaceAll(name, "/", ".")
+}
+
+// percentOf returns part as a percentage of total, rounded to one decimal
+func percentOf(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part*1000/total) / 10
+}
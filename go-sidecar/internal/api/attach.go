@@ -0,0 +1,44 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/attach"
+)
+
+// validAttachMode rejects combining the ways of reaching a JVM other than running jcmd
+func (s *Server) validAttachMode() error {
+	switch {
+	case s.opts.AttachNative && s.opts.AttachNsenter:
+		return errors.New("ATTACH_NATIVE and ATTACH_NSENTER are exclusive")
+	case s.jolokia != nil && (s.opts.AttachNative || s.opts.AttachNsenter):
+		return errors.New("JOLOKIA_URL cannot be combined with ATTACH_NATIVE or ATTACH_NSENTER")
+	}
+	return nil
+}
+
+// attachController is the JVMController with ATTACH_NATIVE: JVMs are found like with jcmd, and
+// commanded over their attach socket
+type attachController struct {
+	ProcessFinder
+	exec *execRunner
+}
+
+// Jcmd sends the command line over the attach protocol. The output starts with the "<pid>:" line
+// jcmd prints, so parsers see the same text either way.
+func (c *attachController) Jcmd(ctx context.Context, pid int, command string, options ...string) ([]byte, error) {
+	args := jcmdArgs(pid, command, options)
+	return c.exec.instrument(ctx, "jcmd", args, func(ctx context.Context) ([]byte, error) {
+		start := time.Now()
+		output, err := attach.Jcmd(ctx, pid, strings.Join(args[1:], " "))
+		output = append([]byte(args[0]+":\n"), output...)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("attach to JVM %d stopped after %s: %w", pid, time.Since(start).Round(time.Millisecond), errCommandTimeout)
+		}
+		return output, err
+	})
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// apiToken reads the static bearer token from API_TOKEN, or from the file named by API_TOKEN_FILE
+// (a mounted Secret). Empty disables the check.
+func apiToken() (string, error) {
+	token := os.Getenv("API_TOKEN")
+	if path := os.Getenv("API_TOKEN_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read API token file: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	return token, nil
+}
+
+// mutating reports whether a request can change state: start or stop recordings, delete files
+func mutating(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// requireToken rejects mutating requests without the static bearer token with 401. Reads stay
+// open so probes and dashboards work unchanged. With tenancy or Kubernetes review enabled, those
+// tokens authenticate every request instead and the static token is not used.
+func (s *Server) requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.token == "" || s.tenants != nil || s.reviewer != nil || !mutating(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="profiler-sidecar"`)
+			sendJSON(w, http.StatusUnauthorized, Response{
+				Success: false,
+				Message: "A valid bearer token is required",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
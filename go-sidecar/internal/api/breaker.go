@@ -0,0 +1,91 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/breaker"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/metrics"
+)
+
+// jcmdBreaker returns the circuit guarding jcmd calls against one JVM. A hung JVM or a broken
+// attach mechanism makes every jcmd call block and fail, so after JCMD_BREAKER_THRESHOLD
+// consecutive failures calls fail fast for JCMD_BREAKER_COOLDOWN.
+func (e *execRunner) jcmdBreaker(pid string) *breaker.Breaker {
+	e.breakersMu.Lock()
+	defer e.breakersMu.Unlock()
+
+	b, ok := e.breakers[pid]
+	if !ok {
+		b = breaker.New("jcmd "+pid, e.opts.JcmdBreakerThreshold, e.opts.JcmdBreakerCooldown)
+		e.breakers[pid] = b
+	}
+	return b
+}
+
+// guardJcmd runs call behind the PID's circuit breaker, logging state changes
+func (e *execRunner) guardJcmd(pid string, call func() ([]byte, error)) ([]byte, error) {
+	b := e.jcmdBreaker(pid)
+	if err := b.Allow(); err != nil {
+		metrics.JcmdRejectedTotal.Inc()
+		return nil, err
+	}
+
+	before := b.State()
+	output, err := call()
+	switch {
+	case errors.Is(err, context.Canceled):
+		// The caller went away; that says nothing about the JVM
+		b.Forget()
+	case err != nil && jvmResponded(pid, output):
+		// The JVM attached and rejected the command (e.g. unknown recording): it is healthy
+		b.Record(nil)
+	default:
+		b.Record(err)
+	}
+
+	after := b.State()
+	if after != before {
+		fields := map[string]interface{}{"pid": pid, "state": after}
+		if after == breaker.Open {
+			logger.Log.WithError(err).WithFields(fields).Warn("jcmd circuit opened, failing fast until cooldown elapses")
+		} else {
+			logger.Log.WithFields(fields).Info("jcmd circuit state changed")
+		}
+	}
+	metrics.JcmdCircuitOpen.WithLabelValues(pid).Set(boolGauge(after == breaker.Open))
+	return output, err
+}
+
+// jvmResponded reports whether jcmd reached the JVM: its replies start with a "<pid>:" line
+func jvmResponded(pid string, output []byte) bool {
+	return bytes.HasPrefix(output, []byte(pid+":\n"))
+}
+
+// commandStatus maps a command failure to an HTTP status: 503 with Retry-After while the circuit
+// is open, 504 when the command timed out, 500 otherwise
+func commandStatus(w http.ResponseWriter, err error) int {
+	var open *breaker.OpenError
+	if errors.As(err, &open) {
+		retry := math.Ceil(time.Until(open.Until).Seconds())
+		w.Header().Set("Retry-After", strconv.Itoa(max(int(retry), 1)))
+		return http.StatusServiceUnavailable
+	}
+	if errors.Is(err, errCommandTimeout) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/requestid"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/uploader"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/validation"
+)
+
+// A /create callbackUrl is POSTed once the recording's file is on disk. Failed deliveries are
+// retried with exponential backoff; RECORDING_CALLBACK_HOSTS, when set, limits the hosts
+// callbacks may be sent to.
+const (
+	callbackTimeout    = 10 * time.Second
+	callbackBackoffMin = time.Second
+	callbackBackoffMax = time.Minute
+
+	// callbackFileWait bounds how long a completed recording's file may take to appear; the JVM
+	// writes it asynchronously when a duration elapses
+	callbackFileWait = 30 * time.Second
+)
+
+// CallbackPayload is the JSON body POSTed to a recording's callbackUrl
+type CallbackPayload struct {
+	JobID     string `json:"jobId"`
+	Name      string `json:"name"`
+	Filename  string `json:"filename"`
+	Path      string `json:"path"` // local path on the profile volume
+	Size      int64  `json:"size"`
+	Pod       string `json:"pod,omitempty"`
+	Object    string `json:"object"`              // destination-relative object name the file is uploaded as
+	UploadURI string `json:"uploadUri,omitempty"` // e.g. gs://bucket/pod/name.jfr, when the destination is known
+	Completed string `json:"completedAt"`         // RFC3339
+	Error     string `json:"error,omitempty"`     // set when the file never appeared
+}
+
+// jobCallback is where and what to report when a job's recording completes
+type jobCallback struct {
+	url       string
+	requestID string
+	object    string
+	uploadURI string
+}
+
+// validCallbackHost checks a valid callback URL against RECORDING_CALLBACK_HOSTS
+func (s *Server) validCallbackHost(field, value string) *validation.FieldError {
+	if value == "" || s.opts.CallbackHosts == "" {
+		return nil
+	}
+	u, _ := url.Parse(value)
+	for _, host := range strings.Split(s.opts.CallbackHosts, ",") {
+		if strings.EqualFold(strings.TrimSpace(host), u.Hostname()) {
+			return nil
+		}
+	}
+	return &validation.FieldError{Field: field, Message: fmt.Sprintf("host %q is not in RECORDING_CALLBACK_HOSTS", u.Hostname())}
+}
+
+// newJobCallback resolves the object the recording at path will be uploaded as. ctx is the
+// creating request's context, which carries the tenant's upload scope and the request ID.
+func (s *Server) newJobCallback(ctx context.Context, callbackURL, path string) *jobCallback {
+	ctx = uploadScope(ctx)
+	cb := &jobCallback{
+		url:       callbackURL,
+		requestID: requestid.FromContext(ctx),
+		object:    uploader.ObjectPath(ctx, path, os.Getenv("POD_NAME")),
+	}
+	// The sidecar usually does not upload itself, but shares the daemon's GCS_* settings
+	if u, err := s.remote(); err == nil {
+		cb.uploadURI = strings.TrimSuffix(uploader.DestinationFor(ctx, u), "/") + "/" + cb.object
+	}
+	return cb
+}
+
+// deliverCallback waits for the job's file and POSTs its description to the callback URL,
+// retrying failed deliveries
+func (s *Server) deliverCallback(job Job, cb *jobCallback) {
+	payload := CallbackPayload{
+		JobID:     job.ID,
+		Name:      job.Recording,
+		Filename:  job.Filename,
+		Path:      job.Path,
+		Pod:       os.Getenv("POD_NAME"),
+		Object:    cb.object,
+		UploadURI: cb.uploadURI,
+	}
+	size, err := s.waitForFile(job.Path)
+	payload.Size = size
+	if err != nil {
+		payload.Error = err.Error()
+	}
+	payload.Completed = s.clock.Now().UTC().Format(time.RFC3339)
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	entry := logger.Log.WithFields(map[string]any{"job": job.ID, "name": job.Recording, "callback": cb.url, "request_id": cb.requestID})
+	for attempt := 1; ; attempt++ {
+		err := postCallback(cb, body)
+		if err == nil {
+			entry.WithField("attempts", attempt).Info("Recording callback delivered")
+			return
+		}
+		if attempt > s.opts.CallbackRetries {
+			entry.WithError(err).WithField("attempts", attempt).Error("Recording callback failed, giving up")
+			return
+		}
+		delay := min(callbackBackoffMin<<min(attempt-1, 10), callbackBackoffMax)
+		entry.WithError(err).WithField("retryIn", delay.String()).Warn("Recording callback failed")
+		select {
+		case <-time.After(delay):
+		case <-s.closing:
+			entry.Warn("Sidecar is shutting down, abandoning recording callback")
+			return
+		}
+	}
+}
+
+// waitForFile waits until a recording's file exists and returns its size
+func (s *Server) waitForFile(path string) (int64, error) {
+	deadline := s.clock.Now().Add(callbackFileWait)
+	for {
+		info, err := s.fs.Stat(path)
+		if err == nil {
+			return info.Size(), nil
+		}
+		if s.finishPending(path) {
+			deadline = s.clock.Now().Add(callbackFileWait)
+		}
+		if s.clock.Now().After(deadline) {
+			return 0, fmt.Errorf("recording file did not appear within %s: %w", callbackFileWait, err)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// postCallback makes one delivery attempt; any non-2xx answer is a failure
+func postCallback(cb *jobCallback, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), callbackTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cb.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cb.requestID != "" {
+		req.Header.Set(requestid.Header, cb.requestID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("callback returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// checkLinePattern matches one recording in JFR.check output, e.g.
+// "Recording 2: name=main-recording duration=1m maxsize=250.0MB (running)"
+var checkLinePattern = regexp.MustCompile(`^Recording (\d+): name=(\S+)(.*?)\s*\((\w+)\)\s*$`)
+
+// RecordingStatus is one recording reported by JFR.check
+type RecordingStatus struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	State       string `json:"state"` // new, delayed, running, stopped or closed
+	Duration    string `json:"duration,omitempty"`
+	MaxSize     string `json:"maxSize,omitempty"` // as printed by the JVM, e.g. "250.0MB"
+	MaxAge      string `json:"maxAge,omitempty"`
+	Destination string `json:"destination,omitempty"` // file the recording writes to, when started by this sidecar
+}
+
+// parseCheckOutput parses the recordings listed in JFR.check output. Lines that do not describe a
+// recording (the "<pid>:" header, verbose event settings) are skipped.
+func parseCheckOutput(output string) []RecordingStatus {
+	recordings := []RecordingStatus{}
+	for _, line := range strings.Split(output, "\n") {
+		m := checkLinePattern.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		id, _ := strconv.Atoi(m[1])
+		rec := RecordingStatus{ID: id, Name: m[2], State: m[4]}
+		for _, option := range strings.Fields(m[3]) {
+			key, value, _ := strings.Cut(option, "=")
+			switch key {
+			case "duration":
+				rec.Duration = value
+			case "maxsize":
+				rec.MaxSize = value
+			case "maxage":
+				rec.MaxAge = value
+			}
+		}
+		recordings = append(recordings, rec)
+	}
+	return recordings
+}
+
+// recordingStatuses parses JFR.check output and adds the destination of recordings started
+// through /create
+func (s *Server) recordingStatuses(output string) []RecordingStatus {
+	recordings := parseCheckOutput(output)
+
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+	for i := range recordings {
+		for j := len(s.jobOrder) - 1; j >= 0; j-- {
+			if job := s.jobs[s.jobOrder[j]]; job != nil && job.Recording == recordings[i].Name && job.Path != "" {
+				recordings[i].Destination = job.Path
+				break
+			}
+		}
+	}
+	return recordings
+}
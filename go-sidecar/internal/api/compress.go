@@ -0,0 +1,136 @@
+package api
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+)
+
+// With COMPRESS_RECORDINGS the JVM writes a hidden file, which the sidecar compresses to
+// {name}.jfr.gz and removes. Recordings shrink 5-10x, and the daemon uploads them with
+// Content-Encoding: gzip. gzip.BestSpeed, the default level, keeps most of the saving for a
+// fraction of the CPU; COMPRESS_CONCURRENCY bounds the cores compression takes from the pod.
+
+// validCompressConfig checks the compression level and rejects combining compression with
+// streaming, where recordings never land on the volume
+func (s *Server) validCompressConfig() error {
+	switch {
+	case !s.opts.CompressRecordings:
+		return nil
+	case s.opts.StreamUpload:
+		return errors.New("COMPRESS_RECORDINGS cannot be combined with STREAM_UPLOAD")
+	case s.opts.CompressLevel < gzip.BestSpeed || s.opts.CompressLevel > gzip.BestCompression:
+		return fmt.Errorf("COMPRESS_LEVEL must be between %d and %d, got %d", gzip.BestSpeed, gzip.BestCompression, s.opts.CompressLevel)
+	case s.opts.CompressConcurrency < 1:
+		return fmt.Errorf("COMPRESS_CONCURRENCY must be at least 1, got %d", s.opts.CompressConcurrency)
+	}
+	return nil
+}
+
+// compressSource returns the hidden file the JVM writes a compressed recording to. Hidden files
+// are neither listed nor uploaded, so no one sees the recording before it is compressed.
+func compressSource(target string) string {
+	return filepath.Join(filepath.Dir(target), "."+strings.TrimSuffix(filepath.Base(target), ".gz"))
+}
+
+// compressRecording gzips a finished recording's source file into its target and returns the
+// file that holds the recording. A recording that cannot be compressed is kept uncompressed as
+// {name}.jfr rather than lost.
+func (s *Server) compressRecording(source, target string) string {
+	s.compressSlots <- struct{}{}
+	defer func() { <-s.compressSlots }()
+
+	entry := logger.Log.WithField("path", target)
+	start := s.clock.Now()
+	read, written, err := s.gzipFile(source, target)
+	if err != nil {
+		plain := strings.TrimSuffix(target, ".gz")
+		entry.WithError(err).Warnf("Failed to compress recording, keeping it uncompressed as %s", filepath.Base(plain))
+		if err := s.fs.Rename(source, plain); err != nil {
+			entry.WithError(err).Error("Failed to keep uncompressed recording")
+		}
+		return plain
+	}
+	s.fs.Remove(source)
+	entry.WithFields(map[string]any{
+		"bytes":      read,
+		"compressed": written,
+		"duration":   s.clock.Now().Sub(start).Round(time.Millisecond),
+	}).Info("Compressed recording")
+	return target
+}
+
+// gzipFile streams source into a hidden temporary file renamed to target once complete, so the
+// daemon never uploads a partial archive. It returns the bytes read and written.
+func (s *Server) gzipFile(source, target string) (int64, int64, error) {
+	in, err := s.fs.Open(source)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer in.Close()
+
+	tmp := filepath.Join(filepath.Dir(target), "."+filepath.Base(target)+".tmp")
+	out, err := s.fs.Create(tmp)
+	if err != nil {
+		return 0, 0, err
+	}
+	counted := &countingWriter{w: out}
+	buffered := bufio.NewWriterSize(counted, 1<<20)
+	gz, err := gzip.NewWriterLevel(buffered, s.opts.CompressLevel)
+	if err != nil {
+		out.Close()
+		s.fs.Remove(tmp)
+		return 0, 0, err
+	}
+	gz.Name = strings.TrimSuffix(filepath.Base(target), ".gz")
+
+	read, err := io.Copy(gz, in)
+	if err == nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = s.fs.Rename(tmp, target)
+	}
+	if err != nil {
+		s.fs.Remove(tmp)
+		return read, 0, err
+	}
+	return read, counted.n, nil
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// openRecording returns a reader of a recording's JFR data, decompressing a .jfr.gz
+func openRecording(f io.Reader, name string) (io.Reader, error) {
+	if !strings.HasSuffix(name, ".gz") {
+		return f, nil
+	}
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return nil, fmt.Errorf("invalid compressed recording: %w", err)
+	}
+	return gz, nil
+}
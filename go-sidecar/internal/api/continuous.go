@@ -0,0 +1,309 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/config"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/validation"
+)
+
+// continuousName is the JFR recording the sidecar keeps running in continuous mode. Its chunks
+// are written as continuous_{timestamp}.jfr.
+const continuousName = "continuous"
+
+// continuousRetry is how soon a continuous recording that is not running is started again, e.g.
+// while the JVM is still starting or after it restarted
+const continuousRetry = 30 * time.Second
+
+// ContinuousConfig is the always-on recording: JFR keeps maxAge of history in its repository and
+// the sidecar dumps the last interval of it to the profile directory every interval
+type ContinuousConfig struct {
+	Enabled   bool   `json:"enabled"`
+	Interval  string `json:"interval,omitempty"`  // rotation period, e.g. "15m"
+	MaxAge    string `json:"maxAge,omitempty"`    // history JFR keeps; at least the interval
+	MaxSize   string `json:"maxSize,omitempty"`   // bound on JFR's repository, e.g. "256Mi"
+	Settings  string `json:"settings,omitempty"`  // JFR settings; continuous recordings default to "default"
+	Container string `json:"container,omitempty"` // target container when the pod runs several JVMs
+}
+
+// continuousFromEnv reads the CONTINUOUS_* settings the sidecar starts with
+func continuousFromEnv() ContinuousConfig {
+	return ContinuousConfig{
+		Enabled:   config.EnvBool("CONTINUOUS_RECORDING", false),
+		Interval:  config.Env("CONTINUOUS_INTERVAL", "15m"),
+		MaxAge:    config.Env("CONTINUOUS_MAX_AGE", "30m"),
+		MaxSize:   os.Getenv("CONTINUOUS_MAX_SIZE"),
+		Settings:  config.Env("CONTINUOUS_SETTINGS", "default"),
+		Container: os.Getenv("CONTINUOUS_CONTAINER"),
+	}
+}
+
+// Validate checks the durations, size and settings, and that chunks do not outlive the history
+func (c *ContinuousConfig) Validate() validation.Errors {
+	errs := validation.Collect(
+		validDuration("interval", c.Interval),
+		validDuration("maxAge", c.MaxAge),
+		validMaxSize("maxSize", c.MaxSize),
+		validSettings("settings", c.Settings),
+	)
+	if len(errs) > 0 {
+		return errs
+	}
+	interval, _ := time.ParseDuration(c.Interval)
+	if c.Interval != "" && interval < time.Minute {
+		errs = append(errs, validation.FieldError{Field: "interval", Message: "must be at least 1m"})
+	}
+	if c.MaxAge != "" {
+		if age, _ := time.ParseDuration(c.MaxAge); age < interval {
+			errs = append(errs, validation.FieldError{Field: "maxAge", Message: "must be at least the interval, or chunks lose data"})
+		}
+	}
+	return errs
+}
+
+// validLimits checks the retention against RECORDING_MAX_SIZE_LIMIT and RECORDING_MAX_AGE_LIMIT
+func (c *ContinuousConfig) validLimits(s *Server) validation.Errors {
+	return validation.Collect(
+		s.validAgeLimit("maxAge", c.MaxAge),
+		s.validSizeLimit("maxSize", c.MaxSize),
+	)
+}
+
+// withDefaults fills unset fields from the environment defaults
+func (c ContinuousConfig) withDefaults() ContinuousConfig {
+	def := continuousFromEnv()
+	if c.Interval == "" {
+		c.Interval = def.Interval
+	}
+	if c.MaxAge == "" {
+		c.MaxAge = def.MaxAge
+		interval, _ := time.ParseDuration(c.Interval)
+		if age, _ := time.ParseDuration(def.MaxAge); age < interval {
+			c.MaxAge = c.Interval
+		}
+	}
+	if c.Settings == "" {
+		c.Settings = def.Settings
+	}
+	return c
+}
+
+// ContinuousStatus reports the continuous recording and its last rotation
+type ContinuousStatus struct {
+	ContinuousConfig
+	Running   bool      `json:"running"`
+	LastChunk string    `json:"lastChunk,omitempty"` // file of the last rotation
+	LastDump  time.Time `json:"lastDump,omitzero"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+// continuousHandler reports (GET) or reconfigures (PUT) continuous mode. Reconfiguring restarts
+// the recording with the new settings; disabling dumps what was recorded since the last
+// rotation and stops it.
+func (s *Server) continuousHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		s.continuousMu.Lock()
+		status := s.continuous
+		s.continuousMu.Unlock()
+		sendJSON(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Continuous recording status",
+			Data:    status,
+		})
+		return
+	}
+
+	// The recording spans tenants; only the operator's static token or RBAC may change it
+	if s.tenants != nil {
+		sendJSON(w, http.StatusForbidden, Response{
+			Success: false,
+			Message: "Continuous recording is configured by the operator when tenants are enabled",
+		})
+		return
+	}
+	var req ContinuousConfig
+	if !s.decodeRequest(w, r, &req) {
+		return
+	}
+	req = req.withDefaults()
+	s.configureContinuous(r.Context(), req)
+
+	s.continuousMu.Lock()
+	status := s.continuous
+	s.continuousMu.Unlock()
+	sendJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("Continuous recording %s", map[bool]string{true: "enabled", false: "disabled"}[req.Enabled]),
+		Data:    status,
+	})
+}
+
+// configureContinuous replaces the continuous configuration. A running recording is flushed and
+// stopped first, so new settings take effect on its restart.
+func (s *Server) configureContinuous(ctx context.Context, cfg ContinuousConfig) {
+	s.continuousMu.Lock()
+	stop := s.stopContinuous
+	s.stopContinuous = nil
+	previous := s.continuous
+	s.continuous = ContinuousStatus{ContinuousConfig: cfg}
+	s.continuousMu.Unlock()
+
+	if stop != nil {
+		stop()
+	}
+	if previous.Running {
+		s.flushContinuous(ctx, previous)
+		if pid, err := s.targetJVM(ctx, JVMSelector{Container: previous.Container}); err == nil {
+			if output, err := s.runJcmd(ctx, []string{continuousName}, pid, "JFR.stop", "name="+continuousName); err != nil {
+				logger.Log.WithError(err).WithField("output", string(output)).Warn("Failed to stop continuous recording")
+			}
+		}
+	}
+	if cfg.Enabled {
+		s.startContinuous()
+	}
+}
+
+// startContinuous runs the rotation loop for the current configuration until configureContinuous
+// or shutdown stops it
+func (s *Server) startContinuous() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.continuousMu.Lock()
+	s.stopContinuous = cancel
+	cfg := s.continuous.ContinuousConfig
+	s.continuousMu.Unlock()
+
+	logger.Log.WithFields(map[string]any{
+		"interval": cfg.Interval,
+		"maxAge":   cfg.MaxAge,
+		"settings": cfg.Settings,
+	}).Info("Continuous recording enabled")
+	go s.runContinuous(ctx, cfg)
+}
+
+// runContinuous keeps the continuous recording running and writes a chunk every interval.
+// A JVM that restarted loses the recording, which is then started again.
+func (s *Server) runContinuous(ctx context.Context, cfg ContinuousConfig) {
+	interval, _ := time.ParseDuration(cfg.Interval)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		wasRunning, err := s.ensureContinuous(ctx, cfg)
+		s.continuousMu.Lock()
+		s.continuous.Running = err == nil
+		if err != nil {
+			s.continuous.LastError = err.Error()
+		}
+		s.continuousMu.Unlock()
+		if err != nil {
+			logger.Log.WithError(err).Warn("Continuous recording is not running")
+			timer.Reset(continuousRetry)
+			continue
+		}
+		if wasRunning {
+			s.rotateContinuous(ctx, cfg)
+		}
+		timer.Reset(interval)
+	}
+}
+
+// ensureContinuous starts the continuous recording unless it is already running. It reports
+// whether a recording was running before, i.e. whether there is data to rotate.
+func (s *Server) ensureContinuous(ctx context.Context, cfg ContinuousConfig) (bool, error) {
+	pid, err := s.targetJVM(ctx, JVMSelector{Container: cfg.Container})
+	if err != nil {
+		return false, fmt.Errorf("failed to find Java process: %w", err)
+	}
+	output, err := s.jvm.Jcmd(ctx, pid, "JFR.check")
+	s.recordCheckTranscript(output, err)
+	if err != nil {
+		return false, err
+	}
+	if slices.Contains(parseRecordingNames(string(output)), continuousName) {
+		return true, nil
+	}
+
+	// disk=true keeps maxAge of history in JFR's repository instead of memory
+	args := []string{"JFR.start", "name=" + continuousName, "disk=true", "settings=" + cfg.Settings}
+	args = append(args, retentionArgs(ProfileRequest{MaxSize: cfg.MaxSize, MaxAge: cfg.MaxAge})...)
+	if output, err := s.runJcmd(ctx, []string{continuousName}, pid, args...); err != nil {
+		return false, fmt.Errorf("failed to start continuous recording: %w, output: %s", err, string(output))
+	}
+	logger.Log.WithField("pid", pid).Info("Started continuous recording")
+	return false, nil
+}
+
+// rotateContinuous dumps the last interval of the continuous recording as a new chunk
+func (s *Server) rotateContinuous(ctx context.Context, cfg ContinuousConfig) {
+	if _, err := s.fs.Stat(filepath.Join(s.cfg.ProfileDir, quotaMarker)); err == nil {
+		logger.Log.Debug("Namespace is over its upload quota, skipping continuous rotation")
+		return
+	}
+	pid, err := s.targetJVM(ctx, JVMSelector{Container: cfg.Container})
+	if err != nil {
+		return
+	}
+
+	now := s.clock.Now()
+	filename := fmt.Sprintf("%s_%s.jfr", continuousName, s.timestampSuffix(now))
+	_, output, err := s.dumpRecording(ctx, pid, s.cfg.ProfileDir, continuousName, filename, cfg.Interval)
+
+	s.continuousMu.Lock()
+	defer s.continuousMu.Unlock()
+	if err != nil {
+		s.continuous.LastError = fmt.Sprintf("failed to dump chunk: %v, output: %s", err, string(output))
+		logger.Log.WithError(err).WithField("output", string(output)).Warn("Failed to rotate continuous recording")
+		return
+	}
+	s.continuous.LastChunk = filename
+	s.continuous.LastDump = now.UTC()
+	s.continuous.LastError = ""
+	logger.Log.WithField("file", filename).Info("Rotated continuous recording")
+}
+
+// flushContinuous writes what the continuous recording holds since its last rotation, so
+// stopping it (reconfiguration, shutdown) loses nothing
+func (s *Server) flushContinuous(ctx context.Context, status ContinuousStatus) {
+	window := status.Interval
+	if !status.LastDump.IsZero() {
+		window = max(s.clock.Now().Sub(status.LastDump), time.Second).String()
+	}
+	s.rotateContinuous(ctx, ContinuousConfig{Interval: window, Container: status.Container})
+}
+
+// continuousEnabled reports whether continuous mode is on
+func (s *Server) continuousEnabled() bool {
+	s.continuousMu.Lock()
+	defer s.continuousMu.Unlock()
+	return s.continuous.Enabled
+}
+
+// shutdownContinuous ends the rotation loop and writes the last chunk. The recording itself is
+// left to SHUTDOWN_STOP_RECORDINGS; stopping it writes nothing, as it has no filename.
+func (s *Server) shutdownContinuous(ctx context.Context) {
+	s.continuousMu.Lock()
+	stop := s.stopContinuous
+	s.stopContinuous = nil
+	status := s.continuous
+	s.continuousMu.Unlock()
+	if stop == nil {
+		return
+	}
+	stop()
+	if status.Running {
+		s.flushContinuous(ctx, status)
+	}
+}
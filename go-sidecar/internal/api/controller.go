@@ -0,0 +1,52 @@
+package api
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/fakejvm"
+)
+
+// The simulated JVM must stay a drop-in controller for handler tests
+var _ JVMController = fakejvm.Controller{}
+
+// jcmdController is the default JVMController: jcmd through the command runner, and a
+// ProcessFinder (pgrep unless Deps names another)
+type jcmdController struct {
+	ProcessFinder
+	runner CommandRunner
+}
+
+// Jcmd runs "jcmd <pid> <command> [options]"
+func (c *jcmdController) Jcmd(ctx context.Context, pid int, command string, options ...string) ([]byte, error) {
+	return c.runner.Run(ctx, "jcmd", jcmdArgs(pid, command, options)...)
+}
+
+// newJVMController picks the backend configured by JOLOKIA_URL or ATTACH_NATIVE, or runs jcmd.
+// The alternate backends share the production runner's timeouts, breakers and metrics, so a
+// runner substituted through Deps, like simulation mode, always gets jcmd.
+func (s *Server) newJVMController(finder ProcessFinder) JVMController {
+	exec, ok := s.runner.(*execRunner)
+	if ok && !fakejvm.Enabled() {
+		switch {
+		case s.jolokia != nil:
+			return &jolokiaController{client: s.jolokia, exec: exec, container: s.opts.JavaContainer}
+		case s.opts.AttachNative:
+			return &attachController{ProcessFinder: s.finderOrPgrep(finder), exec: exec}
+		}
+	}
+	return &jcmdController{ProcessFinder: s.finderOrPgrep(finder), runner: s.runner}
+}
+
+// finderOrPgrep returns finder, or pgrep through the server's runner when it is nil
+func (s *Server) finderOrPgrep(finder ProcessFinder) ProcessFinder {
+	if finder != nil {
+		return finder
+	}
+	return &pgrepFinder{runner: s.runner, container: s.opts.JavaContainer, filter: s.javaFilter}
+}
+
+// jcmdArgs returns jcmd's arguments for a command: "<pid> <command> [options]"
+func jcmdArgs(pid int, command string, options []string) []string {
+	return append([]string{strconv.Itoa(pid), command}, options...)
+}
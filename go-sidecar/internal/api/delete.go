@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"path/filepath"
+	"slices"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/marker"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/recmeta"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/validation"
+)
+
+// DeleteRequest names a local recording to remove
+type DeleteRequest struct {
+	Name string `json:"name"` // path relative to the recording directory, as shown by /list
+}
+
+// Validate checks that name is a recording inside the recording directory
+func (req *DeleteRequest) Validate() validation.Errors {
+	if err := validRecordingFile(req.Name); err != nil {
+		return validation.Errors{{Field: "name", Message: err.Error()}}
+	}
+	return nil
+}
+
+// deleteProfileHandler removes a recording (and its companion metadata) from the recording
+// directory. Recordings the JVM is still writing, or files being served, are refused with 409.
+// The file is named in the body of POST /delete or in the path of DELETE /v1/recordings/{name}.
+func (s *Server) deleteProfileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		sendJSON(w, http.StatusMethodNotAllowed, Response{
+			Success: false,
+			Message: "Method not allowed",
+		})
+		return
+	}
+
+	req := DeleteRequest{Name: r.PathValue("name")}
+	if !s.decodeRequest(w, r, &req) {
+		return
+	}
+
+	root, err := s.recordingDir(r.Context())
+	if err != nil {
+		sendJSON(w, http.StatusInternalServerError, Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to open recording directory: %v", err),
+		})
+		return
+	}
+	filePath := filepath.Join(root, filepath.FromSlash(req.Name))
+
+	if _, err := s.fs.Stat(filePath); errors.Is(err, fs.ErrNotExist) {
+		sendJSON(w, http.StatusNotFound, Response{
+			Success: false,
+			Message: fmt.Sprintf("Recording '%s' not found", req.Name),
+		})
+		return
+	}
+
+	// Recordings write {name}.jfr or {name}.jfr.gz, so a file is still being written while a
+	// recording of that name runs
+	recording := recordingNameOf(path.Base(req.Name))
+	running, err := s.recordingRunning(r.Context(), recording)
+	if err != nil {
+		sendJSON(w, commandStatus(w, err), Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to check running recordings: %v", err),
+		})
+		return
+	}
+	if running {
+		sendJSON(w, http.StatusConflict, Response{
+			Success: false,
+			Message: fmt.Sprintf("Recording '%s' is still running; stop it before deleting the file", recording),
+		})
+		return
+	}
+	if s.files.InUse(filePath) {
+		sendJSON(w, http.StatusConflict, Response{
+			Success: false,
+			Message: fmt.Sprintf("Recording '%s' is in use; try again later", req.Name),
+		})
+		return
+	}
+
+	if err := s.fs.Remove(filePath); err != nil {
+		sendJSON(w, http.StatusInternalServerError, Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to delete recording: %v", err),
+		})
+		return
+	}
+	if err := s.fs.Remove(recmeta.CompanionPath(filePath)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logger.Log.WithError(err).WithField("path", filePath).Warn("Failed to delete recording metadata")
+	}
+	if err := s.fs.Remove(marker.Path(filePath)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logger.Log.WithError(err).WithField("path", filePath).Warn("Failed to delete completion marker")
+	}
+	logger.Log.WithField("path", filePath).Info("Deleted recording")
+
+	sendJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("Recording '%s' deleted", req.Name),
+		Data: map[string]string{
+			"name": req.Name,
+			"path": filePath,
+		},
+	})
+}
+
+// recordingRunning reports whether a recording named name runs in any JVM of the pod. Without a
+// JVM nothing can be writing the file.
+func (s *Server) recordingRunning(ctx context.Context, name string) (bool, error) {
+	s.heldMu.Lock()
+	_, held := s.held[name]
+	s.heldMu.Unlock()
+	if held {
+		return true, nil
+	}
+
+	pids, err := s.jvm.JavaPIDs(ctx)
+	if err != nil {
+		return false, nil
+	}
+	for _, pid := range pids {
+		output, err := s.jvm.Jcmd(ctx, pid, "JFR.check")
+		s.recordCheckTranscript(output, err)
+		if err != nil {
+			return false, err
+		}
+		if slices.Contains(parseRecordingNames(string(output)), name) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/marker"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/recmeta"
+)
+
+func TestDeleteRecording(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string // written to the profile directory before the request
+		running string // recording running while the file is deleted
+		inUse   bool
+		request string
+		want    int
+	}{
+		{"finished recording", "done.jfr", "", false, "done.jfr", http.StatusOK},
+		{"recording still running", "delete-running.jfr", "delete-running", false, "delete-running.jfr", http.StatusConflict},
+		{"file being served", "served.jfr", "", true, "served.jfr", http.StatusConflict},
+		{"missing file", "", "", false, "missing.jfr", http.StatusNotFound},
+		{"outside the directory", "", "", false, "..%2Fescape.jfr", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil)
+			var path string
+			if tt.file != "" {
+				path = filepath.Join(s.cfg.ProfileDir, tt.file)
+				for _, p := range []string{path, recmeta.CompanionPath(path), marker.Path(path)} {
+					if err := os.WriteFile(p, []byte("recording"), 0o644); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if tt.running != "" {
+				startTestRecording(t, s, tt.running)
+			}
+			if tt.inUse {
+				defer s.files.Acquire(path)()
+			}
+
+			code, resp := serve(t, s, http.MethodDelete, "/v1/recordings/"+tt.request, "")
+			if code != tt.want {
+				t.Fatalf("status = %d (%s), want %d", code, resp.Message, tt.want)
+			}
+			if path == "" {
+				return
+			}
+			for _, p := range []string{path, recmeta.CompanionPath(path), marker.Path(path)} {
+				_, err := os.Stat(p)
+				if deleted := os.IsNotExist(err); deleted != (code == http.StatusOK) {
+					t.Errorf("%s deleted = %v after status %d", filepath.Base(p), deleted, code)
+				}
+			}
+		})
+	}
+}
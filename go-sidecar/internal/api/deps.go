@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/config"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/inuse"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/kube"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/tenant"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/uploader"
+)
+
+// CommandRunner runs an external command (jcmd, pgrep, a profiler) and returns its combined output
+type CommandRunner interface {
+	Run(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+// ProcessFinder locates the JVMs the sidecar can attach to
+type ProcessFinder interface {
+	// JavaPIDs returns the PIDs of every visible JVM
+	JavaPIDs(ctx context.Context) ([]int, error)
+	// ResolvePID returns the JVM in the named container, or the only JVM when container is empty
+	ResolvePID(ctx context.Context, container string) (int, error)
+}
+
+// JVMController finds the pod's JVMs and runs diagnostic commands in them; it is the server's
+// only path to a JVM. The default runs jcmd and pgrep, ATTACH_NATIVE and JOLOKIA_URL select the
+// attach socket and JMX, and fakejvm.Controller answers from a simulated JVM.
+type JVMController interface {
+	ProcessFinder
+	// Jcmd runs a diagnostic command ("JFR.start") with its options ("name=x") in the JVM with
+	// the given PID and returns the output jcmd prints
+	Jcmd(ctx context.Context, pid int, command string, options ...string) ([]byte, error)
+}
+
+// AccessReviewer authenticates bearer tokens and checks RBAC for the caller; *kube.Client
+// implements it with TokenReview and SubjectAccessReview
+type AccessReviewer interface {
+	ReviewToken(ctx context.Context, token string, audiences []string) (kube.UserInfo, bool, error)
+	ReviewAccess(ctx context.Context, user kube.UserInfo, attrs kube.ResourceAttributes) (bool, string, error)
+}
+
+// Clock supplies the current time for recording names and snapshots
+type Clock interface {
+	Now() time.Time
+}
+
+// FS is the subset of filesystem operations the server performs on the profile directory
+type FS interface {
+	MkdirAll(path string, perm fs.FileMode) error
+	ReadFile(name string) ([]byte, error)
+	Stat(name string) (fs.FileInfo, error)
+	Open(name string) (fs.File, error)
+	Create(name string) (io.WriteCloser, error)
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	WalkDir(root string, fn fs.WalkDirFunc) error
+	// FreeSpace returns the bytes available to the sidecar on the volume holding path
+	FreeSpace(path string) (int64, error)
+	// TotalSpace returns the size in bytes of the volume holding path
+	TotalSpace(path string) (int64, error)
+}
+
+// Deps are the collaborators a Server is built from. Nil fields get the production
+// implementation: hardened exec, jcmd and pgrep, the system clock and the local filesystem.
+type Deps struct {
+	// Config holds the profile directory and API port; nil uses config.Default
+	Config *config.Config
+
+	// Options are the environment-only settings; nil reads them with OptionsFromEnv, which
+	// tests start from too
+	Options *Options
+
+	Runner CommandRunner
+	// JVM finds and commands JVMs; nil builds the configured backend on Runner, with
+	// Processes (nil: pgrep) finding the JVMs for jcmd and the attach socket
+	JVM       JVMController
+	Processes ProcessFinder
+	Clock     Clock
+	FS        FS
+
+	// Uploader serves streaming uploads and /remote-list; nil creates one from the
+	// environment on first use
+	Uploader uploader.Uploader
+
+	// Token is the bearer token required on mutating requests; empty disables the check
+	Token string
+
+	// Reviewer authorizes every request with Kubernetes RBAC; nil disables the check
+	Reviewer AccessReviewer
+
+	// Tenants requires a tenant token on every request; nil disables tenancy
+	Tenants *tenant.Registry
+
+	// Files is shared with an in-process scanner (standalone mode), which must not upload or
+	// delete files the server still holds
+	Files *inuse.Tracker
+}
+
+// systemClock is the wall clock
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// osFS is the local filesystem
+type osFS struct{}
+
+func (osFS) MkdirAll(path string, perm fs.FileMode) error { return os.MkdirAll(path, perm) }
+func (osFS) ReadFile(name string) ([]byte, error)         { return os.ReadFile(name) }
+func (osFS) Stat(name string) (fs.FileInfo, error)        { return os.Stat(name) }
+func (osFS) Open(name string) (fs.File, error)            { return os.Open(name) }
+func (osFS) Create(name string) (io.WriteCloser, error)   { return os.Create(name) }
+func (osFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+func (osFS) Rename(oldpath, newpath string) error         { return os.Rename(oldpath, newpath) }
+func (osFS) Remove(name string) error                     { return os.Remove(name) }
+func (osFS) WalkDir(root string, fn fs.WalkDirFunc) error { return filepath.WalkDir(root, fn) }
+
+func (osFS) FreeSpace(path string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
+
+func (osFS) TotalSpace(path string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Blocks) * int64(st.Bsize), nil
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/events"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/marker"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/recmeta"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/tenant"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/uploader"
+)
+
+// directUploadBackoff is the wait before the first retry; it doubles with every attempt
+const directUploadBackoff = 2 * time.Second
+
+// validDirectUpload rejects DIRECT_UPLOAD combined with another way of uploading the same files
+func (s *Server) validDirectUpload() error {
+	switch {
+	case !s.opts.DirectUpload:
+		return nil
+	case s.opts.StreamUpload:
+		return errors.New("DIRECT_UPLOAD and STREAM_UPLOAD are exclusive")
+	case s.files != nil:
+		return errors.New("DIRECT_UPLOAD is for sidecar mode; standalone mode already uploads through its scanner")
+	}
+	return nil
+}
+
+// uploadCompletedJob uploads a completed job's file, and its metadata file, in the background.
+// The caller holds s.jobsMu.
+func (s *Server) uploadCompletedJob(job *Job) {
+	if !s.opts.DirectUpload || job.Path == "" {
+		return
+	}
+	s.uploading.Add(1)
+	go func(path, tenantName string) {
+		defer s.uploading.Done()
+		ctx := context.Background()
+		if tenantName != "" {
+			if t, ok := s.tenants.ByName(tenantName); ok {
+				ctx = tenant.WithTenant(ctx, t)
+			}
+		}
+		if err := s.uploadRecordingFile(uploadScope(ctx), path); err != nil {
+			logger.Log.WithError(err).WithField("path", path).Error("Direct upload failed")
+			events.Publish(events.UploadFailed, map[string]any{
+				"path":  path,
+				"pod":   os.Getenv("POD_NAME"),
+				"error": err.Error(),
+			})
+		}
+	}(job.Path, job.tenant)
+}
+
+// uploadRecordingFile waits for the JVM to finish writing path, uploads it with retries and
+// removes the local copy unless DIRECT_UPLOAD_KEEP is set. Success is published like the
+// daemon's uploads, so /jobs/{id} moves to uploaded; the caller publishes failures.
+func (s *Server) uploadRecordingFile(ctx context.Context, path string) error {
+	if err := s.waitForSettledFile(ctx, path); err != nil {
+		return err
+	}
+	u, err := s.remote()
+	if err != nil {
+		return fmt.Errorf("upload destination not configured: %w", err)
+	}
+
+	podName := os.Getenv("POD_NAME")
+	companion := recmeta.CompanionPath(path)
+	if data, err := s.fs.ReadFile(companion); err == nil {
+		if meta, err := recmeta.Parse(data); err == nil {
+			ctx = uploader.WithObjectMetadata(ctx, meta.ObjectMetadata())
+		}
+	} else {
+		companion = ""
+	}
+	destination := uploader.DestinationFor(ctx, u)
+	info, _ := s.fs.Stat(path)
+
+	start := s.clock.Now()
+	backoff := directUploadBackoff
+	for attempt := 1; ; attempt++ {
+		err = u.Upload(ctx, path, podName)
+		if err == nil || attempt >= s.opts.DirectUploadTries {
+			break
+		}
+		logger.Log.WithError(err).WithField("path", path).WithField("attempt", attempt).Warn("Direct upload failed, retrying")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	if err != nil {
+		return err
+	}
+
+	fields := map[string]any{
+		"path":        path,
+		"pod":         podName,
+		"destination": destination,
+		"duration":    s.clock.Now().Sub(start),
+	}
+	if info != nil {
+		fields["size"] = info.Size()
+		fields["modified"] = info.ModTime()
+	}
+	events.Publish(events.UploadCompleted, fields)
+	logger.Log.WithField("path", path).WithField("destination", destination).Info("Recording uploaded")
+
+	if companion != "" {
+		if err := u.Upload(ctx, companion, podName); err != nil {
+			return fmt.Errorf("failed to upload recording metadata: %w", err)
+		}
+	}
+	if s.opts.DirectUploadKeep {
+		return nil
+	}
+	for _, p := range []string{path, companion, marker.Path(path)} {
+		if p == "" {
+			continue
+		}
+		if err := s.fs.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			logger.Log.WithError(err).WithField("path", p).Warn("Failed to remove uploaded file")
+		}
+	}
+	return nil
+}
+
+// waitForSettledFile waits until path exists and its size stops changing, since a timed
+// recording completes when its duration elapses, slightly before the JVM has written its file.
+// With COMPLETION_MARKERS it waits for the file's marker instead.
+func (s *Server) waitForSettledFile(ctx context.Context, path string) error {
+	const poll = 500 * time.Millisecond
+	deadline := s.clock.Now().Add(s.opts.DirectUploadSettle)
+	last := int64(-1)
+	for {
+		if s.cfg.CompletionMarkers {
+			if _, err := s.fs.Stat(marker.Path(path)); err == nil {
+				return nil
+			}
+		} else if info, err := s.fs.Stat(path); err == nil && info.Size() > 0 {
+			if info.Size() == last {
+				return nil
+			}
+			last = info.Size()
+		}
+		if s.finishPending(path) {
+			deadline = s.clock.Now().Add(s.opts.DirectUploadSettle)
+		}
+		if s.clock.Now().After(deadline) {
+			return fmt.Errorf("%s was not written within %s", path, s.opts.DirectUploadSettle)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(poll):
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/config"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/validation"
+)
+
+// errLowDisk is returned by checkDiskSpace when the volume is below DISK_MIN_FREE
+var errLowDisk = errors.New("the profile volume is low on free space")
+
+// DiskUsage is the state of the volume holding the profile directory. Sizes are in bytes.
+type DiskUsage struct {
+	Path           string  `json:"path"`
+	TotalBytes     int64   `json:"totalBytes"`
+	FreeBytes      int64   `json:"freeBytes"`
+	UsedBytes      int64   `json:"usedBytes"`
+	UsedPercent    float64 `json:"usedPercent"`
+	ProfileFiles   int     `json:"profileFiles"` // files in the profile directory, hidden ones included
+	ProfileBytes   int64   `json:"profileBytes"`
+	MinFreeBytes   int64   `json:"minFreeBytes"` // DISK_MIN_FREE; 0 when the threshold is off
+	LowSpaceAction string  `json:"lowSpaceAction"`
+	LowSpace       bool    `json:"lowSpace"` // below the threshold: new recordings are refused or limited
+}
+
+// validDiskConfig checks the low-space settings at startup
+func (s *Server) validDiskConfig() validation.Errors {
+	errs := validation.Collect(validation.OneOf("DISK_LOW_ACTION", s.opts.DiskLowAction, "reject", "limit"))
+	if s.opts.DiskLowMaxSize < recordingMinSize {
+		errs = append(errs, validation.FieldError{Field: "DISK_LOW_MAX_SIZE", Message: "must be at least 1Mi"})
+	}
+	return errs
+}
+
+// diskHandler reports usage of the profile volume and whether it is below DISK_MIN_FREE
+func (s *Server) diskHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendJSON(w, http.StatusMethodNotAllowed, Response{
+			Success: false,
+			Message: "Method not allowed",
+		})
+		return
+	}
+
+	usage, err := s.diskUsage()
+	if err != nil {
+		sendJSON(w, http.StatusInternalServerError, Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to read disk usage: %v", err),
+		})
+		return
+	}
+	message := fmt.Sprintf("%.1f%% of the profile volume is used", usage.UsedPercent)
+	if usage.LowSpace {
+		message += fmt.Sprintf("; below the %d bytes DISK_MIN_FREE requires", s.opts.DiskMinFree)
+	}
+	sendJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: message,
+		Data:    usage,
+	})
+}
+
+// diskUsage measures the profile volume and the files in the profile directory
+func (s *Server) diskUsage() (DiskUsage, error) {
+	dir := s.cfg.ProfileDir
+	total, err := s.fs.TotalSpace(dir)
+	if err != nil {
+		return DiskUsage{}, err
+	}
+	free, err := s.fs.FreeSpace(dir)
+	if err != nil {
+		return DiskUsage{}, err
+	}
+	usage := DiskUsage{
+		Path:           dir,
+		TotalBytes:     total,
+		FreeBytes:      free,
+		UsedBytes:      max(total-free, 0),
+		MinFreeBytes:   s.opts.DiskMinFree,
+		LowSpaceAction: s.opts.DiskLowAction,
+		LowSpace:       free < s.opts.DiskMinFree,
+	}
+	if total > 0 {
+		usage.UsedPercent = 100 * float64(usage.UsedBytes) / float64(total)
+	}
+	err = s.fs.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil // files vanish as the daemon uploads them
+		}
+		if info, err := d.Info(); err == nil {
+			usage.ProfileFiles++
+			usage.ProfileBytes += info.Size()
+		}
+		return nil
+	})
+	return usage, err
+}
+
+// checkDiskSpace applies DISK_MIN_FREE to a recording about to start. With DISK_LOW_ACTION=limit
+// a JFR recording is capped at DISK_LOW_MAX_SIZE instead of refused, as long as that still fits.
+// An unreadable volume is not held against the recording.
+func (s *Server) checkDiskSpace(req *ProfileRequest) error {
+	if s.opts.DiskMinFree <= 0 {
+		return nil
+	}
+	free, err := s.fs.FreeSpace(s.cfg.ProfileDir)
+	if err != nil || free >= s.opts.DiskMinFree {
+		return nil
+	}
+	if s.opts.DiskLowAction == "limit" && req.Engine == engineJFR && free > s.opts.DiskLowMaxSize {
+		if size, _ := config.ParseSize(req.MaxSize); req.MaxSize == "" || size > s.opts.DiskLowMaxSize {
+			req.MaxSize = fmt.Sprint(s.opts.DiskLowMaxSize)
+		}
+		logger.Log.WithField("name", req.Name).
+			WithField("freeBytes", free).
+			WithField("maxSize", req.MaxSize).
+			Warn("Profile volume is low on space, limiting the recording's size")
+		return nil
+	}
+	return fmt.Errorf("%w: %d bytes free, DISK_MIN_FREE is %d", errLowDisk, free, s.opts.DiskMinFree)
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// downloadHandler streams a recording from the recording directory. name is the file's path
+// relative to the directory as shown by /list, e.g. "checkout-slow.jfr", given in the path under
+// /v1 or as the name query parameter. Range, If-Range and conditional requests are handled by
+// http.ServeContent. "format=pprof" converts the recording's execution samples to pprof instead.
+func (s *Server) downloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		sendJSON(w, http.StatusMethodNotAllowed, Response{
+			Success: false,
+			Message: "Method not allowed",
+		})
+		return
+	}
+
+	name := cmp.Or(r.PathValue("name"), r.URL.Query().Get("name"))
+	if err := validRecordingFile(name); err != nil {
+		sendJSON(w, http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("Invalid name: %v", err),
+		})
+		return
+	}
+
+	root, err := s.recordingDir(r.Context())
+	if err != nil {
+		sendJSON(w, http.StatusInternalServerError, Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to open recording directory: %v", err),
+		})
+		return
+	}
+	filePath := filepath.Join(root, filepath.FromSlash(name))
+
+	// Keep an in-process scanner (standalone mode) from deleting the file mid-download
+	if s.files != nil {
+		defer s.files.Acquire(filePath)()
+	}
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "jfr":
+	case "pprof":
+		s.servePprof(w, r, name, filePath)
+		return
+	default:
+		sendJSON(w, http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("Invalid format %q: must be jfr or pprof", format),
+		})
+		return
+	}
+
+	f, err := s.fs.Open(filePath)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, fs.ErrNotExist) {
+			status = http.StatusNotFound
+		}
+		sendJSON(w, status, Response{
+			Success: false,
+			Message: fmt.Sprintf("Recording '%s' not found", name),
+		})
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	content, seekable := f.(io.ReadSeeker)
+	if err != nil || info.IsDir() || !seekable {
+		sendJSON(w, http.StatusNotFound, Response{
+			Success: false,
+			Message: fmt.Sprintf("Recording '%s' not found", name),
+		})
+		return
+	}
+
+	s.extendWriteDeadline(w, info.Size())
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(name)}))
+	http.ServeContent(w, r, info.Name(), info.ModTime(), content)
+}
+
+// validRecordingFile accepts a relative path to a visible .jfr or .jfr.gz file inside the recording directory
+func validRecordingFile(name string) error {
+	switch {
+	case name == "":
+		return errors.New("is required")
+	case !filepath.IsLocal(filepath.FromSlash(name)) || strings.Contains(name, `\`):
+		return errors.New("must be a path inside the recording directory")
+	case !isRecordingFile(name):
+		return errors.New("must name a .jfr or .jfr.gz recording")
+	}
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") {
+			return errors.New("must not name a hidden file")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/events"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/metrics"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/validation"
+)
+
+// DumpRequest snapshots a running recording without stopping it
+type DumpRequest struct {
+	Name      string `json:"name"`                // recording to dump
+	Filename  string `json:"filename,omitempty"`  // output name without .jfr; defaults to {name}-dump-{timestamp}
+	Last      string `json:"last,omitempty"`      // only dump the most recent window, e.g. "5m"; defaults to everything recorded
+	Container string `json:"container,omitempty"` // target container when the pod runs several JVMs
+	PID       int    `json:"pid,omitempty"`       // target JVM by process ID (see /jvms)
+	MainClass string `json:"mainClass,omitempty"` // target JVM by main class or jar
+}
+
+// Validate checks the recording name, output name and window
+func (req *DumpRequest) Validate() validation.Errors {
+	return validation.Collect(
+		validation.Required("name", req.Name),
+		validArgument("name", req.Name),
+		validRecordingName("filename", req.Filename),
+		validDuration("last", req.Last),
+		validPID("pid", req.PID),
+		validArgument("mainClass", req.MainClass),
+	)
+}
+
+// dumpProfileHandler writes the data of a running (typically continuous) recording to a new
+// file in the recording directory, where the daemon picks it up like any finished recording
+func (s *Server) dumpProfileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendJSON(w, http.StatusMethodNotAllowed, Response{
+			Success: false,
+			Message: "Method not allowed",
+		})
+		return
+	}
+
+	// /v1 names the source recording in the path
+	req := DumpRequest{Name: r.PathValue("name")}
+	if !s.decodeRequest(w, r, &req) {
+		return
+	}
+	if req.Filename == "" {
+		req.Filename = fmt.Sprintf("%s-dump-%s", req.Name, s.timestampSuffix(s.clock.Now()))
+	}
+
+	if s.rejectIfOverQuota(w) {
+		return
+	}
+
+	pid, err := s.targetJVM(r.Context(), JVMSelector{Container: req.Container, PID: req.PID, MainClass: req.MainClass})
+	if err != nil {
+		sendJSON(w, http.StatusInternalServerError, Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to find Java process: %v", err),
+		})
+		return
+	}
+
+	if !s.ownsRecording(r.Context(), req.Name) {
+		sendJSON(w, http.StatusNotFound, Response{
+			Success: false,
+			Message: fmt.Sprintf("No recording named '%s'", req.Name),
+		})
+		return
+	}
+
+	dir, err := s.recordingDir(r.Context())
+	if err != nil {
+		sendJSON(w, http.StatusInternalServerError, Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to create recording directory: %v", err),
+		})
+		return
+	}
+	filename := req.Filename + ".jfr"
+	outputPath, output, err := s.dumpRecording(r.Context(), pid, dir, req.Name, filename, req.Last)
+	if err != nil {
+		sendJSON(w, commandStatus(w, err), Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to dump recording: %v, output: %s", err, string(output)),
+		})
+		return
+	}
+
+	sendJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("JFR recording '%s' dumped successfully", req.Name),
+		Data: map[string]string{
+			"pid":      strconv.Itoa(pid),
+			"name":     req.Name,
+			"filename": filename,
+			"path":     outputPath,
+			"output":   string(output),
+		},
+	})
+}
+
+// dumpRecording writes the data of a running recording, or only its last window when last is
+// set, to filename in dir and announces the file. The JVM writes the dump under a hidden name and
+// it is renamed once complete, so the daemon never uploads a partial snapshot.
+func (s *Server) dumpRecording(ctx context.Context, pid int, dir, name, filename, last string) (string, []byte, error) {
+	outputPath := filepath.Join(dir, filename)
+	tmpPath := filepath.Join(dir, "."+filename+".tmp")
+	args := []string{"JFR.dump", fmt.Sprintf("name=%s", name), fmt.Sprintf("filename=%s", tmpPath)}
+	if last != "" {
+		args = append(args, "begin=-"+jfrDuration(last))
+	}
+	output, err := s.runJcmd(ctx, []string{name}, pid, args...)
+	if err != nil {
+		s.fs.Remove(tmpPath)
+		return "", output, err
+	}
+
+	// Dumps of a described recording carry the same description
+	if meta := s.readRecordingMetadata(filepath.Join(dir, name+".jfr")); meta != nil {
+		meta.File = filename
+		if err := s.writeRecordingMetadata(outputPath, meta); err != nil {
+			logger.Log.WithError(err).WithField("name", name).Warn("Failed to write dump metadata")
+		}
+	}
+	if err := s.fs.Rename(tmpPath, outputPath); err != nil {
+		s.fs.Remove(tmpPath)
+		return "", output, fmt.Errorf("failed to move dump into place: %w", err)
+	}
+	s.markComplete(outputPath)
+	if info, err := s.fs.Stat(outputPath); err == nil {
+		metrics.ProfileBytesWrittenTotal.WithLabelValues(engineJFR).Add(float64(info.Size()))
+	}
+
+	events.Publish(events.FileFlushed, map[string]any{
+		"pid":  pid,
+		"name": name,
+		"path": outputPath,
+	})
+	return outputPath, output, nil
+}
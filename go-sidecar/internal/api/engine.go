@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/validation"
+)
+
+// Recording engines /create can start
+const (
+	engineJFR           = "jfr"
+	engineAsyncProfiler = "async-profiler"
+)
+
+// asyncProfilerModes maps the modes of async-profiler recordings to the events they sample
+var asyncProfilerModes = map[string]string{
+	"cpu":   "cpu",
+	"wall":  "wall",  // all threads, running or not, e.g. for time spent waiting on I/O
+	"alloc": "alloc", // allocations, sampled in TLAB refills
+	"lock":  "lock",  // contended Java monitors and locks
+}
+
+// recordingEngine starts and stops the recordings of /create. A recording ends by itself once
+// its duration elapses, writing its file then; stop ends it early.
+type recordingEngine interface {
+	// start begins a recording of req into outputPath
+	start(ctx context.Context, pid int, req ProfileRequest, outputPath string) ([]byte, error)
+	// stop ends a running recording and writes its file
+	stop(ctx context.Context, pid int, name, outputPath string) ([]byte, error)
+}
+
+// engine returns the recording engine by name, JFR by default
+func (s *Server) engine(name string) recordingEngine {
+	if name == engineAsyncProfiler {
+		return asyncProfilerEngine{s}
+	}
+	return jfrEngine{s}
+}
+
+// recordingFilename is the file a recording of req is written to
+func (s *Server) recordingFilename(req ProfileRequest) string {
+	if req.Engine == engineAsyncProfiler && req.Format == "collapsed" {
+		return req.Name + ".collapsed"
+	}
+	if s.opts.CompressRecordings && req.Engine != engineAsyncProfiler {
+		return req.Name + ".jfr.gz"
+	}
+	return req.Name + ".jfr"
+}
+
+// isRecordingFile reports whether a file name is a JFR recording, compressed or not
+func isRecordingFile(name string) bool {
+	return strings.HasSuffix(name, ".jfr") || strings.HasSuffix(name, ".jfr.gz")
+}
+
+// recordingNameOf returns the name of the recording a .jfr or .jfr.gz file was written for
+func recordingNameOf(filename string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(filename, ".gz"), ".jfr")
+}
+
+// jfrEngine records with the JVM's Flight Recorder through jcmd
+type jfrEngine struct{ s *Server }
+
+func (e jfrEngine) start(ctx context.Context, pid int, req ProfileRequest, outputPath string) ([]byte, error) {
+	args := []string{"JFR.start",
+		fmt.Sprintf("name=%s", req.Name),
+		fmt.Sprintf("duration=%s", jfrDuration(req.Duration)),
+		fmt.Sprintf("filename=%s", outputPath)}
+	args = append(args, e.s.settingsArgs(req)...)
+	args = append(args, retentionArgs(req)...)
+	return e.s.runJcmd(ctx, []string{req.Name}, pid, args...)
+}
+
+func (e jfrEngine) stop(ctx context.Context, pid int, name, _ string) ([]byte, error) {
+	return e.s.runJcmd(ctx, []string{name}, pid, "JFR.stop", fmt.Sprintf("name=%s", name))
+}
+
+// asyncProfilerEngine records with async-profiler, attached through asprof. It samples without
+// JFR's safepoint bias and covers native frames, wall-clock time and lock contention where JFR
+// events fall short. A JVM runs one async-profiler session at a time.
+type asyncProfilerEngine struct{ s *Server }
+
+func (e asyncProfilerEngine) start(ctx context.Context, pid int, req ProfileRequest, outputPath string) ([]byte, error) {
+	d, _ := time.ParseDuration(req.Duration)
+	return e.s.runTranscribed(ctx, []string{req.Name}, e.s.opts.AsyncProfilerPath, "start",
+		"-e", asyncProfilerModes[req.Mode],
+		"-o", req.Format,
+		"--timeout", strconv.Itoa(int(math.Ceil(d.Seconds()))),
+		"-f", outputPath,
+		strconv.Itoa(pid))
+}
+
+func (e asyncProfilerEngine) stop(ctx context.Context, pid int, name, outputPath string) ([]byte, error) {
+	format := engineJFR
+	if strings.HasSuffix(outputPath, ".collapsed") {
+		format = "collapsed"
+	}
+	return e.s.runTranscribed(ctx, []string{name}, e.s.opts.AsyncProfilerPath, "stop",
+		"-o", format,
+		"-f", outputPath,
+		strconv.Itoa(pid))
+}
+
+// validEngine applies the engine defaults and checks the options that only one engine supports
+func (req *ProfileRequest) validEngine() validation.Errors {
+	if req.Engine == "" {
+		req.Engine = engineJFR
+	}
+	if req.Engine != engineAsyncProfiler {
+		errs := validation.Collect(validation.OneOf("engine", req.Engine, engineJFR, engineAsyncProfiler))
+		if req.Mode != "" {
+			errs = append(errs, validation.FieldError{Field: "mode", Message: "only applies to async-profiler recordings"})
+		}
+		if req.Format != "" && req.Format != engineJFR {
+			errs = append(errs, validation.FieldError{Field: "format", Message: "JFR recordings are always written as jfr"})
+		}
+		return errs
+	}
+
+	if req.Mode == "" {
+		req.Mode = "cpu"
+	}
+	if req.Format == "" {
+		req.Format = engineJFR
+	}
+	errs := validation.Collect(
+		validation.OneOf("mode", req.Mode, "cpu", "wall", "alloc", "lock"),
+		validation.OneOf("format", req.Format, engineJFR, "collapsed"),
+	)
+	jfrOnly := []struct{ field, value string }{
+		{"settings", req.Settings}, {"preset", req.Preset}, {"maxSize", req.MaxSize}, {"maxAge", req.MaxAge},
+	}
+	for _, option := range jfrOnly {
+		if option.value != "" {
+			errs = append(errs, validation.FieldError{Field: option.field, Message: "only applies to JFR recordings"})
+		}
+	}
+	return errs
+}
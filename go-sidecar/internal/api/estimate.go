@@ -0,0 +1,217 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/jfr"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/validation"
+)
+
+// estimateTopEvents is how many of the most frequent event types an estimate reports
+const estimateTopEvents = 10
+
+// EstimateRequest describes a proposed recording
+type EstimateRequest struct {
+	Duration  string `json:"duration"`            // duration of the proposed recording; defaults to 60s
+	Settings  string `json:"settings,omitempty"`  // JFR settings (default, profile or a .jfc); defaults to default
+	Probe     string `json:"probe,omitempty"`     // how long to sample event rates; defaults to ESTIMATE_PROBE_DURATION
+	Container string `json:"container,omitempty"` // target container when the pod runs several JVMs
+}
+
+// Validate checks the durations and the settings name
+func (req *EstimateRequest) Validate() validation.Errors {
+	return validation.Collect(
+		validDuration("duration", req.Duration),
+		validDuration("probe", req.Probe),
+		validSettings("settings", req.Settings),
+	)
+}
+
+// EventRate is how often one event type was emitted during the probe
+type EventRate struct {
+	Type      string  `json:"type"`
+	Count     int64   `json:"count"`
+	PerSecond float64 `json:"perSecond"`
+}
+
+// SizeEstimate is the expected on-disk size of a proposed recording
+type SizeEstimate struct {
+	Duration        string      `json:"duration"`
+	Settings        string      `json:"settings"`
+	Probe           string      `json:"probe"`
+	ProbeBytes      int64       `json:"probeBytes"`
+	BytesPerSecond  float64     `json:"bytesPerSecond"`
+	EventsPerSecond float64     `json:"eventsPerSecond"`
+	EstimatedBytes  int64       `json:"estimatedBytes"`
+	VolumeFreeBytes int64       `json:"volumeFreeBytes"`
+	Fits            bool        `json:"fits"`
+	TopEvents       []EventRate `json:"topEvents"`
+}
+
+// estimateHandler samples the JVM with a probe recording and estimates the size of a recording
+// with the requested settings and duration, and whether it fits the profile volume
+func (s *Server) estimateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendJSON(w, http.StatusMethodNotAllowed, Response{
+			Success: false,
+			Message: "Method not allowed",
+		})
+		return
+	}
+
+	var req EstimateRequest
+	if !s.decodeRequest(w, r, &req) {
+		return
+	}
+	if req.Duration == "" {
+		req.Duration = "60s"
+	}
+	if req.Settings == "" {
+		req.Settings = "default"
+	}
+	probe := s.opts.EstimateProbeDefault
+	if req.Probe != "" {
+		probe, _ = time.ParseDuration(req.Probe)
+	}
+	if probe > s.opts.EstimateProbeMax {
+		sendJSON(w, http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("probe may be at most %s", s.opts.EstimateProbeMax),
+		})
+		return
+	}
+
+	pid, err := s.getJavaPID(r.Context(), req.Container)
+	if err != nil {
+		sendJSON(w, http.StatusInternalServerError, Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to find Java process: %v", err),
+		})
+		return
+	}
+
+	estimate, err := s.estimateSize(r.Context(), pid, req, probe)
+	if err != nil {
+		sendJSON(w, commandStatus(w, err), Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to estimate recording size: %v", err),
+		})
+		return
+	}
+
+	message := "Recording is expected to fit the profile volume"
+	if !estimate.Fits {
+		message = "Recording is not expected to fit the profile volume"
+	}
+	sendJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: message,
+		Data:    estimate,
+	})
+}
+
+// estimateSize runs a probe recording for probe with the requested settings, dumps and discards
+// it, and scales its size and event rates to the requested duration
+func (s *Server) estimateSize(ctx context.Context, pid int, req EstimateRequest, probe time.Duration) (*SizeEstimate, error) {
+	duration, _ := time.ParseDuration(req.Duration)
+	name := fmt.Sprintf("sidecar-estimate-%d", s.estimateProbes.Add(1))
+
+	// Dump next to the telemetry dump: hidden from /list and ignored by the daemon
+	dumpPath := filepath.Join(s.cfg.ProfileDir, "."+name+".tmp")
+
+	output, err := s.runJcmd(ctx, []string{name}, pid, "JFR.start",
+		fmt.Sprintf("name=%s", name),
+		fmt.Sprintf("settings=%s", req.Settings))
+	if err != nil {
+		return nil, fmt.Errorf("failed to start probe recording: %w, output: %s", err, string(output))
+	}
+	// Started without a filename, so stopping discards the probe's data
+	defer s.runJcmd(context.WithoutCancel(ctx), []string{name}, pid, "JFR.stop", fmt.Sprintf("name=%s", name))
+
+	start := s.clock.Now()
+	select {
+	case <-time.After(probe):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	output, err = s.runJcmd(ctx, []string{name}, pid, "JFR.dump",
+		fmt.Sprintf("name=%s", name),
+		fmt.Sprintf("filename=%s", dumpPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to dump probe recording: %w, output: %s", err, string(output))
+	}
+	defer s.fs.Remove(dumpPath)
+	elapsed := s.clock.Now().Sub(start)
+	if elapsed <= 0 {
+		elapsed = probe
+	}
+
+	data, err := s.fs.ReadFile(dumpPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read probe recording: %w", err)
+	}
+	counts, total, err := countEvents(data)
+	if err != nil {
+		return nil, err
+	}
+
+	seconds := elapsed.Seconds()
+	estimate := &SizeEstimate{
+		Duration:        req.Duration,
+		Settings:        req.Settings,
+		Probe:           elapsed.Round(time.Millisecond).String(),
+		ProbeBytes:      int64(len(data)),
+		BytesPerSecond:  float64(len(data)) / seconds,
+		EventsPerSecond: float64(total) / seconds,
+		EstimatedBytes:  int64(float64(len(data)) * duration.Seconds() / seconds),
+		TopEvents:       topEventRates(counts, seconds, estimateTopEvents),
+	}
+
+	free, err := s.fs.FreeSpace(s.cfg.ProfileDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check free space: %w", err)
+	}
+	estimate.VolumeFreeBytes = free
+	estimate.Fits = estimate.EstimatedBytes <= free
+	return estimate, nil
+}
+
+// countEvents counts the events of each type in a recording
+func countEvents(data []byte) (map[string]int64, int64, error) {
+	counts := map[string]int64{}
+	var total int64
+	err := jfr.Parse(bytes.NewReader(data), func(e *jfr.Event) error {
+		counts[e.Type()]++
+		total++
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to parse probe recording: %w", err)
+	}
+	return counts, total, nil
+}
+
+// topEventRates returns the n most frequent event types with their rates
+func topEventRates(counts map[string]int64, seconds float64, n int) []EventRate {
+	rates := make([]EventRate, 0, len(counts))
+	for typ, count := range counts {
+		rates = append(rates, EventRate{Type: typ, Count: count, PerSecond: float64(count) / seconds})
+	}
+	sort.Slice(rates, func(i, j int) bool {
+		if rates[i].Count != rates[j].Count {
+			return rates[i].Count > rates[j].Count
+		}
+		return rates[i].Type < rates[j].Type
+	})
+	if len(rates) > n {
+		rates = rates[:n]
+	}
+	return rates
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"net/http"
+	"path/filepath"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/events"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/tenant"
+)
+
+// eventsHandler streams recording lifecycle events (started, stopped, file flushed, uploaded) as
+// Server-Sent Events, so UIs can follow progress without polling /running and /list
+func (s *Server) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	events.StreamHandler(s.closing, s.ownsEvent)(w, r)
+}
+
+// ownsEvent reports whether the request may see an event. Tenants only see events of their own
+// recordings, identified by name or, for uploads, by the recording file.
+func (s *Server) ownsEvent(r *http.Request, e events.Event) bool {
+	if tenant.FromContext(r.Context()) == nil {
+		return true
+	}
+	if name, ok := e.Fields["name"].(string); ok {
+		return s.ownsRecording(r.Context(), name)
+	}
+	if path, ok := e.Fields["path"].(string); ok {
+		return s.ownsRecording(r.Context(), recordingNameOf(filepath.Base(path)))
+	}
+	return false
+}
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/breaker"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/fakejvm"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/metrics"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// commandWaitDelay bounds how long output pipes are drained after the process group is killed
+const commandWaitDelay = 5 * time.Second
+
+// errCommandTimeout marks a command killed because it ran past its deadline
+var errCommandTimeout = errors.New("command timed out")
+
+type commandTimeoutKey struct{}
+
+// withCommandTimeout overrides JCMD_TIMEOUT or COMMAND_TIMEOUT for commands run with the returned
+// context, for callers that know a command runs longer (native profiles)
+func withCommandTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, commandTimeoutKey{}, timeout)
+}
+
+// execRunner is the production CommandRunner: it runs pinned, hardened binaries (or the fake JVM
+// in simulation mode) with timeouts, tracing and a circuit breaker per target JVM
+type execRunner struct {
+	opts Options
+
+	pathsMu sync.RWMutex
+	paths   map[string]string // command name -> validated absolute path
+
+	breakersMu sync.Mutex
+	breakers   map[string]*breaker.Breaker // jcmd target PID -> circuit
+}
+
+func newExecRunner(opts Options) *execRunner {
+	return &execRunner{
+		opts:     opts,
+		paths:    map[string]string{},
+		breakers: map[string]*breaker.Breaker{},
+	}
+}
+
+// Run executes an external command inside a child span and returns its combined output
+func (e *execRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return e.instrument(ctx, name, args, func(ctx context.Context) ([]byte, error) {
+		if fakejvm.Enabled() {
+			return fakejvm.Run(name, args...)
+		}
+		name, args, err := e.attachCommand(name, args)
+		if err != nil {
+			return nil, err
+		}
+		return e.execCommand(ctx, name, args...)
+	})
+}
+
+// instrument runs a command, or a backend standing in for one, with the command's timeout,
+// tracing, duration metric and slow-command log, and jcmd calls behind the target JVM's circuit
+// breaker. args are the command's arguments; a jcmd's first one is the target PID.
+func (e *execRunner) instrument(ctx context.Context, name string, args []string, call func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "exec "+name)
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("process.command", name),
+		attribute.String("process.command_line", strings.Join(append([]string{name}, args...), " ")),
+	)
+
+	timeout := e.opts.CommandTimeout
+	if name == "jcmd" {
+		timeout = e.opts.JcmdTimeout
+	}
+	if d, ok := ctx.Value(commandTimeoutKey{}).(time.Duration); ok {
+		timeout = d
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	run := func() ([]byte, error) { return call(ctx) }
+
+	var output []byte
+	var err error
+	if name == "jcmd" && len(args) > 0 {
+		output, err = e.guardJcmd(args[0], run)
+	} else {
+		output, err = run()
+	}
+	elapsed := time.Since(start)
+
+	span.SetAttributes(attribute.Int64("process.duration_ms", elapsed.Milliseconds()))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	e.observeCommand(ctx, name, args, elapsed, output, err)
+	return output, err
+}
+
+// observeCommand records a command's duration and logs it, as a warning with the full invocation
+// when it ran longer than SLOW_COMMAND_THRESHOLD. Slow JFR.stop and JFR.dump calls usually mean
+// the JVM struggles to reach a safepoint.
+func (e *execRunner) observeCommand(ctx context.Context, name string, args []string, elapsed time.Duration, output []byte, err error) {
+	operation := commandOperation(name, args)
+	result := "ok"
+	var open *breaker.OpenError
+	switch {
+	case errors.As(err, &open):
+		result = "rejected"
+	case errors.Is(err, errCommandTimeout):
+		result = "timeout"
+	case err != nil:
+		result = "error"
+	}
+	metrics.CommandDuration.WithLabelValues(name, operation, result).Observe(elapsed.Seconds())
+
+	entry := logger.Log.WithContext(ctx).WithFields(map[string]interface{}{
+		"command":  name,
+		"args":     args,
+		"duration": elapsed.String(),
+	})
+	if e.opts.SlowCommandThreshold <= 0 || elapsed < e.opts.SlowCommandThreshold {
+		entry.Debug("Executed command")
+		return
+	}
+
+	metrics.SlowCommandsTotal.WithLabelValues(name, operation).Inc()
+	entry = entry.WithFields(map[string]interface{}{
+		"operation":   operation,
+		"threshold":   e.opts.SlowCommandThreshold.String(),
+		"result":      result,
+		"outputBytes": len(output),
+	})
+	if name == "jcmd" && len(args) > 0 {
+		entry = entry.WithField("pid", args[0])
+	}
+	if err != nil {
+		entry = entry.WithError(err)
+	}
+	entry.Warn("Slow command")
+}
+
+// commandOperation returns the diagnostic command of a jcmd invocation ("JFR.stop"), or "" for
+// other commands. jcmd arguments are "<pid> <command> [options]".
+func commandOperation(name string, args []string) string {
+	if name != "jcmd" || len(args) < 2 {
+		return ""
+	}
+	return args[1]
+}
+
+// execCommand runs a hardened command in its own process group so that cancellation or a
+// timeout kills it together with any children (nsenter's jcmd, perf's sleep)
+func (e *execRunner) execCommand(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	if err := e.hardenCommand(cmd, name); err != nil {
+		return nil, err
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = commandWaitDelay
+
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+
+	start := time.Now()
+	err := cmd.Start()
+	if err == nil {
+		e.limitProcess(cmd.Process.Pid)
+		err = cmd.Wait()
+	}
+	output := buf.Bytes()
+	switch ctxErr := ctx.Err(); {
+	case err == nil:
+	case errors.Is(ctxErr, context.DeadlineExceeded):
+		err = fmt.Errorf("%s killed after %s: %w", name, time.Since(start).Round(time.Millisecond), errCommandTimeout)
+	case ctxErr != nil:
+		err = fmt.Errorf("%s cancelled: %w", name, ctxErr)
+	}
+	return output, err
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/marker"
+)
+
+// pendingRecording is a recording whose file is finished once the JVM has written it: gzipped
+// with COMPRESS_RECORDINGS, given its completion marker with COMPLETION_MARKERS, then handed to
+// RECORDING_POST_HOOK
+type pendingRecording struct {
+	pid      int
+	name     string
+	engine   string
+	duration string
+	source   string // the file the JVM writes
+	target   string // the finished file; source unless compressed
+	timer    *time.Timer
+	started  bool
+}
+
+// scheduleFinish finishes a recording's file when it stops or its duration elapses
+func (s *Server) scheduleFinish(pid int, req ProfileRequest, source, target string) {
+	pending := &pendingRecording{pid: pid, name: req.Name, engine: req.Engine, duration: req.Duration, source: source, target: target}
+	s.finishMu.Lock()
+	defer s.finishMu.Unlock()
+	if old := s.finishing[req.Name]; old != nil && old.timer != nil && !old.started {
+		old.timer.Stop()
+	}
+	s.finishing[req.Name] = pending
+	if d, err := time.ParseDuration(req.Duration); err == nil && d > 0 {
+		pending.timer = time.AfterFunc(d, func() { s.startFinish(req.Name) })
+	}
+}
+
+// startFinish finishes a stopped recording's file in the background. Stopping a recording calls
+// it directly rather than through the event bus, which drops events for slow subscribers.
+func (s *Server) startFinish(name string) {
+	s.finishMu.Lock()
+	pending := s.finishing[name]
+	if pending == nil || pending.started {
+		s.finishMu.Unlock()
+		return
+	}
+	pending.started = true
+	if pending.timer != nil {
+		pending.timer.Stop()
+	}
+	s.finishMu.Unlock()
+
+	s.uploading.Add(1)
+	go func() {
+		defer s.uploading.Done()
+		path, ok := s.finishRecording(pending)
+		s.finishMu.Lock()
+		if s.finishing[name] == pending {
+			delete(s.finishing, name)
+		}
+		s.finishMu.Unlock()
+		if ok {
+			s.runPostRecordingHook(name, pending.duration, path, pending.pid)
+		}
+	}()
+}
+
+// finishPending reports whether path is a stopped recording not finished yet, so callers waiting
+// for it keep waiting while it queues for a compression slot
+func (s *Server) finishPending(path string) bool {
+	s.finishMu.Lock()
+	defer s.finishMu.Unlock()
+	for _, pending := range s.finishing {
+		if pending.started && pending.target == path {
+			return true
+		}
+	}
+	return false
+}
+
+// finishRecording waits for the JVM to write the recording, compresses it if asked and marks it
+// complete. It returns the finished file, or false when the JVM never finished writing it.
+func (s *Server) finishRecording(p *pendingRecording) (string, bool) {
+	if err := s.waitForRecordingWritten(context.Background(), p); err != nil {
+		logger.Log.WithError(err).WithField("path", p.target).Warn("Recording not finished")
+		return "", false
+	}
+	path := p.source
+	if p.source != p.target {
+		path = s.compressRecording(p.source, p.target)
+	}
+	s.markComplete(path)
+	return path, true
+}
+
+// waitForRecordingWritten waits until the JVM has closed a JFR recording and its file is on disk,
+// or for an async-profiler file to stop growing. A JVM that cannot be reached any more writes
+// nothing further, so its file counts as written. The poll interval doubles up to a few seconds,
+// so recordings that take long to write do not keep JFR.check busy.
+func (s *Server) waitForRecordingWritten(ctx context.Context, p *pendingRecording) error {
+	const maxPoll = 4 * time.Second
+	poll := 250 * time.Millisecond
+	deadline := s.clock.Now().Add(s.opts.DirectUploadSettle)
+	last := int64(-1)
+	for {
+		closed := true
+		if p.engine != engineAsyncProfiler {
+			output, err := s.jvm.Jcmd(ctx, p.pid, "JFR.check")
+			closed = err != nil || !slices.Contains(parseRecordingNames(string(output)), p.name)
+		}
+		if info, err := s.fs.Stat(p.source); err == nil && info.Size() > 0 && closed {
+			if info.Size() == last {
+				return nil
+			}
+			last = info.Size()
+		}
+		if s.clock.Now().After(deadline) {
+			return fmt.Errorf("%s was not written within %s", p.source, s.opts.DirectUploadSettle)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(poll):
+		}
+		poll = min(2*poll, maxPoll)
+	}
+}
+
+// markComplete writes the completion marker of a finished artifact when COMPLETION_MARKERS is on.
+// The daemon uploads the artifact as soon as its marker appears.
+func (s *Server) markComplete(path string) {
+	if !s.cfg.CompletionMarkers {
+		return
+	}
+	if err := s.fs.WriteFile(marker.Path(path), nil, 0o644); err != nil {
+		logger.Log.WithError(err).WithField("path", path).Warn("Failed to write completion marker")
+	}
+}
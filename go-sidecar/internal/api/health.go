@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/fakejvm"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+)
+
+// readinessTimeout bounds the JVM lookup of one readiness probe, so a stuck pgrep cannot hold
+// the probe past the kubelet's own timeout
+const readinessTimeout = 5 * time.Second
+
+// readinessProbeFile is written to the profile directory and removed again by every readiness
+// check; the leading dot keeps it out of /list and retention
+const readinessProbeFile = ".readyz-probe"
+
+// ReadinessCheck is the result of one readiness condition
+type ReadinessCheck struct {
+	Name  string `json:"name"` // jcmd, jvm or profileDir
+	Ready bool   `json:"ready"`
+	Error string `json:"error,omitempty"`
+}
+
+// Readiness reports whether the sidecar can serve profiling requests, with each check's result
+type Readiness struct {
+	Ready  bool             `json:"ready"`
+	PID    int              `json:"pid,omitempty"` // JVM a request naming none would target
+	Checks []ReadinessCheck `json:"checks"`
+}
+
+// livezHandler reports that the API server is running. It checks nothing else, so a missing or
+// restarting JVM never gets the sidecar restarted.
+func (s *Server) livezHandler(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "API server is alive",
+	})
+}
+
+// readyzHandler answers 200 when jcmd is on PATH, a target JVM can be resolved and the profile
+// directory is writable, and 503 otherwise, so Kubernetes stops routing to a sidecar that could
+// not serve a recording
+func (s *Server) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendJSON(w, http.StatusMethodNotAllowed, Response{
+			Success: false,
+			Message: "Method not allowed",
+		})
+		return
+	}
+	readiness := s.readiness(r.Context())
+	if !readiness.Ready {
+		logger.Log.WithField("checks", readiness.Checks).Debug("Sidecar not ready")
+		sendJSON(w, http.StatusServiceUnavailable, Response{
+			Success: false,
+			Message: "Sidecar is not ready",
+			Data:    readiness,
+		})
+		return
+	}
+	sendJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "Sidecar is ready",
+		Data:    readiness,
+	})
+}
+
+// readiness runs every readiness check; all run even once one fails, so the response shows
+// everything that needs fixing
+func (s *Server) readiness(ctx context.Context) Readiness {
+	readiness := Readiness{Ready: true}
+	add := func(name string, err error) {
+		check := ReadinessCheck{Name: name, Ready: err == nil}
+		if err != nil {
+			check.Error = err.Error()
+			readiness.Ready = false
+		}
+		readiness.Checks = append(readiness.Checks, check)
+	}
+
+	add("jcmd", s.checkJcmd())
+
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+	pid, err := s.jvm.ResolvePID(ctx, "")
+	if err == nil {
+		readiness.PID = pid
+	}
+	add("jvm", err)
+
+	add("profileDir", s.checkProfileDirWritable())
+	return readiness
+}
+
+// checkJcmd reports whether jcmd resolves on PATH; simulation mode, ATTACH_NATIVE and
+// JOLOKIA_URL do not run it
+func (s *Server) checkJcmd() error {
+	if fakejvm.Enabled() || s.opts.AttachNative || s.jolokia != nil {
+		return nil
+	}
+	if _, err := exec.LookPath("jcmd"); err != nil {
+		return fmt.Errorf("jcmd not found: %w", err)
+	}
+	return nil
+}
+
+// checkProfileDirWritable writes and removes a probe file in the profile directory, since a
+// read-only mount passes a Stat
+func (s *Server) checkProfileDirWritable() error {
+	probe := filepath.Join(s.cfg.ProfileDir, readinessProbeFile)
+	if err := s.fs.WriteFile(probe, nil, 0o600); err != nil {
+		return fmt.Errorf("profile directory is not writable: %w", err)
+	}
+	if err := s.fs.Remove(probe); err != nil {
+		return fmt.Errorf("failed to remove readiness probe file: %w", err)
+	}
+	return nil
+}
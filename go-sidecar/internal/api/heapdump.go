@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/events"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/validation"
+)
+
+// HeapDumpRequest asks for an HPROF heap dump of a JVM
+type HeapDumpRequest struct {
+	Name      string `json:"name,omitempty"`      // output file stem; defaults to heapdump_{timestamp}
+	All       bool   `json:"all,omitempty"`       // include unreachable objects; by default a full GC runs first and only live objects are dumped
+	Container string `json:"container,omitempty"` // target container when the pod runs several JVMs
+	PID       int    `json:"pid,omitempty"`       // target JVM by process ID (see /jvms)
+	MainClass string `json:"mainClass,omitempty"` // target JVM by main class or jar
+}
+
+// Validate checks the optional name and JVM selector
+func (req *HeapDumpRequest) Validate() validation.Errors {
+	return validation.Collect(
+		validRecordingName("name", req.Name),
+		validPID("pid", req.PID),
+		validArgument("mainClass", req.MainClass),
+	)
+}
+
+// heapDumpHandler writes {name}.hprof to the profile directory in the background, where the
+// daemon picks it up and uploads it compressed. Only one heap dump runs at a time: each one
+// pauses the JVM and needs as much disk as the live heap.
+func (s *Server) heapDumpHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendJSON(w, http.StatusMethodNotAllowed, Response{
+			Success: false,
+			Message: "Method not allowed",
+		})
+		return
+	}
+
+	var req HeapDumpRequest
+	if !s.decodeRequest(w, r, &req) {
+		return
+	}
+
+	if s.rejectIfOverQuota(w) {
+		return
+	}
+
+	if req.Name == "" {
+		req.Name = fmt.Sprintf("heapdump_%s", s.timestampSuffix(s.clock.Now()))
+	}
+
+	pid, err := s.targetJVM(r.Context(), JVMSelector{Container: req.Container, PID: req.PID, MainClass: req.MainClass})
+	if err != nil {
+		sendJSON(w, http.StatusInternalServerError, Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to find Java process: %v", err),
+		})
+		return
+	}
+
+	dir, err := s.recordingDir(r.Context())
+	if err != nil {
+		sendJSON(w, http.StatusInternalServerError, Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to prepare output directory: %v", err),
+		})
+		return
+	}
+	filename := req.Name + ".hprof"
+	path := filepath.Join(dir, filename)
+	if _, err := s.fs.Stat(path); err == nil {
+		sendJSON(w, http.StatusConflict, Response{
+			Success: false,
+			Message: fmt.Sprintf("%s already exists", filename),
+		})
+		return
+	}
+
+	if !s.heapDumping.CompareAndSwap(false, true) {
+		sendJSON(w, http.StatusConflict, Response{
+			Success: false,
+			Message: "A heap dump is already being written; retry once it completes",
+		})
+		return
+	}
+
+	// The dump outlives the request; keep the trace context but not its cancellation
+	ctx := context.WithoutCancel(r.Context())
+	go func() {
+		defer s.heapDumping.Store(false)
+		log := logger.Log.WithContext(ctx).WithField("name", req.Name).WithField("pid", pid)
+		start := s.clock.Now()
+		if err := s.writeHeapDump(ctx, pid, path, req.All); err != nil {
+			log.WithError(err).Error("Heap dump failed")
+			return
+		}
+		log.WithField("filename", filename).WithField("duration", s.clock.Now().Sub(start).String()).Info("Heap dump completed")
+	}()
+
+	sendJSON(w, http.StatusAccepted, Response{
+		Success: true,
+		Message: "Heap dump started",
+		Data: map[string]string{
+			"pid":      strconv.Itoa(pid),
+			"name":     req.Name,
+			"filename": filename,
+		},
+	})
+}
+
+// writeHeapDump runs GC.heap_dump into a hidden file and moves it into place once complete, so
+// the daemon never uploads a partial dump
+func (s *Server) writeHeapDump(ctx context.Context, pid int, path string, all bool) error {
+	tmpPath := hiddenPath(path)
+	args := []string{"GC.heap_dump"}
+	if all {
+		args = append(args, "-all")
+	}
+	args = append(args, tmpPath)
+	output, err := s.runJcmd(withCommandTimeout(ctx, s.opts.HeapDumpTimeout), nil, pid, args...)
+	if err != nil {
+		s.fs.Remove(tmpPath)
+		return fmt.Errorf("GC.heap_dump failed: %w, output: %s", err, string(output))
+	}
+	if err := s.fs.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to move heap dump into place: %w", err)
+	}
+	s.markComplete(path)
+	events.Publish(events.FileFlushed, map[string]any{
+		"pid":  pid,
+		"kind": "heapdump",
+		"path": path,
+	})
+	return nil
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// defaultHistogramTop is how many classes /classhistogram returns without "top"
+const defaultHistogramTop = 50
+
+// ClassHistogram is parsed GC.class_histogram output, largest classes first
+type ClassHistogram struct {
+	PID            int              `json:"pid"`
+	Classes        []HistogramEntry `json:"classes"`
+	TotalClasses   int              `json:"totalClasses"` // classes in the full histogram, before "top"
+	TotalInstances int64            `json:"totalInstances"`
+	TotalBytes     int64            `json:"totalBytes"`
+}
+
+// HistogramEntry is one class of a histogram
+type HistogramEntry struct {
+	Rank      int    `json:"rank"`
+	Class     string `json:"class"`
+	Module    string `json:"module,omitempty"` // e.g. "java.base@21.0.2"
+	Instances int64  `json:"instances"`
+	Bytes     int64  `json:"bytes"`
+}
+
+// classHistogramHandler returns the classes using the most heap. By default the JVM runs a full
+// GC first so only live objects count; "all=true" skips it and counts unreachable objects too.
+// "top" limits the classes returned (0 returns all of them).
+func (s *Server) classHistogramHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendJSON(w, http.StatusMethodNotAllowed, Response{
+			Success: false,
+			Message: "Method not allowed",
+		})
+		return
+	}
+
+	q := r.URL.Query()
+	top := defaultHistogramTop
+	if v := q.Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			sendJSON(w, http.StatusBadRequest, Response{
+				Success: false,
+				Message: fmt.Sprintf("Invalid request: top must be a non-negative number, got %q", v),
+			})
+			return
+		}
+		top = n
+	}
+	sel, err := querySelector(r)
+	if err != nil {
+		sendJSON(w, http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("Invalid request: %v", err),
+		})
+		return
+	}
+	pid, err := s.targetJVM(r.Context(), sel)
+	if err != nil {
+		sendJSON(w, http.StatusInternalServerError, Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to find Java process: %v", err),
+		})
+		return
+	}
+
+	args := []string{"GC.class_histogram"}
+	if all, _ := strconv.ParseBool(q.Get("all")); all {
+		args = append(args, "-all")
+	}
+	output, err := s.runJcmd(r.Context(), nil, pid, args...)
+	if err != nil {
+		sendJSON(w, commandStatus(w, err), Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to capture class histogram: %v, output: %s", err, string(output)),
+		})
+		return
+	}
+
+	histogram := parseClassHistogram(string(output))
+	histogram.PID = pid
+	if top > 0 && len(histogram.Classes) > top {
+		histogram.Classes = histogram.Classes[:top]
+	}
+	sendJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("Class histogram of %d classes captured", histogram.TotalClasses),
+		Data:    histogram,
+	})
+}
+
+// parseClassHistogram reads GC.class_histogram output:
+//
+//	 num     #instances         #bytes  class name (module)
+//	-------------------------------------------------------
+//	   1:         51234        9876544  [B (java.base@21.0.2)
+//	   2:          4321         103704  java.lang.String (java.base@21.0.2)
+//	Total         55555        9980248
+func parseClassHistogram(output string) ClassHistogram {
+	histogram := ClassHistogram{Classes: []HistogramEntry{}}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 3 && fields[0] == "Total" {
+			histogram.TotalInstances, _ = strconv.ParseInt(fields[1], 10, 64)
+			histogram.TotalBytes, _ = strconv.ParseInt(fields[2], 10, 64)
+			continue
+		}
+		if len(fields) < 4 || !strings.HasSuffix(fields[0], ":") {
+			continue
+		}
+		rank, err := strconv.Atoi(strings.TrimSuffix(fields[0], ":"))
+		if err != nil {
+			continue
+		}
+		entry := HistogramEntry{Rank: rank, Class: fields[3]}
+		entry.Instances, _ = strconv.ParseInt(fields[1], 10, 64)
+		entry.Bytes, _ = strconv.ParseInt(fields[2], 10, 64)
+		if len(fields) > 4 {
+			entry.Module = strings.Trim(fields[4], "()")
+		}
+		histogram.Classes = append(histogram.Classes, entry)
+	}
+	histogram.TotalClasses = len(histogram.Classes)
+	return histogram
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/hooks"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+)
+
+// recordingHookVars describes a recording to hook commands and webhooks
+func recordingHookVars(phase, name, duration, path string, pid int) map[string]string {
+	return map[string]string{
+		"RECORDING_PHASE":    phase,
+		"RECORDING_NAME":     name,
+		"RECORDING_DURATION": duration,
+		"RECORDING_FILE":     path,
+		"RECORDING_PID":      fmt.Sprint(pid),
+		"POD_NAME":           os.Getenv("POD_NAME"),
+	}
+}
+
+// runPreRecordingHook runs the configured pre-start hook synchronously
+func (s *Server) runPreRecordingHook(ctx context.Context, name, duration, path string, pid int) error {
+	return hooks.Run(ctx, s.opts.PreRecordingHook, recordingHookVars("pre", name, duration, path, pid))
+}
+
+// runPostRecordingHook runs the configured post-stop hook once a recording's file is finished, so
+// the hook never sees a file the JVM is still writing. Failures are logged.
+func (s *Server) runPostRecordingHook(name, duration, path string, pid int) {
+	vars := recordingHookVars("post", name, duration, path, pid)
+	if err := hooks.Run(context.Background(), s.opts.PostRecordingHook, vars); err != nil {
+		logger.Log.WithError(err).WithField("name", name).Warn("Post-recording hook failed")
+	}
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"time"
+)
+
+// recordingWriteGrace covers the JVM writing out a recording after its duration elapses
+const recordingWriteGrace = 5 * time.Second
+
+type heldRecording struct {
+	release func()
+	timer   *time.Timer
+}
+
+// holdRecording marks a recording's file as in use while the JVM may still be writing it, so an
+// in-process scanner (standalone mode) neither uploads a partial file nor deletes it
+func (s *Server) holdRecording(name, path, duration string) {
+	if s.files == nil {
+		return
+	}
+	s.releaseRecording(name)
+
+	held := &heldRecording{release: s.files.Acquire(path)}
+	if d, err := time.ParseDuration(duration); err == nil && d > 0 {
+		held.timer = time.AfterFunc(d+recordingWriteGrace, func() { s.releaseRecording(name) })
+	}
+
+	s.heldMu.Lock()
+	s.held[name] = held
+	s.heldMu.Unlock()
+}
+
+// releaseRecording ends the hold taken by holdRecording once a recording has stopped
+func (s *Server) releaseRecording(name string) {
+	s.heldMu.Lock()
+	held := s.held[name]
+	delete(s.held, name)
+	s.heldMu.Unlock()
+
+	if held == nil {
+		return
+	}
+	if held.timer != nil {
+		held.timer.Stop()
+	}
+	held.release()
+}
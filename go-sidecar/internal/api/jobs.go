@@ -0,0 +1,275 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/events"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/metrics"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/tenant"
+)
+
+// maxJobs bounds the jobs kept in memory; the oldest are evicted beyond this
+const maxJobs = 500
+
+// JobState is a recording job's position in its lifecycle
+type JobState string
+
+const (
+	JobStarting  JobState = "starting"  // accepted, JFR.start not yet answered
+	JobRecording JobState = "recording" // the JVM is recording
+	JobCompleted JobState = "completed" // the recording stopped and its file was written
+	JobUploaded  JobState = "uploaded"  // the file reached the upload destination
+	JobFailed    JobState = "failed"    // starting or uploading failed; see error
+)
+
+// Job tracks one recording started through /create. Uploads are seen when they happen in this
+// process (standalone mode, streaming or direct uploads); with a separate daemon, jobs end at
+// completed.
+type Job struct {
+	ID          string                 `json:"id"`
+	State       JobState               `json:"state"`
+	Recording   string                 `json:"recording"`
+	PID         int                    `json:"pid"`
+	Duration    string                 `json:"duration"`
+	Engine      string                 `json:"engine"`
+	Filename    string                 `json:"filename"`
+	Path        string                 `json:"path,omitempty"`
+	Destination string                 `json:"destination,omitempty"`
+	Output      string                 `json:"output,omitempty"` // JFR.start or asprof output
+	Error       string                 `json:"error,omitempty"`
+	Timestamps  map[JobState]time.Time `json:"timestamps"` // when each state was entered
+	Ephemeral   bool                   `json:"ephemeral,omitempty"`
+
+	tenant   string
+	timer    *time.Timer
+	callback *jobCallback // notified once the recording completes
+}
+
+// newJob registers a job for a recording about to start. It returns errTooManyRecordings while
+// MAX_CONCURRENT_RECORDINGS jobs are starting or recording.
+func (s *Server) newJob(ctx context.Context, pid int, req ProfileRequest) (*Job, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	job := &Job{
+		ID:         hex.EncodeToString(b),
+		State:      JobStarting,
+		Recording:  req.Name,
+		PID:        pid,
+		Duration:   req.Duration,
+		Engine:     req.Engine,
+		Filename:   s.recordingFilename(req),
+		Ephemeral:  req.Ephemeral,
+		Timestamps: map[JobState]time.Time{JobStarting: s.clock.Now().UTC()},
+	}
+	if t := tenant.FromContext(ctx); t != nil {
+		job.tenant = t.Name
+	}
+
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+	if s.opts.MaxConcurrentRecordings > 0 && s.activeJobsLocked() >= s.opts.MaxConcurrentRecordings {
+		return nil, errTooManyRecordings
+	}
+	if err := s.reserveRecording(pid, req, job.tenant); err != nil {
+		return nil, err
+	}
+	s.jobs[job.ID] = job
+	s.jobOrder = append(s.jobOrder, job.ID)
+	if len(s.jobOrder) > maxJobs {
+		if old := s.jobs[s.jobOrder[0]]; old != nil && old.timer != nil {
+			old.timer.Stop()
+		}
+		delete(s.jobs, s.jobOrder[0])
+		s.jobOrder = s.jobOrder[1:]
+	}
+	return job, nil
+}
+
+// runJob starts the job's recording. It runs after /create has answered, so it must not use the
+// request's cancellation.
+func (s *Server) runJob(ctx context.Context, job *Job, req ProfileRequest) {
+	defer s.starting.Done()
+	path, output, err := s.startRecording(ctx, job.PID, req)
+	var callback *jobCallback
+	if err == nil && req.CallbackURL != "" {
+		callback = s.newJobCallback(ctx, req.CallbackURL, path)
+	}
+
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+	job.Path = path
+	job.Output = string(output)
+	if err != nil {
+		job.Error = fmt.Sprintf("failed to start recording: %v", err)
+		s.setJobStateLocked(job, JobFailed)
+		s.unregisterRecording(job.PID, job.Recording)
+		logger.Log.WithError(err).WithField("job", job.ID).Warn("Recording job failed to start")
+		return
+	}
+	job.callback = callback
+	s.setJobStateLocked(job, JobRecording)
+
+	// A timed recording writes its file when the duration elapses
+	if d, err := time.ParseDuration(req.Duration); err == nil && d > 0 {
+		job.timer = time.AfterFunc(d, func() { s.completeJob(job.Recording) })
+	}
+}
+
+// recordingEngine returns the engine and output path of the latest job recording under name.
+// Recordings without a job, e.g. from rollouts, are JFR recordings.
+func (s *Server) recordingEngine(name string) (string, string) {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+	for i := len(s.jobOrder) - 1; i >= 0; i-- {
+		if job := s.jobs[s.jobOrder[i]]; job != nil && job.Recording == name {
+			return job.Engine, job.Path
+		}
+	}
+	return engineJFR, ""
+}
+
+// setJobStateLocked moves a job to state and counts the recording lifecycle; s.jobsMu must be held
+func (s *Server) setJobStateLocked(job *Job, state JobState) {
+	previous := job.State
+	job.State = state
+	job.Timestamps[state] = s.clock.Now().UTC()
+
+	switch {
+	case state == JobRecording:
+		metrics.RecordingsTotal.WithLabelValues(job.Engine, "started").Inc()
+	case state == JobCompleted:
+		metrics.RecordingsTotal.WithLabelValues(job.Engine, "stopped").Inc()
+	case state == JobFailed && previous == JobStarting:
+		metrics.RecordingsTotal.WithLabelValues(job.Engine, "failed").Inc()
+	}
+	if state == JobRecording || previous == JobRecording {
+		recording := 0
+		for _, j := range s.jobs {
+			if j.State == JobRecording {
+				recording++
+			}
+		}
+		metrics.ActiveRecordings.Set(float64(recording))
+	}
+}
+
+// countWrittenFile adds a job's file to the bytes written once the recorder has finished it
+func (s *Server) countWrittenFile(path, engine string) {
+	go func() {
+		if err := s.waitForSettledFile(context.Background(), path); err != nil {
+			logger.Log.WithError(err).WithField("path", path).Debug("Recording size not counted")
+			return
+		}
+		if info, err := s.fs.Stat(path); err == nil {
+			metrics.ProfileBytesWrittenTotal.WithLabelValues(engine).Add(float64(info.Size()))
+		}
+	}()
+}
+
+// completeJob marks the recording job of a stopped recording completed and starts delivering
+// its callback
+func (s *Server) completeJob(recording string) {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+	for i := len(s.jobOrder) - 1; i >= 0; i-- {
+		job := s.jobs[s.jobOrder[i]]
+		if job == nil || job.Recording != recording {
+			continue
+		}
+		if job.State == JobRecording {
+			if job.timer != nil {
+				job.timer.Stop()
+			}
+			s.setJobStateLocked(job, JobCompleted)
+			if job.Path != "" {
+				s.countWrittenFile(job.Path, job.Engine)
+			}
+			s.uploadCompletedJob(job)
+			if job.callback != nil {
+				go s.deliverCallback(*job, job.callback)
+			}
+		}
+		return
+	}
+}
+
+// uploadedJob records the outcome of uploading a job's file. A failed upload marks the job failed
+// until a retry succeeds.
+func (s *Server) uploadedJob(path, destination string, uploadErr string) {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+	for i := len(s.jobOrder) - 1; i >= 0; i-- {
+		job := s.jobs[s.jobOrder[i]]
+		if job == nil || job.Path != path || job.State == JobStarting {
+			continue
+		}
+		job.Destination = destination
+		if uploadErr != "" {
+			job.Error = "upload failed: " + uploadErr
+			s.setJobStateLocked(job, JobFailed)
+		} else {
+			job.Error = ""
+			s.setJobStateLocked(job, JobUploaded)
+		}
+		return
+	}
+}
+
+// subscribeJobEvents follows recordings and uploads published on the event bus
+func (s *Server) subscribeJobEvents() {
+	events.Subscribe(func(e events.Event) {
+		switch e.Type {
+		case events.RecordingStopped:
+			name, _ := e.Fields["name"].(string)
+			s.completeJob(name)
+		case events.UploadCompleted, events.UploadFailed:
+			path, _ := e.Fields["path"].(string)
+			destination, _ := e.Fields["destination"].(string)
+			uploadErr, _ := e.Fields["error"].(string)
+			s.uploadedJob(path, destination, uploadErr)
+		}
+	}, events.RecordingStopped, events.UploadCompleted, events.UploadFailed)
+}
+
+// jobHandler reports a recording job's state
+func (s *Server) jobHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var owner string
+	if t := tenant.FromContext(r.Context()); t != nil {
+		owner = t.Name
+	}
+
+	s.jobsMu.Lock()
+	job, ok := s.jobs[id]
+	var snapshot Job
+	if ok {
+		snapshot = *job
+		snapshot.Timestamps = make(map[JobState]time.Time, len(job.Timestamps))
+		for state, t := range job.Timestamps {
+			snapshot.Timestamps[state] = t
+		}
+	}
+	s.jobsMu.Unlock()
+
+	if !ok || snapshot.tenant != owner {
+		sendJSON(w, http.StatusNotFound, Response{
+			Success: false,
+			Message: fmt.Sprintf("No job with ID '%s'", id),
+		})
+		return
+	}
+	sendJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("Job is %s", snapshot.State),
+		Data:    snapshot,
+	})
+}
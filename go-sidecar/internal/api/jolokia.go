@@ -0,0 +1,78 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/jolokia"
+)
+
+// newJolokiaClient returns the client of the JVM's Jolokia agent, or nil unless JOLOKIA_URL is set
+func newJolokiaClient(opts Options) *jolokia.Client {
+	if opts.JolokiaURL == "" {
+		return nil
+	}
+	return &jolokia.Client{URL: opts.JolokiaURL, User: opts.JolokiaUser, Password: opts.JolokiaPassword}
+}
+
+// loadJolokiaPassword reads JOLOKIA_PASSWORD_FILE, which takes precedence over JOLOKIA_PASSWORD
+func (s *Server) loadJolokiaPassword() error {
+	path := s.opts.JolokiaPasswordFile
+	if s.jolokia == nil || path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read Jolokia password file: %w", err)
+	}
+	s.jolokia.Password = strings.TrimSpace(string(data))
+	return nil
+}
+
+// jolokiaController is the JVMController with JOLOKIA_URL: the only JVM is the agent's, found and
+// commanded over HTTP without pgrep, jcmd or a shared PID namespace
+type jolokiaController struct {
+	client    *jolokia.Client
+	exec      *execRunner
+	container string // JAVA_CONTAINER, the only container the agent answers for
+}
+
+// Jcmd runs the command through the agent's DiagnosticCommand MBean. The agent reaches a single
+// JVM, so the PID only labels the output like jcmd's "<pid>:" line.
+func (c *jolokiaController) Jcmd(ctx context.Context, pid int, command string, options ...string) ([]byte, error) {
+	return c.exec.instrument(ctx, "jcmd", jcmdArgs(pid, command, options), func(ctx context.Context) ([]byte, error) {
+		start := time.Now()
+		output, err := c.client.DiagnosticCommand(ctx, command, options)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("jolokia request stopped after %s: %w", time.Since(start).Round(time.Millisecond), errCommandTimeout)
+		}
+		return []byte(strconv.Itoa(pid) + ":\n" + output), err
+	})
+}
+
+// JavaPIDs returns the PID of the agent's JVM
+func (f *jolokiaController) JavaPIDs(ctx context.Context) ([]int, error) {
+	pid, err := f.client.PID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("no Java process found: %v", err)
+	}
+	return []int{pid}, nil
+}
+
+// ResolvePID returns the agent's JVM. Containers cannot be told apart through the agent, so a
+// container other than JAVA_CONTAINER is refused rather than answered with the wrong JVM.
+func (f *jolokiaController) ResolvePID(ctx context.Context, container string) (int, error) {
+	if container != "" && container != f.container {
+		return 0, fmt.Errorf("no Java process found in container %q: JOLOKIA_URL reaches a single JVM, name its container in JAVA_CONTAINER", container)
+	}
+	pids, err := f.JavaPIDs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return pids[0], nil
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/fakejvm"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/kube"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+)
+
+// containerIDPattern matches the runtime container ID in a cgroup path, e.g.
+// ".../cri-containerd-<id>.scope" (cgroup v2) or ".../kubepods/burstable/pod<uid>/<id>" (v1)
+var containerIDPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// pgrepFinder is the production ProcessFinder. With a shared PID namespace, every container's
+// processes are visible; containers are told apart by the runtime ID in each process's cgroup.
+type pgrepFinder struct {
+	runner    CommandRunner
+	container string    // JAVA_CONTAINER, the target when a request names no container
+	filter    jvmFilter // JVMs outside it are never found
+
+	kubeOnce   sync.Once
+	kubeClient *kube.Client
+	kubeErr    error
+}
+
+// ResolvePID finds the Java process in the named container, or the only Java process in the
+// pod when container is empty
+func (f *pgrepFinder) ResolvePID(ctx context.Context, container string) (int, error) {
+	if container == "" {
+		container = f.container
+	}
+
+	pids, err := f.JavaPIDs(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if container == "" {
+		if len(pids) > 1 {
+			return 0, fmt.Errorf("found %d Java processes; specify a pid, mainClass or container (see /jvms)", len(pids))
+		}
+		return pids[0], nil
+	}
+
+	if fakejvm.Enabled() {
+		if container != fakejvm.Container {
+			return 0, fmt.Errorf("no Java process found in container %q", container)
+		}
+		return pids[0], nil
+	}
+
+	containerID, err := f.lookupContainerID(ctx, container)
+	if err != nil {
+		return 0, err
+	}
+	for _, pid := range pids {
+		if id, err := cgroupContainerID(pid); err == nil && id == containerID {
+			logger.Log.WithField("pid", pid).WithField("container", container).Debug("Resolved Java PID by container")
+			return pid, nil
+		}
+	}
+	return 0, fmt.Errorf("no Java process found in container %q", container)
+}
+
+// JavaPIDs returns the PIDs of all processes named exactly "java" that pass JAVA_CMDLINE_PATTERN
+// and JAVA_ENV_MARKER
+func (f *pgrepFinder) JavaPIDs(ctx context.Context) ([]int, error) {
+	// Use pgrep -x to match exact process name "java" only
+	// This excludes shell wrappers like "sh -c java ..."
+	output, err := f.runner.Run(ctx, "pgrep", "-x", "java")
+
+	logger.Log.WithFields(map[string]interface{}{
+		"output": string(output),
+		"error":  err,
+	}).Debug("pgrep command result")
+
+	if err != nil {
+		return nil, fmt.Errorf("no Java process found: %v", err)
+	}
+
+	pids, err := parsePIDs(string(output))
+	if err != nil {
+		return nil, err
+	}
+	if len(pids) == 0 {
+		return nil, fmt.Errorf("no Java process found")
+	}
+	if f.filter.enabled() && !fakejvm.Enabled() {
+		found := len(pids)
+		if pids = f.filter.apply(pids); len(pids) == 0 {
+			return nil, fmt.Errorf("no Java process matches %s (found %d Java processes)", f.filter, found)
+		}
+	}
+	return pids, nil
+}
+
+// cgroupContainerID extracts the runtime container ID from /proc/<pid>/cgroup
+func cgroupContainerID(pid int) (string, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if id := containerIDPattern.FindString(line); id != "" {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("no container ID in cgroup of PID %d", pid)
+}
+
+// lookupContainerID asks the Kubernetes API for the runtime ID of a container in this pod
+func (f *pgrepFinder) lookupContainerID(ctx context.Context, container string) (string, error) {
+	f.kubeOnce.Do(func() { f.kubeClient, f.kubeErr = kube.InCluster() })
+	if f.kubeErr != nil {
+		return "", fmt.Errorf("container selection needs the Kubernetes API: %w", f.kubeErr)
+	}
+
+	pod, err := f.kubeClient.GetPod(ctx, kube.Namespace(), os.Getenv("POD_NAME"))
+	if err != nil {
+		return "", fmt.Errorf("failed to look up pod: %w", err)
+	}
+	id, ok := pod.ContainerID(container)
+	if !ok {
+		return "", fmt.Errorf("container %q not found in pod", container)
+	}
+	return id, nil
+}
+
+// parsePIDs parses newline-separated PIDs as printed by pgrep
+func parsePIDs(output string) ([]int, error) {
+	var pids []int
+	for _, field := range strings.Fields(output) {
+		pid, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PID: %v", err)
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
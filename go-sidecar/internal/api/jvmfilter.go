@@ -0,0 +1,125 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+)
+
+// jvmFilter narrows the Java processes pgrep finds to the ones the sidecar may target, for pods
+// whose shared process namespace holds JVMs that are not the application (build agents, admin
+// tools, other sidecars). Unlike a request's selector it applies everywhere: /jvms, default
+// targets and stopping recordings on shutdown see only the JVMs it keeps.
+type jvmFilter struct {
+	cmdline  *regexp.Regexp // matched against /proc/<pid>/cmdline, arguments joined by spaces
+	envName  string         // a variable the JVM's environment must set
+	envValue string         // and its value, when envHas
+	envHas   bool
+}
+
+// newJVMFilter builds the filter of JAVA_CMDLINE_PATTERN and JAVA_ENV_MARKER ("NAME" or
+// "NAME=VALUE"); either may be empty
+func newJVMFilter(pattern, marker string) (jvmFilter, error) {
+	var f jvmFilter
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return f, fmt.Errorf("invalid JAVA_CMDLINE_PATTERN: %v", err)
+		}
+		f.cmdline = re
+	}
+	if marker != "" {
+		f.envName, f.envValue, f.envHas = strings.Cut(marker, "=")
+		if f.envName == "" {
+			return f, fmt.Errorf("JAVA_ENV_MARKER must be NAME or NAME=VALUE, got %q", marker)
+		}
+	}
+	return f, nil
+}
+
+// validJVMFilter reports an invalid filter, and rejects filtering JVMs the sidecar does not find
+// through /proc
+func (s *Server) validJVMFilter() error {
+	switch {
+	case s.javaFilterErr != nil:
+		return s.javaFilterErr
+	case s.jolokia != nil && s.javaFilter.enabled():
+		return errors.New("JAVA_CMDLINE_PATTERN and JAVA_ENV_MARKER cannot be combined with JOLOKIA_URL, which reaches a single JVM")
+	}
+	return nil
+}
+
+// enabled reports whether any filter is set
+func (f jvmFilter) enabled() bool {
+	return f.cmdline != nil || f.envName != ""
+}
+
+// String describes the filter for logs and errors
+func (f jvmFilter) String() string {
+	var parts []string
+	if f.cmdline != nil {
+		parts = append(parts, fmt.Sprintf("JAVA_CMDLINE_PATTERN %q", f.cmdline.String()))
+	}
+	if f.envName != "" {
+		marker := f.envName
+		if f.envHas {
+			marker += "=" + f.envValue
+		}
+		parts = append(parts, fmt.Sprintf("JAVA_ENV_MARKER %q", marker))
+	}
+	return strings.Join(parts, " and ")
+}
+
+// apply returns the PIDs whose process matches the filter. A process whose command line or
+// environment cannot be read (it exited, or belongs to another user) does not match.
+func (f jvmFilter) apply(pids []int) []int {
+	var kept []int
+	for _, pid := range pids {
+		if err := f.match(pid); err != nil {
+			logger.Log.WithError(err).WithField("pid", pid).Debug("Java process filtered out")
+			continue
+		}
+		kept = append(kept, pid)
+	}
+	return kept
+}
+
+// match returns why a process does not match the filter, or nil
+func (f jvmFilter) match(pid int) error {
+	if f.cmdline != nil {
+		data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+		if err != nil {
+			return err
+		}
+		cmdline := string(bytes.TrimRight(bytes.ReplaceAll(data, []byte{0}, []byte{' '}), " "))
+		if !f.cmdline.MatchString(cmdline) {
+			return errors.New("command line does not match JAVA_CMDLINE_PATTERN")
+		}
+	}
+	if f.envName != "" {
+		data, err := os.ReadFile(fmt.Sprintf("/proc/%d/environ", pid))
+		if err != nil {
+			return err
+		}
+		if !hasEnvMarker(data, f.envName, f.envValue, f.envHas) {
+			return errors.New("environment has no JAVA_ENV_MARKER")
+		}
+	}
+	return nil
+}
+
+// hasEnvMarker reports whether a NUL-separated environment sets name, to value when hasValue
+func hasEnvMarker(environ []byte, name, value string, hasValue bool) bool {
+	for _, entry := range strings.Split(string(environ), "\x00") {
+		k, v, ok := strings.Cut(entry, "=")
+		if ok && k == name && (!hasValue || v == value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// secretProperty matches system property names whose values must not leave the pod, such as
+// "spring.datasource.password" or "aws.secretKey"
+var secretProperty = regexp.MustCompile(`(?i)(password|passwd|secret|token|credential|apikey|api-key|private)`)
+
+// secretArgument matches -D options on a command line whose name looks secret
+var secretArgument = regexp.MustCompile(`(-D[^=\s]*(?i:password|passwd|secret|token|credential|apikey|api-key|private)[^=\s]*=)\S*`)
+
+// redacted replaces the values of secret properties
+const redacted = "[redacted]"
+
+// VMFlags is parsed VM.flags output: the flags set on the command line or ergonomically
+type VMFlags struct {
+	PID   int            `json:"pid"`
+	Flags map[string]any `json:"flags"` // name -> true/false for booleans, the value as a string otherwise
+}
+
+// VMInfo is VM.info output split into its sections
+type VMInfo struct {
+	PID        int               `json:"pid"`
+	JREVersion string            `json:"jreVersion,omitempty"`
+	JavaVM     string            `json:"javaVM,omitempty"`
+	Sections   map[string]string `json:"sections"` // "SUMMARY", "PROCESS", "SYSTEM" -> text
+	Output     string            `json:"output"`
+}
+
+// SystemProperties is parsed VM.system_properties output, with secret-looking values redacted
+type SystemProperties struct {
+	PID        int               `json:"pid"`
+	Properties map[string]string `json:"properties"`
+}
+
+// vmFlagsHandler returns the JVM's non-default flags (VM.flags)
+func (s *Server) vmFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	s.jvmDiagnostic(w, r, "VM flags", func(pid int, output string) any {
+		flags := parseVMFlags(output)
+		flags.PID = pid
+		return flags
+	}, "VM.flags")
+}
+
+// vmInfoHandler returns the JVM's VM.info report: version, command line, memory, host and
+// environment. Secret-looking -D options are redacted.
+func (s *Server) vmInfoHandler(w http.ResponseWriter, r *http.Request) {
+	s.jvmDiagnostic(w, r, "VM info", func(pid int, output string) any {
+		info := parseVMInfo(secretArgument.ReplaceAllString(output, "${1}"+redacted))
+		info.PID = pid
+		return info
+	}, "VM.info")
+}
+
+// systemPropertiesHandler returns the JVM's system properties (VM.system_properties)
+func (s *Server) systemPropertiesHandler(w http.ResponseWriter, r *http.Request) {
+	s.jvmDiagnostic(w, r, "System properties", func(pid int, output string) any {
+		return SystemProperties{PID: pid, Properties: parseSystemProperties(output)}
+	}, "VM.system_properties")
+}
+
+// jvmDiagnostic runs a read-only diagnostic command against the JVM selected by the query and
+// responds with its parsed output
+func (s *Server) jvmDiagnostic(w http.ResponseWriter, r *http.Request, what string, parse func(pid int, output string) any, args ...string) {
+	if r.Method != http.MethodGet {
+		sendJSON(w, http.StatusMethodNotAllowed, Response{
+			Success: false,
+			Message: "Method not allowed",
+		})
+		return
+	}
+
+	sel, err := querySelector(r)
+	if err != nil {
+		sendJSON(w, http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("Invalid request: %v", err),
+		})
+		return
+	}
+	pid, err := s.targetJVM(r.Context(), sel)
+	if err != nil {
+		sendJSON(w, http.StatusInternalServerError, Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to find Java process: %v", err),
+		})
+		return
+	}
+
+	output, err := s.runJcmd(r.Context(), nil, pid, args...)
+	if err != nil {
+		sendJSON(w, commandStatus(w, err), Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to run %s: %v, output: %s", args[0], err, string(output)),
+		})
+		return
+	}
+	sendJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("%s retrieved successfully", what),
+		Data:    parse(pid, string(output)),
+	})
+}
+
+// parseVMFlags reads "-XX:+UseG1GC -XX:MaxHeapSize=536870912 ..." after the pid header
+func parseVMFlags(output string) VMFlags {
+	flags := VMFlags{Flags: map[string]any{}}
+	for _, field := range strings.Fields(output) {
+		flag, ok := strings.CutPrefix(field, "-XX:")
+		if !ok {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(flag, "+"):
+			flags.Flags[flag[1:]] = true
+		case strings.HasPrefix(flag, "-"):
+			flags.Flags[flag[1:]] = false
+		default:
+			if name, value, ok := strings.Cut(flag, "="); ok {
+				flags.Flags[name] = value
+			}
+		}
+	}
+	return flags
+}
+
+// vmInfoSection matches VM.info section headers such as "---------------  S U M M A R Y ------------"
+var vmInfoSection = regexp.MustCompile(`^-{3,}\s+(.+?)\s+-{3,}$`)
+
+// parseVMInfo splits VM.info output into its sections and reads the version header
+func parseVMInfo(output string) VMInfo {
+	info := VMInfo{Sections: map[string]string{}, Output: output}
+	var section string
+	var body strings.Builder
+	flush := func() {
+		if section != "" {
+			info.Sections[section] = strings.TrimSpace(body.String())
+		}
+		body.Reset()
+	}
+	for _, line := range strings.Split(output, "\n") {
+		if m := vmInfoSection.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+			flush()
+			section = strings.ReplaceAll(m[1], " ", "") // "S U M M A R Y" -> "SUMMARY"
+			continue
+		}
+		if v, ok := strings.CutPrefix(line, "# JRE version: "); ok {
+			info.JREVersion = strings.TrimSpace(v)
+		} else if v, ok := strings.CutPrefix(line, "# Java VM: "); ok {
+			info.JavaVM = strings.TrimSpace(v)
+		}
+		body.WriteString(line + "\n")
+	}
+	flush()
+	return info
+}
+
+// parseSystemProperties reads java.util.Properties text ("key=value", "#" comments) as printed
+// by VM.system_properties, unescaping the common escapes and redacting secret-looking values
+func parseSystemProperties(output string) map[string]string {
+	unescape := strings.NewReplacer(`\:`, ":", `\=`, "=", `\ `, " ", `\t`, "\t", `\n`, "\n", `\\`, `\`)
+	props := map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key, value = unescape.Replace(key), unescape.Replace(value)
+		if secretProperty.MatchString(key) {
+			value = redacted
+		}
+		props[key] = secretArgument.ReplaceAllString(value, "${1}"+redacted) // e.g. sun.java.command
+	}
+	return props
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// JVMMetrics are the key counters of PerfCounter.print: memory, GC, classes and threads. Sizes
+// are in bytes; times are converted from high-resolution ticks to seconds.
+type JVMMetrics struct {
+	PID           int               `json:"pid"`
+	UptimeSeconds float64           `json:"uptimeSeconds"`
+	Heap          MemoryPool        `json:"heap"`
+	Metaspace     MemoryPool        `json:"metaspace"`
+	GC            []GCCollector     `json:"gc"`
+	Classes       ClassCounts       `json:"classes"`
+	Threads       ThreadCounts      `json:"threads"`
+	Safepoints    SafepointCounts   `json:"safepoints"`
+	Counters      map[string]string `json:"counters,omitempty"` // every counter, with raw=true
+}
+
+// MemoryPool is the usage of a memory area
+type MemoryPool struct {
+	Used      int64 `json:"used"`
+	Committed int64 `json:"committed"`
+	Max       int64 `json:"max"`
+}
+
+// GCCollector is one garbage collector, e.g. "G1 young collection pauses"
+type GCCollector struct {
+	Name        string  `json:"name"`
+	Collections int64   `json:"collections"`
+	TimeSeconds float64 `json:"timeSeconds"`
+}
+
+// ClassCounts are the classes loaded and unloaded since the JVM started
+type ClassCounts struct {
+	Loaded   int64 `json:"loaded"`
+	Unloaded int64 `json:"unloaded"`
+}
+
+// ThreadCounts are the JVM's Java threads
+type ThreadCounts struct {
+	Live    int64 `json:"live"`
+	Daemon  int64 `json:"daemon"`
+	Peak    int64 `json:"peak"`
+	Started int64 `json:"started"` // since the JVM started
+}
+
+// SafepointCounts are the safepoints since the JVM started and the time spent in them
+type SafepointCounts struct {
+	Count       int64   `json:"count"`
+	TimeSeconds float64 `json:"timeSeconds"`
+}
+
+// jvmMetricsHandler samples the JVM's performance counters (PerfCounter.print, the counters
+// jstat reads) and returns the key ones as JSON. "raw=true" adds every counter.
+func (s *Server) jvmMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendJSON(w, http.StatusMethodNotAllowed, Response{
+			Success: false,
+			Message: "Method not allowed",
+		})
+		return
+	}
+
+	sel, err := querySelector(r)
+	if err != nil {
+		sendJSON(w, http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("Invalid request: %v", err),
+		})
+		return
+	}
+	pid, err := s.targetJVM(r.Context(), sel)
+	if err != nil {
+		sendJSON(w, http.StatusInternalServerError, Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to find Java process: %v", err),
+		})
+		return
+	}
+
+	output, err := s.runJcmd(r.Context(), nil, pid, "PerfCounter.print")
+	if err != nil {
+		sendJSON(w, commandStatus(w, err), Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to read performance counters: %v, output: %s", err, string(output)),
+		})
+		return
+	}
+	counters := parsePerfCounters(string(output))
+	if len(counters) == 0 {
+		sendJSON(w, http.StatusConflict, Response{
+			Success: false,
+			Message: "The JVM exposes no performance counters; it runs with -XX:-UsePerfData",
+		})
+		return
+	}
+
+	metrics := jvmMetricsFrom(counters)
+	metrics.PID = pid
+	if raw, _ := strconv.ParseBool(r.URL.Query().Get("raw")); raw {
+		metrics.Counters = counters
+	}
+	sendJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "JVM metrics sampled",
+		Data:    metrics,
+	})
+}
+
+// parsePerfCounters reads "name=value" lines; string values are quoted
+func parsePerfCounters(output string) map[string]string {
+	counters := map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		name, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok || !strings.Contains(name, ".") {
+			continue
+		}
+		counters[name] = strings.Trim(value, `"`)
+	}
+	return counters
+}
+
+// jvmMetricsFrom picks the key counters. Heap usage is the sum of every generation's spaces
+// (eden, survivors, old), which covers both the generational collectors and G1. G1's
+// generations share one region pool, so each reports the whole heap as its maximum.
+func jvmMetricsFrom(c map[string]string) JVMMetrics {
+	num := func(name string) int64 {
+		n, _ := strconv.ParseInt(c[name], 10, 64)
+		return n
+	}
+	frequency := float64(num("sun.os.hrt.frequency"))
+	seconds := func(name string) float64 {
+		if frequency == 0 {
+			return 0
+		}
+		return float64(num(name)) / frequency
+	}
+
+	m := JVMMetrics{
+		UptimeSeconds: seconds("sun.os.hrt.ticks"),
+		Metaspace: MemoryPool{
+			Used:      num("sun.gc.metaspace.used"),
+			Committed: num("sun.gc.metaspace.capacity"),
+			Max:       num("sun.gc.metaspace.maxCapacity"),
+		},
+		GC: []GCCollector{},
+		Classes: ClassCounts{
+			Loaded:   num("java.cls.loadedClasses") + num("sun.cls.sharedLoadedClasses"),
+			Unloaded: num("java.cls.unloadedClasses") + num("sun.cls.sharedUnloadedClasses"),
+		},
+		Threads: ThreadCounts{
+			Live:    num("java.threads.live"),
+			Daemon:  num("java.threads.daemon"),
+			Peak:    num("java.threads.livePeak"),
+			Started: num("java.threads.started"),
+		},
+		Safepoints: SafepointCounts{
+			Count:       num("sun.rt.safepoints"),
+			TimeSeconds: seconds("sun.rt.safepointTime"),
+		},
+	}
+	g1 := c["sun.gc.policy.name"] == "GarbageFirst" || strings.HasPrefix(c["sun.gc.collector.0.name"], "G1 ")
+	for g := 0; ; g++ {
+		prefix := fmt.Sprintf("sun.gc.generation.%d.", g)
+		if _, ok := c[prefix+"capacity"]; !ok {
+			break
+		}
+		m.Heap.Committed += num(prefix + "capacity")
+		if g1 {
+			m.Heap.Max = max(m.Heap.Max, num(prefix+"maxCapacity"))
+		} else {
+			m.Heap.Max += num(prefix + "maxCapacity")
+		}
+		for sp := 0; ; sp++ {
+			used, ok := c[fmt.Sprintf("%sspace.%d.used", prefix, sp)]
+			if !ok {
+				break
+			}
+			n, _ := strconv.ParseInt(used, 10, 64)
+			m.Heap.Used += n
+		}
+	}
+	for i := 0; ; i++ {
+		prefix := fmt.Sprintf("sun.gc.collector.%d.", i)
+		name, ok := c[prefix+"name"]
+		if !ok {
+			break
+		}
+		m.GC = append(m.GC, GCCollector{
+			Name:        name,
+			Collections: num(prefix + "invocations"),
+			TimeSeconds: seconds(prefix + "time"),
+		})
+	}
+	return m
+}
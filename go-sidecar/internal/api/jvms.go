@@ -0,0 +1,196 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/validation"
+)
+
+// JVMSelector picks a request's target JVM. A PID or main class narrows the JVMs of the pod (or
+// of the container, when one is named); with neither, the container's or the pod's only JVM is used.
+type JVMSelector struct {
+	Container string
+	PID       int
+	MainClass string // fully qualified or simple class name, or the jar for "java -jar"
+}
+
+// JVMInfo describes one JVM the sidecar can attach to
+type JVMInfo struct {
+	PID           int       `json:"pid"`
+	MainClass     string    `json:"mainClass,omitempty"`
+	Arguments     string    `json:"arguments,omitempty"`
+	UptimeSeconds float64   `json:"uptimeSeconds,omitempty"`
+	StartedAt     time.Time `json:"startedAt,omitzero"`
+	Error         string    `json:"error,omitempty"` // set when the JVM did not answer
+}
+
+// validPID checks an optional PID selector
+func validPID(field string, pid int) *validation.FieldError {
+	if pid < 0 {
+		return &validation.FieldError{Field: field, Message: "must be a positive process ID"}
+	}
+	return nil
+}
+
+// jvmsHandler lists the JVMs in the pod with their main class and uptime
+func (s *Server) jvmsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendJSON(w, http.StatusMethodNotAllowed, Response{
+			Success: false,
+			Message: "Method not allowed",
+		})
+		return
+	}
+
+	pids, err := s.jvm.JavaPIDs(r.Context())
+	if err != nil {
+		sendJSON(w, http.StatusInternalServerError, Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to find Java processes: %v", err),
+		})
+		return
+	}
+
+	jvms := make([]JVMInfo, 0, len(pids))
+	for _, pid := range pids {
+		jvms = append(jvms, s.describeJVM(r.Context(), pid))
+	}
+	sendJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("Found %d Java processes", len(jvms)),
+		Data:    jvms,
+	})
+}
+
+// describeJVM asks a JVM for its command line and uptime
+func (s *Server) describeJVM(ctx context.Context, pid int) JVMInfo {
+	info := JVMInfo{PID: pid}
+
+	mainClass, arguments, err := s.jvmCommand(ctx, pid)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	info.MainClass, info.Arguments = mainClass, arguments
+
+	output, err := s.jvm.Jcmd(ctx, pid, "VM.uptime")
+	if err != nil {
+		info.Error = fmt.Sprintf("VM.uptime failed: %v", err)
+		return info
+	}
+	if uptime, ok := parseUptime(string(output)); ok {
+		info.UptimeSeconds = uptime.Seconds()
+		info.StartedAt = s.clock.Now().Add(-uptime).UTC().Truncate(time.Second)
+	}
+	return info
+}
+
+// jvmCommand returns the main class (or jar) and program arguments a JVM was launched with
+func (s *Server) jvmCommand(ctx context.Context, pid int) (string, string, error) {
+	output, err := s.jvm.Jcmd(ctx, pid, "VM.command_line")
+	if err != nil {
+		return "", "", fmt.Errorf("VM.command_line failed: %v", err)
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		if command, ok := strings.CutPrefix(strings.TrimSpace(line), "java_command:"); ok {
+			mainClass, arguments, _ := strings.Cut(strings.TrimSpace(command), " ")
+			return mainClass, strings.TrimSpace(arguments), nil
+		}
+	}
+	return "", "", fmt.Errorf("no java_command in VM.command_line output")
+}
+
+// querySelector reads a JVM selector from the container, pid and mainClass query parameters
+func querySelector(r *http.Request) (JVMSelector, error) {
+	q := r.URL.Query()
+	sel := JVMSelector{Container: q.Get("container"), MainClass: q.Get("mainClass")}
+	if v := q.Get("pid"); v != "" {
+		pid, err := strconv.Atoi(v)
+		if err != nil || pid <= 0 {
+			return sel, fmt.Errorf("pid must be a positive process ID, got %q", v)
+		}
+		sel.PID = pid
+	}
+	if fe := validArgument("mainClass", sel.MainClass); fe != nil {
+		return sel, fmt.Errorf("%s: %s", fe.Field, fe.Message)
+	}
+	return sel, nil
+}
+
+// parseUptime reads VM.uptime output such as "4242:\n12.345 s"
+func parseUptime(output string) (time.Duration, bool) {
+	for _, line := range strings.Split(output, "\n") {
+		if value, ok := strings.CutSuffix(strings.TrimSpace(line), " s"); ok {
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+				return time.Duration(seconds * float64(time.Second)), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// matchesMainClass reports whether a JVM's main class is the one selected: by fully qualified
+// name, by simple class name, or by jar file name
+func matchesMainClass(mainClass, selector string) bool {
+	if mainClass == selector || path.Base(mainClass) == selector {
+		return true
+	}
+	if strings.HasSuffix(mainClass, ".jar") {
+		return false
+	}
+	return mainClass[strings.LastIndex(mainClass, ".")+1:] == selector
+}
+
+// targetJVM resolves a request's JVM selector to a PID
+func (s *Server) targetJVM(ctx context.Context, sel JVMSelector) (int, error) {
+	if sel.PID == 0 && sel.MainClass == "" {
+		return s.getJavaPID(ctx, sel.Container)
+	}
+
+	var candidates []int
+	if sel.Container != "" {
+		pid, err := s.getJavaPID(ctx, sel.Container)
+		if err != nil {
+			return 0, err
+		}
+		candidates = []int{pid}
+	} else {
+		pids, err := s.jvm.JavaPIDs(ctx)
+		if err != nil {
+			return 0, err
+		}
+		candidates = pids
+	}
+
+	if sel.PID != 0 {
+		if !slices.Contains(candidates, sel.PID) {
+			return 0, fmt.Errorf("no Java process with PID %d", sel.PID)
+		}
+		candidates = []int{sel.PID}
+	}
+
+	if sel.MainClass != "" {
+		var matching []int
+		for _, pid := range candidates {
+			if mainClass, _, err := s.jvmCommand(ctx, pid); err == nil && matchesMainClass(mainClass, sel.MainClass) {
+				matching = append(matching, pid)
+			}
+		}
+		switch len(matching) {
+		case 0:
+			return 0, fmt.Errorf("no Java process running %s", sel.MainClass)
+		case 1:
+		default:
+			return 0, fmt.Errorf("found %d Java processes running %s; specify a pid", len(matching), sel.MainClass)
+		}
+		candidates = matching
+	}
+	return candidates[0], nil
+}
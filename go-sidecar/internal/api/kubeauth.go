@@ -0,0 +1,155 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/kube"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+)
+
+// API_AUTH_MODE=kubernetes authenticates callers with their ServiceAccount token (TokenReview)
+// and authorizes each request against RBAC on the sidecar's own pod (SubjectAccessReview)
+
+// profileSubresource is the pod subresource RBAC rules grant, e.g. resources: ["pods/profile"]
+const profileSubresource = "profile"
+
+// maxReviewCache bounds the cached review decisions; the cache is cleared when it fills up
+const maxReviewCache = 1024
+
+// reviewDecision is a cached TokenReview and SubjectAccessReview outcome for one token and verb
+type reviewDecision struct {
+	user          string
+	authenticated bool
+	allowed       bool
+	reason        string
+	expires       time.Time
+}
+
+// kubeAuthEnabled reports whether API_AUTH_MODE selects Kubernetes review
+func (o Options) kubeAuthEnabled() bool {
+	return strings.EqualFold(o.AuthMode, "kubernetes")
+}
+
+// reviewVerb maps a request to the RBAC verb checked on pods/profile: reads are "get",
+// deleting a file is "delete", and every other mutating request (starting or stopping recordings) is "create"
+func reviewVerb(r *http.Request) string {
+	switch {
+	case !mutating(r):
+		return "get"
+	case r.Method == http.MethodDelete, r.URL.Path == "/delete":
+		return "delete"
+	}
+	return "create"
+}
+
+// reviewAudiences parses API_AUTH_AUDIENCES, a comma-separated list
+func (s *Server) reviewAudiences() []string {
+	var audiences []string
+	for _, a := range strings.Split(s.opts.AuthAudiences, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			audiences = append(audiences, a)
+		}
+	}
+	return audiences
+}
+
+// reviewRequests authenticates every request except /health and /metrics with TokenReview and
+// authorizes it with SubjectAccessReview. Unknown tokens get 401, denied requests 403, and an
+// unreachable API server 503. Decisions are cached for API_AUTH_CACHE_TTL.
+func (s *Server) reviewRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.reviewer == nil || probePath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="profiler-sidecar"`)
+			sendJSON(w, http.StatusUnauthorized, Response{
+				Success: false,
+				Message: "A Kubernetes ServiceAccount bearer token is required",
+			})
+			return
+		}
+
+		verb := reviewVerb(r)
+		decision, err := s.review(r.Context(), token, verb)
+		if err != nil {
+			logger.Log.WithError(err).Error("Kubernetes access review failed")
+			sendJSON(w, http.StatusServiceUnavailable, Response{
+				Success: false,
+				Message: "Unable to verify credentials with the Kubernetes API",
+			})
+			return
+		}
+		if !decision.authenticated {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="profiler-sidecar", error="invalid_token"`)
+			sendJSON(w, http.StatusUnauthorized, Response{
+				Success: false,
+				Message: "The bearer token was not accepted by the Kubernetes API",
+			})
+			return
+		}
+		setCaller(r.Context(), decision.user)
+		if !decision.allowed {
+			logger.Log.WithFields(map[string]any{
+				"user":   decision.user,
+				"verb":   verb,
+				"path":   r.URL.Path,
+				"reason": decision.reason,
+			}).Warn("API request denied by RBAC")
+			sendJSON(w, http.StatusForbidden, Response{
+				Success: false,
+				Message: decision.user + " may not " + verb + " pods/" + profileSubresource + " on this pod",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// review returns the cached decision for token and verb, asking the API server when there is none
+func (s *Server) review(ctx context.Context, token, verb string) (reviewDecision, error) {
+	sum := sha256.Sum256([]byte(token))
+	key := string(sum[:]) + verb
+	now := s.clock.Now()
+
+	s.reviewMu.Lock()
+	decision, ok := s.reviews[key]
+	s.reviewMu.Unlock()
+	if ok && now.Before(decision.expires) {
+		return decision, nil
+	}
+
+	user, authenticated, err := s.reviewer.ReviewToken(ctx, token, s.reviewAudiences())
+	if err != nil {
+		return reviewDecision{}, err
+	}
+	decision = reviewDecision{user: user.Username, authenticated: authenticated, expires: now.Add(s.opts.AuthCacheTTL)}
+	if authenticated {
+		decision.allowed, decision.reason, err = s.reviewer.ReviewAccess(ctx, user, kube.ResourceAttributes{
+			Namespace:   kube.Namespace(),
+			Verb:        verb,
+			Resource:    "pods",
+			Subresource: profileSubresource,
+			Name:        os.Getenv("POD_NAME"),
+		})
+		if err != nil {
+			return reviewDecision{}, err
+		}
+	}
+
+	s.reviewMu.Lock()
+	if len(s.reviews) >= maxReviewCache {
+		clear(s.reviews)
+	}
+	s.reviews[key] = decision
+	s.reviewMu.Unlock()
+	return decision, nil
+}
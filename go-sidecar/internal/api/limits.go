@@ -0,0 +1,123 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/config"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/validation"
+)
+
+// recordingMinSize is the smallest useful maxSize; JFR rotates whole chunks, which are rarely
+// smaller than this
+const recordingMinSize = 1 << 20
+
+// limitedRequest is a request that is also checked against the limits the server was started
+// with. decodeRequest checks them once the request's own Validate passed.
+type limitedRequest interface {
+	validLimits(s *Server) validation.Errors
+}
+
+// validRecordingDuration checks an optional recording duration such as "90s" or "1h30m" of at
+// least a second
+func validRecordingDuration(field, value string) *validation.FieldError {
+	if err := validDuration(field, value); err != nil || value == "" {
+		return err
+	}
+	if d, _ := time.ParseDuration(value); d < time.Second {
+		return &validation.FieldError{Field: field, Message: "must be at least 1s"}
+	}
+	return nil
+}
+
+// validDurationLimit checks a valid recording duration against RECORDING_MAX_DURATION (0 disables
+// the cap)
+func (s *Server) validDurationLimit(field, value string) *validation.FieldError {
+	limit := s.opts.RecordingMaxDuration
+	if value == "" || limit <= 0 {
+		return nil
+	}
+	if d, _ := time.ParseDuration(value); d > limit {
+		return &validation.FieldError{Field: field, Message: fmt.Sprintf("may be at most %s (RECORDING_MAX_DURATION)", limit)}
+	}
+	return nil
+}
+
+// jfrDuration formats a validated duration for JFR.start and JFR.dump's begin, which take one
+// number and unit, so "1h30m" becomes "5400s". Fractions of a second are rounded up.
+func jfrDuration(value string) string {
+	d, _ := time.ParseDuration(value)
+	return fmt.Sprintf("%ds", int64(math.Ceil(d.Seconds())))
+}
+
+// validMaxSize checks an optional size such as "256Mi" of at least 1Mi
+func validMaxSize(field, value string) *validation.FieldError {
+	if value == "" {
+		return nil
+	}
+	size, err := config.ParseSize(value)
+	switch {
+	case err != nil:
+		return &validation.FieldError{Field: field, Message: fmt.Sprintf("must be a size such as \"256Mi\", got %q", value)}
+	case size < recordingMinSize:
+		return &validation.FieldError{Field: field, Message: "must be at least 1Mi"}
+	}
+	return nil
+}
+
+// validSizeLimit checks a valid maxSize against RECORDING_MAX_SIZE_LIMIT
+func (s *Server) validSizeLimit(field, value string) *validation.FieldError {
+	if value == "" {
+		return nil
+	}
+	if size, _ := config.ParseSize(value); size > s.opts.RecordingMaxSizeLimit {
+		return &validation.FieldError{Field: field, Message: fmt.Sprintf("may be at most %d bytes (RECORDING_MAX_SIZE_LIMIT)", s.opts.RecordingMaxSizeLimit)}
+	}
+	return nil
+}
+
+// validAgeLimit checks a valid maxAge against RECORDING_MAX_AGE_LIMIT
+func (s *Server) validAgeLimit(field, value string) *validation.FieldError {
+	if value == "" {
+		return nil
+	}
+	if d, _ := time.ParseDuration(value); d > s.opts.RecordingMaxAgeLimit {
+		return &validation.FieldError{Field: field, Message: fmt.Sprintf("may be at most %s (RECORDING_MAX_AGE_LIMIT)", s.opts.RecordingMaxAgeLimit)}
+	}
+	return nil
+}
+
+// retentionArgs returns the JFR.start options for a request's maxSize and maxAge. JFR takes the
+// size in bytes and the age in whole seconds.
+func retentionArgs(req ProfileRequest) []string {
+	var args []string
+	if req.MaxSize != "" {
+		size, _ := config.ParseSize(req.MaxSize)
+		args = append(args, fmt.Sprintf("maxsize=%d", size))
+	}
+	if req.MaxAge != "" {
+		age, _ := time.ParseDuration(req.MaxAge)
+		args = append(args, fmt.Sprintf("maxage=%ds", int64(math.Ceil(age.Seconds()))))
+	}
+	return args
+}
+
+// rejectIfMaxSizeExceedsVolume responds 507 when a recording's maxSize cannot fit in the free
+// space of the profile volume
+func (s *Server) rejectIfMaxSizeExceedsVolume(w http.ResponseWriter, req ProfileRequest) bool {
+	if req.MaxSize == "" {
+		return false
+	}
+	size, _ := config.ParseSize(req.MaxSize)
+	free, err := s.fs.FreeSpace(s.cfg.ProfileDir)
+	if err != nil || size <= free {
+		return false
+	}
+	sendJSON(w, http.StatusInsufficientStorage, Response{
+		Success: false,
+		Message: fmt.Sprintf("maxSize %s exceeds the %d bytes free on the profile volume", req.MaxSize, free),
+	})
+	return true
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/recmeta"
+)
+
+// ProfileFile is one recording in the /list response
+type ProfileFile struct {
+	Name     string            `json:"name"`
+	Path     string            `json:"path"`
+	Size     int64             `json:"size"`
+	Modified string            `json:"modified"` // RFC 3339
+	Metadata *recmeta.Metadata `json:"metadata,omitempty"`
+
+	modTime time.Time // for sorting and filtering; Modified has one-second precision
+}
+
+// profileListing is an encoded /list response with its validators
+type profileListing struct {
+	body     []byte
+	etag     string
+	modified time.Time            // newest file or directory mtime, for Last-Modified
+	dirs     map[string]time.Time // directory mtimes the listing was built from
+	built    time.Time
+	files    []ProfileFile // in walk order, for pages of the listing
+}
+
+// profileListing returns the listing for root, walking the directory only when it may have changed
+func (s *Server) profileListing(root string) (*profileListing, error) {
+	s.listingMu.Lock()
+	cached := s.listings[root]
+	s.listingMu.Unlock()
+	if cached != nil && s.clock.Now().Sub(cached.built) < s.opts.ListCacheMaxAge && s.unchanged(cached) {
+		return cached, nil
+	}
+
+	listing, err := s.buildListing(root)
+	if err != nil {
+		return nil, err
+	}
+	s.listingMu.Lock()
+	s.listings[root] = listing
+	s.listingMu.Unlock()
+	return listing, nil
+}
+
+// unchanged reports whether every directory of a listing still has the mtime it was built with
+func (s *Server) unchanged(l *profileListing) bool {
+	for dir, mtime := range l.dirs {
+		info, err := s.fs.Stat(dir)
+		if err != nil || !info.ModTime().Equal(mtime) {
+			return false
+		}
+	}
+	return true
+}
+
+// buildListing walks root and encodes the /list response
+func (s *Server) buildListing(root string) (*profileListing, error) {
+	listing := &profileListing{dirs: map[string]time.Time{}, built: s.clock.Now()}
+	files := []ProfileFile{}
+
+	err := s.fs.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			listing.dirs[path] = info.ModTime()
+			if info.ModTime().After(listing.modified) {
+				listing.modified = info.ModTime()
+			}
+			return nil
+		}
+		if isRecordingFile(d.Name()) && !strings.HasPrefix(d.Name(), ".") {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			files = append(files, ProfileFile{
+				Name:     d.Name(),
+				Path:     path,
+				Size:     info.Size(),
+				Modified: info.ModTime().Format(time.RFC3339),
+				Metadata: s.readRecordingMetadata(path),
+				modTime:  info.ModTime(),
+			})
+			if info.ModTime().After(listing.modified) {
+				listing.modified = info.ModTime()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	listing.files = files
+	if err := listing.encode(fmt.Sprintf("Found %d profile files", len(files)), files); err != nil {
+		return nil, err
+	}
+	return listing, nil
+}
+
+// encode sets the listing's body and the ETag derived from it
+func (l *profileListing) encode(message string, data any) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(Response{
+		Success: true,
+		Message: message,
+		Data:    data,
+	}); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	l.body = buf.Bytes()
+	l.etag = `"` + hex.EncodeToString(sum[:12]) + `"`
+	return nil
+}
+
+// serve writes the listing, or 304 Not Modified when the request's validators still match
+func (l *profileListing) serve(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("ETag", l.etag)
+	if !l.modified.IsZero() {
+		w.Header().Set("Last-Modified", l.modified.UTC().Format(http.TimeFormat))
+	}
+	// Clients may keep the listing but must revalidate it on every poll
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if l.notModified(r) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(l.body)
+}
+
+// notModified evaluates If-None-Match, falling back to If-Modified-Since as RFC 9110 requires
+func (l *profileListing) notModified(r *http.Request) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == l.etag {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !l.modified.IsZero() {
+		since, err := http.ParseTime(ims)
+		// Last-Modified has one-second precision
+		return err == nil && !l.modified.Truncate(time.Second).After(since)
+	}
+	return false
+}
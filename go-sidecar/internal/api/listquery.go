@@ -0,0 +1,193 @@
+package api
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultListLimit and maxListLimit bound a page of /list; a listing without limit, offset or
+// pageToken is returned whole, as before pagination
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// listSorts are the sort keys of /list; without one files are in path order
+var listSorts = []string{"name", "mtime", "size"}
+
+// ProfilePage is the /list response when a page was asked for
+type ProfilePage struct {
+	Files         []ProfileFile `json:"files"`
+	Total         int           `json:"total"`                   // files matching the filters, on all pages
+	NextPageToken string        `json:"nextPageToken,omitempty"` // empty on the last page
+}
+
+// listQuery is the filtering, sorting and pagination of a /list request
+type listQuery struct {
+	prefix string    // of the path relative to the recording directory
+	since  time.Time // files modified at or after
+	sort   string    // one of listSorts, or "" for path order
+	desc   bool
+	paged  bool
+	limit  int
+	offset int
+	cursor *listCursor // resume after this file, from pageToken
+}
+
+// listCursor is the last file of a page, decoded from the next page's token. Resuming after a
+// file rather than at an offset keeps pages from skipping or repeating files when recordings
+// are written or deleted between requests.
+type listCursor struct {
+	Sort     string `json:"s,omitempty"`
+	Path     string `json:"p"`
+	Size     int64  `json:"z,omitempty"`
+	Modified int64  `json:"m,omitempty"` // Unix nanoseconds
+}
+
+// parseListQuery reads prefix, since (RFC 3339 or a duration before now), sort (name, mtime or
+// size, "-" first for descending), limit, and offset or pageToken
+func parseListQuery(values url.Values, now time.Time) (listQuery, error) {
+	q := listQuery{prefix: values.Get("prefix"), limit: defaultListLimit}
+
+	if v := values.Get("since"); v != "" {
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			q.since = t
+		} else if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			q.since = now.Add(-d)
+		} else {
+			return q, fmt.Errorf("since must be an RFC 3339 time or a duration such as 24h, got %q", v)
+		}
+	}
+
+	if v := values.Get("sort"); v != "" {
+		q.sort, q.desc = strings.CutPrefix(v, "-")
+		if !slices.Contains(listSorts, q.sort) {
+			return q, fmt.Errorf("sort must be one of %s, optionally prefixed with '-', got %q", strings.Join(listSorts, ", "), v)
+		}
+	}
+
+	if v := values.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxListLimit {
+			return q, fmt.Errorf("limit must be between 1 and %d, got %q", maxListLimit, v)
+		}
+		q.limit, q.paged = n, true
+	}
+
+	offset, token := values.Get("offset"), values.Get("pageToken")
+	switch {
+	case offset != "" && token != "":
+		return q, fmt.Errorf("offset and pageToken are exclusive")
+	case offset != "":
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			return q, fmt.Errorf("offset must be a non-negative number, got %q", offset)
+		}
+		q.offset, q.paged = n, true
+	case token != "":
+		cursor, err := decodeListCursor(token)
+		if err != nil {
+			return q, err
+		}
+		if cursor.Sort != values.Get("sort") {
+			return q, fmt.Errorf("pageToken belongs to a listing with sort=%q; send the same sort", cursor.Sort)
+		}
+		q.cursor, q.paged = cursor, true
+	}
+	return q, nil
+}
+
+// isZero reports whether the query leaves the listing as it is
+func (q listQuery) isZero() bool {
+	return q.prefix == "" && q.since.IsZero() && q.sort == "" && !q.paged
+}
+
+// compare orders files by the query's sort key, then by path so the order is total
+func (q listQuery) compare(a, b ProfileFile) int {
+	var c int
+	switch q.sort {
+	case "name":
+		c = strings.Compare(a.Name, b.Name)
+	case "mtime":
+		c = a.modTime.Compare(b.modTime)
+	case "size":
+		c = cmp.Compare(a.Size, b.Size)
+	}
+	if c == 0 {
+		c = strings.Compare(a.Path, b.Path)
+	}
+	if q.desc {
+		return -c
+	}
+	return c
+}
+
+// page filters and sorts the listing of root and cuts the page the query asks for
+func (l *profileListing) page(root string, q listQuery) (*profileListing, error) {
+	files := []ProfileFile{}
+	for _, file := range l.files {
+		rel, err := filepath.Rel(root, file.Path)
+		if err != nil || !strings.HasPrefix(filepath.ToSlash(rel), q.prefix) || file.modTime.Before(q.since) {
+			continue
+		}
+		files = append(files, file)
+	}
+	slices.SortStableFunc(files, q.compare)
+
+	page := &profileListing{modified: l.modified}
+	if !q.paged {
+		return page, page.encode(fmt.Sprintf("Found %d profile files", len(files)), files)
+	}
+
+	start := min(q.offset, len(files))
+	if q.cursor != nil {
+		after := q.cursor.file()
+		start, _ = slices.BinarySearchFunc(files, after, q.compare)
+		if start < len(files) && q.compare(files[start], after) == 0 {
+			start++
+		}
+	}
+	end := min(start+q.limit, len(files))
+	result := ProfilePage{Files: files[start:end], Total: len(files)}
+	if end < len(files) {
+		result.NextPageToken = encodeListCursor(q, files[end-1])
+	}
+	message := fmt.Sprintf("Found %d profile files, showing %d", len(files), end-start)
+	return page, page.encode(message, result)
+}
+
+// file returns the cursor as a file to compare listed files with
+func (c *listCursor) file() ProfileFile {
+	return ProfileFile{Name: filepath.Base(c.Path), Path: c.Path, Size: c.Size, modTime: time.Unix(0, c.Modified)}
+}
+
+// encodeListCursor returns the token of the page after file
+func encodeListCursor(q listQuery, file ProfileFile) string {
+	sort := q.sort
+	if q.desc {
+		sort = "-" + sort
+	}
+	data, _ := json.Marshal(listCursor{Sort: sort, Path: file.Path, Size: file.Size, Modified: file.modTime.UnixNano()})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeListCursor reads a pageToken
+func decodeListCursor(token string) (*listCursor, error) {
+	var cursor listCursor
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err == nil {
+		err = json.Unmarshal(data, &cursor)
+	}
+	if err != nil || cursor.Path == "" {
+		return nil, fmt.Errorf("invalid pageToken %q", token)
+	}
+	return &cursor, nil
+}
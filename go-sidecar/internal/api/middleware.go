@@ -0,0 +1,292 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/metrics"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/requestid"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// middleware wraps a handler with cross-cutting behaviour
+type middleware func(http.Handler) http.Handler
+
+// chain applies middlewares to h; the first middleware is the outermost
+func chain(h http.Handler, mws ...middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// Handler builds the sidecar API router with every route behind the same middleware chain.
+// The versioned API lives under /v1 and routes on method and path; the unversioned paths it
+// replaced stay registered as aliases so existing clients, probes and scripts keep working.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/recordings", s.limitProfiling(s.createProfileHandler))
+	mux.HandleFunc("GET /v1/recordings", s.listProfilesHandler)
+	mux.HandleFunc("GET /v1/recordings/{name...}", s.downloadHandler)
+	mux.HandleFunc("DELETE /v1/recordings/{name...}", s.deleteProfileHandler)
+	mux.HandleFunc("POST /v1/recordings/{name}/stop", s.stopProfileHandler)
+	mux.HandleFunc("POST /v1/recordings/{name}/dump", s.limitProfiling(s.dumpProfileHandler))
+	mux.HandleFunc("GET /v1/recordings/{name}/transcript", s.transcriptHandler)
+	mux.HandleFunc("GET /v1/recordings/{name}/analysis", s.analyzeHandler)
+	mux.HandleFunc("POST /v1/recordings/stop-all", s.stopAllHandler)
+	mux.HandleFunc("GET /v1/running", s.listRunningJFRHandler)
+	mux.HandleFunc("GET /v1/disk", s.diskHandler)
+	mux.HandleFunc("GET /v1/jvms", s.jvmsHandler)
+	mux.HandleFunc("GET /v1/jobs/{id}", s.jobHandler)
+	mux.HandleFunc("POST /v1/rollouts", s.rolloutHandler)
+	mux.HandleFunc("POST /v1/native-profiles", s.limitProfiling(s.nativeProfileHandler))
+	mux.HandleFunc("GET /v1/remote-recordings", s.remoteListHandler)
+	mux.HandleFunc("POST /v1/estimates", s.limitProfiling(s.estimateHandler))
+	mux.HandleFunc("POST /v1/heap-dumps", s.limitProfiling(s.heapDumpHandler))
+	mux.HandleFunc("GET /v1/thread-dumps", s.threadDumpHandler)
+	mux.HandleFunc("POST /v1/thread-dumps", s.threadDumpHandler)
+	mux.HandleFunc("GET /v1/class-histogram", s.classHistogramHandler)
+	mux.HandleFunc("GET /v1/native-memory", s.nativeMemoryHandler)
+	mux.HandleFunc("GET /v1/jvm/flags", s.vmFlagsHandler)
+	mux.HandleFunc("GET /v1/jvm/info", s.vmInfoHandler)
+	mux.HandleFunc("GET /v1/jvm/system-properties", s.systemPropertiesHandler)
+	mux.HandleFunc("GET /v1/jvm/metrics", s.jvmMetricsHandler)
+	mux.HandleFunc("GET /v1/livez", s.livezHandler)
+	mux.HandleFunc("GET /v1/readyz", s.readyzHandler)
+	mux.HandleFunc("GET /v1/health", s.livezHandler)
+	mux.HandleFunc("GET /v1/version", s.versionHandler)
+	mux.HandleFunc("GET /v1/openapi.json", s.openAPIHandler)
+	mux.HandleFunc("GET /v1/events", s.eventsHandler)
+	mux.HandleFunc("POST /v1/schedules", s.createScheduleHandler)
+	mux.HandleFunc("GET /v1/schedules", s.listSchedulesHandler)
+	mux.HandleFunc("GET /v1/schedules/{id}", s.getScheduleHandler)
+	mux.HandleFunc("PUT /v1/schedules/{id}", s.updateScheduleHandler)
+	mux.HandleFunc("DELETE /v1/schedules/{id}", s.deleteScheduleHandler)
+	mux.HandleFunc("GET /v1/presets", s.presetsHandler)
+	mux.HandleFunc("GET /v1/continuous", s.continuousHandler)
+	mux.HandleFunc("PUT /v1/continuous", s.continuousHandler)
+	mux.HandleFunc("GET /v1/triggers", s.triggersHandler)
+
+	// Legacy aliases
+	mux.HandleFunc("/create", s.limitProfiling(s.createProfileHandler))
+	mux.HandleFunc("/stop", s.stopProfileHandler)
+	mux.HandleFunc("/stop-all", s.stopAllHandler)
+	mux.HandleFunc("/dump", s.limitProfiling(s.dumpProfileHandler))
+	mux.HandleFunc("/list", s.listProfilesHandler)
+	mux.HandleFunc("/download", s.downloadHandler)
+	mux.HandleFunc("/analyze", s.analyzeHandler)
+	mux.HandleFunc("/delete", s.deleteProfileHandler)
+	mux.HandleFunc("/running", s.listRunningJFRHandler)
+	mux.HandleFunc("/disk", s.diskHandler)
+	mux.HandleFunc("/jvms", s.jvmsHandler)
+	mux.HandleFunc("/livez", s.livezHandler)
+	mux.HandleFunc("/readyz", s.readyzHandler)
+	mux.HandleFunc("/health", s.livezHandler)
+	mux.HandleFunc("/version", s.versionHandler)
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("GET /recordings/{name}/transcript", s.transcriptHandler)
+	mux.HandleFunc("GET /jobs/{id}", s.jobHandler)
+	mux.HandleFunc("/rollouts", s.rolloutHandler)
+	mux.HandleFunc("/native-profile", s.limitProfiling(s.nativeProfileHandler))
+	mux.HandleFunc("/remote-list", s.remoteListHandler)
+	mux.HandleFunc("/estimate", s.limitProfiling(s.estimateHandler))
+	mux.HandleFunc("/heapdump", s.limitProfiling(s.heapDumpHandler))
+	mux.HandleFunc("/threaddump", s.threadDumpHandler)
+	mux.HandleFunc("/classhistogram", s.classHistogramHandler)
+	mux.HandleFunc("/nmt", s.nativeMemoryHandler)
+	mux.HandleFunc("/vm-flags", s.vmFlagsHandler)
+	mux.HandleFunc("/vm-info", s.vmInfoHandler)
+	mux.HandleFunc("/system-properties", s.systemPropertiesHandler)
+	mux.HandleFunc("/jvm-metrics", s.jvmMetricsHandler)
+	mux.HandleFunc("GET /openapi.json", s.openAPIHandler)
+	mux.HandleFunc("GET /events", s.eventsHandler)
+	mux.HandleFunc("POST /schedules", s.createScheduleHandler)
+	mux.HandleFunc("GET /schedules", s.listSchedulesHandler)
+	mux.HandleFunc("GET /schedules/{id}", s.getScheduleHandler)
+	mux.HandleFunc("PUT /schedules/{id}", s.updateScheduleHandler)
+	mux.HandleFunc("DELETE /schedules/{id}", s.deleteScheduleHandler)
+	mux.HandleFunc("GET /presets", s.presetsHandler)
+	mux.HandleFunc("GET /continuous", s.continuousHandler)
+	mux.HandleFunc("PUT /continuous", s.continuousHandler)
+	mux.HandleFunc("GET /triggers", s.triggersHandler)
+
+	return chain(mux,
+		assignRequestIDs,
+		traceRequests,
+		logRequests,
+		recoverPanics,
+		s.requireClientCert,
+		s.reviewRequests,
+		s.requireToken,
+		s.identifyTenant,
+		measureRequests,
+	)
+}
+
+// statusRecorder captures the status code and body size written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer (flushing, deadlines)
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// recordStatus returns a recorder for w, reusing one installed by an outer middleware
+func recordStatus(w http.ResponseWriter) *statusRecorder {
+	if rec, ok := w.(*statusRecorder); ok {
+		return rec
+	}
+	return &statusRecorder{ResponseWriter: w}
+}
+
+// assignRequestIDs propagates the caller's X-Request-ID, or generates one, and echoes it on the
+// response. Log entries written with the request's context carry it as request_id.
+func assignRequestIDs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := requestid.FromHeader(r.Header.Get(requestid.Header))
+		w.Header().Set(requestid.Header, id)
+		next.ServeHTTP(w, r.WithContext(requestid.WithID(r.Context(), id)))
+	})
+}
+
+// probePath reports whether a path serves liveness or readiness probes or metric scrapes. These skip
+// authentication and are logged at debug level.
+func probePath(path string) bool {
+	switch path {
+	case "/livez", "/readyz", "/health", "/v1/livez", "/v1/readyz", "/v1/health", "/metrics":
+		return true
+	}
+	return false
+}
+
+// callerKey carries the name the access log reports for the caller; authentication middleware
+// fills it in once the caller is known
+type callerKey struct{}
+
+// setCaller records who made the request, for the access log
+func setCaller(ctx context.Context, name string) {
+	if caller, ok := ctx.Value(callerKey{}).(*string); ok {
+		*caller = name
+	}
+}
+
+// traceRequests extracts incoming trace context and wraps each request in a server span
+func traceRequests(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "api", otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		return r.Method + " " + r.URL.Path
+	}))
+}
+
+// recoverPanics turns a handler panic into a 500 instead of crashing the sidecar
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := recordStatus(w)
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				// Deliberate abort: let net/http close the connection quietly
+				panic(p)
+			}
+
+			metrics.APIPanicsTotal.Inc()
+			logger.Log.WithContext(r.Context()).WithFields(map[string]interface{}{
+				"method": r.Method,
+				"path":   r.URL.Path,
+				"panic":  fmt.Sprint(p),
+				"stack":  string(debug.Stack()),
+			}).Error("Recovered from panic in API handler")
+
+			// Headers may already be on the wire; only send an error body if not
+			if rec.status == 0 {
+				sendJSON(rec, http.StatusInternalServerError, Response{
+					Success: false,
+					Message: "Internal server error",
+				})
+			}
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// logRequests writes an access log entry for each request: method, path, status, latency and
+// caller (the tenant or Kubernetes user when authenticated, otherwise the client address). Probe
+// and scrape requests are logged at debug level.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := recordStatus(w)
+		start := time.Now()
+		caller := r.RemoteAddr
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			caller = host
+		}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), callerKey{}, &caller)))
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		entry := logger.Log.WithContext(r.Context()).WithFields(map[string]interface{}{
+			"method":   r.Method,
+			"path":     r.URL.Path,
+			"status":   status,
+			"bytes":    rec.bytes,
+			"duration": time.Since(start).String(),
+			"caller":   caller,
+		})
+		if probePath(r.URL.Path) {
+			entry.Debug("Handled request")
+			return
+		}
+		entry.Info("Handled request")
+	})
+}
+
+// measureRequests records request counts and latency per route
+func measureRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := recordStatus(w)
+		start := time.Now()
+		next.ServeHTTP(rec, r)
+
+		// r.Pattern is set by the mux on the request it routed, which is this one
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		metrics.APIRequestsTotal.WithLabelValues(route, r.Method, strconv.Itoa(status)).Inc()
+		metrics.APIRequestDuration.WithLabelValues(route).Observe(time.Since(start).Seconds())
+	})
+}
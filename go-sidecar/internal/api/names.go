@@ -0,0 +1,25 @@
+package api
+
+import (
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+)
+
+// defaultNameTimestampLayout is RFC3339 with milliseconds, so two recordings created within the
+// same second still get distinct names
+const defaultNameTimestampLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// nameLocation returns the timezone of generated names (RECORDING_TIMEZONE: "Local", "UTC" or an
+// IANA name), falling back to local time when tz is empty or unknown
+func nameLocation(tz string) *time.Location {
+	if tz == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		logger.Log.WithError(err).WithField("timezone", tz).Warn("Invalid RECORDING_TIMEZONE, using local time")
+		return time.Local
+	}
+	return loc
+}
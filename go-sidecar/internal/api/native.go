@@ -0,0 +1,207 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/events"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/validation"
+)
+
+const (
+	defaultNativeDuration = "30s"
+	maxNativeDuration     = 10 * time.Minute
+	defaultPerfFrequency  = 99
+)
+
+// NativeProfileRequest asks for a native-level CPU profile, covering JNI and native library frames
+type NativeProfileRequest struct {
+	Engine    string `json:"engine"`              // "async-profiler" (default) or "perf"
+	Duration  string `json:"duration"`            // e.g. "30s"
+	Event     string `json:"event,omitempty"`     // async-profiler event, defaults to "cpu"
+	Name      string `json:"name,omitempty"`      // output file stem
+	Container string `json:"container,omitempty"` // target container when the pod runs several JVMs
+}
+
+// Validate applies defaults and checks the engine and duration
+func (req *NativeProfileRequest) Validate() validation.Errors {
+	if req.Engine == "" {
+		req.Engine = "async-profiler"
+	}
+	if req.Duration == "" {
+		req.Duration = defaultNativeDuration
+	}
+	if req.Event == "" {
+		req.Event = "cpu"
+	}
+
+	errs := validation.Collect(
+		validation.OneOf("engine", req.Engine, "async-profiler", "perf"),
+		validArgument("event", req.Event),
+		validRecordingName("name", req.Name),
+	)
+	if d, err := time.ParseDuration(req.Duration); err != nil || d < time.Second || d > maxNativeDuration {
+		errs = append(errs, validation.FieldError{Field: "duration", Message: fmt.Sprintf("must be a duration between 1s and %s", maxNativeDuration)})
+	}
+	return errs
+}
+
+// nativeProfileHandler captures a native profile in the background. async-profiler writes
+// collapsed stacks ({name}.collapsed); perf writes {name}.perf.data plus the JIT symbol map
+// ({name}.perf.map). Files appear in the profile directory only once complete.
+func (s *Server) nativeProfileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendJSON(w, http.StatusMethodNotAllowed, Response{
+			Success: false,
+			Message: "Method not allowed",
+		})
+		return
+	}
+
+	var req NativeProfileRequest
+	if !s.decodeRequest(w, r, &req) {
+		return
+	}
+
+	if s.rejectIfOverQuota(w) {
+		return
+	}
+
+	duration, _ := time.ParseDuration(req.Duration)
+	if req.Name == "" {
+		req.Name = fmt.Sprintf("native_%s", s.timestampSuffix(s.clock.Now()))
+	}
+
+	pid, err := s.getJavaPID(r.Context(), req.Container)
+	if err != nil {
+		sendJSON(w, http.StatusInternalServerError, Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to find Java process: %v", err),
+		})
+		return
+	}
+
+	dir, err := s.recordingDir(r.Context())
+	if err != nil {
+		sendJSON(w, http.StatusInternalServerError, Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to prepare output directory: %v", err),
+		})
+		return
+	}
+
+	var filename string
+	var capture func(context.Context) error
+	switch req.Engine {
+	case "async-profiler":
+		filename = req.Name + ".collapsed"
+		capture = func(ctx context.Context) error {
+			return s.captureAsyncProfiler(ctx, pid, duration, req.Event, filepath.Join(dir, filename))
+		}
+	case "perf":
+		filename = req.Name + ".perf.data"
+		capture = func(ctx context.Context) error {
+			return s.capturePerf(ctx, pid, duration, filepath.Join(dir, filename))
+		}
+	}
+
+	// The profile outlives the request; keep the trace context but not its cancellation
+	ctx := context.WithoutCancel(r.Context())
+	go func() {
+		log := logger.Log.WithContext(ctx).WithField("name", req.Name).WithField("engine", req.Engine)
+		if err := capture(ctx); err != nil {
+			log.WithError(err).Error("Native profile failed")
+			return
+		}
+		log.WithField("filename", filename).Info("Native profile completed")
+		s.markComplete(filepath.Join(dir, filename))
+		events.Publish(events.FileFlushed, map[string]any{
+			"pid":  pid,
+			"kind": "native",
+			"path": filepath.Join(dir, filename),
+		})
+	}()
+
+	sendJSON(w, http.StatusAccepted, Response{
+		Success: true,
+		Message: "Native profiling started",
+		Data: map[string]string{
+			"pid":      strconv.Itoa(pid),
+			"engine":   req.Engine,
+			"duration": req.Duration,
+			"filename": filename,
+		},
+	})
+}
+
+// captureAsyncProfiler runs async-profiler for the duration and writes collapsed stacks
+func (s *Server) captureAsyncProfiler(ctx context.Context, pid int, duration time.Duration, event, outputPath string) error {
+	tmpPath := hiddenPath(outputPath)
+	output, err := s.runner.Run(withCommandTimeout(ctx, duration+s.opts.CommandTimeout), s.opts.AsyncProfilerPath,
+		"-d", strconv.Itoa(int(duration.Seconds())),
+		"-e", event,
+		"--cstack", "vm",
+		"-o", "collapsed",
+		"-f", tmpPath,
+		strconv.Itoa(pid))
+	if err != nil {
+		s.fs.Remove(tmpPath)
+		return fmt.Errorf("async-profiler failed: %v, output: %s", err, string(output))
+	}
+	return s.fs.Rename(tmpPath, outputPath)
+}
+
+// capturePerf records with perf, then saves the JVM's perf map alongside so JIT frames can be
+// symbolized offline. The map is read through /proc/<pid>/root (requires a shared PID namespace).
+func (s *Server) capturePerf(ctx context.Context, pid int, duration time.Duration, outputPath string) error {
+	tmpPath := hiddenPath(outputPath)
+	output, err := s.runner.Run(withCommandTimeout(ctx, duration+s.opts.CommandTimeout), s.opts.PerfPath, "record",
+		"-F", strconv.Itoa(defaultPerfFrequency),
+		"-g",
+		"-p", strconv.Itoa(pid),
+		"-o", tmpPath,
+		"--", "sleep", strconv.Itoa(int(duration.Seconds())))
+	if err != nil {
+		s.fs.Remove(tmpPath)
+		return fmt.Errorf("perf record failed: %v, output: %s", err, string(output))
+	}
+
+	mapPath := outputPathWithExt(outputPath, ".perf.data", ".perf.map")
+	if output, err := s.runner.Run(ctx, s.opts.PerfMapAgentPath, strconv.Itoa(pid)); err != nil {
+		logger.Log.WithError(err).WithField("output", string(output)).Warn("perf-map-agent failed; JIT frames will be unresolved")
+	} else if err := s.copyFile(fmt.Sprintf("/proc/%d/root/tmp/perf-%d.map", pid, pid), mapPath); err != nil {
+		logger.Log.WithError(err).Warn("Failed to copy perf map")
+	} else {
+		s.markComplete(mapPath)
+	}
+
+	return s.fs.Rename(tmpPath, outputPath)
+}
+
+// hiddenPath returns a dot-prefixed sibling path, ignored by the daemon until renamed
+func hiddenPath(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path))
+}
+
+// outputPathWithExt swaps a known extension on path
+func outputPathWithExt(path, oldExt, newExt string) string {
+	return path[:len(path)-len(oldExt)] + newExt
+}
+
+// copyFile copies src to dst via a hidden temporary file
+func (s *Server) copyFile(src, dst string) error {
+	data, err := s.fs.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	tmp := hiddenPath(dst)
+	if err := s.fs.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return s.fs.Rename(tmp, dst)
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// NativeMemory is parsed VM.native_memory summary output. Sizes are in bytes.
+type NativeMemory struct {
+	PID        int              `json:"pid"`
+	Reserved   int64            `json:"reserved"`
+	Committed  int64            `json:"committed"`
+	Categories []MemoryCategory `json:"categories"`
+	Output     string           `json:"output"`
+}
+
+// MemoryCategory is one NMT category such as "Java Heap", "Class" or "Thread"
+type MemoryCategory struct {
+	Name      string `json:"name"`
+	Reserved  int64  `json:"reserved"`
+	Committed int64  `json:"committed"`
+}
+
+// nmtTotal and nmtCategory match the sizes of the total and category lines, e.g.
+// "-                 Java Heap (reserved=524288KB, committed=262144KB)"
+var (
+	nmtTotal    = regexp.MustCompile(`^Total: reserved=(\d+)KB, committed=(\d+)KB`)
+	nmtCategory = regexp.MustCompile(`^-\s+(.+?) \(reserved=(\d+)KB, committed=(\d+)KB`)
+)
+
+// nativeMemoryHandler returns the JVM's Native Memory Tracking summary, which accounts for the
+// memory outside the heap (metaspace, threads, code cache, GC structures) that container limits
+// also count. The JVM must run with -XX:NativeMemoryTracking=summary (or detail).
+func (s *Server) nativeMemoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendJSON(w, http.StatusMethodNotAllowed, Response{
+			Success: false,
+			Message: "Method not allowed",
+		})
+		return
+	}
+
+	sel, err := querySelector(r)
+	if err != nil {
+		sendJSON(w, http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("Invalid request: %v", err),
+		})
+		return
+	}
+	pid, err := s.targetJVM(r.Context(), sel)
+	if err != nil {
+		sendJSON(w, http.StatusInternalServerError, Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to find Java process: %v", err),
+		})
+		return
+	}
+
+	output, err := s.runJcmd(r.Context(), nil, pid, "VM.native_memory", "summary", "scale=KB")
+	// jcmd exits 0 when tracking is off, so the output has to be checked either way
+	if strings.Contains(string(output), "Native memory tracking is not enabled") {
+		sendJSON(w, http.StatusConflict, Response{
+			Success: false,
+			Message: "Native Memory Tracking is not enabled in the JVM; start it with -XX:NativeMemoryTracking=summary",
+		})
+		return
+	}
+	if err != nil {
+		sendJSON(w, commandStatus(w, err), Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to read native memory summary: %v, output: %s", err, string(output)),
+		})
+		return
+	}
+
+	summary := parseNativeMemory(string(output))
+	summary.PID = pid
+	sendJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("Native memory summary of %d categories", len(summary.Categories)),
+		Data:    summary,
+	})
+}
+
+// parseNativeMemory reads the totals and per-category sizes of a summary in KB
+func parseNativeMemory(output string) NativeMemory {
+	summary := NativeMemory{Categories: []MemoryCategory{}, Output: output}
+	kb := func(s string) int64 {
+		n, _ := strconv.ParseInt(s, 10, 64)
+		return n << 10
+	}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if m := nmtTotal.FindStringSubmatch(line); m != nil {
+			summary.Reserved, summary.Committed = kb(m[1]), kb(m[2])
+		} else if m := nmtCategory.FindStringSubmatch(line); m != nil {
+			summary.Categories = append(summary.Categories, MemoryCategory{Name: m[1], Reserved: kb(m[2]), Committed: kb(m[3])})
+		}
+	}
+	return summary
+}
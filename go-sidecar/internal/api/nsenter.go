@@ -0,0 +1,72 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// attachCommand rewrites a jcmd invocation to run through nsenter with ATTACH_NSENTER.
+// args[0] is the JVM's PID as seen by the sidecar; inside the target namespace it is
+// replaced by the namespace-local PID.
+func (e *execRunner) attachCommand(name string, args []string) (string, []string, error) {
+	if !e.opts.AttachNsenter || name != "jcmd" || len(args) == 0 {
+		return name, args, nil
+	}
+
+	pid, err := strconv.Atoi(args[0])
+	if err != nil {
+		return name, args, nil
+	}
+	status, err := readProcStatus(pid)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to inspect PID %d for nsenter: %w", pid, err)
+	}
+
+	// The attach listener only accepts connections from the JVM's own user
+	nsArgs := []string{
+		fmt.Sprintf("--target=%d", pid), "--mount", "--pid",
+		fmt.Sprintf("--setuid=%s", status.uid), fmt.Sprintf("--setgid=%s", status.gid),
+		"--", "jcmd", status.nsPID,
+	}
+	return e.opts.NsenterPath, append(nsArgs, args[1:]...), nil
+}
+
+type procStatus struct {
+	uid   string
+	gid   string
+	nsPID string // PID in the innermost PID namespace
+}
+
+// readProcStatus reads the effective IDs and namespace PID from /proc/<pid>/status
+func readProcStatus(pid int) (*procStatus, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return nil, err
+	}
+
+	status := &procStatus{nsPID: strconv.Itoa(pid)}
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		switch key {
+		case "Uid":
+			status.uid = fields[min(1, len(fields)-1)]
+		case "Gid":
+			status.gid = fields[min(1, len(fields)-1)]
+		case "NSpid":
+			status.nsPID = fields[len(fields)-1]
+		}
+	}
+	if status.uid == "" || status.gid == "" {
+		return nil, fmt.Errorf("no Uid/Gid in /proc/%d/status", pid)
+	}
+	return status, nil
+}
@@ -0,0 +1,430 @@
+package api
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/uploader"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/validation"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/version"
+)
+
+// apiOperation documents one route. Request and data schemas are generated from the Go types
+// the handlers decode and return, so the document follows the code.
+type apiOperation struct {
+	method  string
+	path    string
+	summary string
+	params  []apiParam
+	request any   // body type, nil for none
+	status  int   // success status
+	data    any   // type of Response.data on success, nil for none
+	errors  []int // error statuses besides the authentication ones every route may return
+
+	// content replaces the JSON envelope for non-JSON responses (downloads, metrics)
+	content string
+}
+
+// apiParam is a query or path parameter
+type apiParam struct {
+	name, in, kind, description string
+}
+
+// selectorParams are the JVM selector query parameters of GET routes
+var selectorParams = []apiParam{
+	{"container", "query", "string", "Target container when the pod runs several JVMs"},
+	{"pid", "query", "integer", "Target JVM by process ID (see /v1/jvms)"},
+	{"mainClass", "query", "string", "Target JVM by main class or jar"},
+}
+
+// listParams filter, sort and page GET /v1/recordings
+var listParams = []apiParam{
+	{"prefix", "query", "string", "Only files whose path relative to the recording directory starts with this"},
+	{"since", "query", "string", "Only files modified at or after this RFC 3339 time, or within this duration (24h)"},
+	{"sort", "query", "string", "name, mtime or size, '-' first for descending; path order by default"},
+	{"limit", "query", "integer", "Files per page, 1-1000 (default 100)"},
+	{"offset", "query", "integer", "Files to skip"},
+	{"pageToken", "query", "string", "nextPageToken of the previous page"},
+}
+
+// recordingParam and fileParam name a recording in the path: a running recording, or a file on
+// the profile volume relative to the recording directory
+var (
+	recordingParam = apiParam{"name", "path", "string", "Recording name"}
+	fileParam      = apiParam{"name", "path", "string", "Recording file as shown by GET /v1/recordings, e.g. checkout-slow.jfr"}
+	scheduleParam  = apiParam{"id", "path", "string", "Schedule ID returned by POST /v1/schedules"}
+)
+
+// locksParam adds ownable synchronizers to thread dumps
+var locksParam = apiParam{"locks", "query", "boolean", "Include locked ownable synchronizers (Thread.print -l)"}
+
+// apiOperations lists every /v1 route served by Handler. The legacy unversioned aliases take the
+// same bodies and are not documented separately.
+func apiOperations() []apiOperation {
+	return []apiOperation{
+		{method: "post", path: "/v1/recordings", summary: "Start a JFR or async-profiler recording as a background job", request: ProfileRequest{},
+			status: http.StatusAccepted, data: struct {
+				JobID    string `json:"jobId"`
+				PID      string `json:"pid"`
+				Name     string `json:"name"`
+				Duration string `json:"duration"`
+				Engine   string `json:"engine"`
+				Settings string `json:"settings"`
+				Filename string `json:"filename"`
+			}{}, errors: []int{400, 409, 429, 500, 507}},
+		{method: "post", path: "/v1/recordings/{name}/stop", summary: "Stop a running recording and write its file",
+			params: []apiParam{recordingParam}, request: StopRequest{},
+			status: http.StatusOK, data: struct {
+				PID    string `json:"pid"`
+				Name   string `json:"name"`
+				Output string `json:"output"`
+			}{}, errors: []int{400, 404, 500, 503, 504}},
+		{method: "post", path: "/v1/recordings/stop-all", summary: "Stop every recording, optionally in one JVM", request: StopAllRequest{},
+			status: http.StatusOK, data: []StopResult{}, errors: []int{400, 500}},
+		{method: "post", path: "/v1/recordings/{name}/dump", summary: "Snapshot a running recording to a new file",
+			params: []apiParam{recordingParam}, request: DumpRequest{},
+			status: http.StatusOK, data: struct {
+				PID      string `json:"pid"`
+				Name     string `json:"name"`
+				Filename string `json:"filename"`
+				Path     string `json:"path"`
+				Output   string `json:"output"`
+			}{}, errors: []int{400, 404, 429, 500}},
+		{method: "get", path: "/v1/recordings", summary: "List recordings on the profile volume (supports ETag and If-Modified-Since); a ProfilePage with limit, offset or pageToken",
+			params: listParams, status: http.StatusOK, data: []ProfileFile{}, errors: []int{304, 400, 500}},
+		{method: "get", path: "/v1/recordings/{name}", summary: "Download a recording (supports Range requests), or its CPU samples as pprof",
+			params: []apiParam{fileParam, {"format", "query", "string", "jfr (default) or pprof: the execution samples as a gzipped pprof profile"}},
+			status: http.StatusOK, content: "application/octet-stream", errors: []int{206, 400, 404, 409, 422, 500}},
+		{method: "delete", path: "/v1/recordings/{name}", summary: "Delete a recording that is neither running nor in use",
+			params: []apiParam{fileParam},
+			status: http.StatusOK, data: struct {
+				Name string `json:"name"`
+				Path string `json:"path"`
+			}{}, errors: []int{400, 404, 409, 500}},
+		{method: "get", path: "/v1/running", summary: "List the recordings running in a JVM", params: selectorParams,
+			status: http.StatusOK, data: struct {
+				PID        string            `json:"pid"`
+				Recordings []RecordingStatus `json:"recordings"`
+				Source     string            `json:"source"` // jcmd, or registry when JFR.check failed
+				Output     string            `json:"output"`
+			}{}, errors: []int{400, 500}},
+		{method: "get", path: "/v1/disk", summary: "Usage of the profile volume and the low-space threshold",
+			status: http.StatusOK, data: DiskUsage{}, errors: []int{500}},
+		{method: "get", path: "/v1/jvms", summary: "List the JVMs in the pod",
+			status: http.StatusOK, data: []JVMInfo{}, errors: []int{500}},
+		{method: "get", path: "/v1/livez", summary: "Liveness check: the API server is running", status: http.StatusOK},
+		{method: "get", path: "/v1/readyz", summary: "Readiness check: jcmd is on PATH, a target JVM resolves and the profile directory is writable",
+			status: http.StatusOK, data: Readiness{}, errors: []int{503}},
+		{method: "get", path: "/v1/health", summary: "Liveness check (alias of /v1/livez)", status: http.StatusOK},
+		{method: "get", path: "/v1/version", summary: "Version, commit and build date of the sidecar",
+			status: http.StatusOK, data: version.Info{}},
+		{method: "get", path: "/metrics", summary: "Prometheus metrics", status: http.StatusOK,
+			content: "text/plain"},
+		{method: "get", path: "/v1/recordings/{name}/transcript", summary: "jcmd invocations made for a recording",
+			params: []apiParam{recordingParam},
+			status: http.StatusOK, data: []TranscriptEntry{}, errors: []int{404}},
+		{method: "get", path: "/v1/recordings/{name}/analysis", summary: "Summarize a recording: event counts, top CPU stacks and allocation sites, GC pauses",
+			params: []apiParam{fileParam, {"top", "query", "integer", "Stacks and allocation sites to return (default 10)"}},
+			status: http.StatusOK, data: Analysis{}, errors: []int{400, 404, 422, 500}},
+		{method: "get", path: "/v1/jobs/{id}", summary: "Lifecycle of a recording job started by POST /v1/recordings",
+			params: []apiParam{{"id", "path", "string", "Job ID returned by POST /v1/recordings"}},
+			status: http.StatusOK, data: Job{}, errors: []int{404}},
+		{method: "post", path: "/v1/rollouts", summary: "Profile canary pods at rollout start or finish", request: RolloutRequest{},
+			status: http.StatusOK, data: struct {
+				PID       string `json:"pid"`
+				RolloutID string `json:"rolloutId"`
+				Phase     string `json:"phase"`
+				Name      string `json:"name"`
+				Duration  string `json:"duration"`
+				Filename  string `json:"filename"`
+			}{}, errors: []int{400, 500}},
+		{method: "post", path: "/v1/native-profiles", summary: "Start a native CPU profile (async-profiler or perf)", request: NativeProfileRequest{},
+			status: http.StatusAccepted, data: struct {
+				PID      string `json:"pid"`
+				Engine   string `json:"engine"`
+				Duration string `json:"duration"`
+				Filename string `json:"filename"`
+			}{}, errors: []int{400, 429, 500}},
+		{method: "get", path: "/v1/remote-recordings", summary: "List recordings already uploaded for this pod",
+			status: http.StatusOK, data: []uploader.ObjectInfo{}, errors: []int{501, 502, 503}},
+		{method: "post", path: "/v1/estimates", summary: "Estimate the size of a recording with a short probe", request: EstimateRequest{},
+			status: http.StatusOK, data: SizeEstimate{}, errors: []int{400, 429, 500}},
+		{method: "post", path: "/v1/heap-dumps", summary: "Write an HPROF heap dump for upload", request: HeapDumpRequest{},
+			status: http.StatusAccepted, data: struct {
+				PID      string `json:"pid"`
+				Name     string `json:"name"`
+				Filename string `json:"filename"`
+			}{}, errors: []int{400, 409, 429, 500}},
+		{method: "get", path: "/v1/thread-dumps", summary: "Capture a thread dump (Thread.print) and return it inline",
+			params: append(slices.Clone(selectorParams), locksParam), status: http.StatusOK, data: ThreadDump{}, errors: []int{400, 500, 503, 504}},
+		{method: "post", path: "/v1/thread-dumps", summary: "Capture a thread dump and save it as a .txt file for upload",
+			params: append(slices.Clone(selectorParams), locksParam), status: http.StatusOK, data: ThreadDump{}, errors: []int{400, 429, 500, 503, 504}},
+		{method: "get", path: "/v1/class-histogram", summary: "Heap usage by class (GC.class_histogram), largest first",
+			params: append(slices.Clone(selectorParams),
+				apiParam{"top", "query", "integer", "Classes to return (default 50, 0 for all)"},
+				apiParam{"all", "query", "boolean", "Count unreachable objects too instead of running a full GC first"}),
+			status: http.StatusOK, data: ClassHistogram{}, errors: []int{400, 500, 503, 504}},
+		{method: "get", path: "/v1/native-memory", summary: "Native Memory Tracking summary by category (VM.native_memory summary)",
+			params: selectorParams, status: http.StatusOK, data: NativeMemory{}, errors: []int{400, 409, 500, 503, 504}},
+		{method: "get", path: "/v1/jvm/flags", summary: "Flags set on the command line or ergonomically (VM.flags)",
+			params: selectorParams, status: http.StatusOK, data: VMFlags{}, errors: []int{400, 500, 503, 504}},
+		{method: "get", path: "/v1/jvm/info", summary: "VM.info report split into sections, secret -D options redacted",
+			params: selectorParams, status: http.StatusOK, data: VMInfo{}, errors: []int{400, 500, 503, 504}},
+		{method: "get", path: "/v1/jvm/system-properties", summary: "System properties, secret-looking values redacted",
+			params: selectorParams, status: http.StatusOK, data: SystemProperties{}, errors: []int{400, 500, 503, 504}},
+		{method: "get", path: "/v1/jvm/metrics", summary: "Heap, metaspace, GC, class and thread counters (PerfCounter.print)",
+			params: append(slices.Clone(selectorParams), apiParam{"raw", "query", "boolean", "Include every performance counter"}),
+			status: http.StatusOK, data: JVMMetrics{}, errors: []int{400, 409, 500, 503, 504}},
+		{method: "get", path: "/v1/events", summary: "Stream recording lifecycle events as Server-Sent Events",
+			params: []apiParam{{"types", "query", "string", "Comma-separated event types, e.g. recording.started,upload.completed; all when empty"}},
+			status: http.StatusOK, content: "text/event-stream"},
+		{method: "post", path: "/v1/schedules", summary: "Register a cron schedule that starts recordings", request: ScheduleRequest{},
+			status: http.StatusCreated, data: Schedule{}, errors: []int{400, 409}},
+		{method: "get", path: "/v1/schedules", summary: "List schedules",
+			status: http.StatusOK, data: []Schedule{}},
+		{method: "get", path: "/v1/schedules/{id}", summary: "Get a schedule", params: []apiParam{scheduleParam},
+			status: http.StatusOK, data: Schedule{}, errors: []int{404}},
+		{method: "put", path: "/v1/schedules/{id}", summary: "Replace a schedule's expression and recording", params: []apiParam{scheduleParam},
+			request: ScheduleRequest{}, status: http.StatusOK, data: Schedule{}, errors: []int{400, 404}},
+		{method: "delete", path: "/v1/schedules/{id}", summary: "Delete a schedule", params: []apiParam{scheduleParam},
+			status: http.StatusOK, errors: []int{404}},
+		{method: "get", path: "/v1/presets", summary: "List the recording presets accepted as \"preset\"",
+			status: http.StatusOK, data: map[string]Preset{}},
+		{method: "get", path: "/v1/continuous", summary: "Get the continuous recording and its last rotation",
+			status: http.StatusOK, data: ContinuousStatus{}},
+		{method: "put", path: "/v1/continuous", summary: "Enable, reconfigure or disable the continuous recording", request: ContinuousConfig{},
+			status: http.StatusOK, data: ContinuousStatus{}, errors: []int{400}},
+		{method: "get", path: "/v1/triggers", summary: "List the threshold triggers and their latest samples",
+			status: http.StatusOK, data: TriggerConfig{}},
+		{method: "get", path: "/v1/openapi.json", summary: "This document", status: http.StatusOK,
+			content: "application/json"},
+	}
+}
+
+// statusDescriptions explain the status codes routes return
+var statusDescriptions = map[int]string{
+	200: "Success",
+	201: "Created",
+	202: "Accepted; the work continues in the background",
+	206: "Partial content for a Range request",
+	304: "Not modified since the validators the client sent",
+	400: "Invalid request; data.errors lists every problem",
+	401: "Missing or invalid credentials",
+	403: "The caller is not allowed to perform this request",
+	404: "Not found",
+	405: "Method not allowed",
+	409: "Conflicts with the current state, e.g. a running recording, a file in use or MAX_CONCURRENT_RECORDINGS",
+	429: "Rate limited or over the namespace upload quota; see Retry-After",
+	500: "Internal error",
+	501: "The uploader cannot list objects",
+	502: "The upload destination failed",
+	503: "The JVM or a dependency is unavailable",
+	504: "jcmd timed out",
+	507: "The profile volume is below DISK_MIN_FREE, or the recording's maxSize exceeds its free space",
+}
+
+// openAPIDocument is built once; the routes and types are fixed at compile time
+var openAPIDocument = sync.OnceValue(buildOpenAPI)
+
+// openAPIHandler serves the OpenAPI 3 description of the API
+func (s *Server) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDocument())
+}
+
+// buildOpenAPI renders the OpenAPI 3.0 document for apiOperations
+func buildOpenAPI() []byte {
+	b := &schemaBuilder{components: map[string]any{}}
+	envelope := b.schema(reflect.TypeFor[Response]())
+	b.components["ValidationErrors"] = map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"errors": map[string]any{"type": "array", "items": b.schema(reflect.TypeFor[validation.FieldError]())},
+		},
+	}
+
+	paths := map[string]any{}
+	for _, op := range apiOperations() {
+		item, _ := paths[op.path].(map[string]any)
+		if item == nil {
+			item = map[string]any{}
+			paths[op.path] = item
+		}
+		item[op.method] = b.operation(op, envelope)
+	}
+
+	doc := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "Profiler sidecar API",
+			"description": "Starts, stops and lists JFR recordings of the JVMs in the pod. The unversioned paths (/create, /stop, /list, ...) remain as aliases of these routes.",
+			"version":     version.String(),
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": b.components,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []any{map[string]any{}, map[string]any{"bearerAuth": []string{}}},
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		panic(err) // only maps, slices and strings: cannot fail
+	}
+	return data
+}
+
+// operation renders one route
+func (b *schemaBuilder) operation(op apiOperation, envelope map[string]any) map[string]any {
+	responses := map[string]any{}
+	success := map[string]any{"description": statusDescriptions[op.status]}
+	switch {
+	case op.content != "":
+		success["content"] = map[string]any{op.content: map[string]any{"schema": map[string]any{"type": "string"}}}
+	case op.data != nil:
+		success["content"] = jsonContent(map[string]any{
+			"allOf": []any{envelope, map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"data": b.schema(reflect.TypeOf(op.data))},
+			}},
+		})
+	default:
+		success["content"] = jsonContent(envelope)
+	}
+	responses[strconv.Itoa(op.status)] = success
+
+	statuses := append([]int{http.StatusUnauthorized, http.StatusForbidden, http.StatusMethodNotAllowed}, op.errors...)
+	for _, status := range statuses {
+		response := map[string]any{"description": statusDescriptions[status]}
+		switch {
+		case status == http.StatusBadRequest && op.request != nil:
+			response["content"] = jsonContent(map[string]any{
+				"allOf": []any{envelope, map[string]any{
+					"type":       "object",
+					"properties": map[string]any{"data": map[string]any{"$ref": "#/components/schemas/ValidationErrors"}},
+				}},
+			})
+		case status == http.StatusNotModified, status == http.StatusPartialContent:
+		default:
+			response["content"] = jsonContent(envelope)
+		}
+		responses[strconv.Itoa(status)] = response
+	}
+
+	rendered := map[string]any{
+		"summary":     op.summary,
+		"operationId": operationID(op),
+		"responses":   responses,
+	}
+	if op.request != nil {
+		rendered["requestBody"] = map[string]any{
+			"required": false,
+			"content":  jsonContent(b.schema(reflect.TypeOf(op.request))),
+		}
+	}
+	if len(op.params) > 0 {
+		params := make([]any, 0, len(op.params))
+		for _, p := range op.params {
+			params = append(params, map[string]any{
+				"name":        p.name,
+				"in":          p.in,
+				"required":    p.in == "path",
+				"description": p.description,
+				"schema":      map[string]any{"type": p.kind},
+			})
+		}
+		rendered["parameters"] = params
+	}
+	return rendered
+}
+
+// operationID names an operation for client generators, e.g. "postStopAll", "getJobsId"
+func operationID(op apiOperation) string {
+	var id strings.Builder
+	id.WriteString(op.method)
+	for _, word := range strings.FieldsFunc(op.path, func(r rune) bool {
+		return r == '/' || r == '-' || r == '.' || r == '{' || r == '}'
+	}) {
+		id.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return id.String()
+}
+
+func jsonContent(schema map[string]any) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": schema}}
+}
+
+// schemaBuilder turns Go types into OpenAPI schemas. Named structs become components and are
+// referenced; anonymous structs are inlined.
+type schemaBuilder struct {
+	components map[string]any
+}
+
+func (b *schemaBuilder) schema(t reflect.Type) map[string]any {
+	switch t {
+	case reflect.TypeFor[time.Time]():
+		return map[string]any{"type": "string", "format": "date-time"}
+	case reflect.TypeFor[time.Duration]():
+		return map[string]any{"type": "integer", "format": "int64", "description": "nanoseconds"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return b.schema(t.Elem())
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		if _, ok := b.components[t.Name()]; !ok {
+			b.components[t.Name()] = map[string]any{} // placeholder, in case the type refers to itself
+			b.components[t.Name()] = b.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]any{} // interface{}: any value
+}
+
+// object renders a struct's exported JSON fields. Fields of untagged embedded structs are
+// promoted, as encoding/json does.
+func (b *schemaBuilder) object(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			maps.Copy(properties, b.object(f.Type)["properties"].(map[string]any))
+			continue
+		}
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		properties[name] = b.schema(f.Type)
+	}
+	return map[string]any{"type": "object", "properties": properties}
+}
@@ -0,0 +1,249 @@
+package api
+
+import (
+	"cmp"
+	"compress/gzip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/config"
+)
+
+// Options holds the sidecar's environment-only settings. They are read once, by OptionsFromEnv,
+// and each server keeps its own copy, so tests can set them through Deps.
+type Options struct {
+	// AttachNative sends diagnostic commands over the JVM's attach socket instead of running
+	// jcmd, so neither the sidecar nor the application image needs a JDK. It reaches JVMs in other
+	// mount and PID namespaces through /proc, which makes AttachNsenter unnecessary.
+	AttachNative bool
+	// AttachNsenter runs jcmd inside the target JVM's mount and PID namespaces, for pods without
+	// shareProcessNamespace. The sidecar then needs hostPID plus SYS_ADMIN, SYS_PTRACE and
+	// SYS_CHROOT, and jcmd must exist in the JVM's container image.
+	AttachNsenter bool
+	NsenterPath   string
+
+	// JolokiaURL sends the diagnostic commands to the JVM's Jolokia agent instead, for clusters
+	// whose seccomp or security policy blocks exec and the attach socket. JolokiaPasswordFile
+	// takes precedence over JolokiaPassword.
+	JolokiaURL          string
+	JolokiaUser         string
+	JolokiaPassword     string
+	JolokiaPasswordFile string
+
+	// JavaContainer selects the target JVM when several containers run Java and a request names
+	// none; JavaCmdlinePattern and JavaEnvMarker narrow the JVMs the sidecar may target
+	JavaContainer      string
+	JavaCmdlinePattern string
+	JavaEnvMarker      string
+
+	// Attach operations can hang indefinitely on a JVM stuck at a safepoint, so every command
+	// runs with a deadline. Commands slower than SlowCommandThreshold are logged as slow.
+	// GC.heap_dump pauses the JVM for about a second per hundred megabytes of heap and gets
+	// HeapDumpTimeout instead.
+	JcmdTimeout          time.Duration
+	CommandTimeout       time.Duration
+	SlowCommandThreshold time.Duration
+	HeapDumpTimeout      time.Duration
+
+	// After JcmdBreakerThreshold consecutive jcmd failures against a PID, calls fail fast for
+	// JcmdBreakerCooldown instead of piling up more attach attempts
+	JcmdBreakerThreshold int
+	JcmdBreakerCooldown  time.Duration
+
+	// Scheduling priority and resource limits of child processes; 0 leaves a limit off
+	CommandNice      int
+	CommandMaxCPU    time.Duration
+	CommandMaxMemory int64
+
+	// AsyncProfilerPath is the asprof launcher from async-profiler 3.x; PerfMapAgentPath generates
+	// /tmp/perf-<pid>.map so perf can symbolize JIT-compiled frames
+	AsyncProfilerPath string
+	PerfPath          string
+	PerfMapAgentPath  string
+
+	// Caps on the duration, maxSize and maxAge a recording may ask for (0 disables the duration
+	// cap). maxSize also has to fit the profile volume's free space.
+	RecordingMaxDuration  time.Duration
+	RecordingMaxSizeLimit int64
+	RecordingMaxAgeLimit  time.Duration
+
+	// PresetsFile adds recording presets to the built-in ones, or overrides them
+	PresetsFile string
+
+	// Generated recording names carry a timestamp in TimestampFormat (a Go time layout) in
+	// Timezone ("Local", "UTC" or an IANA name)
+	TimestampFormat string
+	Timezone        string
+
+	// Limits on the endpoints that attach to the JVM. Rates are requests per minute and may be
+	// used in a burst; 0 disables a limit.
+	ProfileRateLimit        int
+	ProfileClientRateLimit  int
+	MaxConcurrentRecordings int
+	MaxSchedules            int
+
+	// Size estimates come from a short probe recording, ESTIMATE_PROBE_DURATION long by default
+	EstimateProbeDefault time.Duration
+	EstimateProbeMax     time.Duration
+
+	// CompressRecordings gzips JFR recordings once the JVM has written them, before the daemon
+	// sees them. CompressLevel trades CPU for size; CompressConcurrency bounds how many
+	// recordings are compressed at once.
+	CompressRecordings  bool
+	CompressLevel       int
+	CompressConcurrency int
+
+	// DirectUpload makes the sidecar upload each job's file itself once the recording completes,
+	// for clusters where the daemon's hostPath volume is not allowed. Unlike StreamUpload the
+	// file is written to the volume first, so a failed upload can be retried; DirectUploadTries
+	// counts the first attempt.
+	DirectUpload       bool
+	DirectUploadKeep   bool
+	DirectUploadTries  int
+	DirectUploadSettle time.Duration
+
+	// StreamUpload makes the JVM write recordings into a named pipe that the sidecar streams
+	// straight to the uploader, so no full copy lands on the shared volume
+	StreamUpload bool
+
+	// Below DiskMinFree, new recordings are refused ("reject") or started with a maxSize of
+	// DiskLowMaxSize ("limit"), so a recording cannot fill the emptyDir and get the pod evicted
+	DiskMinFree    int64
+	DiskLowAction  string
+	DiskLowMaxSize int64
+
+	// ListCacheMaxAge bounds how long a cached listing is served while no directory changed. A
+	// file growing in place does not change its directory's mtime, so the listing is rebuilt at
+	// least this often.
+	ListCacheMaxAge time.Duration
+
+	// Hooks run before a recording starts and once its file is finished
+	PreRecordingHook  string
+	PostRecordingHook string
+
+	// A /create callbackUrl is retried CallbackRetries times; CallbackHosts, when set, limits the
+	// hosts callbacks may be sent to
+	CallbackRetries int
+	CallbackHosts   string
+
+	// Timeouts of the API server; 0 disables a timeout
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+
+	// TLS for the API server. With TLSClientCA set, callers must present a certificate signed by
+	// that CA (mutual TLS).
+	TLSCert           string
+	TLSKey            string
+	TLSClientCA       string
+	TLSReloadInterval time.Duration
+
+	// AuthMode "kubernetes" authenticates callers with TokenReview and authorizes requests with
+	// SubjectAccessReview; AuthAudiences is a comma-separated list
+	AuthMode      string
+	AuthAudiences string
+	AuthCacheTTL  time.Duration
+
+	// Sidecars announce themselves to the registry at RegistryURL and keep sending heartbeats
+	RegistryURL               string
+	RegistryToken             string
+	RegistryHeartbeatInterval time.Duration
+
+	// On SIGTERM in-flight requests drain for up to ShutdownTimeout, then the recordings
+	// ShutdownStopRecordings selects (all, ephemeral or none) are stopped
+	ShutdownTimeout        time.Duration
+	ShutdownStopRecordings string
+}
+
+// OptionsFromEnv loads the server options from environment variables. Invalid values are
+// reported by config.EnvError.
+func OptionsFromEnv() Options {
+	return Options{
+		AttachNative:  config.EnvBool("ATTACH_NATIVE", false),
+		AttachNsenter: config.EnvBool("ATTACH_NSENTER", false),
+		NsenterPath:   config.Env("NSENTER_PATH", "nsenter"),
+
+		JolokiaURL:          os.Getenv("JOLOKIA_URL"),
+		JolokiaUser:         os.Getenv("JOLOKIA_USER"),
+		JolokiaPassword:     os.Getenv("JOLOKIA_PASSWORD"),
+		JolokiaPasswordFile: os.Getenv("JOLOKIA_PASSWORD_FILE"),
+
+		JavaContainer:      os.Getenv("JAVA_CONTAINER"),
+		JavaCmdlinePattern: os.Getenv("JAVA_CMDLINE_PATTERN"),
+		JavaEnvMarker:      os.Getenv("JAVA_ENV_MARKER"),
+
+		JcmdTimeout:          config.EnvDuration("JCMD_TIMEOUT", 30*time.Second),
+		CommandTimeout:       config.EnvDuration("COMMAND_TIMEOUT", 30*time.Second),
+		SlowCommandThreshold: config.EnvDuration("SLOW_COMMAND_THRESHOLD", 5*time.Second),
+		HeapDumpTimeout:      config.EnvDuration("HEAP_DUMP_TIMEOUT", 10*time.Minute),
+		JcmdBreakerThreshold: config.EnvInt("JCMD_BREAKER_THRESHOLD", 5),
+		JcmdBreakerCooldown:  config.EnvDuration("JCMD_BREAKER_COOLDOWN", 30*time.Second),
+
+		CommandNice:      config.EnvInt("COMMAND_NICE", 0),
+		CommandMaxCPU:    config.EnvDuration("COMMAND_MAX_CPU", 0),
+		CommandMaxMemory: config.EnvSize("COMMAND_MAX_MEMORY", 0),
+
+		AsyncProfilerPath: config.Env("ASYNC_PROFILER_PATH", "asprof"),
+		PerfPath:          config.Env("PERF_PATH", "perf"),
+		PerfMapAgentPath:  config.Env("PERF_MAP_AGENT_PATH", "create-java-perf-map.sh"),
+
+		RecordingMaxDuration:  config.EnvDuration("RECORDING_MAX_DURATION", 30*time.Minute),
+		RecordingMaxSizeLimit: cmp.Or(config.EnvSize("RECORDING_MAX_SIZE_LIMIT", 0), 1<<30),
+		RecordingMaxAgeLimit:  config.EnvDuration("RECORDING_MAX_AGE_LIMIT", 24*time.Hour),
+		PresetsFile:           os.Getenv("RECORDING_PRESETS_FILE"),
+		TimestampFormat:       config.Env("RECORDING_TIMESTAMP_FORMAT", defaultNameTimestampLayout),
+		Timezone:              os.Getenv("RECORDING_TIMEZONE"),
+
+		ProfileRateLimit:        config.EnvInt("PROFILE_RATE_LIMIT", 30),
+		ProfileClientRateLimit:  config.EnvInt("PROFILE_CLIENT_RATE_LIMIT", 10),
+		MaxConcurrentRecordings: config.EnvInt("MAX_CONCURRENT_RECORDINGS", 5),
+		MaxSchedules:            config.EnvInt("MAX_SCHEDULES", 50),
+
+		EstimateProbeDefault: config.EnvDuration("ESTIMATE_PROBE_DURATION", 10*time.Second),
+		EstimateProbeMax:     config.EnvDuration("ESTIMATE_PROBE_MAX", time.Minute),
+
+		CompressRecordings:  config.EnvBool("COMPRESS_RECORDINGS", false),
+		CompressLevel:       config.EnvInt("COMPRESS_LEVEL", gzip.BestSpeed),
+		CompressConcurrency: config.EnvInt("COMPRESS_CONCURRENCY", 1),
+
+		DirectUpload:       config.EnvBool("DIRECT_UPLOAD", false),
+		DirectUploadKeep:   config.EnvBool("DIRECT_UPLOAD_KEEP", false),
+		DirectUploadTries:  config.EnvInt("DIRECT_UPLOAD_RETRIES", 3) + 1,
+		DirectUploadSettle: config.EnvDuration("DIRECT_UPLOAD_SETTLE_TIMEOUT", 30*time.Second),
+		StreamUpload:       config.EnvBool("STREAM_UPLOAD", false),
+
+		DiskMinFree:    config.EnvSize("DISK_MIN_FREE", 256<<20),
+		DiskLowAction:  strings.ToLower(config.Env("DISK_LOW_ACTION", "reject")),
+		DiskLowMaxSize: config.EnvSize("DISK_LOW_MAX_SIZE", 16<<20),
+
+		ListCacheMaxAge: config.EnvDuration("LIST_CACHE_MAX_AGE", 30*time.Second),
+
+		PreRecordingHook:  os.Getenv("RECORDING_PRE_HOOK"),
+		PostRecordingHook: os.Getenv("RECORDING_POST_HOOK"),
+		CallbackRetries:   config.EnvInt("RECORDING_CALLBACK_RETRIES", 5),
+		CallbackHosts:     os.Getenv("RECORDING_CALLBACK_HOSTS"),
+
+		ReadHeaderTimeout: config.EnvDuration("API_READ_HEADER_TIMEOUT", 10*time.Second),
+		ReadTimeout:       config.EnvDuration("API_READ_TIMEOUT", 30*time.Second),
+		WriteTimeout:      config.EnvDuration("API_WRITE_TIMEOUT", 2*time.Minute),
+		IdleTimeout:       config.EnvDuration("API_IDLE_TIMEOUT", 2*time.Minute),
+
+		TLSCert:           os.Getenv("API_TLS_CERT"),
+		TLSKey:            os.Getenv("API_TLS_KEY"),
+		TLSClientCA:       os.Getenv("API_TLS_CLIENT_CA"),
+		TLSReloadInterval: config.EnvDuration("API_TLS_RELOAD_INTERVAL", time.Minute),
+
+		AuthMode:      os.Getenv("API_AUTH_MODE"),
+		AuthAudiences: os.Getenv("API_AUTH_AUDIENCES"),
+		AuthCacheTTL:  config.EnvDuration("API_AUTH_CACHE_TTL", time.Minute),
+
+		RegistryURL:               strings.TrimSuffix(os.Getenv("REGISTRY_URL"), "/"),
+		RegistryToken:             os.Getenv("REGISTRY_TOKEN"),
+		RegistryHeartbeatInterval: config.EnvDuration("REGISTRY_HEARTBEAT_INTERVAL", 30*time.Second),
+
+		ShutdownTimeout:        config.EnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+		ShutdownStopRecordings: cmp.Or(os.Getenv("SHUTDOWN_STOP_RECORDINGS"), "all"),
+	}
+}
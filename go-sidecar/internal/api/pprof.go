@@ -0,0 +1,65 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/jfrconv"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+)
+
+// servePprof converts a recording's execution samples to a gzipped pprof profile and sends it as
+// {name}.pb.gz. The profile is built in memory first, so a failed conversion still gets a JSON
+// error; profiles are small next to their recordings.
+func (s *Server) servePprof(w http.ResponseWriter, r *http.Request, name, filePath string) {
+	f, err := s.fs.Open(filePath)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, fs.ErrNotExist) {
+			status = http.StatusNotFound
+		}
+		sendJSON(w, status, Response{
+			Success: false,
+			Message: fmt.Sprintf("Recording '%s' not found", name),
+		})
+		return
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil {
+		s.extendWriteDeadline(w, info.Size()) // converting a large recording outlasts the write timeout
+	}
+
+	var profile bytes.Buffer
+	recording, err := openRecording(f, name)
+	var summary jfrconv.Summary
+	if err == nil {
+		summary, err = jfrconv.Convert(recording, &profile)
+	}
+	if errors.Is(err, jfrconv.ErrNoSamples) {
+		sendJSON(w, http.StatusConflict, Response{
+			Success: false,
+			Message: fmt.Sprintf("Recording '%s' has no execution samples; record with jdk.ExecutionSample enabled", name),
+		})
+		return
+	}
+	if err != nil {
+		sendJSON(w, http.StatusUnprocessableEntity, Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to convert recording '%s': %v", name, err),
+		})
+		return
+	}
+	logger.Log.WithContext(r.Context()).WithField("name", name).WithField("samples", summary.Samples).Debug("Converted recording to pprof")
+
+	filename := recordingNameOf(path.Base(name)) + ".pb.gz"
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("Content-Length", strconv.Itoa(profile.Len()))
+	w.Write(profile.Bytes())
+}
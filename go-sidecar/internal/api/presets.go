@@ -0,0 +1,129 @@
+package api
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/validation"
+)
+
+// Preset is a named recording configuration for a common investigation, so that callers can ask
+// for {"preset": "alloc"} instead of knowing .jfc internals. Options are .jfc control options
+// passed to JFR.start, such as "allocation-profiling=maximum", which needs JDK 17 or later.
+type Preset struct {
+	Description string            `json:"description"`
+	Settings    string            `json:"settings"`          // template the options refine, e.g. "profile"
+	Options     map[string]string `json:"options,omitempty"` // .jfc option -> value
+}
+
+// builtinPresets are always available; RECORDING_PRESETS_FILE may override them or add more
+var builtinPresets = map[string]Preset{
+	"cpu": {
+		Description: "Method sampling at the highest rate, for hot code paths",
+		Settings:    "profile",
+		Options:     map[string]string{"method-profiling": "max"},
+	},
+	"alloc": {
+		Description: "Every allocation sample the JVM can afford, for allocation pressure and heap churn",
+		Settings:    "profile",
+		Options:     map[string]string{"allocation-profiling": "maximum"},
+	},
+	"lock": {
+		Description: "Monitor and park events above 1ms, for contention",
+		Settings:    "profile",
+		Options:     map[string]string{"locking-threshold": "1ms"},
+	},
+	"gc": {
+		Description: "Detailed garbage collection phases, heap summaries and references",
+		Settings:    "default",
+		Options:     map[string]string{"gc": "detailed"},
+	},
+}
+
+// presetOptionPattern matches a .jfc option name such as "locking-threshold"
+var presetOptionPattern = regexp.MustCompile(`^[a-z][a-z0-9-]{0,63}$`)
+
+// loadPresets merges the presets in RECORDING_PRESETS_FILE, a JSON object of name -> preset, over
+// the built-in ones
+func (s *Server) loadPresets() error {
+	path := s.opts.PresetsFile
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read presets file: %w", err)
+	}
+	var custom map[string]Preset
+	if err := json.Unmarshal(data, &custom); err != nil {
+		return fmt.Errorf("invalid presets file %s: %w", path, err)
+	}
+
+	presets := maps.Clone(builtinPresets)
+	for name, p := range custom {
+		if err := p.validate(name); err != nil {
+			return fmt.Errorf("invalid presets file %s: %w", path, err)
+		}
+		presets[name] = p
+	}
+	s.presets = presets
+	return nil
+}
+
+// validate checks that a configured preset only produces well-formed jcmd arguments
+func (p Preset) validate(name string) error {
+	if !argumentPattern.MatchString(name) {
+		return fmt.Errorf("preset name %q may only contain letters, digits, '.', '_', ':', '+' and '-'", name)
+	}
+	if err := validSettings("settings", p.Settings); err != nil {
+		return fmt.Errorf("preset %s: %s", name, err.Message)
+	}
+	for option, value := range p.Options {
+		if !presetOptionPattern.MatchString(option) {
+			return fmt.Errorf("preset %s: invalid option name %q", name, option)
+		}
+		if !argumentPattern.MatchString(value) {
+			return fmt.Errorf("preset %s: invalid value %q for option %s", name, value, option)
+		}
+	}
+	return nil
+}
+
+// validPreset checks an optional preset name against the configured presets
+func (s *Server) validPreset(field, value string) *validation.FieldError {
+	if _, ok := s.presets[value]; value == "" || ok {
+		return nil
+	}
+	names := slices.Sorted(maps.Keys(s.presets))
+	return &validation.FieldError{Field: field, Message: fmt.Sprintf("must be one of %s, got %q", strings.Join(names, ", "), value)}
+}
+
+// settingsArgs returns the JFR.start settings options for a request: its preset's template and
+// options, with an explicit settings value replacing the preset's template
+func (s *Server) settingsArgs(req ProfileRequest) []string {
+	preset := s.presets[req.Preset]
+	var args []string
+	if settings := cmp.Or(req.Settings, preset.Settings); settings != "" {
+		args = append(args, "settings="+settings)
+	}
+	for _, option := range slices.Sorted(maps.Keys(preset.Options)) {
+		args = append(args, option+"="+preset.Options[option])
+	}
+	return args
+}
+
+// presetsHandler lists the recording presets
+func (s *Server) presetsHandler(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("%d recording presets", len(s.presets)),
+		Data:    s.presets,
+	})
+}
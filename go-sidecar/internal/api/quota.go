@@ -0,0 +1,28 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+)
+
+// quotaMarker is written by the daemon while this pod's namespace is over its upload quota
+const quotaMarker = ".quota-exceeded"
+
+// rejectIfOverQuota responds 429 and returns true while the namespace is over quota
+func (s *Server) rejectIfOverQuota(w http.ResponseWriter) bool {
+	data, err := s.fs.ReadFile(filepath.Join(s.cfg.ProfileDir, quotaMarker))
+	if err != nil {
+		return false
+	}
+
+	var details map[string]any
+	json.Unmarshal(data, &details)
+	sendJSON(w, http.StatusTooManyRequests, Response{
+		Success: false,
+		Message: fmt.Sprintf("Namespace %v is over its upload quota; new recordings are refused until %v", details["namespace"], details["resetsAt"]),
+		Data:    details,
+	})
+	return true
+}
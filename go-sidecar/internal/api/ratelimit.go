@@ -0,0 +1,114 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/metrics"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/tenant"
+	"golang.org/x/time/rate"
+)
+
+// clientLimiterIdle is how long an unused per-client limiter is kept
+const clientLimiterIdle = 10 * time.Minute
+
+// errTooManyRecordings is returned by newJob while MAX_CONCURRENT_RECORDINGS jobs are active
+var errTooManyRecordings = errors.New("too many concurrent recordings")
+
+// clientLimiter is one client's token bucket
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// perMinute builds a limiter allowing n requests per minute, all of them in a burst
+func perMinute(n int) *rate.Limiter {
+	if n <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	return rate.NewLimiter(rate.Every(time.Minute/time.Duration(n)), n)
+}
+
+// rateClient identifies the caller a per-client limit applies to: its tenant, or its address
+func rateClient(r *http.Request) string {
+	if t := tenant.FromContext(r.Context()); t != nil {
+		return "tenant:" + t.Name
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// clientLimiter returns the limiter for client, dropping limiters idle for clientLimiterIdle
+func (s *Server) clientLimiter(client string, now time.Time) *rate.Limiter {
+	s.rateMu.Lock()
+	defer s.rateMu.Unlock()
+	for key, cl := range s.clientLimiters {
+		if now.Sub(cl.lastSeen) > clientLimiterIdle {
+			delete(s.clientLimiters, key)
+		}
+	}
+	cl, ok := s.clientLimiters[client]
+	if !ok {
+		cl = &clientLimiter{limiter: perMinute(s.opts.ProfileClientRateLimit)}
+		s.clientLimiters[client] = cl
+	}
+	cl.lastSeen = now
+	return cl.limiter
+}
+
+// limitProfiling applies the per-client and global rate limits to a profiling endpoint. Refused
+// requests get 429 with Retry-After; a request refused by one limit does not consume the other.
+func (s *Server) limitProfiling(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !mutating(r) {
+			next(w, r)
+			return
+		}
+
+		now := s.clock.Now()
+		client := s.clientLimiter(rateClient(r), now).ReserveN(now, 1)
+		if delay := client.DelayFrom(now); !client.OK() || delay > 0 {
+			client.CancelAt(now)
+			rejectRateLimited(w, r, "client", delay)
+			return
+		}
+		global := s.globalLimiter.ReserveN(now, 1)
+		if delay := global.DelayFrom(now); !global.OK() || delay > 0 {
+			global.CancelAt(now)
+			client.CancelAt(now)
+			rejectRateLimited(w, r, "global", delay)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// rejectRateLimited answers 429, telling the client when the limit next admits a request
+func rejectRateLimited(w http.ResponseWriter, r *http.Request, scope string, delay time.Duration) {
+	metrics.APIRateLimitedTotal.WithLabelValues(r.Pattern, scope).Inc()
+	retry := max(int(math.Ceil(delay.Seconds())), 1)
+	w.Header().Set("Retry-After", strconv.Itoa(retry))
+	sendJSON(w, http.StatusTooManyRequests, Response{
+		Success: false,
+		Message: fmt.Sprintf("Rate limit exceeded (%s); retry in %ds", scope, retry),
+	})
+}
+
+// activeJobsLocked counts jobs whose recording has not stopped; s.jobsMu must be held
+func (s *Server) activeJobsLocked() int {
+	n := 0
+	for _, job := range s.jobs {
+		if job.State == JobStarting || job.State == JobRecording {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/recmeta"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/requestid"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/validation"
+)
+
+// maxLabels and the key and value limits keep a recording's labels well within the 8 KiB of
+// custom metadata GCS allows per object
+const (
+	maxLabels        = 16
+	maxLabelKeyLen   = 63
+	maxLabelValueLen = 256
+)
+
+// labelKeyPattern is a Kubernetes-style label name, which is also a valid metadata key
+var labelKeyPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9._-]*[a-z0-9])?$`)
+
+// validLabels checks the number of labels, their keys and their values
+func validLabels(field string, labels map[string]string) *validation.FieldError {
+	if len(labels) > maxLabels {
+		return &validation.FieldError{Field: field, Message: fmt.Sprintf("must have at most %d labels", maxLabels)}
+	}
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		if len(key) > maxLabelKeyLen || !labelKeyPattern.MatchString(key) {
+			return &validation.FieldError{Field: field, Message: fmt.Sprintf("key %q must be at most %d lower-case letters, digits, '.', '_' or '-', starting and ending with a letter or digit", key, maxLabelKeyLen)}
+		}
+		if err := validation.Text(field+"."+key, labels[key], maxLabelValueLen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordingMetadata returns the companion metadata for a recording request, or nil when the
+// caller gave no description, ticket, requester or labels
+func (s *Server) recordingMetadata(ctx context.Context, req ProfileRequest, filename string, pid int) *recmeta.Metadata {
+	if req.Description == "" && req.Ticket == "" && req.Requester == "" && len(req.Labels) == 0 {
+		return nil
+	}
+	return &recmeta.Metadata{
+		File:        filename,
+		Description: req.Description,
+		Ticket:      req.Ticket,
+		Requester:   req.Requester,
+		Labels:      req.Labels,
+		Pod:         os.Getenv("POD_NAME"),
+		Namespace:   os.Getenv("POD_NAMESPACE"),
+		Container:   req.Container,
+		PID:         pid,
+		Duration:    req.Duration,
+		StartedAt:   s.clock.Now().UTC(),
+		RequestID:   requestid.FromContext(ctx),
+	}
+}
+
+// writeRecordingMetadata writes {name}.meta.json next to a recording. It is written under a
+// hidden name and renamed, so the daemon never reads a partial file.
+func (s *Server) writeRecordingMetadata(recordingPath string, meta *recmeta.Metadata) error {
+	data, err := meta.Marshal()
+	if err != nil {
+		return err
+	}
+	path := recmeta.CompanionPath(recordingPath)
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err := s.fs.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := s.fs.Rename(tmp, path); err != nil {
+		s.fs.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// readRecordingMetadata returns the metadata stored next to a recording, or nil
+func (s *Server) readRecordingMetadata(recordingPath string) *recmeta.Metadata {
+	data, err := s.fs.ReadFile(recmeta.CompanionPath(recordingPath))
+	if err != nil {
+		return nil
+	}
+	meta, err := recmeta.Parse(data)
+	if err != nil {
+		return nil
+	}
+	return meta
+}
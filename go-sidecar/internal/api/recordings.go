@@ -0,0 +1,264 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+)
+
+// recordingsFile persists the recording registry in the profile directory, so a restarted
+// sidecar still knows the recordings it left running. Hidden files are not uploaded.
+const recordingsFile = ".recordings.json"
+
+// errDuplicateRecording is returned by newJob when the JVM already has a recording by that name
+var errDuplicateRecording = errors.New("a recording with this name is already running")
+
+// RegisteredRecording is a recording this sidecar started and has not seen stop
+type RegisteredRecording struct {
+	Name     string    `json:"name"`
+	PID      int       `json:"pid"`
+	Engine   string    `json:"engine"`
+	Duration string    `json:"duration,omitempty"`
+	Path     string    `json:"path,omitempty"` // empty while the recording is starting
+	Tenant   string    `json:"tenant,omitempty"`
+	Started  time.Time `json:"started"`
+	Ends     time.Time `json:"ends,omitzero"` // when a timed recording writes its file
+}
+
+// recordingKey identifies a recording: JFR names are unique per JVM, not per pod
+type recordingKey struct {
+	pid  int
+	name string
+}
+
+// expired reports whether a timed recording has ended by now
+func (rec *RegisteredRecording) expired(now time.Time) bool {
+	return !rec.Ends.IsZero() && now.After(rec.Ends)
+}
+
+// reserveRecording registers a recording about to start, failing with errDuplicateRecording while
+// the JVM has one by the same name. s.jobsMu must be held, so the check and reservation are atomic
+// with the concurrency limit.
+func (s *Server) reserveRecording(pid int, req ProfileRequest, tenantName string) error {
+	now := s.clock.Now()
+	s.recordingsMu.Lock()
+	defer s.recordingsMu.Unlock()
+	key := recordingKey{pid, req.Name}
+	if rec := s.recordings[key]; rec != nil && !rec.expired(now) {
+		return errDuplicateRecording
+	}
+	s.recordings[key] = &RegisteredRecording{
+		Name:     req.Name,
+		PID:      pid,
+		Engine:   req.Engine,
+		Duration: req.Duration,
+		Tenant:   tenantName,
+		Started:  now.UTC(),
+	}
+	return nil
+}
+
+// registerStartedRecording records that a recording is running and writes to path. Recordings
+// started without a job, e.g. by rollouts, are added here.
+func (s *Server) registerStartedRecording(pid int, req ProfileRequest, path string) {
+	now := s.clock.Now()
+	s.recordingsMu.Lock()
+	defer s.recordingsMu.Unlock()
+	key := recordingKey{pid, req.Name}
+	rec := s.recordings[key]
+	if rec == nil {
+		rec = &RegisteredRecording{Name: req.Name, PID: pid, Engine: req.Engine, Duration: req.Duration}
+		s.recordings[key] = rec
+	}
+	rec.Path = path
+	rec.Started = now.UTC()
+	if d, err := time.ParseDuration(req.Duration); err == nil && d > 0 {
+		rec.Ends = now.Add(d + recordingWriteGrace).UTC()
+	}
+	s.persistRecordingsLocked()
+}
+
+// unregisterRecording forgets a recording that stopped or failed to start
+func (s *Server) unregisterRecording(pid int, name string) {
+	s.recordingsMu.Lock()
+	defer s.recordingsMu.Unlock()
+	key := recordingKey{pid, name}
+	rec := s.recordings[key]
+	if rec == nil {
+		return
+	}
+	delete(s.recordings, key)
+	if rec.Path != "" {
+		s.persistRecordingsLocked()
+	}
+}
+
+// registeredRecording returns a JVM's running recording by name, if this sidecar started it
+func (s *Server) registeredRecording(pid int, name string) (RegisteredRecording, bool) {
+	s.recordingsMu.Lock()
+	defer s.recordingsMu.Unlock()
+	rec := s.recordings[recordingKey{pid, name}]
+	if rec == nil || rec.expired(s.clock.Now()) {
+		return RegisteredRecording{}, false
+	}
+	return *rec, true
+}
+
+// registeredRecordings lists the running recordings of a JVM that the request's tenant owns,
+// oldest first
+func (s *Server) registeredRecordings(ctx context.Context, pid int) []RegisteredRecording {
+	now := s.clock.Now()
+	s.recordingsMu.Lock()
+	list := []RegisteredRecording{}
+	for _, rec := range s.recordings {
+		if rec.PID == pid && !rec.expired(now) {
+			list = append(list, *rec)
+		}
+	}
+	s.recordingsMu.Unlock()
+
+	list = slices.DeleteFunc(list, func(rec RegisteredRecording) bool { return !s.ownsRecording(ctx, rec.Name) })
+	slices.SortFunc(list, func(a, b RegisteredRecording) int { return a.Started.Compare(b.Started) })
+	return list
+}
+
+// reconcileRecordings drops the started JFR recordings of a JVM that JFR.check no longer lists,
+// such as recordings stopped from inside the JVM. async-profiler sessions are not in JFR.check.
+func (s *Server) reconcileRecordings(pid int, running []string) {
+	s.recordingsMu.Lock()
+	defer s.recordingsMu.Unlock()
+	changed := false
+	for key, rec := range s.recordings {
+		if key.pid == pid && rec.Engine == engineJFR && rec.Path != "" && !slices.Contains(running, key.name) {
+			delete(s.recordings, key)
+			changed = true
+		}
+	}
+	if changed {
+		s.persistRecordingsLocked()
+	}
+}
+
+// loadRecordings restores the persisted registry, dropping ended recordings and those of JVMs
+// that are gone
+func (s *Server) loadRecordings(ctx context.Context) {
+	data, err := s.fs.ReadFile(filepath.Join(s.cfg.ProfileDir, recordingsFile))
+	if err != nil {
+		return
+	}
+	var list []*RegisteredRecording
+	if err := json.Unmarshal(data, &list); err != nil {
+		logger.Log.WithError(err).Warn("Ignoring unreadable recordings file")
+		return
+	}
+	pids, err := s.jvm.JavaPIDs(ctx)
+	if err != nil {
+		logger.Log.WithError(err).Warn("Could not list Java processes, not restoring recordings")
+		return
+	}
+
+	now := s.clock.Now()
+	s.recordingsMu.Lock()
+	defer s.recordingsMu.Unlock()
+	for _, rec := range list {
+		if rec.Path == "" || rec.expired(now) || !slices.Contains(pids, rec.PID) {
+			continue
+		}
+		s.recordings[recordingKey{rec.PID, rec.Name}] = rec
+		if rec.Tenant != "" {
+			s.ownersMu.Lock()
+			s.owners[rec.Name] = rec.Tenant
+			s.ownersMu.Unlock()
+		}
+	}
+	if len(s.recordings) > 0 {
+		logger.Log.WithField("recordings", len(s.recordings)).Info("Restored running recordings")
+	}
+	s.persistRecordingsLocked()
+}
+
+// saveRecordingsLocked writes the started, unexpired recordings to the recordings file;
+// s.recordingsMu must be held
+func (s *Server) saveRecordingsLocked() error {
+	now := s.clock.Now()
+	list := make([]*RegisteredRecording, 0, len(s.recordings))
+	for key, rec := range s.recordings {
+		if rec.expired(now) {
+			delete(s.recordings, key)
+			continue
+		}
+		if rec.Path != "" {
+			list = append(list, rec)
+		}
+	}
+	slices.SortFunc(list, func(a, b *RegisteredRecording) int { return a.Started.Compare(b.Started) })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.cfg.ProfileDir, recordingsFile)
+	tmp := path + ".tmp"
+	if err := s.fs.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := s.fs.Rename(tmp, path); err != nil {
+		s.fs.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// persistRecordingsLocked saves the registry, logging a failure: it only costs the registry
+// across a restart. s.recordingsMu must be held.
+func (s *Server) persistRecordingsLocked() {
+	if err := s.saveRecordingsLocked(); err != nil {
+		logger.Log.WithError(err).Warn("Failed to persist recording registry")
+	}
+}
+
+// recordingExists reports whether a JVM has a running recording by name: one this sidecar
+// started, or one JFR.check lists. When JFR.check fails it gives the benefit of the doubt, and
+// the stop itself reports the JVM's answer.
+func (s *Server) recordingExists(ctx context.Context, pid int, name string) bool {
+	if _, ok := s.registeredRecording(pid, name); ok {
+		return true
+	}
+	running, err := s.checkRecordings(ctx, pid)
+	if err != nil {
+		return true
+	}
+	return slices.Contains(running, name)
+}
+
+// checkRecordings runs JFR.check, drops the registered recordings it no longer lists and returns
+// the names it does
+func (s *Server) checkRecordings(ctx context.Context, pid int) ([]string, error) {
+	output, err := s.jvm.Jcmd(ctx, pid, "JFR.check")
+	s.recordCheckTranscript(output, err)
+	if err != nil {
+		return nil, err
+	}
+	running := parseRecordingNames(string(output))
+	s.reconcileRecordings(pid, running)
+	return running, nil
+}
+
+// registryStatuses reports registered recordings as /running does JFR.check ones
+func registryStatuses(list []RegisteredRecording) []RecordingStatus {
+	recordings := make([]RecordingStatus, 0, len(list))
+	for _, rec := range list {
+		recordings = append(recordings, RecordingStatus{
+			Name:        rec.Name,
+			State:       "running",
+			Duration:    rec.Duration,
+			Destination: rec.Path,
+		})
+	}
+	return recordings
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/kube"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/metrics"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/version"
+)
+
+// Sidecars announce themselves to a central registry (usually the gateway) so fleet tooling
+// knows which pods are profilable right now and which sidecars are outdated. The registry is
+// expected to forget sidecars whose heartbeats stop.
+
+const registryRequestTimeout = 10 * time.Second
+
+// Registration describes this sidecar to the registry
+type Registration struct {
+	Pod          string    `json:"pod"`
+	Namespace    string    `json:"namespace"`
+	Node         string    `json:"node,omitempty"`
+	Address      string    `json:"address,omitempty"` // host:port of the API, when POD_IP is set
+	Version      string    `json:"version"`
+	Capabilities []string  `json:"capabilities"`
+	StartedAt    time.Time `json:"startedAt"`
+}
+
+// Heartbeat reports that the sidecar is alive and whether it can profile right now
+type Heartbeat struct {
+	Time       time.Time `json:"time"`
+	JVMs       int       `json:"jvms"`
+	Profilable bool      `json:"profilable"`
+	Error      string    `json:"error,omitempty"` // why no JVM can be attached to
+}
+
+// errNotRegistered is returned when the registry no longer knows the sidecar, e.g. after a restart
+var errNotRegistered = errors.New("sidecar not registered")
+
+// registration builds this sidecar's registration
+func (s *Server) registration() Registration {
+	reg := Registration{
+		Pod:          os.Getenv("POD_NAME"),
+		Namespace:    kube.Namespace(),
+		Node:         os.Getenv("NODE_NAME"),
+		Version:      version.String(),
+		Capabilities: s.capabilities(),
+		StartedAt:    s.clock.Now(),
+	}
+	if ip := os.Getenv("POD_IP"); ip != "" {
+		reg.Address = net.JoinHostPort(ip, s.cfg.APIPort)
+	}
+	return reg
+}
+
+// capabilities lists the optional features this sidecar can serve
+func (s *Server) capabilities() []string {
+	caps := []string{"jfr", "heapdump", "rollouts", "transcripts", "schedules"}
+	if s.commandAvailable(s.opts.AsyncProfilerPath) {
+		caps = append(caps, "native:async-profiler")
+	}
+	if s.commandAvailable(s.opts.PerfPath) {
+		caps = append(caps, "native:perf")
+	}
+	if s.continuousEnabled() {
+		caps = append(caps, "continuous")
+	}
+	if s.triggersEnabled() {
+		caps = append(caps, "triggers")
+	}
+	if s.opts.StreamUpload {
+		caps = append(caps, "streaming-upload")
+	}
+	if s.opts.AttachNsenter {
+		caps = append(caps, "attach:nsenter")
+	}
+	if s.opts.AttachNative {
+		caps = append(caps, "attach:native")
+	}
+	if s.jolokia != nil {
+		caps = append(caps, "attach:jolokia")
+	}
+	if s.tenants != nil {
+		caps = append(caps, "tenants")
+	}
+	if s.reviewer != nil {
+		caps = append(caps, "kube-auth")
+	}
+	if s.opts.TLSCert != "" {
+		caps = append(caps, "tls")
+	}
+	if s.opts.TLSClientCA != "" {
+		caps = append(caps, "mtls")
+	}
+	return caps
+}
+
+// commandAvailable reports whether the runner can execute name, when it is able to tell
+func (s *Server) commandAvailable(name string) bool {
+	prober, ok := s.runner.(interface{ Available(name string) bool })
+	return ok && prober.Available(name)
+}
+
+// runRegistration registers with the registry and sends heartbeats until ctx is cancelled,
+// registering again whenever the registry has forgotten the sidecar
+func (s *Server) runRegistration(ctx context.Context) {
+	reg := s.registration()
+	log := logger.Log.WithField("registry", s.opts.RegistryURL)
+
+	registered := false
+	beat := func() {
+		var err error
+		if registered {
+			err = s.sendHeartbeat(ctx, reg)
+		}
+		if !registered || errors.Is(err, errNotRegistered) {
+			if err = s.register(ctx, reg); err == nil {
+				registered = true
+				log.WithField("capabilities", reg.Capabilities).Info("Registered with sidecar registry")
+			}
+		}
+		if err != nil && ctx.Err() == nil {
+			metrics.RegistryHeartbeatFailuresTotal.Inc()
+			log.WithError(err).Warn("Sidecar registry heartbeat failed")
+		}
+		metrics.RegistryRegistered.Set(boolGauge(registered))
+	}
+
+	beat()
+	ticker := time.NewTicker(s.opts.RegistryHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			beat()
+		}
+	}
+}
+
+// register announces the sidecar
+func (s *Server) register(ctx context.Context, reg Registration) error {
+	return s.registryRequest(ctx, http.MethodPost, "/v1/sidecars", reg)
+}
+
+// sendHeartbeat reports liveness and whether a JVM can currently be attached to
+func (s *Server) sendHeartbeat(ctx context.Context, reg Registration) error {
+	hb := Heartbeat{Time: s.clock.Now()}
+	pids, err := s.jvm.JavaPIDs(ctx)
+	if err != nil {
+		hb.Error = err.Error()
+	} else {
+		hb.JVMs = len(pids)
+		hb.Profilable = true
+	}
+	return s.registryRequest(ctx, http.MethodPut, sidecarPath(reg)+"/heartbeat", hb)
+}
+
+// deregister removes the sidecar from the registry during shutdown
+func (s *Server) deregister(ctx context.Context) {
+	reg := s.registration()
+	if err := s.registryRequest(ctx, http.MethodDelete, sidecarPath(reg), nil); err != nil && !errors.Is(err, errNotRegistered) {
+		logger.Log.WithError(err).Warn("Failed to deregister from sidecar registry")
+		return
+	}
+	metrics.RegistryRegistered.Set(0)
+	logger.Log.Info("Deregistered from sidecar registry")
+}
+
+// sidecarPath is the registry resource of one sidecar
+func sidecarPath(reg Registration) string {
+	return fmt.Sprintf("/v1/sidecars/%s/%s", url.PathEscape(reg.Namespace), url.PathEscape(reg.Pod))
+}
+
+// registryRequest sends body as JSON to the registry. A 404 means the sidecar is unknown.
+func (s *Server) registryRequest(ctx context.Context, method, path string, body any) error {
+	ctx, cancel := context.WithTimeout(ctx, registryRequestTimeout)
+	defer cancel()
+
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return fmt.Errorf("failed to encode registry request: %w", err)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.opts.RegistryURL+path, &payload)
+	if err != nil {
+		return fmt.Errorf("failed to create registry request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if s.opts.RegistryToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.opts.RegistryToken)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("registry %s %s failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errNotRegistered
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("registry %s %s returned status %d", method, path, resp.StatusCode)
+	}
+	return nil
+}
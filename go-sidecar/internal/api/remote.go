@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/fakejvm"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/uploader"
+)
+
+// remote returns the sidecar's connection to the upload destination: the injected uploader,
+// or one created on first use from the same GCS_* settings as the daemon
+func (s *Server) remote() (uploader.Uploader, error) {
+	s.uploaderOnce.Do(func() {
+		if s.uploader == nil {
+			s.uploader, s.uploaderErr = uploader.NewFromConfig(context.Background(), s.cfg, fakejvm.Enabled())
+		}
+	})
+	return s.uploader, s.uploaderErr
+}
+
+// remoteListHandler lists objects already uploaded for this pod
+func (s *Server) remoteListHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendJSON(w, http.StatusMethodNotAllowed, Response{
+			Success: false,
+			Message: "Method not allowed",
+		})
+		return
+	}
+
+	u, err := s.remote()
+	if err != nil {
+		sendJSON(w, http.StatusServiceUnavailable, Response{
+			Success: false,
+			Message: fmt.Sprintf("Upload destination not configured: %v", err),
+		})
+		return
+	}
+	lister, ok := u.(uploader.Lister)
+	if !ok {
+		sendJSON(w, http.StatusNotImplemented, Response{
+			Success: false,
+			Message: fmt.Sprintf("Listing is not supported for %s", u.Destination()),
+		})
+		return
+	}
+
+	ctx := uploadScope(r.Context())
+	objects, err := lister.ListPod(ctx, os.Getenv("POD_NAME"))
+	if err != nil {
+		sendJSON(w, http.StatusBadGateway, Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to list uploaded recordings: %v", err),
+		})
+		return
+	}
+	if objects == nil {
+		objects = []uploader.ObjectInfo{}
+	}
+
+	sendJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("Found %d uploaded files in %s", len(objects), uploader.DestinationFor(ctx, u)),
+		Data:    objects,
+	})
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/config"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/marker"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/recmeta"
+)
+
+// defaultRetentionInterval is how often the retention janitor sweeps the profile directory
+const defaultRetentionInterval = 10 * time.Minute
+
+// RetentionPolicy bounds the recordings kept on the profile volume when no daemon uploads and
+// removes them. Either limit may be 0 (off); with both off the janitor does not run.
+type RetentionPolicy struct {
+	MaxAge   time.Duration // recordings last modified longer ago are deleted
+	MaxBytes int64         // the oldest recordings are deleted until the rest fit
+	Interval time.Duration
+}
+
+// retentionFromEnv reads RETENTION_MAX_AGE, RETENTION_MAX_BYTES and RETENTION_INTERVAL
+func retentionFromEnv() RetentionPolicy {
+	return RetentionPolicy{
+		MaxAge:   config.EnvDuration("RETENTION_MAX_AGE", 0),
+		MaxBytes: config.EnvSize("RETENTION_MAX_BYTES", 0),
+		Interval: config.EnvDuration("RETENTION_INTERVAL", defaultRetentionInterval),
+	}
+}
+
+// enabled reports whether the policy limits anything
+func (p RetentionPolicy) enabled() bool {
+	return (p.MaxAge > 0 || p.MaxBytes > 0) && p.Interval > 0
+}
+
+// retainedRecording is a finished recording the janitor may delete
+type retainedRecording struct {
+	path     string
+	size     int64
+	modified time.Time
+}
+
+// runRetention applies the policy at startup and then every interval until ctx is cancelled
+func (s *Server) runRetention(ctx context.Context, policy RetentionPolicy) {
+	logger.Log.WithFields(map[string]any{
+		"maxAge":   policy.MaxAge.String(),
+		"maxBytes": policy.MaxBytes,
+		"interval": policy.Interval.String(),
+	}).Info("Local recording retention enabled")
+
+	ticker := time.NewTicker(policy.Interval)
+	defer ticker.Stop()
+	for {
+		s.applyRetention(ctx, policy)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// applyRetention deletes the .jfr and .jfr.gz files in the profile directory that are older than MaxAge, then
+// the oldest ones beyond MaxBytes. Recordings still running or being read are never deleted, but
+// count toward the budget.
+func (s *Server) applyRetention(ctx context.Context, policy RetentionPolicy) {
+	var recordings []retainedRecording
+	var busyBytes int64
+	err := s.fs.WalkDir(s.cfg.ProfileDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), ".") || !isRecordingFile(d.Name()) {
+			return nil // files vanish while being walked
+		}
+		info, err := d.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		if s.recordingBusy(path) {
+			busyBytes += info.Size()
+			return nil
+		}
+		recordings = append(recordings, retainedRecording{path: path, size: info.Size(), modified: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		logger.Log.WithError(err).Warn("Retention janitor failed to walk the profile directory")
+		return
+	}
+
+	// Oldest first, so the size budget keeps the newest recordings
+	slices.SortFunc(recordings, func(a, b retainedRecording) int {
+		return cmp.Or(a.modified.Compare(b.modified), strings.Compare(a.path, b.path))
+	})
+	total := busyBytes
+	for _, rec := range recordings {
+		total += rec.size
+	}
+	now := s.clock.Now()
+	for _, rec := range recordings {
+		if ctx.Err() != nil {
+			return
+		}
+		reason := ""
+		switch {
+		case policy.MaxAge > 0 && now.Sub(rec.modified) > policy.MaxAge:
+			reason = "age"
+		case policy.MaxBytes > 0 && total > policy.MaxBytes:
+			reason = "size"
+		default:
+			continue
+		}
+		if err := s.fs.Remove(rec.path); err != nil {
+			logger.Log.WithError(err).WithField("path", rec.path).Warn("Failed to delete recording past retention")
+			continue
+		}
+		if err := s.fs.Remove(recmeta.CompanionPath(rec.path)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			logger.Log.WithError(err).WithField("path", rec.path).Warn("Failed to delete recording metadata")
+		}
+		if err := s.fs.Remove(marker.Path(rec.path)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			logger.Log.WithError(err).WithField("path", rec.path).Warn("Failed to delete completion marker")
+		}
+		total -= rec.size
+		logger.Log.WithFields(map[string]any{
+			"path":   rec.path,
+			"bytes":  rec.size,
+			"reason": reason,
+		}).Info("Deleted recording past retention")
+	}
+}
+
+// recordingBusy reports whether a recording file is still written by a running recording or
+// held by a download or an in-process upload
+func (s *Server) recordingBusy(path string) bool {
+	if s.files.InUse(path) {
+		return true
+	}
+	now := s.clock.Now()
+	s.recordingsMu.Lock()
+	defer s.recordingsMu.Unlock()
+	for _, rec := range s.recordings {
+		if rec.expired(now) {
+			continue
+		}
+		// A starting recording's path is not known yet, only its file name
+		if rec.Path == "" && recordingNameOf(filepath.Base(path)) == rec.Name || rec.Path != "" && filepath.Clean(rec.Path) == filepath.Clean(path) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/sampling"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/validation"
+)
+
+const defaultRolloutProfileDuration = "60s"
+
+var rolloutIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RolloutRequest is sent by deployment tools (Argo Rollouts, Spinnaker) at rollout start/finish
+type RolloutRequest struct {
+	RolloutID  string   `json:"rolloutId"`            // rollout or pipeline execution identifier
+	Phase      string   `json:"phase"`                // "start" or "finish"
+	CanaryPods []string `json:"canaryPods,omitempty"` // pods to profile; empty means every pod receiving the call
+	Duration   string   `json:"duration,omitempty"`   // profile duration, defaults to 60s
+	Container  string   `json:"container,omitempty"`  // target container when the pod runs several JVMs
+
+	// Sampling: profile only SamplePercent of Targets, stratified by node.
+	// Seed defaults to a hash of the rollout ID so all pods agree on the sample.
+	SamplePercent float64           `json:"samplePercent,omitempty"`
+	Seed          *int64            `json:"seed,omitempty"`
+	Targets       []sampling.Target `json:"targets,omitempty"`
+}
+
+// Validate checks the rollout ID, phase and sampling parameters
+func (req *RolloutRequest) Validate() validation.Errors {
+	errs := validation.Collect(
+		validation.Required("rolloutId", req.RolloutID),
+		validation.OneOf("phase", req.Phase, "start", "finish"),
+		validRecordingDuration("duration", req.Duration),
+	)
+	if req.RolloutID != "" && !rolloutIDPattern.MatchString(req.RolloutID) {
+		errs = append(errs, validation.FieldError{Field: "rolloutId", Message: "may only contain letters, digits, '.', '_' and '-' (at most 64)"})
+	}
+	if req.SamplePercent < 0 || req.SamplePercent > 100 {
+		errs = append(errs, validation.FieldError{Field: "samplePercent", Message: "must be between 0 and 100"})
+	}
+	return errs
+}
+
+// validLimits checks the duration against RECORDING_MAX_DURATION
+func (req *RolloutRequest) validLimits(s *Server) validation.Errors {
+	return validation.Collect(s.validDurationLimit("duration", req.Duration))
+}
+
+// rolloutHandler records a short profile of this pod when it is a canary in a rollout.
+// Recordings are named rollout_{ID}_{PHASE}_{TIMESTAMP} for before/after comparison.
+func (s *Server) rolloutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendJSON(w, http.StatusMethodNotAllowed, Response{
+			Success: false,
+			Message: "Method not allowed",
+		})
+		return
+	}
+
+	var req RolloutRequest
+	if !s.decodeRequest(w, r, &req) {
+		return
+	}
+
+	podName := os.Getenv("POD_NAME")
+	if len(req.CanaryPods) > 0 && !slices.Contains(req.CanaryPods, podName) {
+		sendJSON(w, http.StatusOK, Response{
+			Success: true,
+			Message: fmt.Sprintf("Pod '%s' is not a canary for rollout '%s', skipping", podName, req.RolloutID),
+		})
+		return
+	}
+
+	if req.SamplePercent > 0 && !inRolloutSample(req, podName) {
+		sendJSON(w, http.StatusOK, Response{
+			Success: true,
+			Message: fmt.Sprintf("Pod '%s' was not sampled for rollout '%s', skipping", podName, req.RolloutID),
+		})
+		return
+	}
+
+	if s.rejectIfOverQuota(w) {
+		return
+	}
+
+	profile := ProfileRequest{
+		Name:     fmt.Sprintf("rollout_%s_%s_%s", req.RolloutID, req.Phase, s.timestampSuffix(s.clock.Now())),
+		Duration: req.Duration,
+	}
+	if profile.Duration == "" {
+		profile.Duration = defaultRolloutProfileDuration
+	}
+
+	pid, err := s.getJavaPID(r.Context(), req.Container)
+	if err != nil {
+		sendJSON(w, http.StatusInternalServerError, Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to find Java process: %v", err),
+		})
+		return
+	}
+
+	_, output, err := s.startRecording(r.Context(), pid, profile)
+	if err != nil {
+		sendJSON(w, commandStatus(w, err), Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to start profiling: %v, output: %s", err, string(output)),
+		})
+		return
+	}
+
+	logger.Log.WithFields(map[string]interface{}{
+		"rolloutId": req.RolloutID,
+		"phase":     req.Phase,
+		"name":      profile.Name,
+	}).Info("Started rollout profile")
+
+	sendJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "Rollout profiling started successfully",
+		Data: map[string]string{
+			"pid":       strconv.Itoa(pid),
+			"rolloutId": req.RolloutID,
+			"phase":     req.Phase,
+			"name":      profile.Name,
+			"duration":  profile.Duration,
+			"filename":  s.recordingFilename(profile),
+		},
+	})
+}
+
+// inRolloutSample reports whether this pod falls within the rollout's sample
+func inRolloutSample(req RolloutRequest, podName string) bool {
+	seed := sampling.SeedFromString(req.RolloutID)
+	if req.Seed != nil {
+		seed = *req.Seed
+	}
+
+	if len(req.Targets) > 0 {
+		return sampling.Contains(sampling.Stratified(req.Targets, req.SamplePercent, seed), podName)
+	}
+	return sampling.Sampled(podName, req.SamplePercent, seed)
+}
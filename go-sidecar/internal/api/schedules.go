@@ -0,0 +1,443 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/metrics"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/schedule"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/tenant"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/validation"
+)
+
+// schedulesFile persists schedules in the profile directory, so they survive container restarts.
+// Hidden files are not uploaded.
+const schedulesFile = ".schedules.json"
+
+// Schedule starts a recording whenever its cron expression matches
+type Schedule struct {
+	ID        string         `json:"id"`
+	Cron      string         `json:"cron"`               // e.g. "0 2 * * *" or "@daily"
+	Timezone  string         `json:"timezone,omitempty"` // IANA zone the expression is read in; UTC when empty
+	Enabled   bool           `json:"enabled"`
+	Recording ProfileRequest `json:"recording"` // as for /create; name is a prefix the start time is appended to
+	Tenant    string         `json:"tenant,omitempty"`
+	Created   time.Time      `json:"created"`
+	NextRun   time.Time      `json:"nextRun,omitzero"`
+	LastRun   time.Time      `json:"lastRun,omitzero"`
+	LastJob   string         `json:"lastJob,omitempty"`   // job of the last recording started, see /jobs/{id}
+	LastError string         `json:"lastError,omitempty"` // why the last run did not start a recording
+
+	cron *schedule.Cron
+	loc  *time.Location
+}
+
+// ScheduleRequest creates or replaces a schedule
+type ScheduleRequest struct {
+	Cron      string         `json:"cron"`
+	Timezone  string         `json:"timezone,omitempty"`
+	Enabled   *bool          `json:"enabled,omitempty"` // defaults to true
+	Recording ProfileRequest `json:"recording"`
+}
+
+// Validate checks the cron expression, time zone and recording parameters
+func (req *ScheduleRequest) Validate() validation.Errors {
+	var errs validation.Errors
+	if req.Cron == "" {
+		errs = append(errs, validation.FieldError{Field: "cron", Message: "is required"})
+	} else if _, err := schedule.Parse(req.Cron); err != nil {
+		errs = append(errs, validation.FieldError{Field: "cron", Message: err.Error()})
+	}
+	if _, err := time.LoadLocation(req.Timezone); err != nil {
+		errs = append(errs, validation.FieldError{Field: "timezone", Message: fmt.Sprintf("unknown time zone %q", req.Timezone)})
+	}
+	return append(errs, recordingErrors(req.Recording.Validate())...)
+}
+
+// validLimits checks the recording against the server's limits
+func (req *ScheduleRequest) validLimits(s *Server) validation.Errors {
+	return recordingErrors(req.Recording.validLimits(s))
+}
+
+// recordingErrors moves a schedule's recording errors under its "recording" field
+func recordingErrors(errs validation.Errors) validation.Errors {
+	for i := range errs {
+		errs[i].Field = "recording." + errs[i].Field
+	}
+	return errs
+}
+
+// apply copies the request into sch and computes its next run after now
+func (req *ScheduleRequest) apply(sch *Schedule, now time.Time) {
+	sch.Cron = req.Cron
+	sch.Timezone = req.Timezone
+	sch.Enabled = req.Enabled == nil || *req.Enabled
+	sch.Recording = req.Recording
+	sch.compile()
+	sch.NextRun = sch.next(now)
+}
+
+// compile parses the expression and zone of a validated or persisted schedule
+func (sch *Schedule) compile() error {
+	c, err := schedule.Parse(sch.Cron)
+	if err != nil {
+		return err
+	}
+	loc, err := time.LoadLocation(sch.Timezone)
+	if err != nil {
+		return err
+	}
+	sch.cron, sch.loc = c, loc
+	return nil
+}
+
+// next returns the schedule's first run after now, or the zero time when it is disabled
+func (sch *Schedule) next(now time.Time) time.Time {
+	if !sch.Enabled || sch.cron == nil {
+		return time.Time{}
+	}
+	return sch.cron.Next(now.In(sch.loc)).UTC()
+}
+
+// scheduleOwner names the tenant a request acts for, "" without tenancy
+func scheduleOwner(ctx context.Context) string {
+	if t := tenant.FromContext(ctx); t != nil {
+		return t.Name
+	}
+	return ""
+}
+
+// createScheduleHandler registers a schedule and answers 201 with it
+func (s *Server) createScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	var req ScheduleRequest
+	if !s.decodeRequest(w, r, &req) {
+		return
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	now := s.clock.Now()
+	sch := &Schedule{ID: hex.EncodeToString(b), Tenant: scheduleOwner(r.Context()), Created: now.UTC()}
+	req.apply(sch, now)
+
+	s.schedulesMu.Lock()
+	if len(s.schedules) >= s.opts.MaxSchedules {
+		s.schedulesMu.Unlock()
+		sendJSON(w, http.StatusConflict, Response{
+			Success: false,
+			Message: fmt.Sprintf("%d schedules already exist (MAX_SCHEDULES); delete one first", s.opts.MaxSchedules),
+		})
+		return
+	}
+	s.schedules[sch.ID] = sch
+	snapshot := *sch
+	err := s.saveSchedulesLocked()
+	s.schedulesMu.Unlock()
+	s.wakeScheduler()
+	if err != nil {
+		logger.Log.WithError(err).Warn("Failed to persist schedules")
+	}
+
+	logger.Log.WithContext(r.Context()).WithFields(map[string]any{
+		"schedule": sch.ID,
+		"cron":     sch.Cron,
+		"nextRun":  sch.NextRun,
+	}).Info("Recording schedule created")
+	w.Header().Set("Location", "/schedules/"+sch.ID)
+	sendJSON(w, http.StatusCreated, Response{
+		Success: true,
+		Message: "Schedule created",
+		Data:    snapshot,
+	})
+}
+
+// listSchedulesHandler lists the caller's schedules, oldest first
+func (s *Server) listSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	owner := scheduleOwner(r.Context())
+	s.schedulesMu.Lock()
+	list := make([]Schedule, 0, len(s.schedules))
+	for _, sch := range s.schedules {
+		if sch.Tenant == owner {
+			list = append(list, *sch)
+		}
+	}
+	s.schedulesMu.Unlock()
+	slices.SortFunc(list, func(a, b Schedule) int { return a.Created.Compare(b.Created) })
+
+	sendJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("Found %d schedules", len(list)),
+		Data:    list,
+	})
+}
+
+// getScheduleHandler returns one schedule
+func (s *Server) getScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	s.schedulesMu.Lock()
+	sch, ok := s.ownedSchedule(r)
+	var snapshot Schedule
+	if ok {
+		snapshot = *sch
+	}
+	s.schedulesMu.Unlock()
+	if !ok {
+		sendScheduleNotFound(w, r)
+		return
+	}
+	sendJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "Schedule retrieved",
+		Data:    snapshot,
+	})
+}
+
+// updateScheduleHandler replaces a schedule's expression and recording parameters, keeping its
+// run history
+func (s *Server) updateScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	var req ScheduleRequest
+	if !s.decodeRequest(w, r, &req) {
+		return
+	}
+
+	s.schedulesMu.Lock()
+	sch, ok := s.ownedSchedule(r)
+	if !ok {
+		s.schedulesMu.Unlock()
+		sendScheduleNotFound(w, r)
+		return
+	}
+	req.apply(sch, s.clock.Now())
+	snapshot := *sch
+	err := s.saveSchedulesLocked()
+	s.schedulesMu.Unlock()
+	s.wakeScheduler()
+	if err != nil {
+		logger.Log.WithError(err).Warn("Failed to persist schedules")
+	}
+
+	sendJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "Schedule updated",
+		Data:    snapshot,
+	})
+}
+
+// deleteScheduleHandler removes a schedule; recordings it already started keep running
+func (s *Server) deleteScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	s.schedulesMu.Lock()
+	sch, ok := s.ownedSchedule(r)
+	if !ok {
+		s.schedulesMu.Unlock()
+		sendScheduleNotFound(w, r)
+		return
+	}
+	delete(s.schedules, sch.ID)
+	err := s.saveSchedulesLocked()
+	s.schedulesMu.Unlock()
+	s.wakeScheduler()
+	if err != nil {
+		logger.Log.WithError(err).Warn("Failed to persist schedules")
+	}
+
+	sendJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("Schedule '%s' deleted", sch.ID),
+	})
+}
+
+// ownedSchedule looks up the {id} of the request among the caller's schedules; s.schedulesMu
+// must be held
+func (s *Server) ownedSchedule(r *http.Request) (*Schedule, bool) {
+	sch, ok := s.schedules[r.PathValue("id")]
+	if !ok || sch.Tenant != scheduleOwner(r.Context()) {
+		return nil, false
+	}
+	return sch, true
+}
+
+func sendScheduleNotFound(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, http.StatusNotFound, Response{
+		Success: false,
+		Message: fmt.Sprintf("No schedule with ID '%s'", r.PathValue("id")),
+	})
+}
+
+// wakeScheduler makes runSchedules recompute its next wake-up after a change
+func (s *Server) wakeScheduler() {
+	select {
+	case s.scheduleWake <- struct{}{}:
+	default:
+	}
+}
+
+// runSchedules starts the recordings of due schedules until ctx is cancelled. Runs missed while
+// the sidecar was down are skipped, not caught up.
+func (s *Server) runSchedules(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.scheduleWake:
+		case <-timer.C:
+			s.runDueSchedules(ctx)
+		}
+		timer.Reset(s.untilNextSchedule())
+	}
+}
+
+// untilNextSchedule returns how long to sleep before the earliest enabled schedule is due
+func (s *Server) untilNextSchedule() time.Duration {
+	now := s.clock.Now()
+	wait := time.Hour // re-check periodically so clock jumps are noticed
+	s.schedulesMu.Lock()
+	defer s.schedulesMu.Unlock()
+	for _, sch := range s.schedules {
+		if !sch.NextRun.IsZero() {
+			wait = min(wait, max(sch.NextRun.Sub(now), 0))
+		}
+	}
+	return wait
+}
+
+// runDueSchedules starts a recording for every schedule whose run time has come
+func (s *Server) runDueSchedules(ctx context.Context) {
+	now := s.clock.Now()
+	s.schedulesMu.Lock()
+	var due []Schedule
+	for _, sch := range s.schedules {
+		if sch.NextRun.IsZero() || sch.NextRun.After(now) {
+			continue
+		}
+		sch.LastRun = now.UTC()
+		sch.NextRun = sch.next(now)
+		due = append(due, *sch)
+	}
+	s.schedulesMu.Unlock()
+	if len(due) == 0 {
+		return
+	}
+
+	for _, sch := range due {
+		jobID, err := s.startScheduledRecording(ctx, sch)
+		log := logger.Log.WithFields(map[string]any{"schedule": sch.ID, "cron": sch.Cron})
+		result := "started"
+		if err != nil {
+			result = "failed"
+			log.WithError(err).Warn("Scheduled recording did not start")
+		} else {
+			log.WithField("job", jobID).Info("Scheduled recording started")
+		}
+		metrics.ScheduledRecordingsTotal.WithLabelValues(result).Inc()
+
+		s.schedulesMu.Lock()
+		if current, ok := s.schedules[sch.ID]; ok {
+			current.LastJob, current.LastError = jobID, ""
+			if err != nil {
+				current.LastError = err.Error()
+			}
+		}
+		s.schedulesMu.Unlock()
+	}
+
+	s.schedulesMu.Lock()
+	err := s.saveSchedulesLocked()
+	s.schedulesMu.Unlock()
+	if err != nil {
+		logger.Log.WithError(err).Warn("Failed to persist schedules")
+	}
+}
+
+// startScheduledRecording starts one run of a schedule as a recording job, like /create
+func (s *Server) startScheduledRecording(ctx context.Context, sch Schedule) (string, error) {
+	if sch.Tenant != "" {
+		t, ok := s.tenants.ByName(sch.Tenant)
+		if !ok {
+			return "", fmt.Errorf("tenant %q no longer exists", sch.Tenant)
+		}
+		ctx = tenant.WithTenant(ctx, t)
+	}
+	if _, err := s.fs.Stat(filepath.Join(s.cfg.ProfileDir, quotaMarker)); err == nil {
+		return "", errors.New("the namespace is over its upload quota")
+	}
+
+	req := sch.Recording
+	req.Duration = cmp.Or(req.Duration, "60s")
+	req.Name = cmp.Or(req.Name, "schedule-"+sch.ID) + "_" + s.timestampSuffix(s.clock.Now())
+	if err := s.checkDiskSpace(&req); err != nil {
+		return "", err
+	}
+	pid, err := s.targetJVM(ctx, req.target())
+	if err != nil {
+		return "", fmt.Errorf("failed to find Java process: %w", err)
+	}
+	job, err := s.newJob(ctx, pid, req)
+	if err != nil {
+		return "", err
+	}
+	s.starting.Add(1)
+	go s.runJob(context.WithoutCancel(ctx), job, req)
+	return job.ID, nil
+}
+
+// loadSchedules restores persisted schedules, dropping any that no longer parse
+func (s *Server) loadSchedules() {
+	data, err := s.fs.ReadFile(filepath.Join(s.cfg.ProfileDir, schedulesFile))
+	if err != nil {
+		return
+	}
+	var list []*Schedule
+	if err := json.Unmarshal(data, &list); err != nil {
+		logger.Log.WithError(err).Warn("Ignoring unreadable schedules file")
+		return
+	}
+
+	now := s.clock.Now()
+	s.schedulesMu.Lock()
+	defer s.schedulesMu.Unlock()
+	for _, sch := range list {
+		if err := sch.compile(); err != nil {
+			logger.Log.WithError(err).WithField("schedule", sch.ID).Warn("Dropping invalid schedule")
+			continue
+		}
+		sch.NextRun = sch.next(now)
+		s.schedules[sch.ID] = sch
+	}
+	if len(s.schedules) > 0 {
+		logger.Log.WithField("schedules", len(s.schedules)).Info("Restored recording schedules")
+	}
+}
+
+// saveSchedulesLocked writes every schedule to the schedules file; s.schedulesMu must be held
+func (s *Server) saveSchedulesLocked() error {
+	list := make([]*Schedule, 0, len(s.schedules))
+	for _, sch := range s.schedules {
+		list = append(list, sch)
+	}
+	slices.SortFunc(list, func(a, b *Schedule) int { return a.Created.Compare(b.Created) })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.cfg.ProfileDir, schedulesFile)
+	tmp := path + ".tmp"
+	if err := s.fs.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := s.fs.Rename(tmp, path); err != nil {
+		s.fs.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -3,53 +3,459 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/fs"
 	"net/http"
 	"os"
-	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/config"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/events"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/fakejvm"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/inuse"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/jolokia"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/kube"
 	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
-)
-
-const (
-	profileDir = "/tmp/jfr"
-	apiPort    = "8081"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/metrics"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/requestid"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/tenant"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/tracing"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/uploader"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/validation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"golang.org/x/time/rate"
 )
 
 type ProfileRequest struct {
-	Duration string `json:"duration"` // e.g., "60s"
-	Name     string `json:"name"`     // optional custom recording name (filename will be derived from this)
+	Duration  string `json:"duration"`            // e.g., "60s"
+	Name      string `json:"name"`                // optional custom recording name (filename will be derived from this)
+	Container string `json:"container,omitempty"` // target container when the pod runs several JVMs
+	PID       int    `json:"pid,omitempty"`       // target JVM by process ID (see /jvms)
+	MainClass string `json:"mainClass,omitempty"` // target JVM by main class or jar
+	Engine    string `json:"engine,omitempty"`    // "jfr" (default) or "async-profiler"
+	Mode      string `json:"mode,omitempty"`      // async-profiler: "cpu" (default), "wall", "alloc" or "lock"
+	Format    string `json:"format,omitempty"`    // async-profiler output: "jfr" (default) or "collapsed"
+	Settings  string `json:"settings,omitempty"`  // JFR settings: "default", "profile" or a .jfc path in the JVM's container
+	Preset    string `json:"preset,omitempty"`    // named settings such as "cpu" or "alloc" (see /presets)
+	MaxSize   string `json:"maxSize,omitempty"`   // keep at most this much data on disk, e.g. "256Mi"
+	MaxAge    string `json:"maxAge,omitempty"`    // keep at most this much history, e.g. "30m"
+	Ephemeral bool   `json:"ephemeral,omitempty"` // stop the recording when the sidecar shuts down (SHUTDOWN_STOP_RECORDINGS=ephemeral)
+
+	// CallbackURL receives a POST describing the file once the recording completes
+	CallbackURL string `json:"callbackUrl,omitempty"`
+
+	// Optional context kept in {name}.meta.json and set as object metadata on upload
+	Description string `json:"description,omitempty"`
+	Ticket      string `json:"ticket,omitempty"` // link to the issue being investigated
+	Requester   string `json:"requester,omitempty"`
+
+	// Labels are free-form key/value context such as team, ticket or reason, searchable on the
+	// uploaded object as label-<key> metadata
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
 type StopRequest struct {
-	Name string `json:"name"` // name of the JFR recording to stop
+	Name      string `json:"name"`                // name of the JFR recording to stop
+	Container string `json:"container,omitempty"` // target container when the pod runs several JVMs
+	PID       int    `json:"pid,omitempty"`       // target JVM by process ID (see /jvms)
+	MainClass string `json:"mainClass,omitempty"` // target JVM by main class or jar
+}
+
+// Validate checks the optional duration, name, engine, settings, retention and description fields
+func (req *ProfileRequest) Validate() validation.Errors {
+	errs := validation.Collect(
+		validRecordingDuration("duration", req.Duration),
+		validRecordingName("name", req.Name),
+		validPID("pid", req.PID),
+		validArgument("mainClass", req.MainClass),
+		validSettings("settings", req.Settings),
+		validMaxSize("maxSize", req.MaxSize),
+		validDuration("maxAge", req.MaxAge),
+		validation.Text("description", req.Description, 1024),
+		validation.URL("ticket", req.Ticket),
+		validation.Text("requester", req.Requester, 128),
+		validLabels("labels", req.Labels),
+		validation.URL("callbackUrl", req.CallbackURL),
+	)
+	return append(errs, req.validEngine()...)
+}
+
+// validLimits checks the duration, preset, retention and callback host against the server's limits
+func (req *ProfileRequest) validLimits(s *Server) validation.Errors {
+	return validation.Collect(
+		s.validDurationLimit("duration", req.Duration),
+		s.validPreset("preset", req.Preset),
+		s.validSizeLimit("maxSize", req.MaxSize),
+		s.validAgeLimit("maxAge", req.MaxAge),
+		s.validCallbackHost("callbackUrl", req.CallbackURL),
+	)
+}
+
+// Validate checks that a usable recording name was given
+func (req *StopRequest) Validate() validation.Errors {
+	return validation.Collect(
+		validation.Required("name", req.Name),
+		validArgument("name", req.Name),
+		validPID("pid", req.PID),
+		validArgument("mainClass", req.MainClass),
+	)
+}
+
+// target returns the request's JVM selector
+func (req *ProfileRequest) target() JVMSelector {
+	return JVMSelector{Container: req.Container, PID: req.PID, MainClass: req.MainClass}
+}
+
+// target returns the request's JVM selector
+func (req *StopRequest) target() JVMSelector {
+	return JVMSelector{Container: req.Container, PID: req.PID, MainClass: req.MainClass}
 }
 
 type Response struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
 	Data    any    `json:"data,omitempty"`
+
+	// RequestID echoes the X-Request-ID header; sendJSON fills it in
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// Server is the sidecar API. Its collaborators are injected through Deps; all state lives on
+// the Server rather than in package variables.
+type Server struct {
+	cfg      *config.Config
+	runner   CommandRunner // profilers and other commands that are not jcmd
+	jvm      JVMController
+	clock    Clock
+	fs       FS
+	tenants  *tenant.Registry
+	token    string
+	reviewer AccessReviewer
+	files    *inuse.Tracker
+	opts     Options
+
+	javaFilter     jvmFilter         // JAVA_CMDLINE_PATTERN and JAVA_ENV_MARKER
+	javaFilterErr  error             // an invalid filter stops the sidecar at startup
+	jolokia        *jolokia.Client   // nil unless JOLOKIA_URL is set
+	presets        map[string]Preset // the presets /create accepts, set by loadPresets before the API serves
+	nameLocation   *time.Location    // timezone of generated recording names
+	estimateProbes atomic.Int64      // numbers the probe recordings of /estimate
+
+	uploaderOnce sync.Once
+	uploader     uploader.Uploader
+	uploaderErr  error
+
+	transcriptMu    sync.Mutex
+	transcripts     map[string][]TranscriptEntry
+	transcriptOrder []string
+
+	ownersMu sync.Mutex
+	owners   map[string]string // recording name -> tenant name
+
+	heldMu sync.Mutex
+	held   map[string]*heldRecording // recording name -> file hold, standalone mode only
+
+	finishMu      sync.Mutex
+	finishing     map[string]*pendingRecording // recording name -> file to compress, mark or hand to the post hook once written
+	compressSlots chan struct{}                // bounds concurrent compressions
+
+	recordingsMu sync.Mutex
+	recordings   map[recordingKey]*RegisteredRecording // recordings started and not yet stopped
+
+	jobsMu   sync.Mutex
+	jobs     map[string]*Job // job ID -> recording job
+	jobOrder []string        // job IDs, oldest first
+	starting sync.WaitGroup  // jobs whose JFR.start has not returned yet
+
+	uploading sync.WaitGroup // DIRECT_UPLOAD uploads and recording compressions in progress
+
+	rateMu         sync.Mutex
+	clientLimiters map[string]*clientLimiter // rate-limit client -> token bucket
+	globalLimiter  *rate.Limiter
+
+	reviewMu sync.Mutex
+	reviews  map[string]reviewDecision // token hash + verb -> cached access review
+
+	listingMu sync.Mutex
+	listings  map[string]*profileListing // recording directory -> cached /list response
+
+	telemetryMu     sync.RWMutex
+	latestTelemetry *TelemetrySnapshot
+	telemetrySinks  []func(*TelemetrySnapshot) // OTLP metrics, Prometheus gauges
+	meterProvider   *sdkmetric.MeterProvider
+
+	schedulesMu  sync.Mutex
+	schedules    map[string]*Schedule // schedule ID -> cron schedule
+	scheduleWake chan struct{}        // signals runSchedules that schedules changed
+
+	heapDumping atomic.Bool // a GC.heap_dump is being written
+
+	continuousMu   sync.Mutex
+	continuous     ContinuousStatus
+	stopContinuous context.CancelFunc // ends the rotation loop; nil when continuous mode is off
+
+	triggersMu sync.Mutex
+	triggers   *TriggerConfig // nil when no threshold trigger is configured
+
+	closing chan struct{} // closed when shutdown begins, ending event streams
+}
+
+// NewServer builds a Server from deps, filling in production defaults for nil fields
+func NewServer(deps Deps) *Server {
+	opts := OptionsFromEnv()
+	if deps.Options != nil {
+		opts = *deps.Options
+	}
+	s := &Server{
+		cfg:            deps.Config,
+		opts:           opts,
+		jolokia:        newJolokiaClient(opts),
+		presets:        builtinPresets,
+		nameLocation:   nameLocation(opts.Timezone),
+		runner:         deps.Runner,
+		jvm:            deps.JVM,
+		clock:          deps.Clock,
+		fs:             deps.FS,
+		tenants:        deps.Tenants,
+		files:          deps.Files,
+		uploader:       deps.Uploader,
+		token:          deps.Token,
+		reviewer:       deps.Reviewer,
+		transcripts:    map[string][]TranscriptEntry{},
+		owners:         map[string]string{},
+		held:           map[string]*heldRecording{},
+		finishing:      map[string]*pendingRecording{},
+		compressSlots:  make(chan struct{}, max(opts.CompressConcurrency, 1)),
+		recordings:     map[recordingKey]*RegisteredRecording{},
+		listings:       map[string]*profileListing{},
+		reviews:        map[string]reviewDecision{},
+		clientLimiters: map[string]*clientLimiter{},
+		globalLimiter:  perMinute(opts.ProfileRateLimit),
+		jobs:           map[string]*Job{},
+		schedules:      map[string]*Schedule{},
+		scheduleWake:   make(chan struct{}, 1),
+		closing:        make(chan struct{}),
+	}
+	s.javaFilter, s.javaFilterErr = newJVMFilter(opts.JavaCmdlinePattern, opts.JavaEnvMarker)
+	if s.cfg == nil {
+		s.cfg = config.Default()
+	}
+	if s.runner == nil {
+		s.runner = newExecRunner(opts)
+	}
+	if s.jvm == nil {
+		s.jvm = s.newJVMController(deps.Processes)
+	}
+	if s.clock == nil {
+		s.clock = systemClock{}
+	}
+	if s.fs == nil {
+		s.fs = osFS{}
+	}
+	return s
+}
+
+// Start builds the production server from cfg and the environment and runs it until shutdown
+func Start(cfg *config.Config) {
+	StartWith(Deps{Config: cfg})
+}
+
+// StartWith runs a server until shutdown, creating the options, command runner, tenants, API
+// token and Kubernetes reviewer from the environment where deps leaves them unset
+func StartWith(deps Deps) {
+	tracing.Init(context.Background())
+
+	if fakejvm.Enabled() {
+		logger.Log.WithField("pid", fakejvm.PID).Warn("Simulation mode enabled: using fake JVM and stub jcmd")
+	}
+
+	if deps.Options == nil {
+		opts := OptionsFromEnv()
+		deps.Options = &opts
+	}
+	if deps.Tenants == nil {
+		tenants, err := tenant.LoadFromEnv()
+		if err != nil {
+			logger.Log.WithError(err).Fatal("Invalid tenant configuration")
+		}
+		if tenants != nil {
+			logger.Log.WithField("tenants", tenants.Len()).Info("Tenant tokens enabled")
+		}
+		deps.Tenants = tenants
+	}
+	if deps.Token == "" {
+		token, err := apiToken()
+		if err != nil {
+			logger.Log.WithError(err).Fatal("Invalid API token configuration")
+		}
+		if token != "" && deps.Tenants == nil {
+			logger.Log.Info("Bearer token required on mutating API requests")
+		}
+		deps.Token = token
+	}
+	if deps.Reviewer == nil && deps.Options.kubeAuthEnabled() {
+		if deps.Tenants != nil {
+			logger.Log.Fatal("API_AUTH_MODE=kubernetes cannot be combined with tenant tokens")
+		}
+		client, err := kube.InCluster()
+		if err != nil {
+			logger.Log.WithError(err).Fatal("API_AUTH_MODE=kubernetes needs in-cluster credentials")
+		}
+		logger.Log.Info("API requests authorized with Kubernetes TokenReview and SubjectAccessReview")
+		deps.Reviewer = client
+	}
+
+	s := NewServer(deps)
+	if err := s.validJVMFilter(); err != nil {
+		logger.Log.WithError(err).Fatal("Invalid JVM selection")
+	}
+	if s.javaFilter.enabled() {
+		logger.Log.WithField("filter", s.javaFilter.String()).Info("Targeting only the Java processes that match")
+	}
+	if runner, ok := s.runner.(*execRunner); ok && deps.Runner == nil {
+		if err := s.validAttachMode(); err != nil {
+			logger.Log.WithError(err).Fatal("Invalid attach configuration")
+		}
+		if err := s.loadJolokiaPassword(); err != nil {
+			logger.Log.WithError(err).Fatal("Invalid Jolokia configuration")
+		}
+		if s.opts.AttachNative {
+			logger.Log.Info("Attaching to JVMs natively, without jcmd")
+		}
+		if s.jolokia != nil {
+			logger.Log.WithField("url", s.jolokia.URL).Info("Controlling the JVM through its Jolokia agent, without jcmd")
+		}
+		if err := runner.resolveCommands(); err != nil {
+			logger.Log.WithError(err).Fatal("Required command unavailable")
+		}
+	}
+	s.Run()
 }
 
-// Start initializes and runs the API server with graceful shutdown
-func Start() {
-	mux := http.NewServeMux()
-	mux.HandleFunc("/create", createProfileHandler)
-	mux.HandleFunc("/stop", stopProfileHandler)
-	mux.HandleFunc("/list", listProfilesHandler)
-	mux.HandleFunc("/running", listRunningJFRHandler)
-	mux.HandleFunc("/health", healthHandler)
+// Run serves the API until SIGINT or SIGTERM, then drains in-flight requests and stops the
+// recordings selected by SHUTDOWN_STOP_RECORDINGS
+func (s *Server) Run() {
+	if err := s.validShutdownStopRecordings(); err != nil {
+		logger.Log.WithError(err).Fatal("Invalid shutdown configuration")
+	}
+	if err := s.validCompressConfig(); err != nil {
+		logger.Log.WithError(err).Fatal("Invalid compression configuration")
+	}
+	if err := s.loadPresets(); err != nil {
+		logger.Log.WithError(err).Fatal("Invalid recording presets")
+	}
+	s.subscribeJobEvents()
+	if s.opts.CompressRecordings {
+		logger.Log.WithField("gzip_level", s.opts.CompressLevel).Info("Compressing recordings before upload")
+	}
+
+	if s.opts.StreamUpload {
+		u, err := s.remote()
+		if err != nil {
+			logger.Log.WithError(err).Fatal("Failed to initialize uploader for streaming uploads")
+		}
+		metrics.SubscribeUploadEvents()
+		logger.Log.WithField("destination", u.Destination()).Info("Streaming recordings directly to the uploader")
+	}
+
+	telemetryCtx, stopTelemetry := context.WithCancel(context.Background())
+	defer stopTelemetry()
+	telemetryEnabled := false
+	if config.EnvBool("JFR_OTLP_METRICS", false) {
+		if err := s.startTelemetryOTLP(telemetryCtx); err != nil {
+			logger.Log.WithError(err).Error("Failed to start OTLP metrics export")
+		} else {
+			telemetryEnabled = true
+		}
+	}
+	if config.EnvBool("JVM_METRICS", false) {
+		s.addTelemetrySink(updateJVMGauges)
+		telemetryEnabled = true
+	}
+	if telemetryEnabled {
+		window := config.EnvDuration("JFR_TELEMETRY_WINDOW", 0)
+		s.startTelemetry(telemetryCtx, window)
+	}
+
+	schedulesCtx, stopSchedules := context.WithCancel(context.Background())
+	defer stopSchedules()
+	s.loadRecordings(context.Background())
+	s.loadSchedules()
+	go s.runSchedules(schedulesCtx)
+
+	retentionCtx, stopRetention := context.WithCancel(context.Background())
+	defer stopRetention()
+	if retention := retentionFromEnv(); retention.enabled() {
+		go s.runRetention(retentionCtx, retention)
+	}
+
+	if err := s.validDirectUpload(); err != nil {
+		logger.Log.WithError(err).Fatal("Invalid upload configuration")
+	}
+	if s.opts.DirectUpload {
+		logger.Log.Info("Uploading completed recordings directly from the sidecar")
+	}
+
+	if errs := s.validDiskConfig(); len(errs) > 0 {
+		logger.Log.WithError(errs).Fatal("Invalid low disk space configuration")
+	}
+
+	if continuous := continuousFromEnv(); continuous.Enabled {
+		if errs := continuous.Validate(); len(errs) > 0 {
+			logger.Log.WithError(errs).Fatal("Invalid continuous recording configuration")
+		}
+		s.configureContinuous(context.Background(), continuous.withDefaults())
+	}
+
+	triggersCtx, stopTriggers := context.WithCancel(context.Background())
+	defer stopTriggers()
+	if triggers := triggersFromEnv(); triggers != nil {
+		if errs := triggers.Validate(); len(errs) > 0 {
+			logger.Log.WithError(errs).Fatal("Invalid threshold trigger configuration")
+		}
+		s.startTriggers(triggersCtx, triggers)
+	}
+
+	// Environment-only settings read while starting up, such as RETENTION_* and TRIGGER_*
+	if err := config.EnvError(); err != nil {
+		logger.Log.WithError(err).Fatal("Invalid sidecar configuration")
+	}
+
+	registrationCtx, stopRegistration := context.WithCancel(context.Background())
+	defer stopRegistration()
+	if s.opts.RegistryURL != "" {
+		go s.runRegistration(registrationCtx)
+	}
 
 	server := &http.Server{
-		Addr:    ":" + apiPort,
-		Handler: mux,
+		Addr:    ":" + s.cfg.APIPort,
+		Handler: s.Handler(),
+	}
+	s.applyServerTimeouts(server)
+	// Event streams never finish on their own; end them so Shutdown can drain
+	server.RegisterOnShutdown(func() { close(s.closing) })
+	tlsCtx, stopTLSReload := context.WithCancel(context.Background())
+	defer stopTLSReload()
+	if s.opts.TLSCert != "" || s.opts.TLSKey != "" {
+		reloader, err := newTLSReloader(s.opts.TLSCert, s.opts.TLSKey, s.opts.TLSClientCA)
+		if err != nil {
+			logger.Log.WithError(err).Fatal("Invalid API TLS configuration")
+		}
+		server.TLSConfig = reloader.config()
+		if s.opts.TLSReloadInterval > 0 {
+			go reloader.watch(tlsCtx, s.opts.TLSReloadInterval)
+		}
+		logger.Log.WithField("mutualTLS", s.opts.TLSClientCA != "").Info("API server TLS enabled")
+	} else if s.opts.TLSClientCA != "" {
+		logger.Log.Fatal("API_TLS_CLIENT_CA needs API_TLS_CERT and API_TLS_KEY")
 	}
 
 	// Channel to listen for shutdown signals
@@ -58,40 +464,60 @@ func Start() {
 
 	// Start server in a goroutine
 	go func() {
-		logger.Log.WithField("port", apiPort).Info("API server listening")
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logger.Log.WithField("port", s.cfg.APIPort).Info("API server listening")
+		var err error
+		if server.TLSConfig != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			logger.Log.WithError(err).Fatal("Failed to start API server")
 		}
 	}()
 
 	// Wait for shutdown signal
 	<-shutdownChan
-	logger.Log.Info("Shutdown signal received, stopping all JFR recordings...")
+	logger.Log.WithField("timeout", s.opts.ShutdownTimeout.String()).Info("Shutdown signal received, draining API requests...")
 
-	// Stop all running JFR recordings before shutting down
-	stopAllJFRRecordings()
-
-	// Gracefully shutdown the HTTP server
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.ShutdownTimeout)
 	defer cancel()
 
+	// Stop being offered as profilable and starting scheduled or triggered recordings, then stop accepting
+	// connections and let in-flight requests finish
+	stopSchedules()
+	stopTriggers()
+	if s.opts.RegistryURL != "" {
+		stopRegistration()
+		s.deregister(ctx)
+	}
 	if err := server.Shutdown(ctx); err != nil {
 		logger.Log.WithError(err).Error("Error during server shutdown")
 	} else {
 		logger.Log.Info("API server stopped gracefully")
 	}
-}
 
-// healthHandler returns API health status
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	sendJSON(w, http.StatusOK, Response{
-		Success: true,
-		Message: "API server is healthy",
-	})
+	// No new recordings can start now; write the continuous recording's last chunk, then stop
+	// the selected recordings so their files are written
+	s.waitForStartingJobs(ctx)
+	s.shutdownContinuous(ctx)
+	if s.opts.ShutdownStopRecordings != "none" {
+		logger.Log.WithField("recordings", s.opts.ShutdownStopRecordings).Info("Stopping JFR recordings before exit")
+		s.stopAllJFRRecordings(ctx)
+	}
+
+	s.waitForUploads(ctx)
+	if s.uploader != nil {
+		s.uploader.Close()
+	}
+	stopTelemetry()
+	s.shutdownTelemetryOTLP(ctx)
+	tracing.Shutdown(ctx)
 }
 
-// createProfileHandler starts a JFR profiling session
-func createProfileHandler(w http.ResponseWriter, r *http.Request) {
+// createProfileHandler accepts a profiling session (JFR or async-profiler) as a job and answers 202 with its ID; the
+// recording starts in the background and /jobs/{id} reports its progress
+func (s *Server) createProfileHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		sendJSON(w, http.StatusMethodNotAllowed, Response{
 			Success: false,
@@ -101,33 +527,36 @@ func createProfileHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req ProfileRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendJSON(w, http.StatusBadRequest, Response{
+	if !s.decodeRequest(w, r, &req) {
+		return
+	}
+
+	if s.rejectIfOverQuota(w) {
+		return
+	}
+	if err := s.checkDiskSpace(&req); err != nil {
+		sendJSON(w, http.StatusInsufficientStorage, Response{
 			Success: false,
-			Message: fmt.Sprintf("Invalid request body: %v", err),
+			Message: fmt.Sprintf("Refusing to start a recording: %v", err),
 		})
 		return
 	}
+	if s.rejectIfMaxSizeExceedsVolume(w, req) {
+		return
+	}
 
 	// Default duration if not specified
 	if req.Duration == "" {
 		req.Duration = "60s"
 	}
 
-	// Generate timestamp suffix in RFC3339 format (filesystem-safe)
-	now := time.Now()
-	timestampSuffix := strings.ReplaceAll(now.Format(time.RFC3339), ":", "-")
-
 	// Generate recording name with RFC3339 timestamp if not provided
 	if req.Name == "" {
-		req.Name = fmt.Sprintf("jfr_%s", timestampSuffix)
+		req.Name = fmt.Sprintf("jfr_%s", s.timestampSuffix(s.clock.Now()))
 	}
 
-	// Derive filename from recording name
-	filename := fmt.Sprintf("%s.jfr", req.Name)
-
 	// Get Java process PID
-	pid, err := getJavaPID()
+	pid, err := s.targetJVM(r.Context(), req.target())
 	if err != nil {
 		sendJSON(w, http.StatusInternalServerError, Response{
 			Success: false,
@@ -136,42 +565,133 @@ func createProfileHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Start JFR recording with name
-	outputPath := filepath.Join(profileDir, filename)
-	logger.Log.WithField("path", outputPath).
-		WithField("name", req.Name).
-		WithField("duration", req.Duration).
-		Debug("Creating profile file")
-
-	cmd := exec.Command("jcmd", strconv.Itoa(pid), "JFR.start",
-		fmt.Sprintf("name=%s", req.Name),
-		fmt.Sprintf("duration=%s", req.Duration),
-		fmt.Sprintf("filename=%s", outputPath))
-
-	output, err := cmd.CombinedOutput()
+	// Start the recording in the background; its progress is reported by /jobs/{id}
+	job, err := s.newJob(r.Context(), pid, req)
+	if errors.Is(err, errDuplicateRecording) {
+		// The registry may still hold a recording the JVM ended on its own
+		if _, checkErr := s.checkRecordings(r.Context(), pid); checkErr == nil {
+			job, err = s.newJob(r.Context(), pid, req)
+		}
+	}
+	if errors.Is(err, errTooManyRecordings) {
+		sendJSON(w, http.StatusConflict, Response{
+			Success: false,
+			Message: fmt.Sprintf("%d recordings are already running (MAX_CONCURRENT_RECORDINGS); stop one or retry later", s.opts.MaxConcurrentRecordings),
+		})
+		return
+	}
+	if errors.Is(err, errDuplicateRecording) {
+		sendJSON(w, http.StatusConflict, Response{
+			Success: false,
+			Message: fmt.Sprintf("A recording named '%s' is already running in JVM %d; stop it or choose another name", req.Name, pid),
+		})
+		return
+	}
 	if err != nil {
 		sendJSON(w, http.StatusInternalServerError, Response{
 			Success: false,
-			Message: fmt.Sprintf("Failed to start profiling: %v, output: %s", err, string(output)),
+			Message: fmt.Sprintf("Failed to create job: %v", err),
 		})
 		return
 	}
+	s.starting.Add(1)
+	go s.runJob(context.WithoutCancel(r.Context()), job, req)
 
-	sendJSON(w, http.StatusOK, Response{
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	sendJSON(w, http.StatusAccepted, Response{
 		Success: true,
-		Message: "Profiling started successfully",
+		Message: "Profiling job accepted",
 		Data: map[string]string{
+			"jobId":    job.ID,
 			"pid":      strconv.Itoa(pid),
 			"name":     req.Name,
 			"duration": req.Duration,
-			"filename": filename,
-			"output":   string(output),
+			"engine":   req.Engine,
+			"settings": req.Settings,
+			"preset":   req.Preset,
+			"filename": s.recordingFilename(req),
 		},
 	})
 }
 
-// stopProfileHandler stops a specific JFR profiling session by name
-func stopProfileHandler(w http.ResponseWriter, r *http.Request) {
+// timestampSuffix formats t for generated recording names (RFC3339 with milliseconds by default),
+// with colons replaced for filesystem safety
+func (s *Server) timestampSuffix(t time.Time) string {
+	return strings.ReplaceAll(t.In(s.nameLocation).Format(s.opts.TimestampFormat), ":", "-")
+}
+
+// startRecording runs the pre-recording hook and starts a recording with the request's engine for
+// a normalized request. It returns the output path and the engine's output.
+func (s *Server) startRecording(ctx context.Context, pid int, req ProfileRequest) (string, []byte, error) {
+	// Derive filename from recording name
+	filename := s.recordingFilename(req)
+	dir, err := s.recordingDir(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	outputPath := filepath.Join(dir, filename)
+
+	meta := s.recordingMetadata(ctx, req, filename, pid)
+
+	// async-profiler seeks back into its output, which a pipe cannot take
+	stream := s.opts.StreamUpload && req.Engine != engineAsyncProfiler
+	abandonStream := func() {}
+	if stream {
+		outputPath = s.streamPath(filename)
+		abandon, err := s.startStream(context.WithoutCancel(ctx), outputPath, filename, meta, func() {
+			s.runPostRecordingHook(req.Name, req.Duration, outputPath, pid)
+		})
+		if err != nil {
+			return outputPath, nil, err
+		}
+		abandonStream = abandon
+	}
+
+	logger.Log.WithField("path", outputPath).
+		WithField("name", req.Name).
+		WithField("duration", req.Duration).
+		WithField("engine", req.Engine).
+		Debug("Creating profile file")
+
+	if err := s.runPreRecordingHook(ctx, req.Name, req.Duration, outputPath, pid); err != nil {
+		logger.Log.WithError(err).WithField("name", req.Name).Warn("Pre-recording hook failed")
+	}
+
+	// A compressed recording is written hidden and gzipped to outputPath once it stops
+	jvmPath := outputPath
+	if strings.HasSuffix(outputPath, ".gz") {
+		jvmPath = compressSource(outputPath)
+	}
+	output, err := s.engine(req.Engine).start(ctx, pid, req, jvmPath)
+	if err != nil {
+		abandonStream()
+		return outputPath, output, err
+	}
+	if !stream && (jvmPath != outputPath || s.cfg.CompletionMarkers || s.opts.PostRecordingHook != "") {
+		s.scheduleFinish(pid, req, jvmPath, outputPath)
+	}
+	s.ownRecording(ctx, req.Name)
+	s.registerStartedRecording(pid, req, outputPath)
+	s.holdRecording(req.Name, outputPath, req.Duration)
+	if meta != nil && !stream {
+		if err := s.writeRecordingMetadata(outputPath, meta); err != nil {
+			logger.Log.WithError(err).WithField("name", req.Name).Warn("Failed to write recording metadata")
+		}
+	}
+
+	events.Publish(events.RecordingStarted, map[string]any{
+		"pid":      pid,
+		"name":     req.Name,
+		"duration": req.Duration,
+		"engine":   req.Engine,
+		"path":     outputPath,
+	})
+
+	return outputPath, output, nil
+}
+
+// stopProfileHandler stops a specific profiling session by name
+func (s *Server) stopProfileHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		sendJSON(w, http.StatusMethodNotAllowed, Response{
 			Success: false,
@@ -180,47 +700,53 @@ func stopProfileHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req StopRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendJSON(w, http.StatusBadRequest, Response{
-			Success: false,
-			Message: fmt.Sprintf("Invalid request body: %v", err),
-		})
+	// /v1 names the recording in the path
+	req := StopRequest{Name: r.PathValue("name")}
+	if !s.decodeRequest(w, r, &req) {
 		return
 	}
 
-	if req.Name == "" {
-		sendJSON(w, http.StatusBadRequest, Response{
+	// Get Java process PID
+	pid, err := s.targetJVM(r.Context(), req.target())
+	if err != nil {
+		sendJSON(w, http.StatusInternalServerError, Response{
 			Success: false,
-			Message: "Recording name is required",
+			Message: fmt.Sprintf("Failed to find Java process: %v", err),
 		})
 		return
 	}
 
-	// Get Java process PID
-	pid, err := getJavaPID()
-	if err != nil {
-		sendJSON(w, http.StatusInternalServerError, Response{
+	if !s.ownsRecording(r.Context(), req.Name) || !s.recordingExists(r.Context(), pid, req.Name) {
+		sendJSON(w, http.StatusNotFound, Response{
 			Success: false,
-			Message: fmt.Sprintf("Failed to find Java process: %v", err),
+			Message: fmt.Sprintf("No recording named '%s'", req.Name),
 		})
 		return
 	}
 
-	// Stop specific JFR recording by name
-	cmd := exec.Command("jcmd", strconv.Itoa(pid), "JFR.stop", fmt.Sprintf("name=%s", req.Name))
-	output, err := cmd.CombinedOutput()
+	// Stop the recording by name with the engine that started it
+	engine, path := s.recordingEngine(req.Name)
+	output, err := s.engine(engine).stop(r.Context(), pid, req.Name, path)
 	if err != nil {
-		sendJSON(w, http.StatusInternalServerError, Response{
+		sendJSON(w, commandStatus(w, err), Response{
 			Success: false,
 			Message: fmt.Sprintf("Failed to stop profiling: %v, output: %s", err, string(output)),
 		})
 		return
 	}
 
+	s.releaseRecording(req.Name)
+	s.unregisterRecording(pid, req.Name)
+	s.completeJob(req.Name)
+	s.startFinish(req.Name)
+	events.Publish(events.RecordingStopped, map[string]any{
+		"pid":  pid,
+		"name": req.Name,
+	})
+
 	sendJSON(w, http.StatusOK, Response{
 		Success: true,
-		Message: fmt.Sprintf("JFR recording '%s' stopped successfully", req.Name),
+		Message: fmt.Sprintf("Recording '%s' stopped successfully", req.Name),
 		Data: map[string]string{
 			"pid":    strconv.Itoa(pid),
 			"name":   req.Name,
@@ -230,7 +756,7 @@ func stopProfileHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // listRunningJFRHandler lists all running JFR recording sessions
-func listRunningJFRHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) listRunningJFRHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		sendJSON(w, http.StatusMethodNotAllowed, Response{
 			Success: false,
@@ -240,7 +766,15 @@ func listRunningJFRHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get Java process PID
-	pid, err := getJavaPID()
+	sel, err := querySelector(r)
+	if err != nil {
+		sendJSON(w, http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("Invalid request: %v", err),
+		})
+		return
+	}
+	pid, err := s.targetJVM(r.Context(), sel)
 	if err != nil {
 		sendJSON(w, http.StatusInternalServerError, Response{
 			Success: false,
@@ -250,28 +784,41 @@ func listRunningJFRHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check running JFR recordings
-	cmd := exec.Command("jcmd", strconv.Itoa(pid), "JFR.check")
-	output, err := cmd.CombinedOutput()
+	output, err := s.jvm.Jcmd(r.Context(), pid, "JFR.check")
+	s.recordCheckTranscript(output, err)
 	if err != nil {
-		sendJSON(w, http.StatusInternalServerError, Response{
-			Success: false,
-			Message: fmt.Sprintf("Failed to check JFR recordings: %v, output: %s", err, string(output)),
+		// Report the recordings this sidecar started rather than nothing at all
+		logger.Log.WithError(err).WithField("pid", pid).Warn("JFR.check failed, listing recordings from the registry")
+		sendJSON(w, http.StatusOK, Response{
+			Success: true,
+			Message: fmt.Sprintf("JFR.check failed (%v); listing the recordings this sidecar started", err),
+			Data: map[string]any{
+				"pid":        strconv.Itoa(pid),
+				"recordings": registryStatuses(s.registeredRecordings(r.Context(), pid)),
+				"source":     "registry",
+				"output":     string(output),
+			},
 		})
 		return
 	}
+	s.reconcileRecordings(pid, parseRecordingNames(string(output)))
 
+	filtered := s.filterCheckOutput(r.Context(), string(output))
 	sendJSON(w, http.StatusOK, Response{
 		Success: true,
 		Message: "JFR recordings retrieved successfully",
-		Data: map[string]string{
-			"pid":    strconv.Itoa(pid),
-			"output": string(output),
+		Data: map[string]any{
+			"pid":        strconv.Itoa(pid),
+			"recordings": s.recordingStatuses(filtered),
+			"source":     "jcmd",
+			"output":     filtered,
 		},
 	})
 }
 
-// listProfilesHandler lists all profile files in the directory
-func listProfilesHandler(w http.ResponseWriter, r *http.Request) {
+// listProfilesHandler lists all profile files in the directory. Responses carry an ETag and
+// Last-Modified; conditional requests for an unchanged listing get 304 Not Modified.
+func (s *Server) listProfilesHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		sendJSON(w, http.StatusMethodNotAllowed, Response{
 			Success: false,
@@ -280,79 +827,112 @@ func listProfilesHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	files := []map[string]interface{}{}
-
-	err := filepath.WalkDir(profileDir, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if !d.IsDir() && strings.HasSuffix(d.Name(), ".jfr") {
-			info, err := d.Info()
-			if err != nil {
-				return err
-			}
-			files = append(files, map[string]interface{}{
-				"name":     d.Name(),
-				"path":     path,
-				"size":     info.Size(),
-				"modified": info.ModTime().Format(time.RFC3339),
-			})
-		}
-		return nil
-	})
-
+	query, err := parseListQuery(r.URL.Query(), s.clock.Now())
 	if err != nil {
-		sendJSON(w, http.StatusInternalServerError, Response{
+		sendJSON(w, http.StatusBadRequest, Response{
 			Success: false,
-			Message: fmt.Sprintf("Failed to list files: %v", err),
+			Message: fmt.Sprintf("Invalid request: %v", err),
 		})
 		return
 	}
 
-	sendJSON(w, http.StatusOK, Response{
-		Success: true,
-		Message: fmt.Sprintf("Found %d profile files", len(files)),
-		Data:    files,
+	root, err := s.recordingDir(r.Context())
+	if err == nil {
+		var listing *profileListing
+		if listing, err = s.profileListing(root); err == nil && !query.isZero() {
+			listing, err = listing.page(root, query)
+		}
+		if err == nil {
+			listing.serve(w, r)
+			return
+		}
+	}
+
+	sendJSON(w, http.StatusInternalServerError, Response{
+		Success: false,
+		Message: fmt.Sprintf("Failed to list files: %v", err),
 	})
 }
 
-// stopAllJFRRecordings stops all running JFR recordings during graceful shutdown
-func stopAllJFRRecordings() {
-	pid, err := getJavaPID()
+// stopAllJFRRecordings stops all running JFR recordings in every JVM during graceful shutdown
+func (s *Server) stopAllJFRRecordings(ctx context.Context) {
+	pids, err := s.jvm.JavaPIDs(ctx)
 	if err != nil {
 		logger.Log.WithError(err).Warn("Could not find Java process during shutdown, skipping JFR cleanup")
 		return
 	}
 
+	for _, pid := range pids {
+		if _, err := s.stopJFRRecordings(ctx, pid, true); err != nil {
+			logger.Log.WithError(err).Warn("Could not check JFR recordings during shutdown")
+		}
+	}
+}
+
+// StopResult is the outcome of stopping one recording
+type StopResult struct {
+	PID     int    `json:"pid"`
+	Name    string `json:"name"`
+	Stopped bool   `json:"stopped"`
+	Output  string `json:"output,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// stopJFRRecordings stops all running JFR recordings of one JVM that the request's tenant owns
+func (s *Server) stopJFRRecordings(ctx context.Context, pid int, shutdown bool) ([]StopResult, error) {
 	// Get list of running recordings
-	cmd := exec.Command("jcmd", strconv.Itoa(pid), "JFR.check")
-	output, err := cmd.CombinedOutput()
+	output, err := s.jvm.Jcmd(ctx, pid, "JFR.check")
+	s.recordCheckTranscript(output, err)
 	if err != nil {
-		logger.Log.WithError(err).Warn("Could not check JFR recordings during shutdown")
-		return
+		return nil, err
 	}
 
 	// Parse recording names from JFR.check output
-	recordingNames := parseRecordingNames(string(output))
+	var recordingNames []string
+	for _, name := range parseRecordingNames(string(output)) {
+		if shutdown && !s.stopOnShutdown(name) {
+			continue
+		}
+		if s.ownsRecording(ctx, name) {
+			recordingNames = append(recordingNames, name)
+		}
+	}
 
 	if len(recordingNames) == 0 {
-		logger.Log.Info("No active JFR recordings to stop")
-		return
+		logger.Log.WithField("pid", pid).Info("No active JFR recordings to stop")
+		return nil, nil
 	}
 
 	logger.Log.WithField("count", len(recordingNames)).Info("Stopping active JFR recordings")
 
 	// Stop each recording
+	results := make([]StopResult, 0, len(recordingNames))
 	for _, name := range recordingNames {
-		cmd := exec.Command("jcmd", strconv.Itoa(pid), "JFR.stop", fmt.Sprintf("name=%s", name))
-		output, err := cmd.CombinedOutput()
+		output, err := s.runJcmd(ctx, []string{name}, pid, "JFR.stop", fmt.Sprintf("name=%s", name))
+		result := StopResult{PID: pid, Name: name, Output: string(output)}
 		if err != nil {
+			result.Error = err.Error()
 			logger.Log.WithError(err).WithField("name", name).Warn("Failed to stop JFR recording")
 		} else {
+			result.Stopped = true
+			s.releaseRecording(name)
+			s.unregisterRecording(pid, name)
+			s.completeJob(name)
+			s.startFinish(name)
+			fields := map[string]any{
+				"pid":  pid,
+				"name": name,
+			}
+			if shutdown {
+				fields["shutdown"] = true
+			}
+			events.Publish(events.RecordingStopped, fields)
 			logger.Log.WithField("name", name).Info("Successfully stopped JFR recording")
 			logger.Log.WithField("output", string(output)).Debug("JFR stop output")
 		}
+		results = append(results, result)
 	}
+	return results, nil
 }
 
 // parseRecordingNames extracts recording names from JFR.check output
@@ -393,46 +973,93 @@ func parseRecordingNames(output string) []string {
 	return names
 }
 
-// getJavaPID finds the PID of the running Java process
-func getJavaPID() (int, error) {
-	// Use pgrep -x to match exact process name "java" only
-	// This excludes shell wrappers like "sh -c java ..."
-	cmd := exec.Command("pgrep", "-x", "java")
-	output, err := cmd.CombinedOutput()
+// getJavaPID finds the PID of the target Java process, optionally restricted to a container
+func (s *Server) getJavaPID(ctx context.Context, container string) (int, error) {
+	pid, err := s.jvm.ResolvePID(ctx, container)
+	if err != nil {
+		logger.Log.WithError(err).Error("Failed to find Java process")
+		return 0, err
+	}
+
+	logger.Log.WithField("pid", pid).Debug("Successfully found Java PID")
+	return pid, nil
+}
 
-	logger.Log.WithFields(map[string]interface{}{
-		"output": string(output),
-		"error":  err,
-	}).Debug("pgrep command result")
+// decodeRequest decodes and validates a request body, responding 400 with per-field errors on failure
+func (s *Server) decodeRequest(w http.ResponseWriter, r *http.Request, req validation.Validator) bool {
+	errs := validation.Decode(r, req)
+	if limited, ok := req.(limitedRequest); ok && len(errs) == 0 {
+		errs = limited.validLimits(s)
+	}
+	if len(errs) == 0 {
+		return true
+	}
+	sendJSON(w, http.StatusBadRequest, Response{
+		Success: false,
+		Message: fmt.Sprintf("Invalid request body: %v", errs),
+		Data:    map[string]any{"errors": errs},
+	})
+	return false
+}
 
-	if err != nil {
-		logger.Log.Error("Failed to find Java process")
-		return 0, fmt.Errorf("no Java process found: %v", err)
+// validDuration checks an optional duration field such as "60s" or "5m"
+func validDuration(field, value string) *validation.FieldError {
+	if value == "" {
+		return nil
 	}
+	if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+		return &validation.FieldError{Field: field, Message: fmt.Sprintf("must be a positive duration such as \"60s\", got %q", value)}
+	}
+	return nil
+}
 
-	pidStr := strings.TrimSpace(string(output))
-	logger.Log.WithField("pidString", pidStr).Debug("PID string after trim")
+// argumentPattern restricts request values that end up on a command line. jcmd joins its
+// arguments with spaces and the JVM splits them again, so a name such as "x filename=/etc/y"
+// would otherwise smuggle in extra options.
+var argumentPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._:+-]{0,127}$`)
 
-	if pidStr == "" {
-		return 0, fmt.Errorf("no Java process found")
+// validArgument checks an optional value that is passed to jcmd or a profiler
+func validArgument(field, value string) *validation.FieldError {
+	if value == "" || argumentPattern.MatchString(value) {
+		return nil
 	}
+	return &validation.FieldError{Field: field, Message: "may only contain letters, digits, '.', '_', ':', '+' and '-' (at most 128, not starting with a symbol)"}
+}
 
-	// Parse the PID
-	pid, err := strconv.Atoi(pidStr)
-	if err != nil {
-		logger.Log.WithFields(map[string]interface{}{
-			"pidString": pidStr,
-			"error":     err,
-		}).Error("Failed to parse PID")
-		return 0, fmt.Errorf("invalid PID: %v", err)
+// recordingNamePattern restricts names that become file names as well as jcmd arguments: no path
+// separators, no leading dot (hidden files are not uploaded) and none of the colons timestamps
+// avoid either
+var recordingNamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._+-]{0,127}$`)
+
+// validRecordingName checks an optional name that the output file is named after
+func validRecordingName(field, value string) *validation.FieldError {
+	if value == "" || recordingNamePattern.MatchString(value) {
+		return nil
 	}
+	return &validation.FieldError{Field: field, Message: "may only contain letters, digits, '.', '_', '+' and '-' (at most 128, not starting with a symbol)"}
+}
 
-	logger.Log.WithField("pid", pid).Debug("Successfully found Java PID")
-	return pid, nil
+// settingsPathPattern matches a custom .jfc template by absolute path. The path is read by the
+// target JVM, so it refers to the JVM container's filesystem.
+var settingsPathPattern = regexp.MustCompile(`^/[A-Za-z0-9._/+-]{1,255}\.jfc$`)
+
+// validSettings checks an optional JFR settings value: a template name such as "default" or
+// "profile", or the absolute path of a .jfc file
+func validSettings(field, value string) *validation.FieldError {
+	if value == "" || argumentPattern.MatchString(value) {
+		return nil
+	}
+	if settingsPathPattern.MatchString(value) && !strings.Contains(value, "..") {
+		return nil
+	}
+	return &validation.FieldError{Field: field, Message: fmt.Sprintf("must be a template name such as \"profile\" or an absolute path to a .jfc file, got %q", value)}
 }
 
 // sendJSON sends a JSON response
 func sendJSON(w http.ResponseWriter, status int, data Response) {
+	if data.RequestID == "" {
+		data.RequestID = w.Header().Get(requestid.Header)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(data)
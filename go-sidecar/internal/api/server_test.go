@@ -0,0 +1,207 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/config"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/fakejvm"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/inuse"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+)
+
+// newTestServer builds a server on the simulated JVM with a temporary profile directory and the
+// environment's options changed by edit
+func newTestServer(t *testing.T, edit func(*Options)) *Server {
+	t.Helper()
+	logger.Init()
+	cfg := config.Default()
+	cfg.ProfileDir = t.TempDir()
+	opts := OptionsFromEnv()
+	if edit != nil {
+		edit(&opts)
+	}
+	return NewServer(Deps{Config: cfg, Options: &opts, JVM: fakejvm.Controller{}, Files: inuse.New()})
+}
+
+// serve sends a request to the server's handler and decodes the response
+func serve(t *testing.T, s *Server, method, path, body string) (int, Response) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+
+	var resp Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s %s: undecodable response %q: %v", method, path, rec.Body.String(), err)
+	}
+	return rec.Code, resp
+}
+
+// startTestRecording starts a recording through the create handler and waits until the JVM runs
+// it. The recording is stopped when the test ends, as the simulated JVM is shared by all tests.
+func startTestRecording(t *testing.T, s *Server, name string) {
+	t.Helper()
+	body := fmt.Sprintf(`{"name":%q,"duration":"10m"}`, name)
+	if code, resp := serve(t, s, http.MethodPost, "/v1/recordings", body); code != http.StatusAccepted {
+		t.Fatalf("create %s: status = %d (%s), want 202", name, code, resp.Message)
+	}
+	s.starting.Wait()
+	t.Cleanup(func() {
+		fakejvm.Controller{}.Jcmd(context.Background(), fakejvm.PID, "JFR.stop", "name="+name)
+	})
+}
+
+// errorFields returns the fields a 400 response reports errors for
+func errorFields(resp Response) []string {
+	data, _ := resp.Data.(map[string]any)
+	errs, _ := data["errors"].([]any)
+	var fields []string
+	for _, e := range errs {
+		if fe, ok := e.(map[string]any); ok {
+			fields = append(fields, fe["field"].(string))
+		}
+	}
+	return fields
+}
+
+func TestRequestsOverServerLimitsAreRejected(t *testing.T) {
+	s := newTestServer(t, func(o *Options) {
+		o.RecordingMaxDuration = time.Minute
+		o.RecordingMaxSizeLimit = 64 << 20
+		o.RecordingMaxAgeLimit = time.Hour
+		o.CallbackHosts = "hooks.example.com"
+	})
+
+	tests := []struct {
+		name  string
+		path  string
+		body  string
+		field string
+	}{
+		{"duration over RECORDING_MAX_DURATION", "/v1/recordings", `{"duration":"2m"}`, "duration"},
+		{"maxSize over RECORDING_MAX_SIZE_LIMIT", "/v1/recordings", `{"maxSize":"128Mi"}`, "maxSize"},
+		{"maxAge over RECORDING_MAX_AGE_LIMIT", "/v1/recordings", `{"maxAge":"2h"}`, "maxAge"},
+		{"unknown preset", "/v1/recordings", `{"preset":"nope"}`, "preset"},
+		{"callback host not allowed", "/v1/recordings", `{"callbackUrl":"https://evil.example.com/x"}`, "callbackUrl"},
+		{"rollout duration", "/v1/rollouts", `{"rolloutId":"r1","phase":"start","duration":"5m"}`, "duration"},
+		{"scheduled recording", "/v1/schedules", `{"cron":"0 * * * *","recording":{"duration":"5m"}}`, "recording.duration"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := serve(t, s, http.MethodPost, tt.path, tt.body)
+			if code != http.StatusBadRequest {
+				t.Fatalf("status = %d (%s), want 400", code, resp.Message)
+			}
+			if fields := errorFields(resp); len(fields) != 1 || fields[0] != tt.field {
+				t.Errorf("error fields = %v, want [%s]", fields, tt.field)
+			}
+		})
+	}
+}
+
+func TestLimitsComeFromTheServerOptions(t *testing.T) {
+	strict := newTestServer(t, func(o *Options) { o.RecordingMaxDuration = time.Minute })
+	lenient := newTestServer(t, func(o *Options) { o.RecordingMaxDuration = 0 })
+
+	body := `{"cron":"0 * * * *","recording":{"duration":"2h"}}`
+	if code, resp := serve(t, strict, http.MethodPost, "/v1/schedules", body); code != http.StatusBadRequest {
+		t.Errorf("strict server: status = %d (%s), want 400", code, resp.Message)
+	}
+	if code, resp := serve(t, lenient, http.MethodPost, "/v1/schedules", body); code != http.StatusCreated {
+		t.Errorf("server without a duration cap: status = %d (%s), want 201", code, resp.Message)
+	}
+}
+
+func TestPresetsFileExtendsTheServersPresets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "presets.json")
+	if err := os.WriteFile(path, []byte(`{"io":{"settings":"profile","options":{"socket-io-threshold":"5ms"}}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t, func(o *Options) { o.PresetsFile = path })
+	if err := s.loadPresets(); err != nil {
+		t.Fatalf("loadPresets: %v", err)
+	}
+
+	_, resp := serve(t, s, http.MethodGet, "/v1/presets", "")
+	presets, _ := resp.Data.(map[string]any)
+	if _, ok := presets["io"]; !ok {
+		t.Errorf("presets = %v, want the io preset from the file", presets)
+	}
+	if _, ok := presets["gc"]; !ok {
+		t.Errorf("presets = %v, want the built-in gc preset too", presets)
+	}
+	if _, ok := newTestServer(t, nil).presets["io"]; ok {
+		t.Error("another server sees the io preset, want presets kept per server")
+	}
+}
+
+func TestCreateRecording(t *testing.T) {
+	s := newTestServer(t, func(o *Options) { o.MaxConcurrentRecordings = 2 })
+	startTestRecording(t, s, "create-running")
+	startTestRecording(t, s, "create-other")
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"duplicate name", `{"name":"create-running"}`, http.StatusConflict},
+		{"too many recordings", `{"name":"create-third"}`, http.StatusConflict},
+		{"invalid name", `{"name":"../escape"}`, http.StatusBadRequest},
+		{"invalid duration", `{"name":"create-bad","duration":"soon"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, resp := serve(t, s, http.MethodPost, "/v1/recordings", tt.body); code != tt.want {
+				t.Errorf("status = %d (%s), want %d", code, resp.Message, tt.want)
+			}
+		})
+	}
+
+	output, err := fakejvm.Controller{}.Jcmd(context.Background(), fakejvm.PID, "JFR.check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := parseRecordingNames(string(output)); !slices.Contains(names, "create-running") {
+		t.Errorf("JFR.check lists %v, want create-running", names)
+	}
+}
+
+func TestStopRecording(t *testing.T) {
+	s := newTestServer(t, nil)
+	startTestRecording(t, s, "stop-running")
+
+	tests := []struct {
+		name      string
+		recording string
+		want      int
+	}{
+		{"running recording", "stop-running", http.StatusOK},
+		{"stopped already", "stop-running", http.StatusNotFound},
+		{"unknown recording", "stop-unknown", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := serve(t, s, http.MethodPost, "/v1/recordings/"+tt.recording+"/stop", "")
+			if code != tt.want {
+				t.Errorf("status = %d (%s), want %d", code, resp.Message, tt.want)
+			}
+		})
+	}
+
+	s.uploading.Wait()
+	if _, err := os.Stat(filepath.Join(s.cfg.ProfileDir, "stop-running.jfr")); err != nil {
+		t.Errorf("stopped recording was not written: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"fmt"
+)
+
+// On SIGTERM the API stops accepting connections and drains in-flight requests for up to
+// SHUTDOWN_TIMEOUT, then stops the recordings SHUTDOWN_STOP_RECORDINGS selects so their files
+// are written before the pod goes away
+
+// validShutdownStopRecordings checks SHUTDOWN_STOP_RECORDINGS
+func (s *Server) validShutdownStopRecordings() error {
+	switch s.opts.ShutdownStopRecordings {
+	case "all", "ephemeral", "none":
+		return nil
+	}
+	return fmt.Errorf("SHUTDOWN_STOP_RECORDINGS must be all, ephemeral or none, got %q", s.opts.ShutdownStopRecordings)
+}
+
+// stopOnShutdown reports whether the named recording is stopped when the sidecar shuts down
+func (s *Server) stopOnShutdown(name string) bool {
+	switch s.opts.ShutdownStopRecordings {
+	case "none":
+		return false
+	case "ephemeral":
+		return s.ephemeralRecording(name)
+	}
+	return true
+}
+
+// ephemeralRecording reports whether the named recording was started with "ephemeral": true
+func (s *Server) ephemeralRecording(name string) bool {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+	for i := len(s.jobOrder) - 1; i >= 0; i-- {
+		if job := s.jobs[s.jobOrder[i]]; job != nil && job.Recording == name {
+			return job.Ephemeral
+		}
+	}
+	return false
+}
+
+// waitForStartingJobs waits until every accepted /create has had its JFR.start answered, so a
+// recording requested just before shutdown is seen by JFR.check. It gives up when ctx ends.
+func (s *Server) waitForStartingJobs(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		s.starting.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// waitForUploads waits for DIRECT_UPLOAD uploads and compressions of recordings stopped during
+// shutdown, so the uploader is not closed under them. It gives up when ctx ends.
+func (s *Server) waitForUploads(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		s.uploading.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
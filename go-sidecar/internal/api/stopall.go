@@ -0,0 +1,91 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/validation"
+)
+
+// StopAllRequest optionally limits /stop-all to one JVM; by default every JVM in the pod is wound down
+type StopAllRequest struct {
+	Container string `json:"container,omitempty"`
+	PID       int    `json:"pid,omitempty"`
+	MainClass string `json:"mainClass,omitempty"`
+}
+
+// Validate checks the optional JVM selector
+func (req *StopAllRequest) Validate() validation.Errors {
+	return validation.Collect(
+		validPID("pid", req.PID),
+		validArgument("mainClass", req.MainClass),
+	)
+}
+
+// stopAllHandler stops every running recording found by JFR.check and reports each result, so
+// profiling can be wound down cleanly before a deploy
+func (s *Server) stopAllHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendJSON(w, http.StatusMethodNotAllowed, Response{
+			Success: false,
+			Message: "Method not allowed",
+		})
+		return
+	}
+
+	var req StopAllRequest
+	if !s.decodeRequest(w, r, &req) {
+		return
+	}
+
+	var pids []int
+	var err error
+	if req.Container == "" && req.PID == 0 && req.MainClass == "" {
+		pids, err = s.jvm.JavaPIDs(r.Context())
+	} else {
+		var pid int
+		pid, err = s.targetJVM(r.Context(), JVMSelector{Container: req.Container, PID: req.PID, MainClass: req.MainClass})
+		pids = []int{pid}
+	}
+	if err != nil {
+		sendJSON(w, http.StatusInternalServerError, Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to find Java process: %v", err),
+		})
+		return
+	}
+
+	results := []StopResult{}
+	for _, pid := range pids {
+		stopped, err := s.stopJFRRecordings(r.Context(), pid, false)
+		if err != nil {
+			sendJSON(w, commandStatus(w, err), Response{
+				Success: false,
+				Message: fmt.Sprintf("Failed to check JFR recordings of PID %d: %v", pid, err),
+				Data:    results,
+			})
+			return
+		}
+		results = append(results, stopped...)
+	}
+
+	failed := 0
+	for _, result := range results {
+		if !result.Stopped {
+			failed++
+		}
+	}
+	if failed > 0 {
+		sendJSON(w, http.StatusInternalServerError, Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to stop %d of %d JFR recordings", failed, len(results)),
+			Data:    results,
+		})
+		return
+	}
+	sendJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("Stopped %d JFR recordings", len(results)),
+		Data:    results,
+	})
+}
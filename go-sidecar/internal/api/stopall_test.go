@@ -0,0 +1,49 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestStopAllRecordings(t *testing.T) {
+	tests := []struct {
+		name       string
+		recordings []string
+		message    string
+	}{
+		{"nothing running", nil, "Stopped 0 JFR recordings"},
+		{"several running", []string{"stopall-a", "stopall-b"}, "Stopped 2 JFR recordings"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil)
+			for _, name := range tt.recordings {
+				startTestRecording(t, s, name)
+			}
+
+			code, resp := serve(t, s, http.MethodPost, "/v1/recordings/stop-all", "{}")
+			s.uploading.Wait()
+			if code != http.StatusOK || resp.Message != tt.message {
+				t.Fatalf("status = %d (%s), want 200 (%s)", code, resp.Message, tt.message)
+			}
+
+			raw, _ := json.Marshal(resp.Data)
+			var results []StopResult
+			if err := json.Unmarshal(raw, &results); err != nil {
+				t.Fatalf("undecodable results %s: %v", raw, err)
+			}
+			var stopped []string
+			for _, result := range results {
+				if result.Stopped {
+					stopped = append(stopped, result.Name)
+				}
+			}
+			slices.Sort(stopped)
+			if !slices.Equal(stopped, tt.recordings) {
+				t.Errorf("stopped %v, want %v", stopped, tt.recordings)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/events"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/recmeta"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/uploader"
+)
+
+// streamPath returns the pipe the JVM writes a recording to. It is hidden so neither /list nor
+// the daemon picks it up.
+func (s *Server) streamPath(filename string) string {
+	return filepath.Join(s.cfg.ProfileDir, ".stream-"+filename)
+}
+
+// startStream creates the pipe for a recording and streams whatever the JVM writes into it once
+// the recording stops or its duration elapses, then calls finished once the JVM has closed the
+// pipe. The returned function abandons the stream, for when the recording failed to start.
+func (s *Server) startStream(ctx context.Context, pipePath, filename string, meta *recmeta.Metadata, finished func()) (func(), error) {
+	os.Remove(pipePath)
+	if err := syscall.Mkfifo(pipePath, 0o666); err != nil {
+		return nil, fmt.Errorf("failed to create stream pipe: %w", err)
+	}
+
+	var abandoned atomic.Bool
+	go func() {
+		defer os.Remove(pipePath)
+		if err := s.streamRecording(ctx, pipePath, filename, meta); err != nil {
+			logger.Log.WithError(err).WithField("filename", filename).Error("Streaming upload failed")
+		}
+		if !abandoned.Load() {
+			finished()
+		}
+	}()
+
+	abandon := func() {
+		abandoned.Store(true)
+		// Opening the write end and closing it gives the reader an immediate EOF
+		if w, err := os.OpenFile(pipePath, os.O_WRONLY|syscall.O_NONBLOCK, 0); err == nil {
+			w.Close()
+		}
+	}
+	return abandon, nil
+}
+
+// streamRecording blocks until the JVM opens the pipe, then uploads its contents followed by the
+// recording's metadata file, if it has one
+func (s *Server) streamRecording(ctx context.Context, pipePath, filename string, meta *recmeta.Metadata) error {
+	f, err := os.Open(pipePath)
+	if err != nil {
+		return fmt.Errorf("failed to open stream pipe: %w", err)
+	}
+	defer f.Close()
+
+	// Don't create an object for a stream that ends before any data arrives
+	r := bufio.NewReaderSize(f, 1<<20)
+	if _, err := r.Peek(1); errors.Is(err, io.EOF) {
+		logger.Log.WithField("filename", filename).Debug("Stream closed without data")
+		return nil
+	}
+
+	streamUploader, err := s.remote()
+	if err != nil {
+		return err
+	}
+
+	podName := os.Getenv("POD_NAME")
+	start := s.clock.Now()
+	ctx = uploadScope(ctx)
+	if meta != nil {
+		ctx = uploader.WithObjectMetadata(ctx, meta.ObjectMetadata())
+	}
+	destination := uploader.DestinationFor(ctx, streamUploader)
+	written, err := streamUploader.UploadStream(ctx, r, podName, filename)
+	if err != nil {
+		events.Publish(events.UploadFailed, map[string]any{
+			"path":        pipePath,
+			"pod":         podName,
+			"destination": destination,
+			"error":       err.Error(),
+		})
+		return err
+	}
+
+	events.Publish(events.UploadCompleted, map[string]any{
+		"path":        pipePath,
+		"pod":         podName,
+		"destination": destination,
+		"size":        written,
+		"modified":    start,
+		"duration":    s.clock.Now().Sub(start),
+	})
+
+	if meta != nil {
+		data, err := meta.Marshal()
+		if err != nil {
+			return err
+		}
+		companion := filepath.Base(recmeta.CompanionPath(filename))
+		if _, err := streamUploader.UploadStream(ctx, bytes.NewReader(data), podName, companion); err != nil {
+			return fmt.Errorf("failed to upload recording metadata: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/config"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/fakejvm"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"golang.org/x/sys/unix"
+)
+
+// commandWorkDir is the working directory of every child process; nothing is resolved relative to it
+const commandWorkDir = "/"
+
+// resolveCommands validates the binaries the sidecar executes and pins their absolute paths,
+// so a writable directory on PATH cannot later shadow them. jcmd and pgrep are required;
+// the others only matter when their feature is used.
+func (e *execRunner) resolveCommands() error {
+	if fakejvm.Enabled() {
+		return nil
+	}
+
+	required := []string{"jcmd", "pgrep"}
+	switch {
+	case e.opts.JolokiaURL != "":
+		required = nil // JVMs are found and controlled over HTTP
+	case e.opts.AttachNative:
+		required = []string{"pgrep"}
+	}
+	if e.opts.AttachNsenter {
+		required = append(required, e.opts.NsenterPath)
+	}
+	optional := []string{e.opts.AsyncProfilerPath, e.opts.PerfPath, e.opts.PerfMapAgentPath}
+
+	for _, name := range required {
+		if _, err := e.pinCommand(name); err != nil {
+			return err
+		}
+	}
+	for _, name := range optional {
+		if _, err := e.pinCommand(name); err != nil {
+			logger.Log.WithError(err).WithField("command", name).Debug("Optional command unavailable")
+		}
+	}
+	return nil
+}
+
+// pinCommand resolves name on PATH, checks it is a regular executable that is not world-writable,
+// and remembers the result
+func (e *execRunner) pinCommand(name string) (string, error) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("command %q not found: %w", name, err)
+	}
+	if path, err = filepath.Abs(path); err != nil {
+		return "", err
+	}
+	if path, err = filepath.EvalSymlinks(path); err != nil {
+		return "", fmt.Errorf("command %q: %w", name, err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("command %q: %w", name, err)
+	}
+	switch mode := info.Mode(); {
+	case !mode.IsRegular():
+		return "", fmt.Errorf("command %q resolves to %s, which is not a regular file", name, path)
+	case mode.Perm()&0o111 == 0:
+		return "", fmt.Errorf("command %q resolves to %s, which is not executable", name, path)
+	case mode.Perm()&0o002 != 0:
+		return "", fmt.Errorf("command %q resolves to %s, which is world-writable", name, path)
+	}
+
+	e.pathsMu.Lock()
+	e.paths[name] = path
+	e.pathsMu.Unlock()
+
+	logger.Log.WithFields(map[string]interface{}{"command": name, "path": path}).Debug("Resolved command")
+	return path, nil
+}
+
+// commandPath returns the pinned path for name, validating it on first use
+func (e *execRunner) commandPath(name string) (string, error) {
+	e.pathsMu.RLock()
+	path, ok := e.paths[name]
+	e.pathsMu.RUnlock()
+	if ok {
+		return path, nil
+	}
+	return e.pinCommand(name)
+}
+
+// Available reports whether name resolves to a usable binary
+func (e *execRunner) Available(name string) bool {
+	if fakejvm.Enabled() {
+		return false
+	}
+	_, err := e.commandPath(name)
+	return err == nil
+}
+
+// hardenCommand pins the binary, environment and working directory of cmd
+func (e *execRunner) hardenCommand(cmd *exec.Cmd, name string) error {
+	path, err := e.commandPath(name)
+	if err != nil {
+		return err
+	}
+	cmd.Path = path
+	cmd.Err = nil
+	cmd.Env = config.CommandEnv()
+	cmd.Dir = commandWorkDir
+	return nil
+}
+
+// limitProcess applies the configured niceness and resource limits to a started child
+func (e *execRunner) limitProcess(pid int) {
+	if e.opts.CommandNice != 0 {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, pid, e.opts.CommandNice); err != nil {
+			logger.Log.WithError(err).WithField("pid", pid).Warn("Failed to set command niceness")
+		}
+	}
+	if e.opts.CommandMaxCPU > 0 {
+		secs := uint64(e.opts.CommandMaxCPU / time.Second)
+		setRlimit(pid, unix.RLIMIT_CPU, max(secs, 1), "CPU")
+	}
+	if e.opts.CommandMaxMemory > 0 {
+		setRlimit(pid, unix.RLIMIT_AS, uint64(e.opts.CommandMaxMemory), "memory")
+	}
+}
+
+func setRlimit(pid, resource int, value uint64, what string) {
+	limit := unix.Rlimit{Cur: value, Max: value}
+	if err := unix.Prlimit(pid, resource, &limit, nil); err != nil {
+		logger.Log.WithError(err).WithField("pid", pid).Warnf("Failed to set command %s limit", what)
+	}
+}
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/jfr"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/metrics"
+)
+
+const (
+	telemetryRecordingName = "sidecar-telemetry"
+	telemetryMaxAge        = "5m"
+	defaultTelemetryWindow = 30 * time.Second
+)
+
+// telemetryEventSettings enables every event summarizeTelemetry reads on top of the default
+// template, which leaves jdk.SafepointBegin off. Event settings need JDK 17 or later.
+var telemetryEventSettings = []string{
+	"jdk.GarbageCollection#enabled=true",
+	"jdk.GarbageCollection#threshold=0ms",
+	"jdk.SafepointBegin#enabled=true",
+	"jdk.SafepointBegin#threshold=0ms",
+	"jdk.ObjectAllocationSample#enabled=true",
+	"jdk.ObjectAllocationSample#throttle=150/s",
+	"jdk.CPULoad#enabled=true",
+	"jdk.CPULoad#period=1s",
+	"jdk.GCHeapSummary#enabled=true",
+	"jdk.JavaThreadStatistics#enabled=true",
+	"jdk.JavaThreadStatistics#period=1s",
+}
+
+// internalRecording reports whether a recording is one the sidecar runs for itself. No request
+// owns it, so it is left out of listings and never stopped by /stop-all or shutdown; a restarted
+// sidecar picks the still-running recording up again.
+func internalRecording(name string) bool {
+	return name == telemetryRecordingName
+}
+
+// TelemetrySnapshot summarizes JVM behaviour over one sampling window of the telemetry recording
+type TelemetrySnapshot struct {
+	Time            time.Time
+	Window          time.Duration
+	GCPauses        map[string][]time.Duration // by collector name
+	Safepoints      []time.Duration
+	AllocationBytes int64
+	CPUJVMUser      float64
+	CPUJVMSystem    float64
+	CPUMachineTotal float64
+	HeapUsedBytes   int64
+	ThreadCount     int64
+}
+
+// AllocationRate returns sampled allocation in bytes per second
+func (s *TelemetrySnapshot) AllocationRate() float64 {
+	if s.Window <= 0 {
+		return 0
+	}
+	return float64(s.AllocationBytes) / s.Window.Seconds()
+}
+
+// startTelemetry keeps a low-overhead continuous recording running and periodically dumps the
+// most recent window, converting selected JFR events into a snapshot handed to each sink. This
+// polls JFR.dump once per window rather than streaming events from the JFR repository.
+func (s *Server) startTelemetry(ctx context.Context, window time.Duration) {
+	if window <= 0 {
+		window = defaultTelemetryWindow
+	}
+
+	// Dump into the shared directory (the JVM writes it), with a non-.jfr
+	// extension so neither /list nor the daemon picks it up
+	dumpPath := filepath.Join(s.cfg.ProfileDir, ".telemetry-dump.tmp")
+
+	go func() {
+		ticker := time.NewTicker(window)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				snapshot, err := s.sampleTelemetry(ctx, dumpPath, window)
+				if err != nil {
+					logger.Log.WithError(err).Warn("JVM telemetry sampling failed")
+					continue
+				}
+
+				s.telemetryMu.Lock()
+				s.latestTelemetry = snapshot
+				sinks := s.telemetrySinks
+				s.telemetryMu.Unlock()
+
+				for _, sink := range sinks {
+					sink(snapshot)
+				}
+			}
+		}
+	}()
+
+	logger.Log.WithField("window", window.String()).Info("JVM telemetry sampling started")
+}
+
+// updateJVMGauges publishes a snapshot on the Prometheus endpoint
+func updateJVMGauges(s *TelemetrySnapshot) {
+	metrics.JVMHeapUsed.Set(float64(s.HeapUsedBytes))
+	metrics.JVMThreads.Set(float64(s.ThreadCount))
+
+	var pauses []time.Duration
+	for _, p := range s.GCPauses {
+		pauses = append(pauses, p...)
+	}
+	metrics.JVMGCPauseP99.Set(percentile(pauses, 0.99).Seconds())
+}
+
+// percentile returns the nearest-rank percentile of durations (0 when empty)
+func percentile(durations []time.Duration, p float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(durations)
+	slices.Sort(sorted)
+	idx := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(idx, 0)]
+}
+
+// addTelemetrySink registers a consumer of every new telemetry snapshot
+func (s *Server) addTelemetrySink(sink func(*TelemetrySnapshot)) {
+	s.telemetryMu.Lock()
+	defer s.telemetryMu.Unlock()
+	s.telemetrySinks = append(s.telemetrySinks, sink)
+}
+
+// currentTelemetry returns the most recent snapshot, or nil before the first sample
+func (s *Server) currentTelemetry() *TelemetrySnapshot {
+	s.telemetryMu.RLock()
+	defer s.telemetryMu.RUnlock()
+	return s.latestTelemetry
+}
+
+// sampleTelemetry dumps the last window of the telemetry recording and summarizes it
+func (s *Server) sampleTelemetry(ctx context.Context, dumpPath string, window time.Duration) (*TelemetrySnapshot, error) {
+	pid, err := s.getJavaPID(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.ensureTelemetryRecording(ctx, pid); err != nil {
+		return nil, err
+	}
+
+	output, err := s.runJcmd(ctx, []string{telemetryRecordingName}, pid, "JFR.dump",
+		fmt.Sprintf("name=%s", telemetryRecordingName),
+		"begin=-"+jfrDuration(window.String()),
+		fmt.Sprintf("filename=%s", dumpPath))
+	if err != nil {
+		return nil, fmt.Errorf("JFR.dump failed: %v, output: %s", err, string(output))
+	}
+	defer s.fs.Remove(dumpPath)
+
+	return summarizeTelemetry(dumpPath, s.clock.Now(), window)
+}
+
+// ensureTelemetryRecording starts the telemetry recording if it is not already running
+func (s *Server) ensureTelemetryRecording(ctx context.Context, pid int) error {
+	output, err := s.jvm.Jcmd(ctx, pid, "JFR.check")
+	if err != nil {
+		return fmt.Errorf("JFR.check failed: %v", err)
+	}
+	for _, name := range parseRecordingNames(string(output)) {
+		if name == telemetryRecordingName {
+			return nil
+		}
+	}
+
+	args := []string{"JFR.start",
+		fmt.Sprintf("name=%s", telemetryRecordingName),
+		"settings=default",
+		fmt.Sprintf("maxage=%s", telemetryMaxAge)}
+	output, err = s.runJcmd(ctx, []string{telemetryRecordingName}, pid, append(args, telemetryEventSettings...)...)
+	if err != nil {
+		return fmt.Errorf("failed to start telemetry recording: %v, output: %s", err, string(output))
+	}
+	logger.Log.WithField("name", telemetryRecordingName).Info("Started JVM telemetry recording")
+	return nil
+}
+
+// summarizeTelemetry converts JFR events in a dump taken at now into a snapshot
+func summarizeTelemetry(path string, now time.Time, window time.Duration) (*TelemetrySnapshot, error) {
+	s := &TelemetrySnapshot{
+		Time:     now,
+		Window:   window,
+		GCPauses: map[string][]time.Duration{},
+	}
+
+	var latestCPU, latestHeap, latestThreads time.Time
+	err := jfr.ParseFile(path, func(e *jfr.Event) error {
+		switch e.Type() {
+		case "jdk.GarbageCollection":
+			s.GCPauses[e.String("name")] = append(s.GCPauses[e.String("name")], e.Duration("sumOfPauses"))
+		case "jdk.SafepointBegin":
+			s.Safepoints = append(s.Safepoints, e.Duration("duration"))
+		case "jdk.ObjectAllocationSample":
+			s.AllocationBytes += e.Int("weight")
+		case "jdk.CPULoad":
+			if t := e.StartTime(); t.After(latestCPU) {
+				latestCPU = t
+				s.CPUJVMUser = e.Float("jvmUser")
+				s.CPUJVMSystem = e.Float("jvmSystem")
+				s.CPUMachineTotal = e.Float("machineTotal")
+			}
+		case "jdk.GCHeapSummary":
+			if t := e.StartTime(); t.After(latestHeap) {
+				latestHeap = t
+				s.HeapUsedBytes = e.Int("heapUsed")
+			}
+		case "jdk.JavaThreadStatistics":
+			if t := e.StartTime(); t.After(latestThreads) {
+				latestThreads = t
+				s.ThreadCount = e.Int("activeCount")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse telemetry dump: %w", err)
+	}
+	return s, nil
+}
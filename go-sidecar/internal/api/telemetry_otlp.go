@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+// startTelemetryOTLP pushes telemetry snapshots to an OTLP collector as OpenTelemetry metrics.
+// The endpoint is read from the standard OTEL_EXPORTER_OTLP_* variables.
+func (s *Server) startTelemetryOTLP(ctx context.Context) error {
+	exporter, err := otlpmetrichttp.New(ctx)
+	if err != nil {
+		return err
+	}
+
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "profiler-sidecar"
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+		semconv.K8SPodName(os.Getenv("POD_NAME")),
+	))
+	if err != nil {
+		res = resource.Default()
+	}
+
+	s.meterProvider = sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)),
+		sdkmetric.WithResource(res),
+	)
+	meter := s.meterProvider.Meter("github.com/oscar-wu_pingcorp/profiler-sidecar/jfr")
+
+	gcPause, err := meter.Float64Histogram("jvm.gc.pause.duration",
+		metric.WithUnit("s"), metric.WithDescription("Total pause time of each garbage collection, from jdk.GarbageCollection."))
+	if err != nil {
+		return err
+	}
+	safepoint, err := meter.Float64Histogram("jvm.safepoint.duration",
+		metric.WithUnit("s"), metric.WithDescription("Safepoint duration, from jdk.SafepointBegin."))
+	if err != nil {
+		return err
+	}
+
+	var mu sync.Mutex
+	var latest *TelemetrySnapshot
+
+	allocRate, err := meter.Float64ObservableGauge("jvm.memory.allocation.rate",
+		metric.WithUnit("By/s"), metric.WithDescription("Sampled allocation rate, from jdk.ObjectAllocationSample."))
+	if err != nil {
+		return err
+	}
+	cpuLoad, err := meter.Float64ObservableGauge("jvm.cpu.load",
+		metric.WithUnit("1"), metric.WithDescription("CPU load, from jdk.CPULoad."))
+	if err != nil {
+		return err
+	}
+	heapUsed, err := meter.Int64ObservableGauge("jvm.memory.heap.used",
+		metric.WithUnit("By"), metric.WithDescription("Heap used after the latest GC, from jdk.GCHeapSummary."))
+	if err != nil {
+		return err
+	}
+	threads, err := meter.Int64ObservableGauge("jvm.thread.count",
+		metric.WithUnit("{thread}"), metric.WithDescription("Active Java threads, from jdk.JavaThreadStatistics."))
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		mu.Lock()
+		s := latest
+		mu.Unlock()
+		if s == nil {
+			return nil
+		}
+		o.ObserveFloat64(allocRate, s.AllocationRate())
+		o.ObserveFloat64(cpuLoad, s.CPUJVMUser, metric.WithAttributes(attribute.String("scope", "jvm_user")))
+		o.ObserveFloat64(cpuLoad, s.CPUJVMSystem, metric.WithAttributes(attribute.String("scope", "jvm_system")))
+		o.ObserveFloat64(cpuLoad, s.CPUMachineTotal, metric.WithAttributes(attribute.String("scope", "machine_total")))
+		o.ObserveInt64(heapUsed, s.HeapUsedBytes)
+		o.ObserveInt64(threads, s.ThreadCount)
+		return nil
+	}, allocRate, cpuLoad, heapUsed, threads)
+	if err != nil {
+		return err
+	}
+
+	s.addTelemetrySink(func(snapshot *TelemetrySnapshot) {
+		for gc, pauses := range snapshot.GCPauses {
+			attrs := metric.WithAttributes(attribute.String("gc", gc))
+			for _, p := range pauses {
+				gcPause.Record(ctx, p.Seconds(), attrs)
+			}
+		}
+		for _, p := range snapshot.Safepoints {
+			safepoint.Record(ctx, p.Seconds())
+		}
+
+		mu.Lock()
+		latest = snapshot
+		mu.Unlock()
+	})
+
+	logger.Log.Info("Streaming JFR telemetry to OTLP metrics")
+	return nil
+}
+
+// shutdownTelemetryOTLP flushes pending metrics
+func (s *Server) shutdownTelemetryOTLP(ctx context.Context) {
+	if s.meterProvider == nil {
+		return
+	}
+	if err := s.meterProvider.Shutdown(ctx); err != nil {
+		logger.Log.WithError(err).Warn("Failed to shut down meter provider")
+	}
+}
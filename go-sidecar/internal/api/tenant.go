@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/tenant"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/uploader"
+)
+
+// identifyTenant resolves the bearer token to a tenant and stores it on the request context.
+// Without a tenant registry (TENANTS_FILE unset) every request passes; with one, every request
+// other than /health and /metrics must carry a tenant token.
+func (s *Server) identifyTenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.tenants == nil || probePath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		t, ok := s.tenants.ByToken(token)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="profiler-sidecar"`)
+			sendJSON(w, http.StatusUnauthorized, Response{
+				Success: false,
+				Message: "A valid tenant token is required",
+			})
+			return
+		}
+		setCaller(r.Context(), "tenant:"+t.Name)
+		next.ServeHTTP(w, r.WithContext(tenant.WithTenant(r.Context(), t)))
+	})
+}
+
+// recordingDir returns the directory the request's artifacts are written to: the profile
+// directory itself, or a per-tenant subdirectory the daemon uploads under the tenant's prefix
+func (s *Server) recordingDir(ctx context.Context) (string, error) {
+	t := tenant.FromContext(ctx)
+	if t == nil {
+		return s.cfg.ProfileDir, nil
+	}
+	dir := filepath.Join(s.cfg.ProfileDir, t.Name)
+	if err := s.fs.MkdirAll(dir, 0o775); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// uploadScope scopes direct uploads and listings to the request's tenant
+func uploadScope(ctx context.Context) context.Context {
+	t := tenant.FromContext(ctx)
+	if t == nil {
+		return ctx
+	}
+	return uploader.WithScope(ctx, uploader.Scope{Prefix: t.Prefix, Bucket: t.Bucket})
+}
+
+// ownRecording records which tenant started a recording
+func (s *Server) ownRecording(ctx context.Context, name string) {
+	t := tenant.FromContext(ctx)
+	if t == nil {
+		return
+	}
+	s.ownersMu.Lock()
+	s.owners[name] = t.Name
+	s.ownersMu.Unlock()
+}
+
+// ownsRecording reports whether the request may see or control a recording. Untenanted
+// requests (tenancy disabled) see everything but the sidecar's internal recordings; tenants only
+// their own recordings.
+func (s *Server) ownsRecording(ctx context.Context, name string) bool {
+	if internalRecording(name) {
+		return false
+	}
+	t := tenant.FromContext(ctx)
+	if t == nil {
+		return true
+	}
+	s.ownersMu.Lock()
+	defer s.ownersMu.Unlock()
+	return s.owners[name] == t.Name
+}
+
+// filterCheckOutput drops recordings the request does not own from JFR.check output
+func (s *Server) filterCheckOutput(ctx context.Context, output string) string {
+	var kept []string
+	keep := true // the "<pid>:" header and anything before the first recording
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "Recording ") {
+			names := parseRecordingNames(line)
+			keep = len(names) == 1 && s.ownsRecording(ctx, names[0])
+		}
+		if keep {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/events"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+)
+
+// ThreadDump is a JVM's Thread.print output with a summary for quick triage
+type ThreadDump struct {
+	PID        int            `json:"pid"`
+	Threads    int            `json:"threads"`
+	States     map[string]int `json:"states"`             // java.lang.Thread.State -> threads
+	Deadlocked bool           `json:"deadlocked"`         // the JVM reported a Java-level deadlock
+	Filename   string         `json:"filename,omitempty"` // set when the dump was saved for upload
+	Output     string         `json:"output"`
+}
+
+// threadDumpHandler captures Thread.print from the target JVM and returns it inline. GET only
+// reads; POST also saves it as threaddump_{timestamp}.txt in the recording directory, from where
+// the daemon uploads it as a thread dump. "locks=true" adds ownable synchronizers (-l).
+func (s *Server) threadDumpHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		sendJSON(w, http.StatusMethodNotAllowed, Response{
+			Success: false,
+			Message: "Method not allowed",
+		})
+		return
+	}
+	if r.Method == http.MethodPost && s.rejectIfOverQuota(w) {
+		return
+	}
+
+	sel, err := querySelector(r)
+	if err != nil {
+		sendJSON(w, http.StatusBadRequest, Response{
+			Success: false,
+			Message: fmt.Sprintf("Invalid request: %v", err),
+		})
+		return
+	}
+	pid, err := s.targetJVM(r.Context(), sel)
+	if err != nil {
+		sendJSON(w, http.StatusInternalServerError, Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to find Java process: %v", err),
+		})
+		return
+	}
+
+	args := []string{"Thread.print"}
+	if locks, _ := strconv.ParseBool(r.URL.Query().Get("locks")); locks {
+		args = append(args, "-l")
+	}
+	output, err := s.runJcmd(r.Context(), nil, pid, args...)
+	if err != nil {
+		sendJSON(w, commandStatus(w, err), Response{
+			Success: false,
+			Message: fmt.Sprintf("Failed to capture thread dump: %v, output: %s", err, string(output)),
+		})
+		return
+	}
+
+	dump := parseThreadDump(string(output))
+	dump.PID = pid
+	if r.Method == http.MethodPost {
+		filename, err := s.saveThreadDump(r, pid, output)
+		if err != nil {
+			sendJSON(w, http.StatusInternalServerError, Response{
+				Success: false,
+				Message: fmt.Sprintf("Failed to save thread dump: %v", err),
+			})
+			return
+		}
+		dump.Filename = filename
+	}
+
+	sendJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("Thread dump of %d threads captured", dump.Threads),
+		Data:    dump,
+	})
+}
+
+// saveThreadDump writes a thread dump to the recording directory via a hidden file
+func (s *Server) saveThreadDump(r *http.Request, pid int, output []byte) (string, error) {
+	dir, err := s.recordingDir(r.Context())
+	if err != nil {
+		return "", err
+	}
+	filename := fmt.Sprintf("threaddump_%s.txt", s.timestampSuffix(s.clock.Now()))
+	path := filepath.Join(dir, filename)
+	tmp := hiddenPath(path)
+	if err := s.fs.WriteFile(tmp, output, 0o644); err != nil {
+		return "", err
+	}
+	if err := s.fs.Rename(tmp, path); err != nil {
+		return "", err
+	}
+	s.markComplete(path)
+	logger.Log.WithContext(r.Context()).WithField("filename", filename).Info("Thread dump saved")
+	events.Publish(events.FileFlushed, map[string]any{
+		"pid":  pid,
+		"kind": "threaddump",
+		"path": path,
+	})
+	return filename, nil
+}
+
+// parseThreadDump counts the threads of Thread.print output by state. Threads start with a
+// quoted name line; Java threads follow it with "java.lang.Thread.State: RUNNABLE". The deadlock
+// report at the end names threads again and is not counted.
+func parseThreadDump(output string) ThreadDump {
+	dump := ThreadDump{States: map[string]int{}, Output: output}
+	for _, line := range strings.Split(output, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case dump.Deadlocked:
+		case strings.HasPrefix(line, `"`):
+			dump.Threads++
+		case strings.HasPrefix(trimmed, "java.lang.Thread.State: "):
+			state, _, _ := strings.Cut(strings.TrimPrefix(trimmed, "java.lang.Thread.State: "), " ")
+			dump.States[state]++
+		case strings.HasPrefix(trimmed, "Found one Java-level deadlock"), strings.HasPrefix(trimmed, "Found ") && strings.HasSuffix(trimmed, "deadlocks."):
+			dump.Deadlocked = true
+		}
+	}
+	return dump
+}
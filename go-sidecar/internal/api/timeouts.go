@@ -0,0 +1,41 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+)
+
+// Timeouts of the API server, so slow or abandoned clients cannot hold connections and their
+// goroutines forever. The write timeout has to cover the slowest synchronous handler: a jcmd call
+// up to JCMD_TIMEOUT, or an estimate's probe of up to ESTIMATE_PROBE_MAX. 0 disables a timeout.
+
+// downloadMinRate is the slowest transfer a download is given time for beyond the write timeout
+const downloadMinRate = 1 << 20 // bytes per second
+
+// applyServerTimeouts sets the configured timeouts on the API server and warns when the write
+// timeout would cut off responses to jcmd calls that are still within JCMD_TIMEOUT
+func (s *Server) applyServerTimeouts(server *http.Server) {
+	server.ReadHeaderTimeout = s.opts.ReadHeaderTimeout
+	server.ReadTimeout = s.opts.ReadTimeout
+	server.WriteTimeout = s.opts.WriteTimeout
+	server.IdleTimeout = s.opts.IdleTimeout
+
+	if s.opts.WriteTimeout > 0 && s.opts.WriteTimeout <= s.opts.JcmdTimeout {
+		logger.Log.WithField("writeTimeout", s.opts.WriteTimeout.String()).
+			WithField("jcmdTimeout", s.opts.JcmdTimeout.String()).
+			Warn("API_WRITE_TIMEOUT is not longer than JCMD_TIMEOUT; slow jcmd calls will lose their response")
+	}
+}
+
+// extendWriteDeadline gives a response reading or sending size bytes of a recording time to do so
+// at downloadMinRate on top of the write timeout, since a large recording can take longer than
+// any single API call
+func (s *Server) extendWriteDeadline(w http.ResponseWriter, size int64) {
+	if s.opts.WriteTimeout <= 0 {
+		return
+	}
+	transfer := time.Duration(size/downloadMinRate+1) * time.Second
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(s.opts.WriteTimeout + transfer))
+}
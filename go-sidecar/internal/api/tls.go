@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+)
+
+// TLS for the API server. With API_TLS_CLIENT_CA set, callers must present a certificate signed
+// by that CA (mutual TLS). Files are re-read when they change, so rotated Secrets (cert-manager,
+// CSI drivers) take effect without a restart.
+
+// tlsReloader serves the current certificate and client CA pool, reloading them when their files
+// change on disk
+type tlsReloader struct {
+	certPath, keyPath, caPath string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	clientCA *x509.CertPool
+	modTimes map[string]time.Time
+}
+
+// newTLSReloader loads the certificate, key and optional client CA; it fails when they are unusable
+func newTLSReloader(certPath, keyPath, caPath string) (*tlsReloader, error) {
+	r := &tlsReloader{certPath: certPath, keyPath: keyPath, caPath: caPath}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// load reads every file and swaps them in together
+func (r *tlsReloader) load() error {
+	modTimes, err := r.stat()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to load API TLS certificate: %w", err)
+	}
+	var pool *x509.CertPool
+	if r.caPath != "" {
+		data, err := os.ReadFile(r.caPath)
+		if err != nil {
+			return fmt.Errorf("failed to read API client CA: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates found in API client CA %s", r.caPath)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert, r.clientCA, r.modTimes = &cert, pool, modTimes
+	r.mu.Unlock()
+	return nil
+}
+
+// stat returns the modification time of every file
+func (r *tlsReloader) stat() (map[string]time.Time, error) {
+	modTimes := map[string]time.Time{}
+	for _, path := range []string{r.certPath, r.keyPath, r.caPath} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read API TLS file: %w", err)
+		}
+		modTimes[path] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+// changed reports whether any file was modified since the last load
+func (r *tlsReloader) changed() bool {
+	modTimes, err := r.stat()
+	if err != nil {
+		return false // mid-rotation; try again on the next tick
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for path, t := range modTimes {
+		if !t.Equal(r.modTimes[path]) {
+			return true
+		}
+	}
+	return false
+}
+
+// watch reloads changed files every interval until ctx is cancelled. A failed reload keeps
+// serving the previous certificate.
+func (r *tlsReloader) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.load(); err != nil {
+				logger.Log.WithError(err).Warn("Failed to reload API TLS certificates, keeping the previous ones")
+				continue
+			}
+			logger.Log.Info("Reloaded API TLS certificates")
+		}
+	}
+}
+
+// config returns a server TLS configuration that always uses the latest certificate and CA pool
+func (r *tlsReloader) config() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+			}
+			if r.clientCA != nil {
+				// Verified when presented; requireClientCert rejects requests without one, so
+				// kubelet probes (which cannot present certificates) can still reach /health
+				cfg.ClientAuth = tls.VerifyClientCertIfGiven
+				cfg.ClientCAs = r.clientCA
+			}
+			return cfg, nil
+		},
+	}
+}
+
+// requireClientCert rejects requests that did not present a verified client certificate when
+// mutual TLS is enabled; /health and /metrics stay reachable for probes and scrapers
+func (s *Server) requireClientCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.opts.TLSClientCA == "" || probePath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			sendJSON(w, http.StatusUnauthorized, Response{
+				Success: false,
+				Message: "A client certificate signed by the configured CA is required",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxTranscriptEntries    = 100 // per recording
+	maxTranscriptRecordings = 200 // oldest recording transcripts are evicted beyond this
+)
+
+// TranscriptEntry is a single jcmd or asprof invocation captured for a recording
+type TranscriptEntry struct {
+	Time       time.Time `json:"time"`
+	Command    string    `json:"command"`
+	Output     string    `json:"output"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"durationMs"`
+}
+
+// runJcmd runs a diagnostic command (args[0]) with its options in the JVM and records the
+// invocation, as jcmd's command line, in each named recording's transcript
+func (s *Server) runJcmd(ctx context.Context, recordings []string, pid int, args ...string) ([]byte, error) {
+	command := "jcmd " + strings.Join(append([]string{strconv.Itoa(pid)}, args...), " ")
+	return s.transcribe(recordings, command, func() ([]byte, error) {
+		return s.jvm.Jcmd(ctx, pid, args[0], args[1:]...)
+	})
+}
+
+// runTranscribed runs a command such as asprof and appends it to the transcript of each of the
+// recordings it concerns
+func (s *Server) runTranscribed(ctx context.Context, recordings []string, name string, args ...string) ([]byte, error) {
+	return s.transcribe(recordings, name+" "+strings.Join(args, " "), func() ([]byte, error) {
+		return s.runner.Run(ctx, name, args...)
+	})
+}
+
+// transcribe makes a call and appends it to the transcript of each of the recordings it concerns
+func (s *Server) transcribe(recordings []string, command string, call func() ([]byte, error)) ([]byte, error) {
+	start := s.clock.Now()
+	output, err := call()
+
+	entry := TranscriptEntry{
+		Time:       start,
+		Command:    command,
+		Output:     string(output),
+		DurationMs: s.clock.Now().Sub(start).Milliseconds(),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	for _, name := range recordings {
+		s.appendTranscript(name, entry)
+	}
+	return output, err
+}
+
+// recordCheckTranscript adds JFR.check output to the transcript of every recording it lists
+func (s *Server) recordCheckTranscript(output []byte, err error) {
+	entry := TranscriptEntry{
+		Time:    s.clock.Now(),
+		Command: "jcmd JFR.check",
+		Output:  string(output),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	for _, name := range parseRecordingNames(string(output)) {
+		s.appendTranscript(name, entry)
+	}
+}
+
+// appendTranscript adds an entry to a recording's transcript, bounding memory use
+func (s *Server) appendTranscript(name string, entry TranscriptEntry) {
+	s.transcriptMu.Lock()
+	defer s.transcriptMu.Unlock()
+
+	entries, exists := s.transcripts[name]
+	if !exists {
+		s.transcriptOrder = append(s.transcriptOrder, name)
+		if len(s.transcriptOrder) > maxTranscriptRecordings {
+			delete(s.transcripts, s.transcriptOrder[0])
+			s.transcriptOrder = s.transcriptOrder[1:]
+		}
+	}
+
+	entries = append(entries, entry)
+	if len(entries) > maxTranscriptEntries {
+		entries = entries[len(entries)-maxTranscriptEntries:]
+	}
+	s.transcripts[name] = entries
+}
+
+// transcriptHandler returns the captured jcmd transcript for a recording
+func (s *Server) transcriptHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	s.transcriptMu.Lock()
+	entries, ok := s.transcripts[name]
+	entries = append([]TranscriptEntry(nil), entries...)
+	s.transcriptMu.Unlock()
+
+	if !ok || !s.ownsRecording(r.Context(), name) {
+		sendJSON(w, http.StatusNotFound, Response{
+			Success: false,
+			Message: fmt.Sprintf("No transcript found for recording '%s'", name),
+		})
+		return
+	}
+
+	sendJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "Transcript retrieved successfully",
+		Data:    entries,
+	})
+}
@@ -0,0 +1,323 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/config"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/validation"
+)
+
+// clockTicks is USER_HZ, the unit of the CPU times in /proc/<pid>/stat on Linux
+const clockTicks = 100
+
+// Trigger watches one JVM metric and starts a preset recording once it stays above its threshold
+type Trigger struct {
+	Metric    string  `json:"metric"`    // "cpu" or "heap"
+	Threshold float64 `json:"threshold"` // percent
+	For       string  `json:"for"`       // how long the metric must stay above the threshold
+	Preset    string  `json:"preset"`
+
+	Value      float64   `json:"value"` // latest sample, percent
+	AboveSince time.Time `json:"aboveSince,omitzero"`
+	LastFired  time.Time `json:"lastFired,omitzero"`
+	LastJob    string    `json:"lastJob,omitempty"` // job of the last triggered recording
+	LastError  string    `json:"lastError,omitempty"`
+
+	forDuration time.Duration
+}
+
+// TriggerConfig is the threshold watcher: every interval it samples the JVM's CPU usage (from
+// /proc, as a share of cpuCores) and heap occupancy (from PerfCounter.print)
+type TriggerConfig struct {
+	Interval  string    `json:"interval"`
+	Cooldown  string    `json:"cooldown"` // minimum time between two recordings of one trigger
+	Duration  string    `json:"duration"` // length of the triggered recordings
+	CPUCores  float64   `json:"cpuCores"` // CPU capacity that 100% stands for
+	Container string    `json:"container,omitempty"`
+	Triggers  []Trigger `json:"triggers"`
+}
+
+// triggersFromEnv reads the TRIGGER_* settings; it returns nil when no threshold is set
+func triggersFromEnv() *TriggerConfig {
+	cfg := &TriggerConfig{
+		Interval:  config.Env("TRIGGER_INTERVAL", "15s"),
+		Cooldown:  config.Env("TRIGGER_COOLDOWN", "30m"),
+		Duration:  config.Env("TRIGGER_DURATION", "60s"),
+		CPUCores:  float64(runtime.NumCPU()),
+		Container: os.Getenv("TRIGGER_CONTAINER"),
+	}
+	if cores, err := strconv.ParseFloat(os.Getenv("TRIGGER_CPU_CORES"), 64); err == nil {
+		cfg.CPUCores = cores
+	}
+	for _, metric := range []struct{ name, preset string }{{"cpu", "cpu"}, {"heap", "alloc"}} {
+		prefix := "TRIGGER_" + strings.ToUpper(metric.name) + "_"
+		v := os.Getenv(prefix + "PERCENT")
+		if v == "" {
+			continue
+		}
+		threshold, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			threshold = -1 // rejected by Validate
+		}
+		cfg.Triggers = append(cfg.Triggers, Trigger{
+			Metric:    metric.name,
+			Threshold: threshold,
+			For:       config.Env(prefix+"FOR", "2m"),
+			Preset:    config.Env(prefix+"PRESET", metric.preset),
+		})
+	}
+	if len(cfg.Triggers) == 0 {
+		return nil
+	}
+	return cfg
+}
+
+// Validate checks the durations and thresholds
+func (c *TriggerConfig) Validate() validation.Errors {
+	errs := validation.Collect(
+		validDuration("interval", c.Interval),
+		validDuration("cooldown", c.Cooldown),
+		validRecordingDuration("duration", c.Duration),
+	)
+	if c.CPUCores <= 0 {
+		errs = append(errs, validation.FieldError{Field: "cpuCores", Message: "must be positive"})
+	}
+	for i, t := range c.Triggers {
+		field := fmt.Sprintf("triggers[%d]", i)
+		if t.Threshold <= 0 || t.Threshold > 100 {
+			errs = append(errs, validation.FieldError{Field: field + ".threshold", Message: "must be a percentage between 0 and 100"})
+		}
+		errs = append(errs, validation.Collect(validDuration(field+".for", t.For))...)
+	}
+	return errs
+}
+
+// validLimits checks the duration against RECORDING_MAX_DURATION and the presets against the
+// configured ones
+func (c *TriggerConfig) validLimits(s *Server) validation.Errors {
+	errs := validation.Collect(s.validDurationLimit("duration", c.Duration))
+	for i, t := range c.Triggers {
+		errs = append(errs, validation.Collect(s.validPreset(fmt.Sprintf("triggers[%d].preset", i), t.Preset))...)
+	}
+	return errs
+}
+
+// cpuSample is a process's cumulative CPU time at a point in time
+type cpuSample struct {
+	pid   int
+	ticks int64
+	at    time.Time
+}
+
+// startTriggers runs the threshold watcher until ctx is done
+func (s *Server) startTriggers(ctx context.Context, cfg *TriggerConfig) {
+	for i := range cfg.Triggers {
+		cfg.Triggers[i].forDuration, _ = time.ParseDuration(cfg.Triggers[i].For)
+	}
+	s.triggersMu.Lock()
+	s.triggers = cfg
+	s.triggersMu.Unlock()
+
+	interval, _ := time.ParseDuration(cfg.Interval)
+	logger.Log.WithField("interval", cfg.Interval).WithField("triggers", len(cfg.Triggers)).Info("Threshold triggers enabled")
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var last cpuSample
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				last = s.checkTriggers(ctx, last)
+			}
+		}
+	}()
+}
+
+// checkTriggers samples the metrics once and fires the triggers that stayed above their
+// threshold for long enough and are out of their cooldown. CPU usage needs two samples, so it
+// takes the previous one and returns the new one.
+func (s *Server) checkTriggers(ctx context.Context, last cpuSample) cpuSample {
+	s.triggersMu.Lock()
+	cfg := *s.triggers
+	s.triggersMu.Unlock()
+
+	pid, err := s.targetJVM(ctx, JVMSelector{Container: cfg.Container})
+	values := map[string]float64{}
+	errs := map[string]error{}
+	if err != nil {
+		errs["cpu"], errs["heap"] = err, err
+	} else {
+		var cpu float64
+		cpu, last, errs["cpu"] = s.sampleCPU(pid, last, cfg.CPUCores)
+		values["cpu"] = cpu
+		values["heap"], errs["heap"] = s.sampleHeap(ctx, pid)
+	}
+
+	now := s.clock.Now()
+	cooldown, _ := time.ParseDuration(cfg.Cooldown)
+	var fire []Trigger
+	s.triggersMu.Lock()
+	for i := range s.triggers.Triggers {
+		t := &s.triggers.Triggers[i]
+		if err := errs[t.Metric]; err != nil {
+			if !errors.Is(err, errFirstCPUSample) {
+				t.LastError = err.Error()
+			}
+			continue
+		}
+		t.Value = values[t.Metric]
+		t.LastError = ""
+		switch {
+		case t.Value <= t.Threshold:
+			t.AboveSince = time.Time{}
+		case t.AboveSince.IsZero():
+			t.AboveSince = now
+		}
+		if !t.AboveSince.IsZero() && now.Sub(t.AboveSince) >= t.forDuration &&
+			(t.LastFired.IsZero() || now.Sub(t.LastFired) >= cooldown) {
+			t.LastFired = now
+			fire = append(fire, *t)
+			t.AboveSince = time.Time{}
+		}
+	}
+	s.triggersMu.Unlock()
+
+	for _, t := range fire {
+		jobID, err := s.startTriggeredRecording(ctx, pid, cfg, t)
+		s.triggersMu.Lock()
+		for i := range s.triggers.Triggers {
+			if current := &s.triggers.Triggers[i]; current.Metric == t.Metric {
+				current.LastJob = jobID
+				if err != nil {
+					current.LastError = fmt.Sprintf("failed to start recording: %v", err)
+				}
+			}
+		}
+		s.triggersMu.Unlock()
+	}
+	return last
+}
+
+// errFirstCPUSample reports that CPU usage has no previous sample to compare with yet
+var errFirstCPUSample = errors.New("no previous CPU sample")
+
+// sampleCPU returns the JVM's CPU usage since the last sample as a percentage of cores. It reads
+// utime and stime from /proc/<pid>/stat, which needs a shared PID namespace.
+func (s *Server) sampleCPU(pid int, last cpuSample, cores float64) (float64, cpuSample, error) {
+	data, err := s.fs.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, last, fmt.Errorf("failed to read CPU usage: %w", err)
+	}
+	// The command name in parentheses may contain spaces; the fields after it are fixed
+	i := strings.LastIndexByte(string(data), ')')
+	fields := strings.Fields(string(data)[i+1:])
+	if i < 0 || len(fields) < 13 {
+		return 0, last, errors.New("failed to read CPU usage: unexpected /proc stat format")
+	}
+	utime, _ := strconv.ParseInt(fields[11], 10, 64)
+	stime, _ := strconv.ParseInt(fields[12], 10, 64)
+	current := cpuSample{pid: pid, ticks: utime + stime, at: s.clock.Now()}
+
+	elapsed := current.at.Sub(last.at).Seconds()
+	if last.pid != pid || elapsed <= 0 {
+		return 0, current, errFirstCPUSample
+	}
+	used := float64(current.ticks-last.ticks) / clockTicks
+	return 100 * used / elapsed / cores, current, nil
+}
+
+// sampleHeap returns the heap's occupancy as a percentage of its maximum size
+func (s *Server) sampleHeap(ctx context.Context, pid int) (float64, error) {
+	output, err := s.runJcmd(ctx, nil, pid, "PerfCounter.print")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read performance counters: %v, output: %s", err, string(output))
+	}
+	heap := jvmMetricsFrom(parsePerfCounters(string(output))).Heap
+	if heap.Max == 0 {
+		return 0, errors.New("the JVM exposes no heap counters")
+	}
+	return 100 * float64(heap.Used) / float64(heap.Max), nil
+}
+
+// startTriggeredRecording starts a preset recording for a fired trigger as a job, like /create
+func (s *Server) startTriggeredRecording(ctx context.Context, pid int, cfg TriggerConfig, t Trigger) (string, error) {
+	if _, err := s.fs.Stat(filepath.Join(s.cfg.ProfileDir, quotaMarker)); err == nil {
+		return "", errors.New("the namespace is over its upload quota")
+	}
+	req := ProfileRequest{
+		Name:        fmt.Sprintf("trigger-%s_%s", t.Metric, s.timestampSuffix(s.clock.Now())),
+		Duration:    cfg.Duration,
+		Engine:      engineJFR,
+		Preset:      t.Preset,
+		Container:   cfg.Container,
+		Description: fmt.Sprintf("Triggered: %s at %.1f%%, above %.0f%% for %s", t.Metric, t.Value, t.Threshold, t.For),
+	}
+	if err := s.checkDiskSpace(&req); err != nil {
+		return "", err
+	}
+	job, err := s.newJob(ctx, pid, req)
+	if err != nil {
+		return "", err
+	}
+	logger.Log.WithFields(map[string]any{
+		"metric":    t.Metric,
+		"value":     t.Value,
+		"threshold": t.Threshold,
+		"name":      req.Name,
+	}).Warn("Threshold crossed, starting recording")
+	s.starting.Add(1)
+	go s.runJob(context.WithoutCancel(ctx), job, req)
+	return job.ID, nil
+}
+
+// triggersHandler reports the threshold triggers and their latest samples
+func (s *Server) triggersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendJSON(w, http.StatusMethodNotAllowed, Response{
+			Success: false,
+			Message: "Method not allowed",
+		})
+		return
+	}
+	s.triggersMu.Lock()
+	var status *TriggerConfig
+	if s.triggers != nil {
+		snapshot := *s.triggers
+		snapshot.Triggers = append([]Trigger(nil), s.triggers.Triggers...)
+		status = &snapshot
+	}
+	s.triggersMu.Unlock()
+
+	if status == nil {
+		sendJSON(w, http.StatusOK, Response{
+			Success: true,
+			Message: "No threshold triggers are configured",
+			Data:    TriggerConfig{Triggers: []Trigger{}},
+		})
+		return
+	}
+	sendJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("%d threshold triggers", len(status.Triggers)),
+		Data:    status,
+	})
+}
+
+// triggersEnabled reports whether any threshold trigger is configured
+func (s *Server) triggersEnabled() bool {
+	s.triggersMu.Lock()
+	defer s.triggersMu.Unlock()
+	return s.triggers != nil
+}
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/version"
+)
+
+// versionHandler reports the sidecar's build, so a deployment can be told apart from another
+func (s *Server) versionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendJSON(w, http.StatusMethodNotAllowed, Response{
+			Success: false,
+			Message: "Method not allowed",
+		})
+		return
+	}
+	build := version.Get()
+	sendJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "profiler-sidecar " + build.Version,
+		Data:    build,
+	})
+}
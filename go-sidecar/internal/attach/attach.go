@@ -0,0 +1,167 @@
+// Package attach speaks the HotSpot dynamic attach protocol, the one jcmd and jattach use, so
+// diagnostic commands can be sent to a JVM without a JDK in the caller's image.
+//
+// A JVM starts its attach listener when it receives SIGQUIT while a file named
+// .attach_pid<pid> exists in its working or temporary directory. It then listens on the UNIX
+// socket /tmp/.java_pid<pid> and accepts connections from its own effective user or root. The
+// paths are reached through /proc/<pid>/root and /proc/<pid>/cwd, so the JVM may run in another
+// mount namespace, and <pid> is the JVM's PID in its own PID namespace.
+package attach
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// protocolVersion is the attach request version every HotSpot release since JDK 6 accepts
+const protocolVersion = "1"
+
+// listenerPoll is the first interval between checks for the attach socket; it doubles up to
+// listenerPollMax
+const (
+	listenerPoll    = 20 * time.Millisecond
+	listenerPollMax = 500 * time.Millisecond
+)
+
+// ErrCommandFailed marks a command the JVM ran and reported as failed; the output has its message
+var ErrCommandFailed = errors.New("attach command failed")
+
+// Jcmd runs a diagnostic command line ("JFR.check", "JFR.start name=x duration=60s") in the JVM
+// with the given PID and returns its output. The JVM's attach listener is started first if
+// needed. ctx bounds the whole exchange; a command the JVM already started keeps running when
+// ctx ends.
+func Jcmd(ctx context.Context, pid int, command string) ([]byte, error) {
+	nsPID, err := namespacePID(pid)
+	if err != nil {
+		return nil, err
+	}
+	socket := filepath.Join(procPath(pid, "root"), "tmp", ".java_pid"+nsPID)
+	if err := startListener(ctx, pid, nsPID, socket); err != nil {
+		return nil, err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the attach listener of JVM %d: %w", pid, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// Closing the connection unblocks a read when ctx is cancelled without a deadline
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	// Version, the "jcmd" operation and its three arguments, each NUL-terminated
+	request := strings.Join([]string{protocolVersion, "jcmd", command, "", ""}, "\x00") + "\x00"
+	if _, err := io.WriteString(conn, request); err != nil {
+		return nil, fmt.Errorf("failed to send command to JVM %d: %w", pid, contextErr(ctx, err))
+	}
+	return readResponse(ctx, conn, pid)
+}
+
+// readResponse reads the result code line followed by the command's output
+func readResponse(ctx context.Context, conn net.Conn, pid int) ([]byte, error) {
+	reader := bufio.NewReader(conn)
+	status, err := reader.ReadString('\n')
+	if err != nil {
+		if errors.Is(err, io.EOF) && status == "" {
+			return nil, fmt.Errorf("JVM %d closed the attach connection; the sidecar must run as the JVM's user or as root", pid)
+		}
+		return nil, fmt.Errorf("failed to read the reply of JVM %d: %w", pid, contextErr(ctx, err))
+	}
+	output, err := io.ReadAll(reader)
+	if err != nil {
+		return output, fmt.Errorf("failed to read the reply of JVM %d: %w", pid, contextErr(ctx, err))
+	}
+
+	code, err := strconv.Atoi(strings.TrimSpace(status))
+	if err != nil {
+		return output, fmt.Errorf("unexpected attach reply %q from JVM %d", strings.TrimSpace(status), pid)
+	}
+	if code != 0 {
+		return output, fmt.Errorf("%w: JVM %d returned %d", ErrCommandFailed, pid, code)
+	}
+	return output, nil
+}
+
+// startListener makes the JVM open its attach socket if it has not already
+func startListener(ctx context.Context, pid int, nsPID, socket string) error {
+	if isSocket(socket) {
+		return nil
+	}
+
+	// The JVM looks for the trigger file in its working directory, then in /tmp
+	trigger := filepath.Join(procPath(pid, "cwd"), ".attach_pid"+nsPID)
+	if err := os.WriteFile(trigger, nil, 0o600); err != nil {
+		trigger = filepath.Join(procPath(pid, "root"), "tmp", ".attach_pid"+nsPID)
+		if err := os.WriteFile(trigger, nil, 0o600); err != nil {
+			return fmt.Errorf("failed to request the attach listener of JVM %d: %w", pid, err)
+		}
+	}
+	defer os.Remove(trigger)
+
+	if err := syscall.Kill(pid, syscall.SIGQUIT); err != nil {
+		return fmt.Errorf("failed to signal JVM %d: %w", pid, err)
+	}
+
+	poll := listenerPoll
+	for !isSocket(socket) {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("attach listener of JVM %d did not start (is it started with -XX:+DisableAttachMechanism?): %w", pid, ctx.Err())
+		case <-time.After(poll):
+		}
+		poll = min(2*poll, listenerPollMax)
+	}
+	return nil
+}
+
+// namespacePID returns the PID the JVM sees for itself, the last entry of NSpid in
+// /proc/<pid>/status; kernels without NSpid share the caller's PID namespace
+func namespacePID(pid int) (string, error) {
+	data, err := os.ReadFile(procPath(pid, "status"))
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect JVM %d: %w", pid, err)
+	}
+	for line := range bytes.Lines(data) {
+		if value, ok := bytes.CutPrefix(line, []byte("NSpid:")); ok {
+			if fields := strings.Fields(string(value)); len(fields) > 0 {
+				return fields[len(fields)-1], nil
+			}
+		}
+	}
+	return strconv.Itoa(pid), nil
+}
+
+// procPath returns /proc/<pid>/<name>
+func procPath(pid int, name string) string {
+	return filepath.Join("/proc", strconv.Itoa(pid), name)
+}
+
+// isSocket reports whether path is a UNIX socket
+func isSocket(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode()&os.ModeSocket != 0
+}
+
+// contextErr prefers ctx's error, since an expired deadline or a cancellation surfaces from the
+// connection as a timeout or a closed connection
+func contextErr(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
@@ -0,0 +1,129 @@
+package breaker
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned (wrapped in *OpenError) while a circuit refuses calls
+var ErrOpen = errors.New("circuit open")
+
+// State is the position of a circuit
+type State string
+
+const (
+	Closed   State = "closed"    // calls flow normally
+	Open     State = "open"      // calls fail fast until the cooldown elapses
+	HalfOpen State = "half-open" // a single trial call decides whether to close again
+)
+
+// OpenError reports why a call was refused and when it may be retried
+type OpenError struct {
+	Name     string
+	Failures int
+	Until    time.Time
+	LastErr  error
+}
+
+func (e *OpenError) Error() string {
+	msg := fmt.Sprintf("%s: circuit open after %d consecutive failures, retry after %s",
+		e.Name, e.Failures, e.Until.Format(time.RFC3339))
+	if e.LastErr != nil {
+		msg += fmt.Sprintf(" (last error: %v)", e.LastErr)
+	}
+	return msg
+}
+
+func (e *OpenError) Unwrap() error {
+	return ErrOpen
+}
+
+// Breaker opens after threshold consecutive failures and stays open for cooldown.
+// After the cooldown one trial call is let through; its result closes or re-opens the circuit.
+type Breaker struct {
+	mu        sync.Mutex
+	name      string
+	threshold int
+	cooldown  time.Duration
+	state     State
+	failures  int
+	openUntil time.Time
+	lastErr   error
+	trial     bool // a half-open trial call is in flight
+}
+
+// New creates a closed breaker; threshold <= 0 disables it
+func New(name string, threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{name: name, threshold: threshold, cooldown: cooldown, state: Closed}
+}
+
+// Allow reports whether a call may proceed; callers that get nil must call Record with its result
+func (b *Breaker) Allow() error {
+	if b.threshold <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Open:
+		if time.Now().Before(b.openUntil) {
+			return b.openError()
+		}
+		b.state = HalfOpen
+		fallthrough
+	case HalfOpen:
+		if b.trial {
+			return b.openError()
+		}
+		b.trial = true
+	}
+	return nil
+}
+
+// Record feeds the result of an allowed call back into the breaker
+func (b *Breaker) Record(err error) {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if err == nil {
+		b.state = Closed
+		b.failures = 0
+		b.lastErr = nil
+		return
+	}
+
+	b.failures++
+	b.lastErr = err
+	if b.state == HalfOpen || b.failures >= b.threshold {
+		b.state = Open
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+// Forget releases an allowed call whose outcome says nothing about the target (e.g. the caller gave up)
+func (b *Breaker) Forget() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+// State returns the current position of the circuit
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open && !time.Now().Before(b.openUntil) {
+		return HalfOpen
+	}
+	return b.state
+}
+
+func (b *Breaker) openError() *OpenError {
+	return &OpenError{Name: b.name, Failures: b.failures, Until: b.openUntil, LastErr: b.lastErr}
+}
@@ -0,0 +1,349 @@
+package collector
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/config"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/fakejvm"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/filetype"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/metrics"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/requestid"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/tenant"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/uploader"
+	"github.com/sirupsen/logrus"
+)
+
+// Collector configuration. Uploads are refused with 503 and a Retry-After once the spool holds
+// COLLECTOR_SPOOL_MAX bytes or COLLECTOR_MAX_CONCURRENT uploads are being received, so sidecars and
+// daemons keep their files and retry instead of the collector running out of disk.
+var (
+	collectorPort = config.Env("COLLECTOR_PORT", "8443")
+	spoolDir      = config.Env("COLLECTOR_SPOOL_DIR", "/var/spool/profiler")
+	spoolMax      = config.EnvSize("COLLECTOR_SPOOL_MAX", 10<<30)
+	maxConcurrent = config.EnvInt("COLLECTOR_MAX_CONCURRENT", 32)
+	workers       = config.EnvInt("COLLECTOR_WORKERS", 4)
+	retryAfter    = config.EnvDuration("COLLECTOR_RETRY_AFTER", 30*time.Second)
+	tlsCert       = os.Getenv("COLLECTOR_TLS_CERT")
+	tlsKey        = os.Getenv("COLLECTOR_TLS_KEY")
+)
+
+// namePattern keeps pod and file names usable as a single path element
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._+-]{0,252}$`)
+
+// maxMetadataBytes bounds the object metadata an upload may carry
+const maxMetadataBytes = 8 << 10
+
+// errSpoolFull is returned once a receive would take the spool over COLLECTOR_SPOOL_MAX
+var errSpoolFull = errors.New("spool is full")
+
+// Response mirrors the sidecar API's JSON envelope
+type Response struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+// Deps are the collaborators a Server is built from
+type Deps struct {
+	// Uploader forwards spooled files to the object store
+	Uploader uploader.Uploader
+
+	// Token authenticates node daemons and sidecars, which send their own upload scope
+	Token string
+
+	// Tenants accepts tenant tokens; their uploads are forced into the tenant's scope
+	Tenants *tenant.Registry
+}
+
+// Server receives recordings from sidecars and daemons, spools them to local disk and forwards
+// them to the object store. Spooled files survive restarts and are forwarded on the next start.
+type Server struct {
+	uploader uploader.Uploader
+	token    string
+	tenants  *tenant.Registry
+	spool    *spool
+
+	receiving chan struct{} // one slot per upload being received
+	queue     chan *job
+}
+
+// NewServer builds a collector spooling to COLLECTOR_SPOOL_DIR
+func NewServer(deps Deps) (*Server, error) {
+	if deps.Token == "" && deps.Tenants == nil {
+		return nil, fmt.Errorf("COLLECTOR_TOKEN or TENANTS_FILE is required; the collector never accepts unauthenticated uploads")
+	}
+	if spoolMax <= 0 {
+		return nil, fmt.Errorf("COLLECTOR_SPOOL_MAX must be positive, got %d", spoolMax)
+	}
+	sp, err := openSpool(spoolDir, spoolMax)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{
+		uploader:  deps.Uploader,
+		token:     deps.Token,
+		tenants:   deps.Tenants,
+		spool:     sp,
+		receiving: make(chan struct{}, max(maxConcurrent, 1)),
+		queue:     make(chan *job, 1024),
+	}, nil
+}
+
+// Start runs the collector until SIGINT or SIGTERM, with the uploader built from cfg and the
+// environment, and the token and tenants taken from the environment
+func Start(cfg *config.Config) {
+	u, err := uploader.NewFromConfig(context.Background(), cfg, fakejvm.Enabled())
+	if err != nil {
+		logger.Log.Fatalf("Failed to initialize uploader: %v", err)
+	}
+	defer u.Close()
+
+	token := os.Getenv("COLLECTOR_TOKEN")
+	if path := os.Getenv("COLLECTOR_TOKEN_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			logger.Log.Fatalf("Failed to read collector token file: %v", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	tenants, err := tenant.LoadFromEnv()
+	if err != nil {
+		logger.Log.Fatalf("Invalid tenant configuration: %v", err)
+	}
+
+	s, err := NewServer(Deps{Uploader: u, Token: token, Tenants: tenants})
+	if err != nil {
+		logger.Log.Fatalf("Failed to start collector: %v", err)
+	}
+	s.Run()
+}
+
+// Run forwards spooled files and serves uploads until SIGINT or SIGTERM
+func (s *Server) Run() {
+	logger.Log.WithFields(logrus.Fields{
+		"spool":       spoolDir,
+		"spool_max":   spoolMax,
+		"destination": s.uploader.Destination(),
+	}).Info("Collector started")
+
+	metrics.SubscribeUploadEvents()
+
+	ctx, stopWorkers := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.forward(ctx)
+		}()
+	}
+
+	// Files spooled before a restart are forwarded first
+	pending, err := s.spool.recover()
+	if err != nil {
+		logger.Log.WithError(err).Error("Failed to recover spooled files")
+	}
+	for _, j := range pending {
+		s.enqueue(ctx, j, 0)
+	}
+	if len(pending) > 0 {
+		logger.Log.WithField("files", len(pending)).Info("Forwarding files spooled before restart")
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /v1/recordings/{pod}/{filename}", s.receiveHandler)
+	mux.HandleFunc("GET /health", s.healthHandler)
+	mux.Handle("GET /metrics", metrics.Handler())
+	server := &http.Server{
+		Addr:              ":" + collectorPort,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	shutdownChan := make(chan os.Signal, 1)
+	signal.Notify(shutdownChan, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		var err error
+		if tlsCert != "" && tlsKey != "" {
+			logger.Log.WithField("port", collectorPort).Info("Collector listening (TLS)")
+			err = server.ListenAndServeTLS(tlsCert, tlsKey)
+		} else {
+			logger.Log.WithField("port", collectorPort).Warn("Collector listening without TLS; set COLLECTOR_TLS_CERT and COLLECTOR_TLS_KEY")
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			logger.Log.WithError(err).Fatal("Failed to start collector")
+		}
+	}()
+
+	<-shutdownChan
+	logger.Log.Info("Shutdown signal received, finishing in-flight uploads...")
+
+	// Let receives finish; anything not yet forwarded stays spooled for the next start
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Log.WithError(err).Error("Collector shutdown error")
+	}
+	stopWorkers()
+	wg.Wait()
+	logger.Log.Info("Collector stopped")
+}
+
+// receiveHandler spools an upload and queues it for forwarding. The body may be chunked; files
+// are only acknowledged once fully written to the spool.
+func (s *Server) receiveHandler(w http.ResponseWriter, r *http.Request) {
+	scope, ok := s.authenticate(r)
+	if !ok {
+		metrics.CollectorRequestsTotal.WithLabelValues("unauthorized").Inc()
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		sendJSON(w, http.StatusUnauthorized, Response{Success: false, Message: "Unauthorized"})
+		return
+	}
+
+	pod, filename := r.PathValue("pod"), r.PathValue("filename")
+	if !namePattern.MatchString(pod) || !namePattern.MatchString(filename) || filetype.Lookup(filename).Prefix == "" {
+		metrics.CollectorRequestsTotal.WithLabelValues("invalid").Inc()
+		sendJSON(w, http.StatusBadRequest, Response{
+			Success: false,
+			Message: "pod and filename must be plain names of a profiling artifact",
+		})
+		return
+	}
+
+	if r.ContentLength > spoolMax {
+		metrics.CollectorRequestsTotal.WithLabelValues("too_large").Inc()
+		sendJSON(w, http.StatusRequestEntityTooLarge, Response{
+			Success: false,
+			Message: fmt.Sprintf("File exceeds the collector spool (%d bytes)", spoolMax),
+		})
+		return
+	}
+
+	select {
+	case s.receiving <- struct{}{}:
+		defer func() { <-s.receiving }()
+	default:
+		s.sendBusy(w, "busy", "Too many uploads in progress")
+		return
+	}
+
+	requestID := requestid.FromHeader(r.Header.Get(requestid.Header))
+	w.Header().Set(requestid.Header, requestID)
+
+	j, err := s.spool.receive(r.Body, r.ContentLength, pod, filename, scope, objectMetadata(r.Header))
+	if err != nil {
+		if errors.Is(err, errSpoolFull) {
+			s.sendBusy(w, "spool_full", "Collector spool is full")
+			return
+		}
+		metrics.CollectorRequestsTotal.WithLabelValues("failed").Inc()
+		logger.Log.WithError(err).WithFields(logrus.Fields{"pod": pod, "request_id": requestID}).Error("Failed to spool upload")
+		sendJSON(w, http.StatusInternalServerError, Response{Success: false, Message: "Failed to spool upload"})
+		return
+	}
+
+	metrics.CollectorRequestsTotal.WithLabelValues("accepted").Inc()
+	metrics.CollectorReceivedBytesTotal.Add(float64(j.Size))
+	logger.Log.WithFields(logrus.Fields{
+		"pod":        pod,
+		"file":       filename,
+		"size":       j.Size,
+		"id":         j.ID,
+		"request_id": requestID,
+	}).Info("Spooled upload")
+
+	s.enqueue(context.Background(), j, 0)
+	sendJSON(w, http.StatusAccepted, Response{
+		Success: true,
+		Message: "Upload spooled for forwarding",
+		Data:    map[string]any{"id": j.ID, "size": j.Size},
+	})
+}
+
+// authenticate checks the bearer token and returns the scope to upload with: a tenant's own, or
+// the one a trusted node sends in the scope headers
+func (s *Server) authenticate(r *http.Request) (uploader.Scope, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return uploader.Scope{}, false
+	}
+	if s.tenants != nil {
+		if t, ok := s.tenants.ByToken(token); ok {
+			return uploader.Scope{Prefix: t.Prefix, Bucket: t.Bucket}, true
+		}
+	}
+	if s.token != "" && subtle.ConstantTimeCompare([]byte(s.token), []byte(token)) == 1 {
+		return uploader.Scope{
+			Prefix: strings.Trim(r.Header.Get(uploader.CollectorPrefixHeader), "/"),
+			Bucket: r.Header.Get(uploader.CollectorBucketHeader),
+		}, true
+	}
+	return uploader.Scope{}, false
+}
+
+// objectMetadata collects the extra object metadata sent in X-Upload-Metadata-* headers, up to
+// the 8 KiB GCS allows per object
+func objectMetadata(h http.Header) map[string]string {
+	var metadata map[string]string
+	total := 0
+	for name, values := range h {
+		key, ok := strings.CutPrefix(name, uploader.CollectorMetadataPrefix)
+		if !ok || key == "" || len(values) == 0 {
+			continue
+		}
+		key = strings.ToLower(key)
+		if total += len(key) + len(values[0]); total > maxMetadataBytes {
+			break
+		}
+		if metadata == nil {
+			metadata = map[string]string{}
+		}
+		metadata[key] = values[0]
+	}
+	return metadata
+}
+
+// sendBusy rejects an upload the collector cannot take right now
+func (s *Server) sendBusy(w http.ResponseWriter, reason, message string) {
+	metrics.CollectorRequestsTotal.WithLabelValues(reason).Inc()
+	w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+	sendJSON(w, http.StatusServiceUnavailable, Response{Success: false, Message: message})
+}
+
+// healthHandler reports spool usage
+func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
+	files, bytes := s.spool.usage()
+	sendJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "Collector is healthy",
+		Data: map[string]any{
+			"spoolFiles":    files,
+			"spoolBytes":    bytes,
+			"spoolMaxBytes": spoolMax,
+			"receiving":     len(s.receiving),
+		},
+	})
+}
+
+// sendJSON sends a JSON response
+func sendJSON(w http.ResponseWriter, status int, data Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
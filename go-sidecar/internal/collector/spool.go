@@ -0,0 +1,313 @@
+package collector
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/events"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/metrics"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/uploader"
+)
+
+const (
+	jobFile         = "job.json"
+	retryBackoffMin = 5 * time.Second
+	retryBackoffMax = 5 * time.Minute
+)
+
+// job is one spooled file: {spool}/{ID}/{Filename}, described by {spool}/{ID}/job.json. The
+// description is written last, so a directory without one is an interrupted receive.
+type job struct {
+	ID       string            `json:"id"`
+	Pod      string            `json:"pod"`
+	Filename string            `json:"filename"`
+	Prefix   string            `json:"prefix,omitempty"`
+	Bucket   string            `json:"bucket,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Size     int64             `json:"size"`
+	Received time.Time         `json:"received"`
+
+	dir      string
+	attempts int
+}
+
+func (j *job) path() string {
+	return filepath.Join(j.dir, j.Filename)
+}
+
+// spool tracks the bytes held on disk, including reservations for uploads still being received
+type spool struct {
+	dir string
+	max int64
+
+	mu    sync.Mutex
+	bytes int64
+	files int
+}
+
+// openSpool creates the spool directory
+func openSpool(dir string, max int64) (*spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	return &spool{dir: dir, max: max}, nil
+}
+
+// reserve claims n bytes of spool space, failing with errSpoolFull when they are not available
+func (sp *spool) reserve(n int64) error {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if sp.bytes+n > sp.max {
+		return errSpoolFull
+	}
+	sp.bytes += n
+	metrics.CollectorSpoolBytes.Set(float64(sp.bytes))
+	return nil
+}
+
+// free returns n bytes to the spool
+func (sp *spool) free(n int64) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	sp.bytes -= n
+	metrics.CollectorSpoolBytes.Set(float64(sp.bytes))
+}
+
+func (sp *spool) addFiles(n int) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	sp.files += n
+	metrics.CollectorSpoolFiles.Set(float64(sp.files))
+}
+
+// usage returns the number of spooled files and the bytes held
+func (sp *spool) usage() (int, int64) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	return sp.files, sp.bytes
+}
+
+// receive writes body to a new job. A known size is reserved up front; a chunked body reserves
+// space as it arrives and is abandoned as soon as the spool fills.
+func (sp *spool) receive(body io.Reader, size int64, pod, filename string, scope uploader.Scope, metadata map[string]string) (*job, error) {
+	if size > 0 {
+		if err := sp.reserve(size); err != nil {
+			return nil, err
+		}
+	}
+	reserved := max(size, 0)
+
+	id, err := newJobID()
+	if err != nil {
+		sp.free(reserved)
+		return nil, err
+	}
+	j := &job{
+		ID:       id,
+		Pod:      pod,
+		Filename: filename,
+		Prefix:   scope.Prefix,
+		Bucket:   scope.Bucket,
+		Metadata: metadata,
+		Received: time.Now().UTC(),
+		dir:      filepath.Join(sp.dir, id),
+	}
+	fail := func(err error) (*job, error) {
+		os.RemoveAll(j.dir)
+		sp.free(reserved)
+		return nil, err
+	}
+
+	if err := os.Mkdir(j.dir, 0o700); err != nil {
+		return fail(fmt.Errorf("failed to create spool entry: %w", err))
+	}
+	f, err := os.Create(j.path())
+	if err != nil {
+		return fail(fmt.Errorf("failed to create spool file: %w", err))
+	}
+
+	written, copyErr := io.Copy(f, &reservingReader{r: body, sp: sp, reserved: &reserved})
+	if copyErr == nil {
+		copyErr = f.Sync()
+	}
+	if err := f.Close(); copyErr == nil {
+		copyErr = err
+	}
+	if copyErr != nil {
+		return fail(copyErr)
+	}
+	if size > 0 && written != size {
+		return fail(fmt.Errorf("received %d of %d bytes", written, size))
+	}
+
+	// A declared size larger than the body leaves spare reservation behind
+	sp.free(reserved - written)
+	reserved = written
+	j.Size = written
+
+	data, err := json.Marshal(j)
+	if err != nil {
+		return fail(err)
+	}
+	if err := os.WriteFile(filepath.Join(j.dir, jobFile), data, 0o600); err != nil {
+		return fail(fmt.Errorf("failed to record spool entry: %w", err))
+	}
+	sp.addFiles(1)
+	return j, nil
+}
+
+// recover loads the jobs left in the spool by a previous run and removes interrupted receives
+func (sp *spool) recover() ([]*job, error) {
+	entries, err := os.ReadDir(sp.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []*job
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(sp.dir, entry.Name())
+		data, err := os.ReadFile(filepath.Join(dir, jobFile))
+		if err != nil {
+			logger.Log.WithField("dir", dir).Info("Removing interrupted spool entry")
+			os.RemoveAll(dir)
+			continue
+		}
+		j := &job{dir: dir}
+		if err := json.Unmarshal(data, j); err != nil || !namePattern.MatchString(j.Pod) || !namePattern.MatchString(j.Filename) {
+			logger.Log.WithField("dir", dir).Warn("Removing unreadable spool entry")
+			os.RemoveAll(dir)
+			continue
+		}
+		// Recovered files are accounted even past the limit, which only holds back new receives
+		sp.mu.Lock()
+		sp.bytes += j.Size
+		metrics.CollectorSpoolBytes.Set(float64(sp.bytes))
+		sp.mu.Unlock()
+		sp.addFiles(1)
+		jobs = append(jobs, j)
+	}
+	return jobs, nil
+}
+
+// remove deletes a forwarded job and frees its space
+func (sp *spool) remove(j *job) error {
+	if err := os.RemoveAll(j.dir); err != nil {
+		return err
+	}
+	sp.free(j.Size)
+	sp.addFiles(-1)
+	return nil
+}
+
+// reservingReader reserves spool space for every chunk read from a body of unknown length
+type reservingReader struct {
+	r        io.Reader
+	sp       *spool
+	reserved *int64
+	read     int64
+}
+
+func (rr *reservingReader) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+	rr.read += int64(n)
+	if extra := rr.read - *rr.reserved; extra > 0 {
+		if rerr := rr.sp.reserve(extra); rerr != nil {
+			return n, rerr
+		}
+		*rr.reserved += extra
+	}
+	return n, err
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// enqueue queues j for forwarding after delay
+func (s *Server) enqueue(ctx context.Context, j *job, delay time.Duration) {
+	go func() {
+		if delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return
+			}
+		}
+		select {
+		case s.queue <- j:
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// forward uploads queued jobs until ctx is cancelled. Failed uploads stay spooled and are retried
+// with exponential backoff.
+func (s *Server) forward(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case j := <-s.queue:
+			s.forwardJob(ctx, j)
+		}
+	}
+}
+
+func (s *Server) forwardJob(ctx context.Context, j *job) {
+	uploadCtx := ctx
+	if j.Prefix != "" || j.Bucket != "" {
+		uploadCtx = uploader.WithScope(ctx, uploader.Scope{Prefix: j.Prefix, Bucket: j.Bucket})
+	}
+	uploadCtx = uploader.WithObjectMetadata(uploadCtx, j.Metadata)
+	destination := uploader.DestinationFor(uploadCtx, s.uploader)
+
+	start := time.Now()
+	err := s.uploader.Upload(uploadCtx, j.path(), j.Pod)
+	if err != nil {
+		if ctx.Err() != nil {
+			return // shutting down; forwarded on the next start
+		}
+		j.attempts++
+		delay := min(retryBackoffMin<<min(j.attempts-1, 10), retryBackoffMax)
+		events.Publish(events.UploadFailed, map[string]any{
+			"path":        j.path(),
+			"pod":         j.Pod,
+			"destination": destination,
+			"error":       err.Error(),
+		})
+		metrics.CollectorForwardRetriesTotal.Inc()
+		logger.Log.WithError(err).Warnf("Forwarding %s/%s failed (attempt %d), retrying in %s", j.Pod, j.Filename, j.attempts, delay)
+		s.enqueue(ctx, j, delay)
+		return
+	}
+
+	events.Publish(events.UploadCompleted, map[string]any{
+		"path":        j.path(),
+		"pod":         j.Pod,
+		"destination": destination,
+		"size":        j.Size,
+		"modified":    j.Received,
+		"duration":    time.Since(start),
+	})
+	if err := s.spool.remove(j); err != nil {
+		logger.Log.WithError(err).Errorf("Failed to remove forwarded spool entry %s", j.dir)
+		return
+	}
+	logger.Log.Infof("Forwarded %s/%s to %s", j.Pod, j.Filename, destination)
+}
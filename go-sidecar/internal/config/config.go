@@ -0,0 +1,208 @@
+// Package config holds the paths, ports and timings shared by every mode. Values come from
+// built-in defaults, then an optional YAML file, then environment variables, then command-line
+// flags, each overriding the one before. Settings that are environment-only are read through the
+// Env helpers, which report invalid values instead of falling back silently.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the profiler's runtime configuration
+type Config struct {
+	// ProfileDir is where the sidecar writes recordings (the pod's shared volume)
+	ProfileDir string `yaml:"profileDir"`
+	// APIPort is the sidecar API's listen port
+	APIPort string `yaml:"apiPort"`
+
+	// ProfileRoot is the daemon's HostPath root, holding one directory per pod
+	ProfileRoot string `yaml:"profileRoot"`
+	// AdminPort serves the daemon's admin API and Prometheus scrape endpoint
+	AdminPort string `yaml:"adminPort"`
+	// ScanInterval is the daemon's fallback periodic scan, for events the watcher missed
+	ScanInterval time.Duration `yaml:"scanInterval"`
+	// SettleDelay is how long the daemon waits after a file event before uploading the file
+	SettleDelay time.Duration `yaml:"settleDelay"`
+
+	// StabilityDelay is how long the GCS uploader waits between two size checks before it
+	// considers a file completely written. Files with a completion marker are not checked.
+	StabilityDelay time.Duration `yaml:"stabilityDelay"`
+
+	// CompletionMarkers makes the sidecar write {file}.done once an artifact is complete and the
+	// daemon upload only files that have one, without SettleDelay or StabilityDelay
+	CompletionMarkers bool `yaml:"completionMarkers"`
+}
+
+// Default returns the built-in configuration
+func Default() *Config {
+	return &Config{
+		ProfileDir:     "/tmp/jfr",
+		APIPort:        "8081",
+		ProfileRoot:    "/tmp/jfr",
+		AdminPort:      "9090",
+		ScanInterval:   30 * time.Second,
+		SettleDelay:    5 * time.Second,
+		StabilityDelay: 2 * time.Second,
+	}
+}
+
+// Load builds the configuration from args (the flags after the mode), the environment and the
+// YAML file named by --config or PROFILER_CONFIG
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("profiler-sidecar", flag.ContinueOnError)
+	path := fs.String("config", os.Getenv("PROFILER_CONFIG"), "YAML configuration file")
+	profileDir := fs.String("profile-dir", "", "directory the sidecar writes recordings to")
+	apiPort := fs.String("api-port", "", "sidecar API listen port")
+	profileRoot := fs.String("profile-root", "", "daemon HostPath root")
+	adminPort := fs.String("admin-port", "", "daemon admin API port")
+	scanInterval := fs.Duration("scan-interval", 0, "daemon fallback scan interval")
+	settleDelay := fs.Duration("settle-delay", 0, "wait after a file event before uploading")
+	stabilityDelay := fs.Duration("stability-delay", 0, "wait between file size checks before uploading")
+	completionMarkers := fs.Bool("completion-markers", false, "mark complete files with {file}.done and upload only marked files")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *path != "" {
+		if err := cfg.loadFile(*path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	// Only flags given on the command line override
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "profile-dir":
+			cfg.ProfileDir = *profileDir
+		case "api-port":
+			cfg.APIPort = *apiPort
+		case "profile-root":
+			cfg.ProfileRoot = *profileRoot
+		case "admin-port":
+			cfg.AdminPort = *adminPort
+		case "scan-interval":
+			cfg.ScanInterval = *scanInterval
+		case "settle-delay":
+			cfg.SettleDelay = *settleDelay
+		case "stability-delay":
+			cfg.StabilityDelay = *stabilityDelay
+		case "completion-markers":
+			cfg.CompletionMarkers = *completionMarkers
+		}
+	})
+
+	// Package-level settings have been read by now; invalid ones stop the process with the rest
+	if err := errors.Join(cfg.Validate(), EnvError()); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile overlays the fields set in a YAML file; unknown keys are rejected so typos surface
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadEnv overlays the environment variables that are set
+func (c *Config) loadEnv() error {
+	text := []struct {
+		key   string
+		field *string
+	}{
+		{"PROFILE_DIR", &c.ProfileDir},
+		{"API_PORT", &c.APIPort},
+		{"PROFILE_ROOT", &c.ProfileRoot},
+		{"ADMIN_PORT", &c.AdminPort},
+	}
+	for _, e := range text {
+		if v := os.Getenv(e.key); v != "" {
+			*e.field = v
+		}
+	}
+
+	durations := []struct {
+		key   string
+		field *time.Duration
+	}{
+		{"SCAN_INTERVAL", &c.ScanInterval},
+		{"SETTLE_DELAY", &c.SettleDelay},
+		{"STABILITY_DELAY", &c.StabilityDelay},
+	}
+	for _, e := range durations {
+		v := os.Getenv(e.key)
+		if v == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", e.key, err)
+		}
+		*e.field = d
+	}
+
+	if v := os.Getenv("COMPLETION_MARKERS"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid COMPLETION_MARKERS: %w", err)
+		}
+		c.CompletionMarkers = enabled
+	}
+	return nil
+}
+
+// Validate reports every invalid field
+func (c *Config) Validate() error {
+	var errs []error
+	if !filepath.IsAbs(c.ProfileDir) {
+		errs = append(errs, fmt.Errorf("profileDir must be an absolute path, got %q", c.ProfileDir))
+	}
+	if !filepath.IsAbs(c.ProfileRoot) {
+		errs = append(errs, fmt.Errorf("profileRoot must be an absolute path, got %q", c.ProfileRoot))
+	}
+	if !validPort(c.APIPort) {
+		errs = append(errs, fmt.Errorf("apiPort must be a port number, got %q", c.APIPort))
+	}
+	if !validPort(c.AdminPort) {
+		errs = append(errs, fmt.Errorf("adminPort must be a port number, got %q", c.AdminPort))
+	}
+	if c.ScanInterval <= 0 {
+		errs = append(errs, fmt.Errorf("scanInterval must be positive, got %s", c.ScanInterval))
+	}
+	if c.SettleDelay < 0 {
+		errs = append(errs, fmt.Errorf("settleDelay must not be negative, got %s", c.SettleDelay))
+	}
+	if c.StabilityDelay < 0 {
+		errs = append(errs, fmt.Errorf("stabilityDelay must not be negative, got %s", c.StabilityDelay))
+	}
+	return errors.Join(errs...)
+}
+
+// validPort reports whether port is a TCP port number
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n >= 1 && n <= 65535
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The Env helpers read the settings that are environment-only. Each returns its default when the
+// variable is unset; a value that is set but invalid also yields the default, and is recorded
+// for EnvError, so every mode can refuse to start on a typo instead of silently ignoring it.
+
+var envErrs = struct {
+	sync.Mutex
+	byKey map[string]error
+}{byKey: map[string]error{}}
+
+// EnvError reports every invalid environment variable read so far, in key order
+func EnvError() error {
+	envErrs.Lock()
+	defer envErrs.Unlock()
+	var errs []error
+	for _, key := range slices.Sorted(maps.Keys(envErrs.byKey)) {
+		errs = append(errs, envErrs.byKey[key])
+	}
+	return errors.Join(errs...)
+}
+
+// invalidEnv records that key holds a value that is not a want
+func invalidEnv(key, value, want string) {
+	envErrs.Lock()
+	defer envErrs.Unlock()
+	envErrs.byKey[key] = fmt.Errorf("invalid %s: %q is not %s", key, value, want)
+}
+
+// lookupEnv returns a variable's trimmed value, or false when it is unset or blank
+func lookupEnv(key string) (string, bool) {
+	v := strings.TrimSpace(os.Getenv(key))
+	return v, v != ""
+}
+
+// Env returns a string variable, or def when it is unset
+func Env(key, def string) string {
+	if v, ok := lookupEnv(key); ok {
+		return v
+	}
+	return def
+}
+
+// CommandEnv returns all of the sidecar's environment a child process inherits: PATH, HOME, LANG,
+// TZ, TMPDIR and JAVA_HOME, plus the variables COMMAND_ENV_PASSTHROUGH lists (comma-separated).
+// Credentials and JAVA_TOOL_OPTIONS-style injection points stay out.
+func CommandEnv() []string {
+	keys := append([]string{"PATH", "HOME", "LANG", "TZ", "TMPDIR", "JAVA_HOME"},
+		strings.FieldsFunc(os.Getenv("COMMAND_ENV_PASSTHROUGH"), func(r rune) bool { return r == ',' })...)
+	env := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if v, ok := os.LookupEnv(key); ok {
+			env = append(env, key+"="+v)
+		}
+	}
+	return env
+}
+
+// EnvBool returns a boolean variable: 1, t, true or yes, or 0, f, false or no, in any case. The
+// single letters t and f match strconv.ParseBool.
+func EnvBool(key string, def bool) bool {
+	v, ok := lookupEnv(key)
+	if !ok {
+		return def
+	}
+	switch strings.ToLower(v) {
+	case "1", "true", "yes", "t":
+		return true
+	case "0", "false", "no", "f":
+		return false
+	}
+	invalidEnv(key, v, "true or false")
+	return def
+}
+
+// EnvInt returns an integer variable
+func EnvInt(key string, def int) int {
+	v, ok := lookupEnv(key)
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		invalidEnv(key, v, "an integer")
+		return def
+	}
+	return n
+}
+
+// EnvDuration returns a duration variable such as "30s"
+func EnvDuration(key string, def time.Duration) time.Duration {
+	v, ok := lookupEnv(key)
+	if !ok {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		invalidEnv(key, v, "a duration such as 30s")
+		return def
+	}
+	return d
+}
+
+// EnvSize returns a byte size variable such as "256Mi"; "0" is a valid size
+func EnvSize(key string, def int64) int64 {
+	v, ok := lookupEnv(key)
+	if !ok {
+		return def
+	}
+	size, err := ParseSize(v)
+	if err != nil {
+		invalidEnv(key, v, "a size such as 256Mi")
+		return def
+	}
+	return size
+}
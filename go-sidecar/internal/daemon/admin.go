@@ -0,0 +1,82 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/events"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/metrics"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/uploader"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/version"
+)
+
+// adminResponse mirrors the sidecar API's JSON envelope
+type adminResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+// serveAdmin starts the daemon admin API (metrics, upload status, requeue) in the background
+func (s *Scanner) serveAdmin(port string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/uploads", uploadsHandler)
+	mux.HandleFunc("/uploads/requeue", s.requeueHandler)
+	mux.HandleFunc("/uploads/history", s.historyHandler)
+	mux.HandleFunc("/events", events.StreamHandler(nil, nil))
+	mux.HandleFunc("/version", versionHandler)
+
+	// No write timeout: /events streams stay open. The header and idle timeouts still bound
+	// abandoned connections.
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+	go func() {
+		logger.Log.WithField("port", port).Info("Admin server listening")
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Log.WithError(err).Error("Admin server stopped")
+		}
+	}()
+}
+
+// versionHandler reports the daemon's build
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	build := version.Get()
+	sendAdminJSON(w, http.StatusOK, adminResponse{
+		Success: true,
+		Message: "profiler-sidecar " + build.Version,
+		Data:    build,
+	})
+}
+
+// uploadsHandler reports the progress of in-flight uploads
+func uploadsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendAdminJSON(w, http.StatusMethodNotAllowed, adminResponse{
+			Success: false,
+			Message: "Method not allowed",
+		})
+		return
+	}
+
+	uploads := uploader.ActiveUploads()
+	sendAdminJSON(w, http.StatusOK, adminResponse{
+		Success: true,
+		Message: fmt.Sprintf("%d uploads in progress", len(uploads)),
+		Data:    uploads,
+	})
+}
+
+// sendAdminJSON sends a JSON response
+func sendAdminJSON(w http.ResponseWriter, status int, data adminResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,79 @@
+package daemon
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/config"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/history"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/inuse"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/quota"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/tenant"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/uploader"
+)
+
+// Clock supplies the current time for upload durations, cache expiry and file ages
+type Clock interface {
+	Now() time.Time
+}
+
+// FS is the subset of filesystem operations the daemon performs on the profile root
+type FS interface {
+	Stat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	Remove(name string) error
+	RemoveAll(path string) error
+	Walk(root string, fn filepath.WalkFunc) error
+}
+
+// Deps are the collaborators a Scanner is built from. Uploader is required; nil Clock and FS
+// get the system clock and the local filesystem.
+type Deps struct {
+	// Config holds the profile root, admin port and scan timings; nil uses config.Default
+	Config *config.Config
+
+	// Options are the upload hooks and pprof conversion; nil reads them with OptionsFromEnv
+	Options *Options
+
+	Uploader uploader.Uploader
+	Clock    Clock
+	FS       FS
+
+	// Tenants scopes uploads of tenant subdirectories; nil disables tenancy
+	Tenants *tenant.Registry
+
+	// Quotas defers uploads of namespaces over their quota; nil disables quotas
+	Quotas *quota.Tracker
+
+	// History records completed uploads for the admin API and periodic reports; nil disables it
+	History *history.Log
+
+	// Pod makes the profile root a single pod's directory, laid out as the sidecar writes it
+	// ({root}/[{tenant}/]{file}), instead of a directory per pod. Used in standalone mode.
+	Pod string
+
+	// Files is shared with an in-process API server; held files are neither uploaded nor deleted
+	Files *inuse.Tracker
+}
+
+// systemClock is the wall clock
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// osFS is the local filesystem
+type osFS struct{}
+
+func (osFS) Stat(name string) (fs.FileInfo, error)      { return os.Stat(name) }
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+func (osFS) ReadFile(name string) ([]byte, error)       { return os.ReadFile(name) }
+func (osFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+func (osFS) Remove(name string) error                     { return os.Remove(name) }
+func (osFS) RemoveAll(path string) error                  { return os.RemoveAll(path) }
+func (osFS) Walk(root string, fn filepath.WalkFunc) error { return filepath.Walk(root, fn) }
@@ -0,0 +1,184 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/config"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/history"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/uploader"
+)
+
+// reportPrefix is where periodic upload history reports are written in the bucket:
+// {reportPrefix}/{NODE_NAME}/upload-history-{FROM}-{TO}.csv
+const reportPrefix = "reports"
+
+// loadHistory loads the upload history persisted under root. UPLOAD_HISTORY_MAX=0 disables it (nil).
+func loadHistory(root string) (*history.Log, error) {
+	max := config.EnvInt("UPLOAD_HISTORY_MAX", 10000)
+	if max <= 0 {
+		return nil, nil
+	}
+	statePath := os.Getenv("UPLOAD_HISTORY_STATE")
+	if statePath == "" {
+		statePath = filepath.Join(root, ".upload-history.json")
+	}
+	return history.New(statePath, max, config.EnvDuration("UPLOAD_HISTORY_RETENTION", 90*24*time.Hour))
+}
+
+// recordHistory adds a completed upload to the history
+func (s *Scanner) recordHistory(ctx context.Context, entry history.Entry) {
+	if s.history == nil {
+		return
+	}
+	entry.Namespace = s.pods.Namespace(ctx, entry.Pod)
+	entry.Duration = entry.CompletedAt.Sub(entry.StartedAt).Seconds()
+	if err := s.history.Add(entry); err != nil {
+		logger.Log.WithError(err).Warn("Failed to persist upload history")
+	}
+}
+
+// historyHandler exports the upload history as JSON, or as CSV with ?format=csv (or
+// Accept: text/csv), filtered by ?since= and ?until= (RFC 3339) and ?pod=
+func (s *Scanner) historyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendAdminJSON(w, http.StatusMethodNotAllowed, adminResponse{
+			Success: false,
+			Message: "Method not allowed",
+		})
+		return
+	}
+	if s.history == nil {
+		sendAdminJSON(w, http.StatusNotFound, adminResponse{
+			Success: false,
+			Message: "Upload history is disabled (UPLOAD_HISTORY_MAX=0)",
+		})
+		return
+	}
+
+	filter := history.Filter{Pod: r.URL.Query().Get("pod")}
+	for param, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		v := r.URL.Query().Get(param)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			sendAdminJSON(w, http.StatusBadRequest, adminResponse{
+				Success: false,
+				Message: fmt.Sprintf("%s must be an RFC 3339 time, got %q", param, v),
+			})
+			return
+		}
+		*t = parsed
+	}
+	entries := s.history.Entries(filter)
+
+	if r.URL.Query().Get("format") == "csv" || strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="upload-history.csv"`)
+		if err := history.WriteCSV(w, entries); err != nil {
+			logger.Log.WithError(err).Warn("Failed to write upload history CSV")
+		}
+		return
+	}
+
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+	sendAdminJSON(w, http.StatusOK, adminResponse{
+		Success: true,
+		Message: fmt.Sprintf("%d uploads, %d bytes", len(entries), total),
+		Data:    entries,
+	})
+}
+
+// runHistoryReports writes the uploads completed since the previous report to the bucket every
+// UPLOAD_HISTORY_REPORT_INTERVAL, as CSV plus a JSON summary
+func (s *Scanner) runHistoryReports(ctx context.Context, interval time.Duration) {
+	if s.history == nil || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.writeHistoryReport(ctx); err != nil {
+				logger.Log.WithError(err).Warn("Failed to write upload history report")
+			}
+		}
+	}
+}
+
+// historySummary totals a report's uploads
+type historySummary struct {
+	Node    string           `json:"node"`
+	From    time.Time        `json:"from"`
+	To      time.Time        `json:"to"`
+	Uploads int              `json:"uploads"`
+	Bytes   int64            `json:"bytes"`
+	ByPod   map[string]int64 `json:"bytesByPod"`
+}
+
+// writeHistoryReport uploads the report for the period since the last one
+func (s *Scanner) writeHistoryReport(ctx context.Context) error {
+	to := s.clock.Now().UTC()
+	from := s.history.LastReport()
+	entries := s.history.Entries(history.Filter{Since: from, Until: to})
+	if len(entries) == 0 {
+		return s.history.SetLastReport(to)
+	}
+
+	node := os.Getenv("NODE_NAME")
+	if node == "" {
+		node, _ = os.Hostname()
+	}
+	if s.pod != "" {
+		node = s.pod
+	}
+
+	summary := historySummary{Node: node, From: from, To: to, Uploads: len(entries), ByPod: map[string]int64{}}
+	for _, e := range entries {
+		summary.Bytes += e.Size
+		summary.ByPod[e.Pod] += e.Size
+	}
+	if from.IsZero() {
+		summary.From = entries[0].CompletedAt
+	}
+
+	var csv bytes.Buffer
+	if err := history.WriteCSV(&csv, entries); err != nil {
+		return err
+	}
+	summaryJSON, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// The report lives outside any pod's prefix; UploadStream joins the "pod" into the object path
+	dir := path.Join(reportPrefix, node)
+	base := fmt.Sprintf("upload-history-%s-%s", summary.From.Format("20060102T150405Z"), to.Format("20060102T150405Z"))
+	if _, err := s.uploader.UploadStream(ctx, &csv, dir, base+".csv"); err != nil {
+		return err
+	}
+	if _, err := s.uploader.UploadStream(ctx, bytes.NewReader(summaryJSON), dir, base+".json"); err != nil {
+		return err
+	}
+
+	logger.Log.WithField("uploads", len(entries)).WithField("bytes", summary.Bytes).
+		Infof("Wrote upload history report to %s/%s", uploader.DestinationFor(ctx, s.uploader), dir)
+	return s.history.SetLastReport(to)
+}
@@ -0,0 +1,53 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/hooks"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/uploader"
+)
+
+// uploadHookVars describes an upload to hook commands and webhooks
+func uploadHookVars(phase, filePath, podName, destinationURI string) map[string]string {
+	return map[string]string{
+		"UPLOAD_PHASE":       phase,
+		"UPLOAD_FILE":        filePath,
+		"UPLOAD_POD":         podName,
+		"UPLOAD_DESTINATION": destinationURI,
+		"NODE_NAME":          os.Getenv("NODE_NAME"),
+	}
+}
+
+// runPreUploadHook runs the pre-upload hook; a failure vetoes the upload
+func (s *Scanner) runPreUploadHook(ctx context.Context, filePath, podName, destinationURI string) error {
+	if err := hooks.Run(ctx, s.opts.PreUploadHook, uploadHookVars("pre", filePath, podName, destinationURI)); err != nil {
+		return fmt.Errorf("pre-upload hook rejected file: %w", err)
+	}
+	return nil
+}
+
+// runPostUploadHook runs the post-upload hook with the upload result, logging failures
+func (s *Scanner) runPostUploadHook(ctx context.Context, filePath, podName, destinationURI string, uploadErr error) {
+	if s.opts.PostUploadHook == "" {
+		return
+	}
+
+	vars := uploadHookVars("post", filePath, podName, destinationURI)
+	vars["UPLOAD_RESULT"] = "success"
+	if uploadErr != nil {
+		vars["UPLOAD_RESULT"] = "failure"
+		vars["UPLOAD_ERROR"] = uploadErr.Error()
+	}
+
+	if err := hooks.Run(ctx, s.opts.PostUploadHook, vars); err != nil {
+		logger.Log.WithError(err).WithField("path", filePath).Warn("Post-upload hook failed")
+	}
+}
+
+// objectURI returns the full destination URI of an uploaded file
+func objectURI(ctx context.Context, destination, podName, filePath string) string {
+	return fmt.Sprintf("%s/%s", destination, uploader.ObjectPath(ctx, filePath, podName))
+}
@@ -0,0 +1,204 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/config"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/filetype"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/marker"
+)
+
+const (
+	defaultJanitorInterval = 10 * time.Minute
+	defaultPodDirMaxAge    = 24 * time.Hour
+	defaultPodDirGrace     = time.Hour
+	defaultPartialMaxAge   = time.Hour
+
+	// podDirMinAge protects directories of pods created since the pod list was last fetched
+	podDirMinAge = 10 * time.Minute
+)
+
+// partialSuffixes mark files that are still being written, or were abandoned mid-write
+var partialSuffixes = []string{".part", ".tmp"}
+
+// janitor removes directories left behind by pods that no longer run on this node, and
+// empty or partial files that would otherwise be rescanned forever
+type janitor struct {
+	fs        FS
+	clock     Clock
+	pods      *podDirectory
+	root      string
+	sweepPods bool // false when the root is a single pod's directory, which is never stale
+
+	interval      time.Duration
+	maxAge        time.Duration // used when the Kubernetes API is unavailable
+	grace         time.Duration // how long a stale directory may keep unuploaded files
+	partialMaxAge time.Duration
+	stale         map[string]time.Time
+}
+
+func newJanitor(fsys FS, clock Clock, pods *podDirectory, root string, sweepPods bool) *janitor {
+	return &janitor{
+		fs:        fsys,
+		clock:     clock,
+		pods:      pods,
+		root:      root,
+		sweepPods: sweepPods,
+
+		interval: config.EnvDuration("POD_DIR_CLEANUP_INTERVAL", defaultJanitorInterval),
+		maxAge:   config.EnvDuration("POD_DIR_MAX_AGE", defaultPodDirMaxAge),
+		grace:    config.EnvDuration("POD_DIR_GRACE_PERIOD", defaultPodDirGrace),
+
+		partialMaxAge: config.EnvDuration("PARTIAL_FILE_MAX_AGE", defaultPartialMaxAge),
+		stale:         map[string]time.Time{},
+	}
+}
+
+// run sweeps the profile root periodically until ctx is cancelled
+func (j *janitor) run(ctx context.Context) {
+	if j.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			j.collectGarbage()
+			if j.sweepPods {
+				j.sweep(ctx)
+			}
+		}
+	}
+}
+
+// sweep removes stale pod directories that are empty, or whose grace period has passed
+func (j *janitor) sweep(ctx context.Context) {
+	entries, err := j.fs.ReadDir(j.root)
+	if err != nil {
+		logger.Log.WithError(err).Warn("Janitor failed to read profile root")
+		return
+	}
+
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		name := entry.Name()
+		dir := filepath.Join(j.root, name)
+		seen[name] = true
+
+		if !j.isStale(ctx, name, dir) {
+			delete(j.stale, name)
+			continue
+		}
+		if _, ok := j.stale[name]; !ok {
+			j.stale[name] = j.clock.Now()
+		}
+
+		pending := j.pendingFiles(dir)
+		if pending > 0 && j.since(j.stale[name]) < j.grace {
+			continue
+		}
+
+		if err := j.fs.RemoveAll(dir); err != nil {
+			logger.Log.WithError(err).WithField("dir", dir).Warn("Failed to remove stale pod directory")
+			continue
+		}
+		delete(j.stale, name)
+		logger.Log.WithField("dir", dir).WithField("discarded_files", pending).Info("Removed stale pod directory")
+	}
+
+	for name := range j.stale {
+		if !seen[name] {
+			delete(j.stale, name)
+		}
+	}
+}
+
+// collectGarbage removes zero-byte artifacts, stale partial/temporary files and completion
+// markers whose file is gone, once older than partialMaxAge. Named pipes (streaming uploads) are
+// never touched.
+func (j *janitor) collectGarbage() {
+	if j.partialMaxAge <= 0 {
+		return
+	}
+	j.fs.Walk(j.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() || j.since(info.ModTime()) < j.partialMaxAge {
+			return nil
+		}
+
+		reason := ""
+		switch {
+		case isPartial(info.Name()):
+			reason = "partial"
+		case marker.IsMarker(info.Name()):
+			if _, err := j.fs.Stat(marker.FileOf(path)); !errors.Is(err, fs.ErrNotExist) {
+				return nil // kept until its file is uploaded
+			}
+			reason = "orphaned marker"
+		case info.Size() == 0 && filetype.Lookup(info.Name()).Prefix != "":
+			reason = "empty"
+		default:
+			return nil
+		}
+
+		if err := j.fs.Remove(path); err != nil {
+			logger.Log.WithError(err).WithField("path", path).Warn("Failed to remove leftover file")
+			return nil
+		}
+		logger.Log.WithField("path", path).WithField("reason", reason).Info("Removed leftover file")
+		return nil
+	})
+}
+
+// isPartial reports whether a filename marks an incomplete write
+func isPartial(name string) bool {
+	for _, suffix := range partialSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isStale reports whether a pod directory no longer belongs to a pod on this node. Without the
+// Kubernetes API, directories untouched for maxAge are considered stale.
+func (j *janitor) isStale(ctx context.Context, podName, dir string) bool {
+	info, err := j.fs.Stat(dir)
+	if err != nil || j.since(info.ModTime()) < podDirMinAge {
+		return false
+	}
+
+	if exists, known := j.pods.Exists(ctx, podName); known {
+		return !exists
+	}
+	return j.since(info.ModTime()) > j.maxAge
+}
+
+// since returns the time elapsed since t on the janitor's clock
+func (j *janitor) since(t time.Time) time.Duration {
+	return j.clock.Now().Sub(t)
+}
+
+// pendingFiles counts the non-hidden files left in a directory tree
+func (j *janitor) pendingFiles(dir string) int {
+	count := 0
+	j.fs.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && !strings.HasPrefix(info.Name(), ".") {
+			count++
+		}
+		return nil
+	})
+	return count
+}
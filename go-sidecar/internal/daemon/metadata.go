@@ -0,0 +1,62 @@
+package daemon
+
+import (
+	"context"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/recmeta"
+)
+
+// companionGrace is how long after a recording's duration its metadata file waits for the
+// recording to appear before it is uploaded on its own
+const companionGrace = 5 * time.Minute
+
+// companionOf returns the metadata file next to a recording and its parsed contents, or "" when
+// the recording has none
+func (s *Scanner) companionOf(recordingPath string) (string, *recmeta.Metadata) {
+	if recmeta.IsCompanion(recordingPath) {
+		return "", nil
+	}
+	path := recmeta.CompanionPath(recordingPath)
+	data, err := s.fs.ReadFile(path)
+	if err != nil {
+		return "", nil
+	}
+	meta, err := recmeta.Parse(data)
+	if err != nil {
+		// Still shipped next to the recording, just without object metadata
+		logger.Log.WithError(err).Warnf("Ignoring unreadable metadata file %s", path)
+		return path, nil
+	}
+	return path, meta
+}
+
+// orphanedCompanion reports whether a metadata file should be uploaded on its own: its recording
+// does not exist and is no longer expected, e.g. it was uploaded while the metadata upload failed
+func (s *Scanner) orphanedCompanion(path string) bool {
+	data, err := s.fs.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	meta, err := recmeta.Parse(data)
+	if err != nil {
+		return true
+	}
+	if _, err := s.fs.Stat(meta.RecordingPath(path)); err == nil {
+		return false
+	}
+	return s.clock.Now().After(meta.ExpectedEnd().Add(companionGrace))
+}
+
+// uploadCompanion uploads a recording's metadata file after the recording and deletes it. A
+// failed upload leaves the file, which is retried on its own once orphaned.
+func (s *Scanner) uploadCompanion(ctx context.Context, path, podName string) {
+	if err := s.uploader.Upload(ctx, path, podName); err != nil {
+		logger.Log.WithError(err).Warnf("Failed to upload metadata file %s", path)
+		return
+	}
+	if err := s.fs.Remove(path); err != nil {
+		logger.Log.WithError(err).Warnf("Failed to delete metadata file %s", path)
+	}
+}
@@ -0,0 +1,93 @@
+package daemon
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/kube"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+)
+
+const (
+	podCacheTTL      = time.Minute
+	unknownNamespace = "unknown"
+)
+
+// podDirectory resolves pod directory names to pods scheduled on this node
+type podDirectory struct {
+	clock   Clock
+	once    sync.Once
+	mu      sync.Mutex
+	client  *kube.Client
+	pods    map[string]kube.Pod
+	fetched time.Time
+}
+
+// init connects to the Kubernetes API on first use
+func (d *podDirectory) init() {
+	d.once.Do(func() {
+		client, err := kube.InCluster()
+		if err != nil {
+			logger.Log.WithError(err).Info("Kubernetes API unavailable; pods cannot be resolved")
+			return
+		}
+		d.client = client
+	})
+}
+
+// Namespace returns the namespace of a pod on this node, or "unknown"
+func (d *podDirectory) Namespace(ctx context.Context, podName string) string {
+	if pod, ok := d.Lookup(ctx, podName); ok && pod.Metadata.Namespace != "" {
+		return pod.Metadata.Namespace
+	}
+	return unknownNamespace
+}
+
+// Lookup returns a pod on this node by name, refreshing the cached pod list when stale.
+// The second result is false when the pod is not known (or the API is unavailable).
+func (d *podDirectory) Lookup(ctx context.Context, podName string) (kube.Pod, bool) {
+	d.init()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.client == nil {
+		return kube.Pod{}, false
+	}
+	if d.clock.Now().Sub(d.fetched) > podCacheTTL {
+		if err := d.refreshLocked(ctx); err != nil {
+			logger.Log.WithError(err).Warn("Failed to list pods on node")
+		}
+	}
+	pod, ok := d.pods[podName]
+	return pod, ok
+}
+
+// Exists reports whether a pod runs on this node. known is false when the answer cannot be
+// trusted: no Kubernetes API, or the pod list has never been fetched successfully.
+func (d *podDirectory) Exists(ctx context.Context, podName string) (exists, known bool) {
+	_, exists = d.Lookup(ctx, podName)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return exists, d.client != nil && !d.fetched.IsZero()
+}
+
+func (d *podDirectory) refreshLocked(ctx context.Context) error {
+	selector := ""
+	if node := os.Getenv("NODE_NAME"); node != "" {
+		selector = "spec.nodeName=" + node
+	}
+	list, err := d.client.ListPods(ctx, "", selector)
+	if err != nil {
+		return err
+	}
+
+	d.pods = make(map[string]kube.Pod, len(list))
+	for _, pod := range list {
+		d.pods[pod.Metadata.Name] = pod
+	}
+	d.fetched = d.clock.Now()
+	return nil
+}
@@ -0,0 +1,29 @@
+package daemon
+
+import (
+	"os"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/config"
+)
+
+// Options holds the scanner's environment-only upload settings. They are read once, by
+// OptionsFromEnv, and each scanner keeps its own copy, so tests can set them through Deps.
+type Options struct {
+	// Hooks run before each upload, where a failure vetoes it, and after it with the result
+	PreUploadHook  string
+	PostUploadHook string
+
+	// UploadPprof converts each .jfr or .jfr.gz recording's execution samples to pprof before
+	// it is uploaded, and uploads the profile next to it as {name}.pb.gz
+	UploadPprof bool
+}
+
+// OptionsFromEnv loads the scanner options from environment variables. Invalid values are
+// reported by config.EnvError.
+func OptionsFromEnv() Options {
+	return Options{
+		PreUploadHook:  os.Getenv("UPLOAD_PRE_HOOK"),
+		PostUploadHook: os.Getenv("UPLOAD_POST_HOOK"),
+		UploadPprof:    config.EnvBool("UPLOAD_PPROF", false),
+	}
+}
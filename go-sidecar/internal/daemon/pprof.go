@@ -0,0 +1,60 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/filetype"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/jfrconv"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+)
+
+// convertPprof writes the pprof profile of a recording into a temporary directory outside the
+// profile root. It returns the profile's path, or "" when there is none, and a cleanup function.
+// A failed conversion is logged and never holds up the recording's upload.
+func (s *Scanner) convertPprof(filePath string) (string, func()) {
+	t := filetype.Detect(filePath)
+	if !s.opts.UploadPprof || t.Name != "jfr" {
+		return "", func() {}
+	}
+
+	dir, err := os.MkdirTemp("", "pprof-")
+	if err != nil {
+		logger.Log.WithError(err).Warnf("Failed to convert %s to pprof", filePath)
+		return "", func() {}
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	profilePath := filepath.Join(dir, strings.TrimSuffix(strings.TrimSuffix(filepath.Base(filePath), ".gz"), ".jfr")+".pb.gz")
+	f, err := os.Create(profilePath)
+	if err != nil {
+		logger.Log.WithError(err).Warnf("Failed to convert %s to pprof", filePath)
+		return "", cleanup
+	}
+	summary, err := jfrconv.ConvertFile(filePath, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	switch {
+	case errors.Is(err, jfrconv.ErrNoSamples):
+		logger.Log.Debugf("No execution samples to convert to pprof in %s", filePath)
+		return "", cleanup
+	case err != nil:
+		logger.Log.WithError(err).Warnf("Failed to convert %s to pprof", filePath)
+		return "", cleanup
+	}
+	logger.Log.Debugf("Converted %s to pprof (%d samples)", filePath, summary.Samples)
+	return profilePath, cleanup
+}
+
+// uploadProfile uploads a converted pprof profile; failures are logged, the recording stays uploaded
+func (s *Scanner) uploadProfile(ctx context.Context, path, podName string) {
+	if err := s.uploader.Upload(ctx, path, podName); err != nil {
+		logger.Log.WithError(err).Warnf("Failed to upload pprof profile %s", path)
+		return
+	}
+	logger.Log.WithContext(ctx).Infof("Uploaded pprof profile: %s", filepath.Base(path))
+}
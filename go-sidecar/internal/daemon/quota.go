@@ -0,0 +1,186 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/config"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/events"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/metrics"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/quota"
+)
+
+const (
+	defaultQuotaPeriod = 24 * time.Hour
+
+	// quotaMarker is written into an over-quota pod's directory; the sidecar sees it as
+	// /tmp/jfr/.quota-exceeded and rejects new recordings
+	quotaMarker = ".quota-exceeded"
+)
+
+// loadQuotas loads quota configuration and persisted counters. The tracker is nil unless
+// NAMESPACE_QUOTAS or NAMESPACE_QUOTA_DEFAULT is set.
+func loadQuotas(root string) (*quota.Tracker, error) {
+	limitsSpec, defaultSpec := os.Getenv("NAMESPACE_QUOTAS"), os.Getenv("NAMESPACE_QUOTA_DEFAULT")
+	if limitsSpec == "" && defaultSpec == "" {
+		return nil, nil
+	}
+
+	limits, err := quota.ParseLimits(limitsSpec)
+	if err != nil {
+		return nil, err
+	}
+	var fallback int64
+	if defaultSpec != "" {
+		if fallback, err = config.ParseSize(defaultSpec); err != nil {
+			return nil, err
+		}
+	}
+	period := config.EnvDuration("NAMESPACE_QUOTA_PERIOD", defaultQuotaPeriod)
+	statePath := os.Getenv("NAMESPACE_QUOTA_STATE")
+	if statePath == "" {
+		statePath = filepath.Join(root, ".quota-state.json")
+	}
+
+	quotas, err := quota.New(statePath, period, limits, fallback)
+	if err != nil {
+		return nil, err
+	}
+	for ns, limit := range limits {
+		metrics.NamespaceQuotaBytes.WithLabelValues(ns).Set(float64(limit))
+	}
+	logger.Log.WithField("period", period.String()).WithField("namespaces", len(limits)).Info("Namespace upload quotas enabled")
+	return quotas, nil
+}
+
+// quotaMarkerContent explains to humans (and the sidecar) why recordings are refused
+type quotaMarkerContent struct {
+	Namespace string    `json:"namespace"`
+	UsedBytes int64     `json:"usedBytes"`
+	Limit     int64     `json:"limitBytes"`
+	ResetsAt  time.Time `json:"resetsAt"`
+}
+
+// checkQuota reports whether a file may be uploaded now. Over-quota files stay on disk and are
+// retried once the quota period rolls over; files larger than the whole quota are never
+// uploaded. Either is reported once per file and period, not on every rescan.
+func (s *Scanner) checkQuota(ctx context.Context, filePath, podName string, size int64) bool {
+	if s.quotas == nil {
+		return true
+	}
+	ns := s.pods.Namespace(ctx, podName)
+	if s.quotas.Allow(ns, size) {
+		if !s.quotas.Exceeded(ns) {
+			s.fs.Remove(s.quotaMarkerFile(podName))
+		}
+		s.deferredMu.Lock()
+		delete(s.deferred, filePath)
+		s.deferredMu.Unlock()
+		return true
+	}
+
+	limit := s.quotas.Limit(ns)
+	if size > limit {
+		if s.noteDeferred(filePath, time.Time{}) {
+			metrics.UploadsDeferredTotal.WithLabelValues(ns, "oversize").Inc()
+			events.Publish(events.UploadDeferred, map[string]any{
+				"path":      filePath,
+				"pod":       podName,
+				"namespace": ns,
+				"reason":    "oversize",
+				"size":      size,
+				"limit":     limit,
+			})
+			logger.Log.WithFields(map[string]interface{}{
+				"path":      filePath,
+				"namespace": ns,
+				"size":      size,
+				"limit":     limit,
+			}).Error("File is larger than its namespace's whole upload quota and will not be uploaded")
+		}
+		return false
+	}
+
+	if !s.noteDeferred(filePath, s.quotas.PeriodEnd()) {
+		logger.Log.WithField("path", filePath).Debug("Upload still deferred by namespace quota")
+		return false
+	}
+	metrics.UploadsDeferredTotal.WithLabelValues(ns, "quota").Inc()
+	events.Publish(events.UploadDeferred, map[string]any{
+		"path":      filePath,
+		"pod":       podName,
+		"namespace": ns,
+		"reason":    "quota",
+		"used":      s.quotas.Used(ns),
+		"limit":     limit,
+	})
+	logger.Log.WithFields(map[string]interface{}{
+		"path":      filePath,
+		"namespace": ns,
+		"used":      s.quotas.Used(ns),
+		"limit":     limit,
+		"resets_at": s.quotas.PeriodEnd().Format(time.RFC3339),
+	}).Warn("Namespace over upload quota, deferring upload")
+	s.writeQuotaMarker(podName, ns)
+	return false
+}
+
+// noteDeferred remembers that a file is held back until periodEnd (zero: for good) and reports
+// whether that is news. Entries of past periods and of files gone from disk are dropped.
+func (s *Scanner) noteDeferred(filePath string, periodEnd time.Time) bool {
+	s.deferredMu.Lock()
+	defer s.deferredMu.Unlock()
+	if until, ok := s.deferred[filePath]; ok && until.Equal(periodEnd) {
+		return false
+	}
+	now := s.clock.Now()
+	for path, until := range s.deferred {
+		if !until.IsZero() && !until.After(now) {
+			delete(s.deferred, path)
+		} else if _, err := s.fs.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			delete(s.deferred, path)
+		}
+	}
+	s.deferred[filePath] = periodEnd
+	return true
+}
+
+// recordQuotaUsage accounts an uploaded file against its namespace
+func (s *Scanner) recordQuotaUsage(ctx context.Context, podName string, size int64) {
+	if s.quotas == nil {
+		return
+	}
+	ns := s.pods.Namespace(ctx, podName)
+	if err := s.quotas.Record(ns, size); err != nil {
+		logger.Log.WithError(err).Warn("Failed to persist quota counters")
+	}
+	metrics.NamespaceUploadedBytes.WithLabelValues(ns).Set(float64(s.quotas.Used(ns)))
+	if s.quotas.Exceeded(ns) {
+		s.writeQuotaMarker(podName, ns)
+	}
+}
+
+// quotaMarkerFile returns the over-quota marker path in a pod's directory
+func (s *Scanner) quotaMarkerFile(podName string) string {
+	return filepath.Join(s.podDir(podName), quotaMarker)
+}
+
+// writeQuotaMarker tells the pod's sidecar to refuse new recordings
+func (s *Scanner) writeQuotaMarker(podName, ns string) {
+	marker := s.quotaMarkerFile(podName)
+	data, _ := json.Marshal(quotaMarkerContent{
+		Namespace: ns,
+		UsedBytes: s.quotas.Used(ns),
+		Limit:     s.quotas.Limit(ns),
+		ResetsAt:  s.quotas.PeriodEnd(),
+	})
+	if err := s.fs.WriteFile(marker, data, 0o644); err != nil {
+		logger.Log.WithError(err).WithField("path", marker).Warn("Failed to write quota marker")
+	}
+}
@@ -0,0 +1,73 @@
+package daemon
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/uploader"
+)
+
+const defaultReplicationInterval = time.Hour
+
+// runReconciler periodically confirms that every destination of a fan-out uploader holds the
+// objects of the pods on this node, re-shipping missing copies. Each daemon only reconciles
+// its own node's pods so the work is not repeated cluster-wide.
+func (s *Scanner) runReconciler(ctx context.Context, interval time.Duration) {
+	multi, ok := s.uploader.(*uploader.MultiUploader)
+	if !ok || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.reconcileReplicas(ctx, multi)
+		}
+	}
+}
+
+// reconcileReplicas runs one reconciliation pass over the pod directories under the root
+func (s *Scanner) reconcileReplicas(ctx context.Context, multi *uploader.MultiUploader) {
+	pods, err := s.localPods()
+	if err != nil {
+		logger.Log.WithError(err).Warn("Replication check could not list pod directories")
+		return
+	}
+
+	report, err := multi.Reconcile(ctx, pods)
+	if err != nil {
+		logger.Log.WithError(err).Warn("Replication check failed")
+		return
+	}
+	logger.Log.WithFields(map[string]interface{}{
+		"pods":     len(pods),
+		"checked":  report.Checked,
+		"missing":  report.Missing,
+		"repaired": report.Repaired,
+		"failed":   report.Failed,
+	}).Info("Replication check completed")
+}
+
+// localPods returns the pods with a directory under the root
+func (s *Scanner) localPods() ([]string, error) {
+	if s.pod != "" {
+		return []string{s.pod}, nil
+	}
+	entries, err := s.fs.ReadDir(s.cfg.ProfileRoot)
+	if err != nil {
+		return nil, err
+	}
+	var pods []string
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+			pods = append(pods, e.Name())
+		}
+	}
+	return pods, nil
+}
@@ -0,0 +1,139 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/filetype"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/validation"
+)
+
+// RequeueRequest selects local files to upload immediately
+type RequeueRequest struct {
+	Path string `json:"path,omitempty"` // a single file under the profile root
+	Pod  string `json:"pod,omitempty"`  // every artifact in a pod's directory
+}
+
+// Validate checks that exactly one of path and pod is set
+func (req *RequeueRequest) Validate() validation.Errors {
+	switch {
+	case req.Path != "" && req.Pod != "":
+		return validation.Errors{{Field: "pod", Message: "cannot be combined with path"}}
+	case req.Path == "" && req.Pod == "":
+		return validation.Errors{{Field: "path", Message: "path or pod is required"}}
+	}
+	return nil
+}
+
+// claimFile marks a file as being processed; it returns false if another scan already owns it
+func (s *Scanner) claimFile(path string) bool {
+	s.inFlightMu.Lock()
+	defer s.inFlightMu.Unlock()
+	if s.inFlight[path] {
+		return false
+	}
+	s.inFlight[path] = true
+	return true
+}
+
+// releaseFile clears the in-flight mark set by claimFile
+func (s *Scanner) releaseFile(path string) {
+	s.inFlightMu.Lock()
+	defer s.inFlightMu.Unlock()
+	delete(s.inFlight, path)
+}
+
+// requeueHandler uploads the selected files now instead of waiting for the next scan,
+// e.g. after fixing the IAM problem behind a backlog of failures
+func (s *Scanner) requeueHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendAdminJSON(w, http.StatusMethodNotAllowed, adminResponse{
+			Success: false,
+			Message: "Method not allowed",
+		})
+		return
+	}
+
+	var req RequeueRequest
+	if errs := validation.Decode(r, &req); len(errs) > 0 {
+		sendAdminJSON(w, http.StatusBadRequest, adminResponse{
+			Success: false,
+			Message: fmt.Sprintf("Invalid request body: %v", errs),
+			Data:    map[string]any{"errors": errs},
+		})
+		return
+	}
+
+	files, err := s.requeueTargets(req)
+	if err != nil {
+		sendAdminJSON(w, http.StatusBadRequest, adminResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	go func() {
+		ctx := context.Background()
+		for _, path := range files {
+			if err := s.processFile(ctx, path); err != nil {
+				logger.Log.Infof("Requeued upload of %s failed: %v", path, err)
+			}
+		}
+	}()
+
+	sendAdminJSON(w, http.StatusAccepted, adminResponse{
+		Success: true,
+		Message: fmt.Sprintf("Queued %d files for upload", len(files)),
+		Data:    files,
+	})
+}
+
+// requeueTargets resolves a request to artifact paths, refusing anything outside the profile root
+func (s *Scanner) requeueTargets(req RequeueRequest) ([]string, error) {
+	switch {
+	case req.Path != "":
+		path := filepath.Clean(req.Path)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(s.cfg.ProfileRoot, path)
+		}
+		if rel, err := filepath.Rel(s.cfg.ProfileRoot, path); err != nil || strings.HasPrefix(rel, "..") {
+			return nil, fmt.Errorf("path must be under %s", s.cfg.ProfileRoot)
+		}
+		if info, err := s.fs.Stat(path); err != nil || info.IsDir() {
+			return nil, fmt.Errorf("no such file: %s", path)
+		}
+		return []string{path}, nil
+
+	case req.Pod != "":
+		if strings.ContainsAny(req.Pod, `/\`) || req.Pod == "." || req.Pod == ".." {
+			return nil, fmt.Errorf("invalid pod name %q", req.Pod)
+		}
+		if s.pod != "" && req.Pod != s.pod {
+			return nil, fmt.Errorf("unknown pod %q; this scanner only serves %s", req.Pod, s.pod)
+		}
+		dir := s.podDir(req.Pod)
+		files := []string{}
+		err := s.fs.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && filetype.IsArtifact(path) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pod directory: %w", err)
+		}
+		return files, nil
+
+	default:
+		return nil, fmt.Errorf("path or pod is required")
+	}
+}
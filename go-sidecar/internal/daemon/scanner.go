@@ -2,40 +2,165 @@ package daemon
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/config"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/events"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/fakejvm"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/filetype"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/history"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/inuse"
 	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/marker"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/metrics"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/quota"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/recmeta"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/requestid"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/tenant"
 	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/uploader"
 )
 
-const (
-	rootProfileDir = "/tmp/jfr"       // Root HostPath directory
-	scanInterval   = 30 * time.Second // Fallback periodic scan
-)
+// Scanner watches the profile root and uploads finished artifacts. Its collaborators are injected
+// through Deps; all state lives on the Scanner rather than in package variables.
+type Scanner struct {
+	cfg      *config.Config
+	uploader uploader.Uploader
+	clock    Clock
+	fs       FS
+	tenants  *tenant.Registry
+	quotas   *quota.Tracker
+	history  *history.Log
+	pods     *podDirectory
+	pod      string // set when the root is a single pod's directory
+	files    *inuse.Tracker
+	opts     Options
+
+	inFlightMu sync.Mutex
+	inFlight   map[string]bool
+
+	deferredMu sync.Mutex
+	deferred   map[string]time.Time // files held back by quotas: period end, or zero if too large
+
+	unmarkedWarned atomic.Bool
+}
 
-// Start begins the daemon scanner
-func Start() {
-	bucketName := os.Getenv("GCS_BUCKET")
-	if bucketName == "" {
-		logger.Log.Fatal("GCS_BUCKET environment variable is required")
+// NewScanner builds a Scanner from deps, filling in production defaults for nil fields
+func NewScanner(deps Deps) *Scanner {
+	opts := OptionsFromEnv()
+	if deps.Options != nil {
+		opts = *deps.Options
+	}
+	s := &Scanner{
+		opts:     opts,
+		cfg:      deps.Config,
+		uploader: deps.Uploader,
+		clock:    deps.Clock,
+		fs:       deps.FS,
+		tenants:  deps.Tenants,
+		quotas:   deps.Quotas,
+		history:  deps.History,
+		pod:      deps.Pod,
+		files:    deps.Files,
+		inFlight: map[string]bool{},
+		deferred: map[string]time.Time{},
+	}
+	if s.cfg == nil {
+		s.cfg = config.Default()
 	}
+	if s.clock == nil {
+		s.clock = systemClock{}
+	}
+	if s.fs == nil {
+		s.fs = osFS{}
+	}
+	s.pods = &podDirectory{clock: s.clock}
+	return s
+}
 
-	ctx := context.Background()
+// Start builds the production scanner from cfg and the environment and runs it
+func Start(cfg *config.Config) {
+	StartWith(context.Background(), Deps{Config: cfg})
+}
 
-	// Initialize GCS uploader
-	gcsUploader, err := uploader.NewGCSUploader(ctx, bucketName)
-	if err != nil {
-		logger.Log.Fatalf("Failed to initialize GCS uploader: %v", err)
+// StartWith runs a scanner until ctx is cancelled, creating the uploader, quotas and tenants
+// from the environment where deps leaves them nil
+func StartWith(ctx context.Context, deps Deps) {
+	if deps.Config == nil {
+		deps.Config = config.Default()
+	}
+	if deps.Uploader == nil {
+		u, err := uploader.NewFromConfig(ctx, deps.Config, fakejvm.Enabled())
+		if err != nil {
+			logger.Log.Fatalf("Failed to initialize uploader: %v", err)
+		}
+		defer u.Close()
+		deps.Uploader = u
+	}
+
+	logger.Log.Infof("Daemon scanner started. Watching %s for profiling artifacts", deps.Config.ProfileRoot)
+	logger.Log.Infof("Upload destination: %s", deps.Uploader.Destination())
+
+	var err error
+	if deps.Quotas == nil {
+		if deps.Quotas, err = loadQuotas(deps.Config.ProfileRoot); err != nil {
+			logger.Log.Fatalf("Invalid namespace quota configuration: %v", err)
+		}
+	}
+	if deps.History == nil {
+		if deps.History, err = loadHistory(deps.Config.ProfileRoot); err != nil {
+			logger.Log.Fatalf("Invalid upload history: %v", err)
+		}
+	}
+	if deps.Tenants == nil {
+		if deps.Tenants, err = tenant.LoadFromEnv(); err != nil {
+			logger.Log.Fatalf("Invalid tenant configuration: %v", err)
+		}
+		if deps.Tenants != nil {
+			logger.Log.WithField("tenants", deps.Tenants.Len()).Info("Tenant-scoped uploads enabled")
+		}
+	}
+
+	NewScanner(deps).Run(ctx)
+}
+
+// Run serves the admin API and uploads artifacts as they appear, until ctx is cancelled or the
+// watcher closes
+func (s *Scanner) Run(ctx context.Context) {
+	janitor := newJanitor(s.fs, s.clock, s.pods, s.cfg.ProfileRoot, s.pod == "")
+	reconcileInterval := config.EnvDuration("REPLICATION_VERIFY_INTERVAL", defaultReplicationInterval)
+	reportInterval := config.EnvDuration("UPLOAD_HISTORY_REPORT_INTERVAL", 24*time.Hour)
+	if err := config.EnvError(); err != nil {
+		logger.Log.Fatalf("Invalid daemon configuration: %v", err)
 	}
-	defer gcsUploader.Close()
 
-	logger.Log.Infof("Daemon scanner started. Watching %s for .jfr files", rootProfileDir)
-	logger.Log.Infof("GCS bucket: %s", bucketName)
+	// Remove directories of pods that are gone, and leftover partial files
+	go janitor.run(ctx)
+
+	// Upload recordings as soon as an in-process API server stops writing them
+	s.files.OnIdle(func(path string) {
+		if filetype.IsArtifact(path) {
+			go s.processFile(ctx, path)
+		}
+	})
+
+	// Re-ship copies missing from any fan-out destination
+	go s.runReconciler(ctx, reconcileInterval)
+
+	// Write the upload history to the bucket for capacity and cost reviews
+	go s.runHistoryReports(ctx, reportInterval)
+
+	// Export upload metrics and serve the admin API
+	metrics.SubscribeUploadEvents()
+	s.serveAdmin(s.cfg.AdminPort)
 
 	// Create file system watcher
 	watcher, err := fsnotify.NewWatcher()
@@ -45,27 +170,30 @@ func Start() {
 	defer watcher.Close()
 
 	// Watch the root profile directory recursively
-	if err := watchDirectoryRecursive(watcher, rootProfileDir); err != nil {
+	if err := s.watchDirectoryRecursive(watcher, s.cfg.ProfileRoot); err != nil {
 		logger.Log.Fatalf("Failed to watch directory: %v", err)
 	}
 
 	// Perform initial scan of existing files
-	if err := scanAndUploadExisting(ctx, gcsUploader, rootProfileDir); err != nil {
+	if err := s.scanAndUploadExisting(ctx, s.cfg.ProfileRoot); err != nil {
 		logger.Log.Infof("Initial scan failed: %v", err)
 	}
 
 	// Start periodic scanner as fallback
-	ticker := time.NewTicker(scanInterval)
+	ticker := time.NewTicker(s.cfg.ScanInterval)
 	defer ticker.Stop()
 
 	// Event loop
 	for {
 		select {
+		case <-ctx.Done():
+			return
+
 		case event, ok := <-watcher.Events:
 			if !ok {
 				return
 			}
-			handleFileEvent(ctx, gcsUploader, event)
+			s.handleFileEvent(ctx, event)
 
 		case err, ok := <-watcher.Errors:
 			if !ok {
@@ -75,7 +203,7 @@ func Start() {
 
 		case <-ticker.C:
 			// Periodic scan as fallback
-			if err := scanAndUploadExisting(ctx, gcsUploader, rootProfileDir); err != nil {
+			if err := s.scanAndUploadExisting(ctx, s.cfg.ProfileRoot); err != nil {
 				logger.Log.Infof("Periodic scan failed: %v", err)
 			}
 		}
@@ -83,86 +211,264 @@ func Start() {
 }
 
 // handleFileEvent processes file system events
-func handleFileEvent(ctx context.Context, uploader *uploader.GCSUploader, event fsnotify.Event) {
-	// Only care about Create and Write events for .jfr files
-	if !strings.HasSuffix(event.Name, ".jfr") {
+func (s *Scanner) handleFileEvent(ctx context.Context, event fsnotify.Event) {
+	if event.Op&fsnotify.Remove == fsnotify.Remove {
+		if filetype.Lookup(event.Name).Prefix != "" {
+			logger.Log.Infof("Detected file Removed: %s", event.Name)
+		}
 		return
 	}
 
-	if event.Op&fsnotify.Remove == fsnotify.Remove {
-		logger.Log.Infof("Detected file Removed: %s", event.Name)
+	// A completion marker means its file is complete; upload it right away
+	if s.cfg.CompletionMarkers && marker.IsMarker(event.Name) {
+		if event.Op&fsnotify.Create == fsnotify.Create {
+			if err := s.processFile(ctx, marker.FileOf(event.Name)); err != nil {
+				logger.Log.Infof("Failed to process file %s: %v", marker.FileOf(event.Name), err)
+			}
+		}
+		return
+	}
+
+	// Only care about Create and Write events for profiling artifacts
+	if !filetype.IsArtifact(event.Name) {
 		return
 	}
 
 	if event.Op&fsnotify.Create == fsnotify.Create || event.Op&fsnotify.Write == fsnotify.Write {
 		logger.Log.Infof("Detected new/modified file: %s", event.Name)
 
-		// Wait a bit to ensure file write is complete
-		time.Sleep(5 * time.Second)
+		// Wait a bit to ensure file write is complete; a marked file is complete once marked
+		if !s.cfg.CompletionMarkers {
+			time.Sleep(s.cfg.SettleDelay)
+		}
 
 		// Process the file
-		if err := processFile(ctx, uploader, event.Name); err != nil {
+		if err := s.processFile(ctx, event.Name); err != nil {
 			logger.Log.Infof("Failed to process file %s: %v", event.Name, err)
 		}
 	}
 }
 
 // processFile uploads a file to GCS and deletes it locally on success
-func processFile(ctx context.Context, gcsUploader *uploader.GCSUploader, filePath string) error {
-	// Extract pod name from path: /tmp/jfr/{POD_NAME}/file.jfr
-	relativePath, err := filepath.Rel(rootProfileDir, filePath)
+func (s *Scanner) processFile(ctx context.Context, filePath string) error {
+	podName, parts, err := s.splitPath(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to get relative path: %w", err)
+		return err
 	}
+	ctx, tenantName := s.tenantScope(ctx, parts)
 
-	parts := strings.Split(relativePath, string(os.PathSeparator))
-	if len(parts) < 2 {
-		return fmt.Errorf("invalid file path structure: %s", filePath)
+	// The watcher, periodic scan and requeue requests can all reach the same file
+	if !s.claimFile(filePath) {
+		logger.Log.Debugf("Already processing %s", filePath)
+		return nil
 	}
+	defer s.releaseFile(filePath)
 
-	podName := parts[0]
+	// Still being written or served by the in-process API; picked up again once released
+	if s.files.InUse(filePath) {
+		logger.Log.Debugf("Skipping file in use: %s", filePath)
+		return nil
+	}
+
+	// With completion markers, only files the sidecar marked complete are uploaded
+	if s.cfg.CompletionMarkers && !recmeta.IsCompanion(filePath) {
+		if _, err := s.fs.Stat(marker.Path(filePath)); err != nil {
+			logger.Log.Debugf("Waiting for completion marker: %s", filePath)
+			s.warnIfUnmarked(filePath)
+			return nil
+		}
+	}
+
+	// Metadata files are uploaded with their recording; only orphans are uploaded on their own
+	if recmeta.IsCompanion(filePath) && !s.orphanedCompanion(filePath) {
+		logger.Log.Debugf("Deferring metadata file to its recording: %s", filePath)
+		return nil
+	}
 
 	// Check if file exists and is readable
-	fileInfo, err := os.Stat(filePath)
+	fileInfo, err := s.fs.Stat(filePath)
 	if err != nil {
 		return fmt.Errorf("file not accessible: %w", err)
 	}
 
 	if fileInfo.Size() == 0 {
-		logger.Log.Infof("Skipping empty file: %s", filePath)
+		// Removed by the janitor once older than PARTIAL_FILE_MAX_AGE
+		logger.Log.Debugf("Skipping empty file: %s", filePath)
+		return nil
+	}
+
+	events.Publish(events.FileDiscovered, map[string]any{
+		"path":   filePath,
+		"pod":    podName,
+		"tenant": tenantName,
+		"size":   fileInfo.Size(),
+	})
+
+	if !s.checkQuota(ctx, filePath, podName, fileInfo.Size()) {
 		return nil
 	}
 
+	companion, meta := s.companionOf(filePath)
+	if meta != nil {
+		ctx = uploader.WithObjectMetadata(ctx, meta.ObjectMetadata())
+		if meta.RequestID != "" {
+			ctx = requestid.WithID(ctx, meta.RequestID)
+		}
+	}
+
+	destination := uploader.DestinationFor(ctx, s.uploader)
+	destinationURI := objectURI(ctx, destination, podName, filePath)
+	if err := s.runPreUploadHook(ctx, filePath, podName, destinationURI); err != nil {
+		return err
+	}
+
+	// Checksum the file while it is still on disk, for the upload history
+	var checksum string
+	if s.history != nil {
+		if checksum, err = uploader.FileSHA256(filePath); err != nil {
+			logger.Log.WithError(err).Warnf("Failed to checksum %s", filePath)
+		}
+	}
+
+	profilePath, cleanupProfile := s.convertPprof(filePath)
+	defer cleanupProfile()
+
 	// Upload to GCS
-	logger.Log.Infof("Uploading file: %s (pod: %s, size: %d bytes)", filePath, podName, fileInfo.Size())
+	logger.Log.WithContext(ctx).Infof("Uploading file: %s (pod: %s, size: %d bytes)", filePath, podName, fileInfo.Size())
 
-	if err := gcsUploader.Upload(ctx, filePath, podName); err != nil {
+	uploadStart := s.clock.Now()
+	err = s.uploader.Upload(ctx, filePath, podName)
+	s.runPostUploadHook(ctx, filePath, podName, destinationURI, err)
+	if err != nil {
+		payload := map[string]any{
+			"path":        filePath,
+			"pod":         podName,
+			"destination": destination,
+			"error":       err.Error(),
+		}
+		// With several destinations, say which ones are missing the copy and why
+		var replication *uploader.ReplicationError
+		if errors.As(err, &replication) {
+			missing := map[string]string{}
+			for d, derr := range replication.Destinations {
+				missing[d] = derr.Error()
+			}
+			payload["missing"] = missing
+		}
+		events.Publish(events.UploadFailed, payload)
 		return fmt.Errorf("upload failed: %w", err)
 	}
 
-	// Delete local file ONLY after successful upload
-	logger.Log.Infof("Upload successful. Deleting local file: %s", filePath)
-	if err := os.Remove(filePath); err != nil {
-		return fmt.Errorf("failed to delete local file: %w", err)
+	events.Publish(events.UploadCompleted, map[string]any{
+		"path":        filePath,
+		"pod":         podName,
+		"destination": destination,
+		"size":        fileInfo.Size(),
+		"modified":    fileInfo.ModTime(),
+		"duration":    s.clock.Now().Sub(uploadStart),
+	})
+	s.recordQuotaUsage(ctx, podName, fileInfo.Size())
+	s.recordHistory(ctx, history.Entry{
+		Path:        filePath,
+		Pod:         podName,
+		Tenant:      tenantName,
+		Object:      destinationURI,
+		Size:        fileInfo.Size(),
+		SHA256:      checksum,
+		Modified:    fileInfo.ModTime(),
+		StartedAt:   uploadStart,
+		CompletedAt: s.clock.Now(),
+	})
+	if companion != "" {
+		s.uploadCompanion(ctx, companion, podName)
+	}
+	if profilePath != "" {
+		s.uploadProfile(ctx, profilePath, podName)
+	}
+
+	// Delete local file ONLY after successful upload, and never while the API still holds it
+	logger.Log.WithContext(ctx).Infof("Upload successful. Deleting local file: %s", filePath)
+	var removeErr error
+	remove := func() {
+		if removeErr = s.fs.Remove(filePath); removeErr != nil {
+			logger.Log.Infof("Failed to delete local file %s: %v", filePath, removeErr)
+			return
+		}
+		if err := s.fs.Remove(marker.Path(filePath)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			logger.Log.Infof("Failed to delete completion marker of %s: %v", filePath, err)
+		}
+	}
+	if !s.files.RemoveWhenIdle(filePath, remove) {
+		logger.Log.Infof("File still in use, deleting once released: %s", filePath)
+		return nil
+	}
+	if removeErr != nil {
+		return fmt.Errorf("failed to delete local file: %w", removeErr)
 	}
 
 	logger.Log.Infof("Successfully processed and deleted: %s", filePath)
 	return nil
 }
 
-// scanAndUploadExisting scans for existing .jfr files and uploads them
-func scanAndUploadExisting(ctx context.Context, gcsUploader *uploader.GCSUploader, rootDir string) error {
-	logger.Log.Infof("Scanning for existing .jfr files in %s", rootDir)
+// unmarkedWarnAge is how long a file may wait for its completion marker before the daemon warns.
+// It is at least a minute, so a large recording the sidecar is still compressing is not mistaken
+// for a sidecar that never writes markers.
+func (s *Scanner) unmarkedWarnAge() time.Duration {
+	return max(s.cfg.SettleDelay, time.Minute)
+}
+
+// warnIfUnmarked warns, once, when a file is past the settle age without a completion marker. The
+// sidecar then most likely runs without COMPLETION_MARKERS, and its files are never uploaded.
+func (s *Scanner) warnIfUnmarked(filePath string) {
+	info, err := s.fs.Stat(filePath)
+	if err != nil || s.clock.Now().Sub(info.ModTime()) < s.unmarkedWarnAge() {
+		return
+	}
+	if s.unmarkedWarned.CompareAndSwap(false, true) {
+		logger.Log.WithField("path", filePath).WithField("age", s.clock.Now().Sub(info.ModTime()).Round(time.Second).String()).
+			Warn("File has no completion marker and is not uploaded; set COMPLETION_MARKERS on the sidecar too, or disable it on the daemon")
+	}
+}
+
+// splitPath extracts the pod name and the path below the pod's directory from a file under the
+// root: /tmp/jfr/{POD_NAME}/[{TENANT}/]file.jfr, or /tmp/jfr/[{TENANT}/]file.jfr for a single pod
+func (s *Scanner) splitPath(filePath string) (string, []string, error) {
+	relativePath, err := filepath.Rel(s.cfg.ProfileRoot, filePath)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get relative path: %w", err)
+	}
+
+	parts := strings.Split(relativePath, string(os.PathSeparator))
+	if s.pod != "" {
+		return s.pod, parts, nil
+	}
+	if len(parts) < 2 {
+		return "", nil, fmt.Errorf("invalid file path structure: %s", filePath)
+	}
+	return parts[0], parts[1:], nil
+}
+
+// podDir returns the local directory holding a pod's files
+func (s *Scanner) podDir(podName string) string {
+	if s.pod != "" {
+		return s.cfg.ProfileRoot
+	}
+	return filepath.Join(s.cfg.ProfileRoot, podName)
+}
+
+// scanAndUploadExisting scans for existing artifacts (JFRs, heap dumps, ...) and uploads them
+func (s *Scanner) scanAndUploadExisting(ctx context.Context, rootDir string) error {
+	logger.Log.Infof("Scanning for existing profiling artifacts in %s", rootDir)
 
-	return filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
+	return s.fs.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			logger.Log.Infof("Error accessing path %s: %v", path, err)
 			return nil // Continue walking
 		}
 
-		if !info.IsDir() && strings.HasSuffix(info.Name(), ".jfr") {
+		if !info.IsDir() && filetype.IsArtifact(path) {
 			logger.Log.Infof("Found existing file: %s", path)
-			if err := processFile(ctx, gcsUploader, path); err != nil {
+			if err := s.processFile(ctx, path); err != nil {
 				logger.Log.Infof("Failed to process existing file %s: %v", path, err)
 			}
 		}
@@ -172,8 +478,8 @@ func scanAndUploadExisting(ctx context.Context, gcsUploader *uploader.GCSUploade
 }
 
 // watchDirectoryRecursive adds the directory and all subdirectories to the watcher
-func watchDirectoryRecursive(watcher *fsnotify.Watcher, root string) error {
-	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+func (s *Scanner) watchDirectoryRecursive(watcher *fsnotify.Watcher, root string) error {
+	return s.fs.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,137 @@
+package daemon
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/config"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/marker"
+)
+
+// fakeUploader records the files it was asked to upload
+type fakeUploader struct {
+	mu       sync.Mutex
+	uploaded []string
+}
+
+func (u *fakeUploader) Upload(ctx context.Context, localPath, podName string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.uploaded = append(u.uploaded, podName+"/"+filepath.Base(localPath))
+	return nil
+}
+
+func (u *fakeUploader) UploadStream(ctx context.Context, r io.Reader, podName, filename string) (int64, error) {
+	return io.Copy(io.Discard, r)
+}
+
+func (u *fakeUploader) Destination() string { return "gs://test-bucket" }
+func (u *fakeUploader) Close() error        { return nil }
+
+func TestPreUploadHookFromOptions(t *testing.T) {
+	logger.Init()
+	tests := []struct {
+		name     string
+		hook     string
+		uploaded bool
+	}{
+		{"no hook", "", true},
+		{"hook accepts", "/bin/true", true},
+		{"hook vetoes", "/bin/false", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.ProfileRoot = t.TempDir()
+			path := filepath.Join(cfg.ProfileRoot, "pod-a", "rec.jfr")
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte("recording"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			u := &fakeUploader{}
+			s := NewScanner(Deps{Config: cfg, Uploader: u, Options: &Options{PreUploadHook: tt.hook}})
+			err := s.processFile(context.Background(), path)
+
+			if tt.uploaded {
+				if err != nil {
+					t.Fatalf("processFile: %v", err)
+				}
+				if len(u.uploaded) != 1 || u.uploaded[0] != "pod-a/rec.jfr" {
+					t.Errorf("uploaded = %v, want [pod-a/rec.jfr]", u.uploaded)
+				}
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Errorf("uploaded file still exists (stat: %v)", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Error("processFile succeeded, want the hook's veto")
+			}
+			if len(u.uploaded) != 0 {
+				t.Errorf("uploaded = %v, want nothing", u.uploaded)
+			}
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("vetoed file was removed: %v", err)
+			}
+		})
+	}
+}
+
+func TestUnmarkedFilesWaitForTheirMarker(t *testing.T) {
+	logger.Init()
+	tests := []struct {
+		name     string
+		age      time.Duration
+		marked   bool
+		uploaded bool
+		warned   bool
+	}{
+		{"marked file", time.Hour, true, true, false},
+		{"recent unmarked file", time.Second, false, false, false},
+		{"unmarked file past the settle age", time.Hour, false, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.ProfileRoot = t.TempDir()
+			cfg.CompletionMarkers = true
+			path := filepath.Join(cfg.ProfileRoot, "pod-a", "rec.jfr")
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte("recording"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			modified := time.Now().Add(-tt.age)
+			if err := os.Chtimes(path, modified, modified); err != nil {
+				t.Fatal(err)
+			}
+			if tt.marked {
+				if err := os.WriteFile(marker.Path(path), nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			u := &fakeUploader{}
+			s := NewScanner(Deps{Config: cfg, Uploader: u, Options: &Options{}})
+			if err := s.processFile(context.Background(), path); err != nil {
+				t.Fatalf("processFile: %v", err)
+			}
+			if uploaded := len(u.uploaded) == 1; uploaded != tt.uploaded {
+				t.Errorf("uploaded = %v, want %v", u.uploaded, tt.uploaded)
+			}
+			if warned := s.unmarkedWarned.Load(); warned != tt.warned {
+				t.Errorf("warned = %v, want %v", warned, tt.warned)
+			}
+		})
+	}
+}
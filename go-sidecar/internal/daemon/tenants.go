@@ -0,0 +1,20 @@
+package daemon
+
+import (
+	"context"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/uploader"
+)
+
+// tenantScope scopes uploads of /tmp/jfr/{POD_NAME}/{TENANT}/{FILENAME} to the tenant's
+// prefix and bucket. parts is the path relative to the pod's directory.
+func (s *Scanner) tenantScope(ctx context.Context, parts []string) (context.Context, string) {
+	if s.tenants == nil || len(parts) != 2 {
+		return ctx, ""
+	}
+	t, ok := s.tenants.ByName(parts[0])
+	if !ok {
+		return ctx, ""
+	}
+	return uploader.WithScope(ctx, uploader.Scope{Prefix: t.Prefix, Bucket: t.Bucket}), t.Name
+}
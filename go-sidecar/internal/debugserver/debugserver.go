@@ -0,0 +1,48 @@
+// Package debugserver serves the Go runtime's pprof endpoints for the profiler binaries
+// themselves, so memory growth or goroutine leaks in the sidecar, daemon or collector can be
+// diagnosed. It is off unless DEBUG_PPROF_ADDR is set.
+package debugserver
+
+import (
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+)
+
+// Start serves /debug/pprof/ on DEBUG_PPROF_ADDR in the background. The listener is separate
+// from the API and admin ports and has no authentication, so it should be bound to localhost
+// (the default host when the address only names a port) and reached with kubectl port-forward.
+func Start() {
+	addr := os.Getenv("DEBUG_PPROF_ADDR")
+	if addr == "" {
+		return
+	}
+	if host, port, err := net.SplitHostPort(addr); err == nil && host == "" {
+		addr = net.JoinHostPort("localhost", port)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	// No write timeout: CPU profiles and traces stream for as long as their seconds parameter
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+	go func() {
+		logger.Log.WithField("addr", addr).Warn("pprof debug server listening; do not expose it outside the pod")
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Log.WithError(err).Error("pprof debug server stopped")
+		}
+	}()
+}
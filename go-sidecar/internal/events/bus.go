@@ -0,0 +1,136 @@
+package events
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// Type identifies the kind of lifecycle event
+type Type string
+
+const (
+	RecordingStarted Type = "recording.started"
+	RecordingStopped Type = "recording.stopped"
+	FileFlushed      Type = "file.flushed"
+	FileDiscovered   Type = "file.discovered"
+	UploadCompleted  Type = "upload.completed"
+	UploadFailed     Type = "upload.failed"
+	UploadDeferred   Type = "upload.deferred"
+)
+
+// Event is a single lifecycle notification published on the bus
+type Event struct {
+	Type   Type           `json:"type"`
+	Time   time.Time      `json:"time"`
+	Fields map[string]any `json:"fields,omitempty"`
+}
+
+// Handler processes events delivered to a subscriber
+type Handler func(Event)
+
+// subscription queues a subscriber's events without bound, so a slow handler delays its own
+// events but never loses them: job state, upload metrics and post-recording hooks depend on
+// seeing every event
+type subscription struct {
+	types map[Type]bool
+
+	mu     sync.Mutex
+	queue  []Event
+	closed bool
+	wake   chan struct{} // signalled, without blocking, when the queue grows or closes
+}
+
+// push queues an event unless the subscription is closed
+func (s *subscription) push(e Event) {
+	s.mu.Lock()
+	if !s.closed {
+		s.queue = append(s.queue, e)
+	}
+	s.mu.Unlock()
+	s.signal()
+}
+
+// close stops queueing; events already queued are still delivered
+func (s *subscription) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.signal()
+}
+
+func (s *subscription) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliver hands queued events to handler in order until the subscription is closed and drained
+func (s *subscription) deliver(handler Handler) {
+	for {
+		s.mu.Lock()
+		queued, closed := s.queue, s.closed
+		s.queue = nil
+		s.mu.Unlock()
+
+		for _, e := range queued {
+			handler(e)
+		}
+		if closed && len(queued) == 0 {
+			return
+		}
+		if len(queued) == 0 {
+			<-s.wake
+		}
+	}
+}
+
+var (
+	mu   sync.RWMutex
+	subs []*subscription
+)
+
+// Subscribe registers a handler for the given event types (all types if none given).
+// Each subscriber receives events on its own goroutine so slow handlers never block publishers.
+// The returned function unsubscribes; events already queued are still delivered.
+func Subscribe(handler Handler, types ...Type) func() {
+	sub := &subscription{
+		types: make(map[Type]bool, len(types)),
+		wake:  make(chan struct{}, 1),
+	}
+	for _, t := range types {
+		sub.types[t] = true
+	}
+
+	go sub.deliver(handler)
+
+	mu.Lock()
+	subs = append(subs, sub)
+	mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			mu.Lock()
+			subs = slices.DeleteFunc(subs, func(s *subscription) bool { return s == sub })
+			mu.Unlock()
+			sub.close()
+		})
+	}
+}
+
+// Publish queues an event for every matching subscriber without blocking
+func Publish(t Type, fields map[string]any) {
+	e := Event{Type: t, Time: time.Now(), Fields: fields}
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for _, sub := range subs {
+		if len(sub.types) > 0 && !sub.types[t] {
+			continue
+		}
+		sub.push(e)
+	}
+}
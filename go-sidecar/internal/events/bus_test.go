@@ -0,0 +1,39 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlowSubscriberReceivesEveryEvent(t *testing.T) {
+	const n = 1000
+	release := make(chan struct{})
+	got := make(chan int, n)
+	unsubscribe := Subscribe(func(e Event) {
+		<-release
+		got <- e.Fields["i"].(int)
+	}, FileFlushed)
+
+	for i := range n {
+		Publish(FileFlushed, map[string]any{"i": i})
+	}
+	Publish(UploadCompleted, nil) // not subscribed to
+	unsubscribe()
+	close(release)
+
+	for want := range n {
+		select {
+		case i := <-got:
+			if i != want {
+				t.Fatalf("event %d delivered in position %d", i, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %d of %d events delivered", want, n)
+		}
+	}
+	select {
+	case i := <-got:
+		t.Fatalf("unexpected event %d after unsubscribing", i)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,88 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+)
+
+// streamBuffer is how many events a stream holds for a client that reads slower than they arrive
+const streamBuffer = 64
+
+// heartbeatInterval keeps idle streams alive through proxies and load balancers that close
+// silent connections
+const heartbeatInterval = 15 * time.Second
+
+// StreamHandler serves lifecycle events as Server-Sent Events, one "event: <type>" message per
+// event with the event as JSON data. The "types" query parameter (comma-separated) narrows the
+// stream. allow, when set, hides events the request may not see. Streams end when the client
+// disconnects or done is closed, so a shutting-down server is not held open by them.
+func StreamHandler(done <-chan struct{}, allow func(*http.Request, Event) bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var types []Type
+		for _, t := range strings.Split(r.URL.Query().Get("types"), ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				types = append(types, Type(t))
+			}
+		}
+
+		// The bus must never block on a slow client: events that do not fit are dropped
+		ch := make(chan Event, streamBuffer)
+		unsubscribe := Subscribe(func(e Event) {
+			if allow != nil && !allow(r, e) {
+				return
+			}
+			select {
+			case ch <- e:
+			default:
+				logger.Log.WithContext(r.Context()).WithField("type", string(e.Type)).Warn("Event stream client is falling behind, dropping event")
+			}
+		}, types...)
+		defer unsubscribe()
+
+		rc := http.NewResponseController(w)
+		rc.SetWriteDeadline(time.Time{}) // the stream outlives any server write timeout
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "retry: 5000\n\n")
+		if err := rc.Flush(); err != nil {
+			logger.Log.WithContext(r.Context()).WithError(err).Warn("Event stream cannot be flushed")
+			return
+		}
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+		var id int
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-done:
+				return
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+			case e := <-ch:
+				data, err := json.Marshal(e)
+				if err != nil {
+					continue
+				}
+				id++
+				fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, e.Type, data)
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
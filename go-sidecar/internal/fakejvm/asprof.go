@@ -0,0 +1,116 @@
+package fakejvm
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+)
+
+// profilerSession is the fake JVM's async-profiler session; like the real agent, a JVM runs at
+// most one at a time
+type profilerSession struct {
+	file    string
+	format  string
+	started time.Time
+	timer   *time.Timer
+}
+
+var session *profilerSession // guarded by mu
+
+// asprof emulates async-profiler. Without an action it waits for -d seconds and writes collapsed
+// stacks to -f; "start" begins a session that "stop" (or --timeout) ends, writing -f in the -o
+// format ("jfr" or "collapsed").
+func asprof(args []string) ([]byte, error) {
+	if len(args) == 0 || args[len(args)-1] != strconv.Itoa(PID) {
+		return []byte("Target JVM not found\n"), fmt.Errorf("exit status 1")
+	}
+	action := "collect"
+	if args[0] == "start" || args[0] == "stop" {
+		action, args = args[0], args[1:]
+	}
+	var seconds, timeout int
+	var filename, format string
+	for i := 0; i+1 < len(args); i++ {
+		switch args[i] {
+		case "-d":
+			seconds, _ = strconv.Atoi(args[i+1])
+		case "--timeout":
+			timeout, _ = strconv.Atoi(args[i+1])
+		case "-f":
+			filename = args[i+1]
+		case "-o":
+			format = args[i+1]
+		}
+	}
+
+	switch action {
+	case "start":
+		mu.Lock()
+		defer mu.Unlock()
+		if session != nil {
+			return []byte("[ERROR] Profiler already started\n"), fmt.Errorf("exit status 1")
+		}
+		current := &profilerSession{file: filename, format: format, started: time.Now()}
+		if timeout > 0 {
+			current.timer = time.AfterFunc(time.Duration(timeout)*time.Second, func() { stopSession(current) })
+		}
+		session = current
+		return []byte("Profiling started\n"), nil
+
+	case "stop":
+		mu.Lock()
+		current := session
+		mu.Unlock()
+		if current == nil {
+			return []byte("[ERROR] Profiler is not active\n"), fmt.Errorf("exit status 1")
+		}
+		if filename != "" {
+			current.file = filename
+		}
+		if format != "" {
+			current.format = format
+		}
+		if err := stopSession(current); err != nil {
+			return []byte(err.Error() + "\n"), fmt.Errorf("exit status 1")
+		}
+		return []byte("OK\n"), nil
+	}
+
+	time.Sleep(time.Duration(seconds) * time.Second)
+	if filename == "" {
+		return []byte(syntheticCollapsed(seconds)), nil
+	}
+	if err := os.WriteFile(filename, []byte(syntheticCollapsed(seconds)), 0o644); err != nil {
+		return []byte(err.Error() + "\n"), fmt.Errorf("exit status 1")
+	}
+	return []byte(fmt.Sprintf("Profiling for %d seconds\nDone\n", seconds)), nil
+}
+
+// stopSession ends a profiling session and writes its output, unless it already ended
+func stopSession(s *profilerSession) error {
+	mu.Lock()
+	if session != s {
+		mu.Unlock()
+		return nil
+	}
+	session = nil
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	mu.Unlock()
+
+	elapsed := time.Since(s.started)
+	data := syntheticRecording(s.started, elapsed)
+	if s.format == "collapsed" {
+		data = []byte(syntheticCollapsed(int(elapsed.Seconds())))
+	}
+	if err := os.WriteFile(s.file, data, 0o644); err != nil {
+		logger.Log.WithError(err).Warn("Simulation: failed to write profile")
+		return err
+	}
+	logger.Log.WithField("file", s.file).Info("Simulation: async-profiler session finished")
+	return nil
+}
@@ -0,0 +1,30 @@
+package fakejvm
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// Controller finds and commands the simulated JVM directly, without a command runner, so API
+// handlers can be exercised in-process (set api.Deps.JVM). It works whether or not
+// SIMULATION_MODE is on; the JVM's recordings are shared with Run.
+type Controller struct{}
+
+// JavaPIDs returns the simulated JVM's PID
+func (Controller) JavaPIDs(ctx context.Context) ([]int, error) {
+	return []int{PID}, nil
+}
+
+// ResolvePID returns the simulated JVM when container is empty or names its container
+func (Controller) ResolvePID(ctx context.Context, container string) (int, error) {
+	if container != "" && container != Container {
+		return 0, fmt.Errorf("no Java process found in container %q", container)
+	}
+	return PID, nil
+}
+
+// Jcmd runs a diagnostic command against the simulated JVM, answering like jcmd
+func (Controller) Jcmd(ctx context.Context, pid int, command string, options ...string) ([]byte, error) {
+	return Run("jcmd", append([]string{strconv.Itoa(pid), command}, options...)...)
+}
@@ -0,0 +1,229 @@
+package fakejvm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// heapDump emulates GC.heap_dump [-all] <filename> with an HPROF file holding only its header
+func heapDump(header string, args []string) ([]byte, error) {
+	var filename string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			filename = arg
+		}
+	}
+	if filename == "" {
+		return []byte(header + "java.lang.IllegalArgumentException: The argument 'filename' is mandatory.\n"), fmt.Errorf("exit status 1")
+	}
+	if _, err := os.Stat(filename); err == nil {
+		return []byte(header + fmt.Sprintf("Unable to create %s: File exists\n", filename)), fmt.Errorf("exit status 1")
+	}
+
+	// "JAVA PROFILE 1.0.2", 8-byte identifiers, the dump time, then an empty HEAP DUMP END record
+	data := append([]byte("JAVA PROFILE 1.0.2\x00"), binary.BigEndian.AppendUint32(nil, 8)...)
+	data = binary.BigEndian.AppendUint64(data, uint64(time.Now().UnixMilli()))
+	data = append(data, 0x2c, 0, 0, 0, 0, 0, 0, 0, 0)
+	if err := os.WriteFile(filename, data, 0o644); err != nil {
+		return []byte(header + err.Error() + "\n"), fmt.Errorf("exit status 1")
+	}
+	return []byte(header + fmt.Sprintf("Dumping heap to %s ...\nHeap dump file created [%d bytes in 0.004 secs]\n", filename, len(data))), nil
+}
+
+// threadPrint emulates Thread.print with the threads of an idle web application
+func threadPrint(header string) []byte {
+	return []byte(header + time.Now().Format("2006-01-02 15:04:05") + `
+Full thread dump OpenJDK 64-Bit Server VM (21.0.2+13-LTS mixed mode, sharing):
+
+"main" #1 [4243] prio=5 os_prio=0 cpu=812.45ms elapsed=` + fmt.Sprintf("%.2fs", time.Since(started).Seconds()) + ` tid=0x00007f3c2c02b000 nid=4243 waiting on condition  [0x00007f3c33bfe000]
+   java.lang.Thread.State: WAITING (parking)
+	at jdk.internal.misc.Unsafe.park(java.base@21.0.2/Native Method)
+	at java.util.concurrent.locks.LockSupport.park(java.base@21.0.2/LockSupport.java:371)
+	at ` + MainClass + `.main(Application.java:24)
+
+"Reference Handler" #9 [4251] daemon prio=10 os_prio=0 cpu=0.52ms elapsed=12.10s tid=0x00007f3c2c1a4800 nid=4251 waiting on condition  [0x00007f3c0f2fd000]
+   java.lang.Thread.State: RUNNABLE
+	at java.lang.ref.Reference.waitForReferencePendingList(java.base@21.0.2/Native Method)
+
+"http-nio-8080-exec-1" #42 [4290] daemon prio=5 os_prio=0 cpu=154.20ms elapsed=11.90s tid=0x00007f3c2d5ef000 nid=4290 waiting on condition  [0x00007f3c0c8fe000]
+   java.lang.Thread.State: TIMED_WAITING (parking)
+	at jdk.internal.misc.Unsafe.park(java.base@21.0.2/Native Method)
+	at java.util.concurrent.LinkedBlockingQueue.poll(java.base@21.0.2/LinkedBlockingQueue.java:460)
+
+"http-nio-8080-Acceptor" #45 [4293] daemon prio=5 os_prio=0 cpu=3.11ms elapsed=11.88s tid=0x00007f3c2d61c000 nid=4293 runnable  [0x00007f3c0c5fe000]
+   java.lang.Thread.State: RUNNABLE
+	at sun.nio.ch.Net.accept(java.base@21.0.2/Native Method)
+
+"VM Thread" os_prio=0 cpu=25.61ms elapsed=12.11s tid=0x00007f3c2c195000 nid=4250 runnable
+
+"GC Thread#0" os_prio=0 cpu=18.40ms elapsed=12.12s tid=0x00007f3c2c05c800 nid=4245 runnable
+
+JNI global refs: 24, weak refs: 0
+
+`)
+}
+
+// classHistogram emulates GC.class_histogram for a small Spring application
+func classHistogram(header string) []byte {
+	classes := []struct {
+		name      string
+		module    string
+		instances int64
+		size      int64 // bytes per instance
+	}{
+		{"[B", "java.base@21.0.2", 48210, 212},
+		{"java.lang.String", "java.base@21.0.2", 45872, 24},
+		{"java.lang.Class", "java.base@21.0.2", 9318, 104},
+		{"java.util.HashMap$Node", "java.base@21.0.2", 21544, 32},
+		{"[Ljava.lang.Object;", "java.base@21.0.2", 8127, 56},
+		{"java.lang.reflect.Method", "java.base@21.0.2", 3987, 80},
+		{"java.util.concurrent.ConcurrentHashMap$Node", "java.base@21.0.2", 7420, 32},
+		{"com.example.demo.OrderCache$Entry", "", 5000, 40},
+	}
+	var b strings.Builder
+	b.WriteString(header)
+	b.WriteString(" num     #instances         #bytes  class name (module)\n")
+	b.WriteString("-------------------------------------------------------\n")
+	var instances, bytes int64
+	for i, c := range classes {
+		line := fmt.Sprintf("%4d: %13d %14d  %s", i+1, c.instances, c.instances*c.size, c.name)
+		if c.module != "" {
+			line += " (" + c.module + ")"
+		}
+		b.WriteString(line + "\n")
+		instances += c.instances
+		bytes += c.instances * c.size
+	}
+	fmt.Fprintf(&b, "Total %13d %14d\n", instances, bytes)
+	return []byte(b.String())
+}
+
+// nativeMemorySummary emulates VM.native_memory summary of a JVM started with
+// -XX:NativeMemoryTracking=summary
+func nativeMemorySummary(header string) []byte {
+	return []byte(header + `
+Native Memory Tracking:
+
+(Omitting categories weighting less than 1KB)
+
+Total: reserved=1620553KB, committed=366085KB
+       malloc: 28225KB #112364
+       mmap:   reserved=1592328KB, committed=337860KB
+
+-                 Java Heap (reserved=524288KB, committed=262144KB)
+                            (mmap: reserved=524288KB, committed=262144KB)
+
+-                     Class (reserved=1049340KB, committed=8956KB)
+                            (classes #11929)
+                            (  instance classes #11157, array classes #772)
+
+-                    Thread (reserved=33876KB, committed=2884KB)
+                            (thread #33)
+                            (stack: reserved=33792KB, committed=2800KB)
+
+-                      Code (reserved=248786KB, committed=21690KB)
+                            (malloc=1098KB #5508)
+
+-                        GC (reserved=54604KB, committed=54604KB)
+                            (malloc=8876KB #6841)
+
+-                  Internal (reserved=652KB, committed=652KB)
+                            (malloc=588KB #2201)
+
+-                    Symbol (reserved=14738KB, committed=14738KB)
+                            (malloc=12410KB #160843)
+`)
+}
+
+// vmInfo emulates the start of VM.info
+func vmInfo(header string) []byte {
+	elapsed := time.Since(started)
+	return []byte(header + `#
+# JRE version: OpenJDK Runtime Environment (21.0.2+13) (build 21.0.2+13-LTS)
+# Java VM: OpenJDK 64-Bit Server VM (21.0.2+13-LTS, mixed mode, sharing, tiered, compressed oops, compressed class ptrs, g1 gc, linux-amd64)
+
+---------------  S U M M A R Y ------------
+
+Command Line: -Xmx512m -XX:+UseG1GC -Ddb.password=hunter2 ` + MainClass + ` --server.port=8080
+
+Host: Intel(R) Xeon(R) CPU @ 2.20GHz, 2 cores, 1G, Debian GNU/Linux 12 (bookworm)
+Time: ` + time.Now().Format("Mon Jan _2 15:04:05 2006 MST") + fmt.Sprintf(" elapsed time: %.6f seconds", elapsed.Seconds()) + `
+
+---------------  P R O C E S S  ---------------
+
+Heap address: 0x00000000e0000000, size: 512 MB, Compressed Oops mode: 32-bit
+
+ garbage-first heap   total 32768K, used 12288K [0x00000000e0000000, 0x0000000100000000)
+  region size 1024K, 8 young (8192K), 1 survivors (1024K)
+
+---------------  S Y S T E M  ---------------
+
+OS:
+PRETTY_NAME="Debian GNU/Linux 12 (bookworm)"
+uname: Linux 6.1.0 #1 SMP x86_64
+`)
+}
+
+// systemProperties emulates VM.system_properties
+func systemProperties(header string) []byte {
+	return []byte(header + "#" + time.Now().Format("Mon Jan 02 15:04:05 MST 2006") + `
+db.password=hunter2
+file.encoding=UTF-8
+file.separator=/
+java.class.path=/app/classes\:/app/libs/*
+java.home=/opt/java/openjdk
+java.runtime.version=21.0.2+13-LTS
+java.vendor=Eclipse Adoptium
+java.version=21.0.2
+java.vm.name=OpenJDK 64-Bit Server VM
+line.separator=\n
+os.arch=amd64
+os.name=Linux
+sun.java.command=` + MainClass + ` --server.port\=8080
+user.dir=/app
+user.timezone=UTC
+`)
+}
+
+// perfCounters emulates PerfCounter.print for a G1 JVM with a 512MB heap
+func perfCounters(header string) []byte {
+	const frequency = 1_000_000_000
+	ticks := time.Since(started).Nanoseconds()
+	collections := 1 + ticks/int64(20*time.Second)
+	counters := []string{
+		"java.cls.loadedClasses=9318",
+		"java.cls.unloadedClasses=12",
+		"java.threads.daemon=27",
+		"java.threads.live=33",
+		"java.threads.livePeak=35",
+		"java.threads.started=41",
+		"sun.cls.sharedLoadedClasses=1043",
+		"sun.cls.sharedUnloadedClasses=0",
+		`sun.gc.collector.0.name="G1 young collection pauses"`,
+		fmt.Sprintf("sun.gc.collector.0.invocations=%d", collections),
+		fmt.Sprintf("sun.gc.collector.0.time=%d", collections*4_200_000),
+		`sun.gc.collector.1.name="G1 full collection pauses"`,
+		"sun.gc.collector.1.invocations=0",
+		"sun.gc.collector.1.time=0",
+		"sun.gc.generation.0.capacity=20971520",
+		"sun.gc.generation.0.maxCapacity=536870912",
+		"sun.gc.generation.0.space.0.used=8388608",
+		"sun.gc.generation.0.space.1.used=0",
+		"sun.gc.generation.0.space.2.used=1048576",
+		"sun.gc.generation.1.capacity=12582912",
+		"sun.gc.generation.1.maxCapacity=536870912",
+		"sun.gc.generation.1.space.0.used=4194304",
+		"sun.gc.metaspace.capacity=58720256",
+		"sun.gc.metaspace.maxCapacity=1124073472",
+		"sun.gc.metaspace.used=57344512",
+		`sun.gc.policy.name="GarbageFirst"`,
+		fmt.Sprintf("sun.os.hrt.frequency=%d", frequency),
+		fmt.Sprintf("sun.os.hrt.ticks=%d", ticks),
+		fmt.Sprintf("sun.rt.safepointTime=%d", collections*4_500_000),
+		fmt.Sprintf("sun.rt.safepoints=%d", collections*3),
+	}
+	return []byte(header + strings.Join(counters, "\n") + "\n")
+}
@@ -0,0 +1,244 @@
+package fakejvm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+)
+
+// PID is the process ID reported for the simulated JVM
+const PID = 4242
+
+// Container is the container name the simulated JVM runs in
+const Container = "java-app"
+
+// MainClass is the main class the simulated JVM was launched with
+const MainClass = "com.example.demo.Application"
+
+// started is when the simulated JVM "launched", for VM.uptime
+var started = time.Now()
+
+type recording struct {
+	id       int
+	name     string
+	duration string
+	filename string
+	maxsize  string
+	maxage   string
+	started  time.Time
+	timer    *time.Timer
+}
+
+var (
+	mu         sync.Mutex
+	nextID     = 1
+	recordings = map[string]*recording{}
+)
+
+// Enabled reports whether simulation mode is switched on via SIMULATION_MODE
+func Enabled() bool {
+	switch strings.ToLower(os.Getenv("SIMULATION_MODE")) {
+	case "1", "true", "yes":
+		return true
+	}
+	return false
+}
+
+// Run emulates pgrep, jcmd and asprof invocations against an in-process fake JVM
+func Run(name string, args ...string) ([]byte, error) {
+	switch name {
+	case "pgrep":
+		return []byte(fmt.Sprintf("%d\n", PID)), nil
+	case "jcmd":
+		if len(args) < 2 {
+			return []byte("Usage: jcmd <pid> <command>\n"), fmt.Errorf("exit status 1")
+		}
+		if args[0] != strconv.Itoa(PID) {
+			return []byte(fmt.Sprintf("%s not found\n", args[0])), fmt.Errorf("exit status 1")
+		}
+		return jcmd(args[1], args[2:])
+	case "asprof":
+		return asprof(args)
+	default:
+		return nil, fmt.Errorf("simulation mode: unsupported command %q", name)
+	}
+}
+
+// jcmd dispatches a diagnostic command to the fake JVM
+func jcmd(command string, args []string) ([]byte, error) {
+	header := fmt.Sprintf("%d:\n", PID)
+	opts := parseOptions(args)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	switch command {
+	case "VM.command_line":
+		return []byte(header + "VM Arguments:\njvm_args: -Xmx512m -XX:+UseG1GC\njava_command: " + MainClass +
+			" --server.port=8080\njava_class_path (initial): /app/classes:/app/libs/*\nLauncher Type: SUN_STANDARD\n"), nil
+
+	case "VM.uptime":
+		return []byte(header + fmt.Sprintf("%.3f s\n", time.Since(started).Seconds())), nil
+
+	case "JFR.start":
+		name := opts["name"]
+		if name == "" {
+			name = strconv.Itoa(nextID)
+		}
+		if _, exists := recordings[name]; exists {
+			return []byte(header + fmt.Sprintf("Recording with name %s already exists\n", name)), fmt.Errorf("exit status 1")
+		}
+
+		rec := &recording{id: nextID, name: name, duration: opts["duration"], filename: opts["filename"],
+			maxsize: opts["maxsize"], maxage: opts["maxage"], started: time.Now()}
+		nextID++
+		recordings[name] = rec
+
+		if d, err := time.ParseDuration(rec.duration); err == nil && d > 0 {
+			rec.timer = time.AfterFunc(d, func() { finish(name) })
+		}
+
+		return []byte(header + fmt.Sprintf("Started recording %d. The result will be written to:\n\n%s\n", rec.id, rec.filename)), nil
+
+	case "JFR.check":
+		if len(recordings) == 0 {
+			return []byte(header + "No available recordings.\n\nUse jcmd " + strconv.Itoa(PID) + " JFR.start to start a recording.\n"), nil
+		}
+		var lines []string
+		for _, rec := range sortedRecordings() {
+			line := fmt.Sprintf("Recording %d: name=%s", rec.id, rec.name)
+			if rec.duration != "" {
+				line += " duration=" + rec.duration
+			}
+			if size, err := strconv.ParseInt(rec.maxsize, 10, 64); err == nil && size > 0 {
+				line += fmt.Sprintf(" maxsize=%.1fMB", float64(size)/(1<<20))
+			}
+			if rec.maxage != "" {
+				line += " maxage=" + rec.maxage
+			}
+			lines = append(lines, line+" (running)")
+		}
+		return []byte(header + strings.Join(lines, "\n") + "\n"), nil
+
+	case "JFR.stop":
+		rec, ok := recordings[opts["name"]]
+		if !ok {
+			return []byte(header + fmt.Sprintf("Could not find %s.\n\nUse JFR.check without options to see list of all available recordings.\n", opts["name"])), fmt.Errorf("exit status 1")
+		}
+		if rec.timer != nil {
+			rec.timer.Stop()
+		}
+		delete(recordings, rec.name)
+		if err := writeDummyRecording(rec); err != nil {
+			return []byte(header + err.Error() + "\n"), fmt.Errorf("exit status 1")
+		}
+		return []byte(header + fmt.Sprintf("Stopped recording \"%s\".\n", rec.name)), nil
+
+	case "JFR.dump":
+		rec, ok := recordings[opts["name"]]
+		if !ok {
+			return []byte(header + fmt.Sprintf("Could not find %s.\n", opts["name"])), fmt.Errorf("exit status 1")
+		}
+		snapshot := &recording{filename: opts["filename"], started: rec.started}
+		if begin, err := time.ParseDuration(strings.TrimPrefix(opts["begin"], "-")); err == nil && time.Now().Add(-begin).After(rec.started) {
+			snapshot.started = time.Now().Add(-begin)
+		}
+		if snapshot.filename == "" {
+			snapshot.filename = rec.filename
+		}
+		if err := writeDummyRecording(snapshot); err != nil {
+			return []byte(header + err.Error() + "\n"), fmt.Errorf("exit status 1")
+		}
+		var size int64
+		if info, err := os.Stat(snapshot.filename); err == nil {
+			size = info.Size()
+		}
+		return []byte(header + fmt.Sprintf("Dumped recording \"%s\", %.1f kB written to:\n\n%s\n", rec.name, float64(size)/1024, snapshot.filename)), nil
+
+	case "GC.heap_dump":
+		return heapDump(header, args)
+
+	case "Thread.print":
+		return threadPrint(header), nil
+
+	case "GC.class_histogram":
+		return classHistogram(header), nil
+
+	case "VM.native_memory":
+		return nativeMemorySummary(header), nil
+
+	case "VM.flags":
+		return []byte(header + "-XX:CICompilerCount=3 -XX:ConcGCThreads=1 -XX:G1HeapRegionSize=1048576 -XX:InitialHeapSize=33554432 " +
+			"-XX:MaxHeapSize=536870912 -XX:MaxNewSize=321912832 -XX:+UseCompressedOops -XX:+UseG1GC -XX:-UseLargePages\n"), nil
+
+	case "VM.info":
+		return vmInfo(header), nil
+
+	case "VM.system_properties":
+		return systemProperties(header), nil
+
+	case "PerfCounter.print":
+		return perfCounters(header), nil
+
+	default:
+		return []byte(header + fmt.Sprintf("Unknown diagnostic command: %s\n", command)), fmt.Errorf("exit status 1")
+	}
+}
+
+// finish completes a recording once its duration elapses
+func finish(name string) {
+	mu.Lock()
+	rec, ok := recordings[name]
+	if ok {
+		delete(recordings, name)
+	}
+	mu.Unlock()
+
+	if !ok {
+		return
+	}
+	if err := writeDummyRecording(rec); err != nil {
+		logger.Log.WithError(err).WithField("name", name).Warn("Simulation: failed to write recording")
+		return
+	}
+	logger.Log.WithField("name", name).Info("Simulation: recording finished")
+}
+
+// writeDummyRecording writes a synthetic but parseable JFR file covering the recording's lifetime
+func writeDummyRecording(rec *recording) error {
+	if rec.filename == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(rec.filename), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	return os.WriteFile(rec.filename, syntheticRecording(rec.started, time.Since(rec.started)), 0o644)
+}
+
+func sortedRecordings() []*recording {
+	list := make([]*recording, 0, len(recordings))
+	for _, rec := range recordings {
+		list = append(list, rec)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].id < list[j].id })
+	return list
+}
+
+// parseOptions turns key=value jcmd arguments into a map
+func parseOptions(args []string) map[string]string {
+	opts := make(map[string]string, len(args))
+	for _, arg := range args {
+		if k, v, ok := strings.Cut(arg, "="); ok {
+			opts[k] = v
+		}
+	}
+	return opts
+}
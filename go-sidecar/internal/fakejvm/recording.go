@@ -0,0 +1,169 @@
+package fakejvm
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/jfr"
+)
+
+// syntheticStacks are (class, method) frames, innermost first
+var syntheticStacks = [][][2]string{
+	{{"java.util.HashMap", "resize"}, {"java.util.HashMap", "putVal"}, {"com.example.spring_boot_docker.SpringBootDockerApplication", "home"}},
+	{{"java.lang.StringBuilder", "append"}, {"com.example.spring_boot_docker.SpringBootDockerApplication", "home"}},
+	{{"sun.nio.ch.EPoll", "wait"}, {"org.apache.tomcat.util.net.NioEndpoint$Poller", "run"}, {"java.lang.Thread", "run"}},
+	{{"java.util.concurrent.locks.LockSupport", "park"}, {"java.util.concurrent.ThreadPoolExecutor", "getTask"}, {"java.lang.Thread", "run"}},
+}
+
+var syntheticAllocClasses = []string{"byte[]", "java.lang.String", "java.util.HashMap$Node", "java.lang.Object[]"}
+
+// syntheticRecording generates a parseable JFR chunk with CPU, allocation, GC and thread events
+func syntheticRecording(start time.Time, duration time.Duration) []byte {
+	if duration <= 0 {
+		duration = time.Second
+	}
+	if duration > 5*time.Minute {
+		duration = 5 * time.Minute
+	}
+
+	w := jfr.NewWriter(start)
+	w.DefineType("java.lang.Thread", "", jfr.FieldSpec{Name: "javaName", Type: "java.lang.String"}, jfr.FieldSpec{Name: "javaThreadId", Type: "long"})
+	w.DefineType("jdk.types.Symbol", "", jfr.FieldSpec{Name: "string", Type: "java.lang.String"})
+	w.DefineType("java.lang.Class", "", jfr.FieldSpec{Name: "name", Type: "jdk.types.Symbol", ConstantPool: true})
+	w.DefineType("jdk.types.Method", "",
+		jfr.FieldSpec{Name: "type", Type: "java.lang.Class", ConstantPool: true},
+		jfr.FieldSpec{Name: "name", Type: "jdk.types.Symbol", ConstantPool: true})
+	w.DefineType("jdk.types.StackFrame", "",
+		jfr.FieldSpec{Name: "method", Type: "jdk.types.Method", ConstantPool: true},
+		jfr.FieldSpec{Name: "lineNumber", Type: "int"})
+	w.DefineType("jdk.types.StackTrace", "",
+		jfr.FieldSpec{Name: "truncated", Type: "boolean"},
+		jfr.FieldSpec{Name: "frames", Type: "jdk.types.StackFrame", Array: true})
+	w.DefineType("jdk.types.GCName", "", jfr.FieldSpec{Name: "name", Type: "java.lang.String"})
+	w.DefineType("jdk.types.GCCause", "", jfr.FieldSpec{Name: "cause", Type: "java.lang.String"})
+
+	w.DefineType("jdk.ExecutionSample", "jdk.jfr.Event",
+		jfr.FieldSpec{Name: "startTime", Type: "long"},
+		jfr.FieldSpec{Name: "sampledThread", Type: "java.lang.Thread", ConstantPool: true},
+		jfr.FieldSpec{Name: "stackTrace", Type: "jdk.types.StackTrace", ConstantPool: true})
+	w.DefineType("jdk.ObjectAllocationSample", "jdk.jfr.Event",
+		jfr.FieldSpec{Name: "startTime", Type: "long"},
+		jfr.FieldSpec{Name: "eventThread", Type: "java.lang.Thread", ConstantPool: true},
+		jfr.FieldSpec{Name: "stackTrace", Type: "jdk.types.StackTrace", ConstantPool: true},
+		jfr.FieldSpec{Name: "objectClass", Type: "java.lang.Class", ConstantPool: true},
+		jfr.FieldSpec{Name: "weight", Type: "long"})
+	w.DefineType("jdk.GarbageCollection", "jdk.jfr.Event",
+		jfr.FieldSpec{Name: "startTime", Type: "long"},
+		jfr.FieldSpec{Name: "duration", Type: "long"},
+		jfr.FieldSpec{Name: "gcId", Type: "int"},
+		jfr.FieldSpec{Name: "name", Type: "jdk.types.GCName", ConstantPool: true},
+		jfr.FieldSpec{Name: "cause", Type: "jdk.types.GCCause", ConstantPool: true},
+		jfr.FieldSpec{Name: "sumOfPauses", Type: "long"},
+		jfr.FieldSpec{Name: "longestPause", Type: "long"})
+	w.DefineType("jdk.GCHeapSummary", "jdk.jfr.Event",
+		jfr.FieldSpec{Name: "startTime", Type: "long"},
+		jfr.FieldSpec{Name: "gcId", Type: "int"},
+		jfr.FieldSpec{Name: "heapUsed", Type: "long"})
+	w.DefineType("jdk.SafepointBegin", "jdk.jfr.Event",
+		jfr.FieldSpec{Name: "startTime", Type: "long"},
+		jfr.FieldSpec{Name: "duration", Type: "long"},
+		jfr.FieldSpec{Name: "safepointId", Type: "long"})
+	w.DefineType("jdk.CPULoad", "jdk.jfr.Event",
+		jfr.FieldSpec{Name: "startTime", Type: "long"},
+		jfr.FieldSpec{Name: "jvmUser", Type: "float"},
+		jfr.FieldSpec{Name: "jvmSystem", Type: "float"},
+		jfr.FieldSpec{Name: "machineTotal", Type: "float"})
+	w.DefineType("jdk.JavaThreadStatistics", "jdk.jfr.Event",
+		jfr.FieldSpec{Name: "startTime", Type: "long"},
+		jfr.FieldSpec{Name: "activeCount", Type: "long"},
+		jfr.FieldSpec{Name: "daemonCount", Type: "long"},
+		jfr.FieldSpec{Name: "peakCount", Type: "long"})
+
+	symbols := map[string]int64{}
+	symbol := func(s string) int64 {
+		if idx, ok := symbols[s]; ok {
+			return idx
+		}
+		symbols[s] = w.Constant("jdk.types.Symbol", s)
+		return symbols[s]
+	}
+	classes := map[string]int64{}
+	class := func(name string) int64 {
+		if idx, ok := classes[name]; ok {
+			return idx
+		}
+		classes[name] = w.Constant("java.lang.Class", symbol(name))
+		return classes[name]
+	}
+
+	var stacks []int64
+	for _, frames := range syntheticStacks {
+		var encoded []any
+		for i, f := range frames {
+			method := w.Constant("jdk.types.Method", class(f[0]), symbol(f[1]))
+			encoded = append(encoded, []any{method, int64(40 + i*7)})
+		}
+		stacks = append(stacks, w.Constant("jdk.types.StackTrace", false, encoded))
+	}
+
+	var threads []int64
+	for i, name := range []string{"http-nio-8080-exec-1", "http-nio-8080-exec-2", "http-nio-8080-Poller", "main"} {
+		threads = append(threads, w.Constant("java.lang.Thread", name, int64(i+20)))
+	}
+
+	g1Young := w.Constant("jdk.types.GCName", "G1New")
+	allocFailure := w.Constant("jdk.types.GCCause", "G1 Evacuation Pause")
+
+	rng := rand.New(rand.NewSource(start.UnixNano()))
+	end := start.Add(duration)
+	gcID := int64(0)
+	safepointID := int64(0)
+
+	for t := start; t.Before(end); t = t.Add(20 * time.Millisecond) {
+		ticks := w.Ticks(t)
+		for _, thread := range threads[:2] {
+			w.Event("jdk.ExecutionSample", ticks, thread, stacks[rng.Intn(len(stacks))])
+		}
+		if rng.Intn(4) == 0 {
+			alloc := syntheticAllocClasses[rng.Intn(len(syntheticAllocClasses))]
+			w.Event("jdk.ObjectAllocationSample", ticks, threads[rng.Intn(2)], stacks[rng.Intn(2)], class(alloc), int64(256*1024+rng.Intn(4*1024*1024)))
+		}
+	}
+
+	for t := start; t.Before(end); t = t.Add(time.Second) {
+		ticks := w.Ticks(t)
+		w.Event("jdk.CPULoad", ticks, 0.2+rng.Float64()*0.3, 0.02+rng.Float64()*0.05, 0.4+rng.Float64()*0.4)
+		w.Event("jdk.JavaThreadStatistics", ticks, int64(28+rng.Intn(4)), int64(20), int64(34))
+
+		if rng.Intn(2) == 0 {
+			gcID++
+			pause := time.Duration(2+rng.Intn(25)) * time.Millisecond
+			w.Event("jdk.GCHeapSummary", ticks, gcID, int64(180+rng.Intn(120))*1024*1024)
+			w.Event("jdk.GarbageCollection", ticks, pause.Nanoseconds(), gcID, g1Young, allocFailure, pause.Nanoseconds(), pause.Nanoseconds())
+			safepointID++
+			w.Event("jdk.SafepointBegin", ticks, (pause + time.Millisecond).Nanoseconds(), safepointID)
+		}
+	}
+
+	return w.Bytes()
+}
+
+// syntheticCollapsed returns collapsed stacks (root first, native frames included) for a profile
+// of the given length, in the format async-profiler writes with -o collapsed
+func syntheticCollapsed(seconds int) string {
+	var b strings.Builder
+	for i, frames := range syntheticStacks {
+		names := []string{"start_thread", "thread_native_entry", "JavaThread::run"}
+		for _, f := range slices.Backward(frames) {
+			names = append(names, strings.ReplaceAll(f[0], ".", "/")+"."+f[1])
+		}
+		if i == 0 {
+			names = append(names, "[libc.so.6]", "__memmove_avx_unaligned_erms")
+		}
+		fmt.Fprintf(&b, "%s %d\n", strings.Join(names, ";"), max(seconds, 1)*(100-20*i))
+	}
+	return b.String()
+}
@@ -0,0 +1,136 @@
+package filetype
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Type describes how an artifact of a given kind is stored
+type Type struct {
+	Name            string // Short artifact kind, e.g. "jfr"
+	Extension       string // Filename suffix, including the leading dot
+	ContentType     string
+	ContentEncoding string // Set when the file is stored compressed
+	Prefix          string // Object prefix when laying out uploads by type; empty for non-artifacts
+}
+
+// Default is used for files that match no registered type
+var Default = Type{Name: "other", ContentType: "application/octet-stream"}
+
+// registry lists known artifact types; compressed variants come before their plain forms
+var registry = []Type{
+	{Name: "jfr", Extension: ".jfr.gz", ContentType: "application/jfr", ContentEncoding: "gzip", Prefix: "jfr"},
+	{Name: "jfr", Extension: ".jfr", ContentType: "application/jfr", Prefix: "jfr"},
+	{Name: "heapdump", Extension: ".hprof.gz", ContentType: "application/x-hprof", ContentEncoding: "gzip", Prefix: "heapdumps"},
+	{Name: "heapdump", Extension: ".hprof", ContentType: "application/x-hprof", Prefix: "heapdumps"},
+	{Name: "threaddump", Extension: ".tdump", ContentType: "text/plain; charset=utf-8", Prefix: "threaddumps"},
+	{Name: "gclog", Extension: ".gc.log", ContentType: "text/plain; charset=utf-8", Prefix: "gclogs"},
+	{Name: "native", Extension: ".collapsed", ContentType: "text/plain; charset=utf-8", Prefix: "native"},
+	{Name: "native", Extension: ".perf.data", ContentType: "application/octet-stream", Prefix: "native"},
+	{Name: "native", Extension: ".perf.map", ContentType: "text/plain; charset=utf-8", Prefix: "native"},
+	{Name: "flamegraph", Extension: ".html", ContentType: "text/html; charset=utf-8"},
+	{Name: "flamegraph", Extension: ".svg", ContentType: "image/svg+xml"},
+	{Name: "pprof", Extension: ".pb.gz", ContentType: "application/octet-stream", ContentEncoding: "gzip", Prefix: "pprof"},
+	{Name: "text", Extension: ".txt", ContentType: "text/plain; charset=utf-8"},
+	{Name: "metadata", Extension: ".meta.json", ContentType: "application/json", Prefix: "jfr"}, // recording companion, kept next to it
+	{Name: "json", Extension: ".json", ContentType: "application/json"},
+}
+
+// signatures identify artifacts by their leading bytes when the extension is not conclusive.
+// Thread dumps and GC logs carry a timestamp or jcmd header first, so they match anywhere in the head.
+var signatures = []struct {
+	magic    []byte
+	anywhere bool
+	typeName string
+}{
+	{[]byte("FLR\x00"), false, "jfr"},
+	{[]byte("JAVA PROFILE 1.0."), false, "heapdump"},
+	{[]byte("Full thread dump"), true, "threaddump"},
+	{[]byte("][gc"), true, "gclog"},
+}
+
+// sniffLen is how much of a file Detect reads
+const sniffLen = 512
+
+// Lookup returns the registered type for a filename, or Default
+func Lookup(filename string) Type {
+	for _, t := range registry {
+		if strings.HasSuffix(filename, t.Extension) {
+			return t
+		}
+	}
+	return Default
+}
+
+// Detect returns the type of a file by extension, falling back to its content for
+// files such as plain .txt or .log that may hold a thread dump or GC log
+func Detect(path string) Type {
+	t := Lookup(path)
+	if t.Prefix != "" {
+		return t
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return t
+	}
+	defer f.Close()
+
+	head := make([]byte, sniffLen)
+	n, _ := io.ReadFull(f, head)
+	head = head[:n]
+
+	for _, sig := range signatures {
+		if bytes.HasPrefix(head, sig.magic) || (sig.anywhere && bytes.Contains(head, sig.magic)) {
+			return withContentFrom(byName(sig.typeName), t)
+		}
+	}
+	return t
+}
+
+// byName returns the registry entry for a type name, preferring the uncompressed form
+func byName(name string) Type {
+	var found Type
+	for _, t := range registry {
+		if t.Name == name {
+			found = t
+			if t.ContentEncoding == "" {
+				return t
+			}
+		}
+	}
+	return found
+}
+
+// withContentFrom keeps the artifact kind of detected but the content type of the extension
+// match, so a sniffed thread dump in a .txt file is still served as text
+func withContentFrom(detected, byExtension Type) Type {
+	if byExtension != Default {
+		detected.ContentType = byExtension.ContentType
+		detected.ContentEncoding = byExtension.ContentEncoding
+	}
+	return detected
+}
+
+// IsArtifact reports whether a file is a profiling artifact the daemon should upload
+func IsArtifact(path string) bool {
+	if strings.HasPrefix(filepath.Base(path), ".") {
+		return false // hidden scratch files, e.g. telemetry dumps in progress
+	}
+	return Detect(path).Prefix != ""
+}
+
+// Prefixes returns the distinct object prefixes of registered artifact types
+func Prefixes() []string {
+	var prefixes []string
+	for _, t := range registry {
+		if t.Prefix != "" && !slices.Contains(prefixes, t.Prefix) {
+			prefixes = append(prefixes, t.Prefix)
+		}
+	}
+	return prefixes
+}
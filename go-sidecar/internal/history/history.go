@@ -0,0 +1,181 @@
+package history
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Entry describes one completed upload
+type Entry struct {
+	Path        string    `json:"path"`
+	Pod         string    `json:"pod"`
+	Namespace   string    `json:"namespace,omitempty"`
+	Tenant      string    `json:"tenant,omitempty"`
+	Object      string    `json:"object"` // destination URI of the uploaded object
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256,omitempty"`
+	Modified    time.Time `json:"modified"` // when the file was last written
+	StartedAt   time.Time `json:"startedAt"`
+	CompletedAt time.Time `json:"completedAt"`
+	Duration    float64   `json:"durationSeconds"`
+}
+
+// Filter selects entries by completion time and pod; zero values match everything
+type Filter struct {
+	Since time.Time
+	Until time.Time
+	Pod   string
+}
+
+func (f Filter) match(e Entry) bool {
+	if !f.Since.IsZero() && e.CompletedAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.CompletedAt.Before(f.Until) {
+		return false
+	}
+	return f.Pod == "" || e.Pod == f.Pod
+}
+
+// Log keeps the most recent completed uploads, bounded by count and age. Entries are persisted
+// so a daemon restart does not lose the history.
+type Log struct {
+	mu        sync.Mutex
+	path      string
+	max       int
+	retention time.Duration
+	state     state
+}
+
+type state struct {
+	LastReport time.Time `json:"lastReport"`
+	Entries    []Entry   `json:"entries"`
+}
+
+// New loads persisted history from path (if present), keeping at most max entries no older
+// than retention (0 keeps entries of any age)
+func New(path string, max int, retention time.Duration) (*Log, error) {
+	l := &Log{path: path, max: max, retention: retention}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read upload history: %w", err)
+	default:
+		if err := json.Unmarshal(data, &l.state); err != nil {
+			return nil, fmt.Errorf("invalid upload history %s: %w", path, err)
+		}
+	}
+	l.trimLocked(time.Now())
+	return l, nil
+}
+
+// Add records a completed upload and persists the history
+func (l *Log) Add(e Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.state.Entries = append(l.state.Entries, e)
+	l.trimLocked(e.CompletedAt)
+	return l.saveLocked()
+}
+
+// Entries returns the entries matching f, oldest first
+func (l *Log) Entries(f Filter) []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.trimLocked(time.Now())
+	entries := []Entry{}
+	for _, e := range l.state.Entries {
+		if f.match(e) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// LastReport returns when the last periodic report was written
+func (l *Log) LastReport() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.state.LastReport
+}
+
+// SetLastReport records that a report covering everything until t was written
+func (l *Log) SetLastReport(t time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.state.LastReport = t
+	return l.saveLocked()
+}
+
+// trimLocked drops entries beyond the count limit or older than the retention
+func (l *Log) trimLocked(now time.Time) {
+	entries := l.state.Entries
+	if l.retention > 0 {
+		cutoff := now.Add(-l.retention)
+		i := 0
+		for i < len(entries) && entries[i].CompletedAt.Before(cutoff) {
+			i++
+		}
+		entries = entries[i:]
+	}
+	if l.max > 0 && len(entries) > l.max {
+		entries = entries[len(entries)-l.max:]
+	}
+	l.state.Entries = entries
+}
+
+// saveLocked writes the history atomically (write to a temporary file, then rename)
+func (l *Log) saveLocked() error {
+	data, err := json.Marshal(l.state)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(l.path), "."+filepath.Base(l.path)+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write upload history: %w", err)
+	}
+	return os.Rename(tmp, l.path)
+}
+
+// csvHeader names the columns written by WriteCSV
+var csvHeader = []string{
+	"completed_at", "started_at", "duration_seconds", "pod", "namespace", "tenant",
+	"path", "object", "size_bytes", "sha256", "modified",
+}
+
+// WriteCSV writes entries as CSV with a header row
+func WriteCSV(w io.Writer, entries []Entry) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		err := cw.Write([]string{
+			e.CompletedAt.UTC().Format(time.RFC3339),
+			e.StartedAt.UTC().Format(time.RFC3339),
+			strconv.FormatFloat(e.Duration, 'f', 3, 64),
+			e.Pod,
+			e.Namespace,
+			e.Tenant,
+			e.Path,
+			e.Object,
+			strconv.FormatInt(e.Size, 10),
+			e.SHA256,
+			e.Modified.UTC().Format(time.RFC3339),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
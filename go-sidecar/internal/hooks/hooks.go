@@ -0,0 +1,93 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/config"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+)
+
+const hookTimeout = 30 * time.Second
+
+// Run executes a hook target with the given variables.
+// Targets starting with http:// or https:// receive the variables as a JSON POST body;
+// anything else is executed directly (no shell) with the variables added to the allowlisted
+// environment child processes get (config.CommandEnv), so credentials never reach hook scripts.
+func Run(ctx context.Context, target string, vars map[string]string) error {
+	if target == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, hookTimeout)
+	defer cancel()
+
+	start := time.Now()
+	var err error
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		err = runWebhook(ctx, target, vars)
+	} else {
+		err = runCommand(ctx, target, vars)
+	}
+
+	logger.Log.WithFields(map[string]interface{}{
+		"hook":     target,
+		"duration": time.Since(start).String(),
+		"success":  err == nil,
+	}).Debug("Hook executed")
+
+	return err
+}
+
+// runCommand executes a hook script with vars exported as environment variables
+func runCommand(ctx context.Context, path string, vars map[string]string) error {
+	cmd := exec.CommandContext(ctx, path)
+	// Kill the whole process group on timeout so scripts cannot leave children running
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = 5 * time.Second
+	cmd.Env = config.CommandEnv()
+	for k, v := range vars {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("hook %s failed: %v, output: %s", path, err, string(output))
+	}
+	return nil
+}
+
+// runWebhook posts vars as a JSON object to the hook URL
+func runWebhook(ctx context.Context, url string, vars map[string]string) error {
+	body, err := json.Marshal(vars)
+	if err != nil {
+		return fmt.Errorf("failed to encode hook payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create hook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("hook %s failed: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("hook %s returned status %d", url, resp.StatusCode)
+	}
+	return nil
+}
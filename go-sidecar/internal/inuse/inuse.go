@@ -0,0 +1,97 @@
+package inuse
+
+import "sync"
+
+// Tracker coordinates access to local recording files between the API and the scanner when
+// both run in one process. The API holds a file while the JVM is still writing it or while it
+// is being served; the scanner skips held files and defers deleting them until released.
+// A nil *Tracker holds nothing, so components work unchanged without one.
+type Tracker struct {
+	mu      sync.Mutex
+	holds   map[string]int
+	removal map[string]func() // removals deferred until the path is released
+	idle    []func(path string)
+}
+
+// New returns a tracker holding no files
+func New() *Tracker {
+	return &Tracker{
+		holds:   map[string]int{},
+		removal: map[string]func(){},
+	}
+}
+
+// Acquire holds path until the returned function is called. Calling it more than once is harmless.
+func (t *Tracker) Acquire(path string) (release func()) {
+	if t == nil {
+		return func() {}
+	}
+	t.mu.Lock()
+	t.holds[path]++
+	t.mu.Unlock()
+
+	var once sync.Once
+	return func() { once.Do(func() { t.release(path) }) }
+}
+
+func (t *Tracker) release(path string) {
+	t.mu.Lock()
+	t.holds[path]--
+	if t.holds[path] > 0 {
+		t.mu.Unlock()
+		return
+	}
+	delete(t.holds, path)
+	remove, deferred := t.removal[path]
+	delete(t.removal, path)
+	idle := t.idle
+	if deferred {
+		// Still under the lock, so nobody acquires the file between release and removal
+		remove()
+	}
+	t.mu.Unlock()
+
+	if !deferred {
+		for _, fn := range idle {
+			fn(path)
+		}
+	}
+}
+
+// InUse reports whether path is currently held
+func (t *Tracker) InUse(path string) bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.holds[path] > 0
+}
+
+// RemoveWhenIdle calls remove now if path is not held and returns true; otherwise remove runs
+// when the last holder releases the path and RemoveWhenIdle returns false
+func (t *Tracker) RemoveWhenIdle(path string, remove func()) bool {
+	if t == nil {
+		remove()
+		return true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.holds[path] > 0 {
+		t.removal[path] = remove
+		return false
+	}
+	remove()
+	return true
+}
+
+// OnIdle registers fn to be called (outside the lock) whenever the last holder releases a path
+// that has no deferred removal, e.g. so the scanner can upload a recording as soon as it finishes
+func (t *Tracker) OnIdle(fn func(path string)) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.idle = append(t.idle, fn)
+}
@@ -0,0 +1,438 @@
+package jfr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	chunkHeaderSize = 68
+
+	metadataEventType     = 0
+	constantPoolEventType = 1
+
+	featureCompressedInts = 1
+)
+
+var magic = []byte{'F', 'L', 'R', 0}
+
+// Field describes a field of a JFR type
+type Field struct {
+	Name         string
+	TypeID       int64
+	ConstantPool bool
+	Array        bool
+}
+
+// Class describes a JFR type declared in the chunk metadata
+type Class struct {
+	ID        int64
+	Name      string
+	SuperType string
+	Fields    []Field
+}
+
+// Chunk is a single self-contained JFR chunk
+type Chunk struct {
+	Major, Minor   int
+	StartNanos     int64
+	DurationNanos  int64
+	StartTicks     int64
+	TicksPerSecond int64
+
+	classes      map[int64]*Class
+	pools        map[int64]map[int64]any
+	stringTypeID int64
+}
+
+// Duration converts a tick count to a duration
+func (c *Chunk) Duration(ticks int64) time.Duration {
+	if c.TicksPerSecond <= 0 {
+		return time.Duration(ticks)
+	}
+	return time.Duration(float64(ticks) * float64(time.Second) / float64(c.TicksPerSecond))
+}
+
+// Time converts a tick timestamp to wall-clock time
+func (c *Chunk) Time(ticks int64) time.Time {
+	return time.Unix(0, c.StartNanos).Add(c.Duration(ticks - c.StartTicks))
+}
+
+type poolRef struct {
+	typeID int64
+	index  int64
+}
+
+// resolve replaces constant-pool references with their values
+func (c *Chunk) resolve(v any) any {
+	for i := 0; i < 8; i++ { // bounded to guard against cyclic pools
+		ref, ok := v.(poolRef)
+		if !ok {
+			return v
+		}
+		v = c.pools[ref.typeID][ref.index]
+	}
+	return v
+}
+
+// ParseFile reads every chunk of a recording and calls fn for each event
+func ParseFile(path string, fn func(*Event) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open recording: %w", err)
+	}
+	defer f.Close()
+
+	return Parse(f, fn)
+}
+
+// Parse reads every chunk from r and calls fn for each event
+func Parse(r io.Reader, fn func(*Event) error) error {
+	for {
+		header := make([]byte, chunkHeaderSize)
+		if _, err := io.ReadFull(r, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("failed to read chunk header: %w", err)
+		}
+
+		if string(header[:4]) != string(magic) {
+			return fmt.Errorf("not a JFR file (bad magic)")
+		}
+
+		size := int64(binary.BigEndian.Uint64(header[8:16]))
+		if size < chunkHeaderSize {
+			return fmt.Errorf("invalid chunk size %d", size)
+		}
+
+		// Grow with the data read rather than trusting size up front, so a corrupt header fails
+		// with a short read instead of a huge allocation
+		buf := bytes.NewBuffer(header)
+		if _, err := io.CopyN(buf, r, size-chunkHeaderSize); err != nil {
+			return fmt.Errorf("failed to read chunk: %w", err)
+		}
+
+		if err := parseChunk(buf.Bytes(), fn); err != nil {
+			return err
+		}
+	}
+}
+
+// parseChunk decodes metadata and constant pools, then emits events in file order
+func parseChunk(buf []byte, fn func(*Event) error) error {
+	c := &Chunk{
+		Major:          int(binary.BigEndian.Uint16(buf[4:6])),
+		Minor:          int(binary.BigEndian.Uint16(buf[6:8])),
+		StartNanos:     int64(binary.BigEndian.Uint64(buf[32:40])),
+		DurationNanos:  int64(binary.BigEndian.Uint64(buf[40:48])),
+		StartTicks:     int64(binary.BigEndian.Uint64(buf[48:56])),
+		TicksPerSecond: int64(binary.BigEndian.Uint64(buf[56:64])),
+		pools:          map[int64]map[int64]any{},
+	}
+	cpOffset := int64(binary.BigEndian.Uint64(buf[16:24]))
+	metaOffset := int64(binary.BigEndian.Uint64(buf[24:32]))
+	features := binary.BigEndian.Uint32(buf[64:68])
+
+	r := &reader{buf: buf, compressed: c.Major >= 2 || features&featureCompressedInts != 0}
+
+	if err := c.readMetadata(r, metaOffset); err != nil {
+		return fmt.Errorf("failed to read metadata: %w", err)
+	}
+	if err := c.readConstantPools(r, cpOffset); err != nil {
+		return fmt.Errorf("failed to read constant pools: %w", err)
+	}
+
+	pos := int64(chunkHeaderSize)
+	for pos < int64(len(buf)) {
+		r.pos = int(pos)
+		size, err := r.i32()
+		if err != nil {
+			return err
+		}
+		if size <= 0 || size > int64(len(buf))-pos {
+			return fmt.Errorf("invalid event size %d at offset %d", size, pos)
+		}
+		typeID, err := r.i64()
+		if err != nil {
+			return err
+		}
+
+		if typeID != metadataEventType && typeID != constantPoolEventType {
+			if cls, ok := c.classes[typeID]; ok {
+				event := &reader{buf: buf[:pos+size], pos: r.pos, compressed: r.compressed}
+				v, err := c.readValue(event, cls)
+				if err != nil {
+					return fmt.Errorf("failed to read %s event: %w", cls.Name, err)
+				}
+				if obj, ok := v.(*Object); ok {
+					if err := fn(obj); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		pos += size
+	}
+	return nil
+}
+
+// element is a node of the metadata tree
+type element struct {
+	name     string
+	attrs    map[string]string
+	children []*element
+}
+
+// readMetadata decodes the metadata event describing all types in the chunk
+func (c *Chunk) readMetadata(r *reader, offset int64) error {
+	if offset < chunkHeaderSize || offset >= int64(len(r.buf)) {
+		return fmt.Errorf("invalid metadata offset %d in a %d-byte chunk", offset, len(r.buf))
+	}
+	r.pos = int(offset)
+	// size, type, start time, duration, metadata id
+	for i := 0; i < 5; i++ {
+		if _, err := r.i64(); err != nil {
+			return err
+		}
+	}
+
+	n, err := r.count()
+	if err != nil {
+		return err
+	}
+	strs := make([]string, n)
+	for i := range strs {
+		v, err := r.string(0)
+		if err != nil {
+			return err
+		}
+		strs[i], _ = v.(string)
+	}
+
+	root, err := readElement(r, strs, 0)
+	if err != nil {
+		return err
+	}
+
+	c.classes = map[int64]*Class{}
+	collectClasses(root, c.classes)
+	for id, cls := range c.classes {
+		if cls.Name == "java.lang.String" {
+			c.stringTypeID = id
+		}
+	}
+	return nil
+}
+
+func readElement(r *reader, strs []string, depth int) (*element, error) {
+	if depth > 32 {
+		return nil, fmt.Errorf("metadata nesting too deep")
+	}
+	lookup := func() (string, error) {
+		idx, err := r.i32()
+		if err != nil {
+			return "", err
+		}
+		if idx < 0 || idx >= int64(len(strs)) {
+			return "", fmt.Errorf("invalid metadata string index %d", idx)
+		}
+		return strs[idx], nil
+	}
+
+	name, err := lookup()
+	if err != nil {
+		return nil, err
+	}
+	e := &element{name: name, attrs: map[string]string{}}
+
+	attrCount, err := r.count()
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < attrCount; i++ {
+		k, err := lookup()
+		if err != nil {
+			return nil, err
+		}
+		v, err := lookup()
+		if err != nil {
+			return nil, err
+		}
+		e.attrs[k] = v
+	}
+
+	childCount, err := r.count()
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < childCount; i++ {
+		child, err := readElement(r, strs, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		e.children = append(e.children, child)
+	}
+	return e, nil
+}
+
+func collectClasses(e *element, classes map[int64]*Class) {
+	if e.name == "class" {
+		id, err := strconv.ParseInt(e.attrs["id"], 10, 64)
+		if err == nil {
+			cls := &Class{ID: id, Name: e.attrs["name"], SuperType: e.attrs["superType"]}
+			for _, child := range e.children {
+				if child.name != "field" {
+					continue
+				}
+				typeID, _ := strconv.ParseInt(child.attrs["class"], 10, 64)
+				cls.Fields = append(cls.Fields, Field{
+					Name:         child.attrs["name"],
+					TypeID:       typeID,
+					ConstantPool: child.attrs["constantPool"] == "true",
+					Array:        child.attrs["dimension"] == "1",
+				})
+			}
+			classes[id] = cls
+		}
+	}
+	for _, child := range e.children {
+		collectClasses(child, classes)
+	}
+}
+
+// readConstantPools follows the chain of constant pool events backwards from offset; an offset of
+// 0 means the chunk has none
+func (c *Chunk) readConstantPools(r *reader, offset int64) error {
+	for visited := 0; offset != 0 && visited < 10000; visited++ {
+		if offset < chunkHeaderSize || offset >= int64(len(r.buf)) {
+			return fmt.Errorf("invalid constant pool offset %d in a %d-byte chunk", offset, len(r.buf))
+		}
+		r.pos = int(offset)
+		// size, type, start time, duration
+		for i := 0; i < 4; i++ {
+			if _, err := r.i64(); err != nil {
+				return err
+			}
+		}
+		delta, err := r.i64()
+		if err != nil {
+			return err
+		}
+		if _, err := r.byte(); err != nil { // flush / type mask
+			return err
+		}
+
+		poolCount, err := r.count()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < poolCount; i++ {
+			typeID, err := r.i64()
+			if err != nil {
+				return err
+			}
+			cls, ok := c.classes[typeID]
+			if !ok {
+				return fmt.Errorf("constant pool for unknown type %d", typeID)
+			}
+			n, err := r.count()
+			if err != nil {
+				return err
+			}
+			pool := c.pools[typeID]
+			if pool == nil {
+				pool = map[int64]any{}
+				c.pools[typeID] = pool
+			}
+			for j := 0; j < n; j++ {
+				idx, err := r.i64()
+				if err != nil {
+					return err
+				}
+				v, err := c.readValue(r, cls)
+				if err != nil {
+					return fmt.Errorf("failed to read %s constant: %w", cls.Name, err)
+				}
+				pool[idx] = v
+			}
+		}
+
+		if delta == 0 {
+			return nil
+		}
+		offset += delta
+	}
+	return nil
+}
+
+// readValue decodes a value of the given type
+func (c *Chunk) readValue(r *reader, cls *Class) (any, error) {
+	switch cls.Name {
+	case "boolean":
+		b, err := r.byte()
+		return b != 0, err
+	case "byte":
+		b, err := r.byte()
+		return int64(int8(b)), err
+	case "char", "short":
+		return r.i16()
+	case "int":
+		return r.i32()
+	case "long":
+		return r.i64()
+	case "float":
+		return r.f32()
+	case "double":
+		return r.f64()
+	case "java.lang.String":
+		return r.string(c.stringTypeID)
+	}
+
+	obj := &Object{Class: cls, chunk: c, values: make([]any, len(cls.Fields))}
+	for i, f := range cls.Fields {
+		if f.Array {
+			n, err := r.count()
+			if err != nil {
+				return nil, err
+			}
+			arr := make([]any, n)
+			for j := range arr {
+				if arr[j], err = c.readField(r, f); err != nil {
+					return nil, err
+				}
+			}
+			obj.values[i] = arr
+			continue
+		}
+
+		v, err := c.readField(r, f)
+		if err != nil {
+			return nil, err
+		}
+		obj.values[i] = v
+	}
+	return obj, nil
+}
+
+func (c *Chunk) readField(r *reader, f Field) (any, error) {
+	if f.ConstantPool {
+		idx, err := r.i64()
+		if err != nil {
+			return nil, err
+		}
+		return poolRef{typeID: f.TypeID, index: idx}, nil
+	}
+
+	cls, ok := c.classes[f.TypeID]
+	if !ok {
+		return nil, fmt.Errorf("field %s has unknown type %d", f.Name, f.TypeID)
+	}
+	return c.readValue(r, cls)
+}
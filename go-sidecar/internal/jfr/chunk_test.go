@@ -0,0 +1,101 @@
+package jfr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// testRecording writes a chunk with a constant-pool string, a nested stack trace and two events
+func testRecording(t *testing.T) []byte {
+	t.Helper()
+	start := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+	w := NewWriter(start)
+	w.DefineType("java.lang.Thread", "", FieldSpec{Name: "javaName", Type: "java.lang.String"})
+	w.DefineType("jdk.types.StackFrame", "", FieldSpec{Name: "lineNumber", Type: "int"})
+	w.DefineType("jdk.types.StackTrace", "",
+		FieldSpec{Name: "truncated", Type: "boolean"},
+		FieldSpec{Name: "frames", Type: "jdk.types.StackFrame", Array: true})
+	w.DefineType("jdk.ExecutionSample", "jdk.jfr.Event",
+		FieldSpec{Name: "startTime", Type: "long"},
+		FieldSpec{Name: "sampledThread", Type: "java.lang.Thread", ConstantPool: true},
+		FieldSpec{Name: "stackTrace", Type: "jdk.types.StackTrace", ConstantPool: true})
+
+	thread := w.Constant("java.lang.Thread", "main")
+	stack := w.Constant("jdk.types.StackTrace", false, []any{[]any{int64(42)}, []any{int64(7)}})
+	w.Event("jdk.ExecutionSample", w.Ticks(start.Add(time.Second)), thread, stack)
+	w.Event("jdk.ExecutionSample", w.Ticks(start.Add(2*time.Second)), thread, stack)
+	return w.Bytes()
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	data := testRecording(t)
+
+	var events []*Event
+	if err := Parse(bytes.NewReader(data), func(e *Event) error {
+		events = append(events, e)
+		return nil
+	}); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	e := events[1]
+	if got := e.Type(); got != "jdk.ExecutionSample" {
+		t.Errorf("Type() = %q, want jdk.ExecutionSample", got)
+	}
+	if got, want := e.StartTime(), time.Date(2026, 1, 15, 10, 0, 2, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("StartTime() = %s, want %s", got, want)
+	}
+	if got := e.Object("sampledThread").String("javaName"); got != "main" {
+		t.Errorf("thread name = %q, want main", got)
+	}
+	frames := e.Object("stackTrace").Array("frames")
+	if len(frames) != 2 {
+		t.Fatalf("got %d frames, want 2", len(frames))
+	}
+	if got := frames[0].(*Object).Int("lineNumber"); got != 42 {
+		t.Errorf("first frame line = %d, want 42", got)
+	}
+}
+
+func TestParseRejectsCorruptChunks(t *testing.T) {
+	valid := testRecording(t)
+	corrupt := func(edit func([]byte) []byte) []byte {
+		return edit(bytes.Clone(valid))
+	}
+	offset := func(at int, v uint64) func([]byte) []byte {
+		return func(b []byte) []byte {
+			binary.BigEndian.PutUint64(b[at:at+8], v)
+			return b
+		}
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"negative metadata offset", corrupt(offset(24, 1<<63))},
+		{"metadata offset past the chunk", corrupt(offset(24, uint64(len(valid))))},
+		{"metadata offset in the header", corrupt(offset(24, 8))},
+		{"negative constant pool offset", corrupt(offset(16, 1<<63|5))},
+		{"constant pool offset past the chunk", corrupt(offset(16, 1<<40))},
+		{"huge chunk size", corrupt(offset(8, 1<<62))},
+		{"truncated chunk", valid[:len(valid)-10]},
+		{"oversized event", corrupt(func(b []byte) []byte {
+			b[chunkHeaderSize] = 0x7f // first event claims 127 bytes, past the events
+			return b
+		})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Parse(bytes.NewReader(tt.data), func(*Event) error { return nil })
+			if err == nil {
+				t.Fatal("Parse succeeded, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package jfr
+
+import "time"
+
+// Object is a decoded JFR value of a composite type (events, stack traces, methods, ...)
+type Object struct {
+	Class  *Class
+	chunk  *Chunk
+	values []any
+}
+
+// Event is a top-level JFR event
+type Event = Object
+
+// Type returns the JFR type name, e.g. "jdk.GarbageCollection"
+func (o *Object) Type() string {
+	if o == nil {
+		return ""
+	}
+	return o.Class.Name
+}
+
+// Chunk returns the chunk the object was read from
+func (o *Object) Chunk() *Chunk {
+	return o.chunk
+}
+
+// Get returns the named field with constant-pool references resolved, or nil
+func (o *Object) Get(name string) any {
+	if o == nil {
+		return nil
+	}
+	for i, f := range o.Class.Fields {
+		if f.Name == name {
+			return o.chunk.resolve(o.values[i])
+		}
+	}
+	return nil
+}
+
+// Int returns an integer field, or 0
+func (o *Object) Int(name string) int64 {
+	v, _ := unwrap(o.Get(name)).(int64)
+	return v
+}
+
+// Float returns a floating-point field (integers are converted), or 0
+func (o *Object) Float(name string) float64 {
+	switch v := unwrap(o.Get(name)).(type) {
+	case float64:
+		return v
+	case int64:
+		return float64(v)
+	}
+	return 0
+}
+
+// Bool returns a boolean field, or false
+func (o *Object) Bool(name string) bool {
+	v, _ := unwrap(o.Get(name)).(bool)
+	return v
+}
+
+// String returns a string field; symbol-like wrapper objects are unwrapped
+func (o *Object) String(name string) string {
+	v, _ := unwrap(o.Get(name)).(string)
+	return v
+}
+
+// Object returns a composite field, or nil
+func (o *Object) Object(name string) *Object {
+	v, _ := o.Get(name).(*Object)
+	return v
+}
+
+// Array returns an array field with elements resolved
+func (o *Object) Array(name string) []any {
+	arr, _ := o.Get(name).([]any)
+	out := make([]any, len(arr))
+	for i, v := range arr {
+		out[i] = o.chunk.resolve(v)
+	}
+	return out
+}
+
+// Duration returns a tick-valued timespan field as a duration
+func (o *Object) Duration(name string) time.Duration {
+	return o.chunk.Duration(o.Int(name))
+}
+
+// StartTime returns the event start time
+func (o *Object) StartTime() time.Time {
+	return o.chunk.Time(o.Int("startTime"))
+}
+
+// unwrap returns the value of single-field wrapper types such as jdk.types.Symbol
+func unwrap(v any) any {
+	for i := 0; i < 4; i++ {
+		obj, ok := v.(*Object)
+		if !ok || len(obj.values) != 1 {
+			return v
+		}
+		v = obj.chunk.resolve(obj.values[0])
+	}
+	return v
+}
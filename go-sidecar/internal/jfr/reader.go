@@ -0,0 +1,188 @@
+package jfr
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"unicode/utf8"
+)
+
+var errShortBuffer = errors.New("unexpected end of chunk data")
+
+// reader decodes JFR primitive values from a chunk buffer. Positions come from untrusted chunk
+// headers and sizes, so every read is bounds-checked in both directions.
+type reader struct {
+	buf        []byte
+	pos        int
+	compressed bool // LEB128-style compressed integers (JDK 11+ default)
+}
+
+func (r *reader) byte() (byte, error) {
+	if r.pos < 0 || r.pos >= len(r.buf) {
+		return 0, errShortBuffer
+	}
+	b := r.buf[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *reader) bytes(n int) ([]byte, error) {
+	if n < 0 || r.pos < 0 || n > len(r.buf)-r.pos {
+		return nil, errShortBuffer
+	}
+	b := r.buf[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+// varint reads a JFR compressed integer: 7 bits per byte for up to 8 bytes, then a full 9th byte
+func (r *reader) varint() (int64, error) {
+	var v uint64
+	for i := 0; i < 8; i++ {
+		b, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		v |= uint64(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			return int64(v), nil
+		}
+	}
+	b, err := r.byte()
+	if err != nil {
+		return 0, err
+	}
+	v |= uint64(b) << 56
+	return int64(v), nil
+}
+
+func (r *reader) i16() (int64, error) {
+	if r.compressed {
+		return r.varint()
+	}
+	b, err := r.bytes(2)
+	if err != nil {
+		return 0, err
+	}
+	return int64(int16(binary.BigEndian.Uint16(b))), nil
+}
+
+func (r *reader) i32() (int64, error) {
+	if r.compressed {
+		return r.varint()
+	}
+	b, err := r.bytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return int64(int32(binary.BigEndian.Uint32(b))), nil
+}
+
+func (r *reader) i64() (int64, error) {
+	if r.compressed {
+		return r.varint()
+	}
+	b, err := r.bytes(8)
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(b)), nil
+}
+
+// count reads a non-negative int used as a length, bounded by the remaining buffer
+func (r *reader) count() (int, error) {
+	n, err := r.i32()
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 || n > int64(len(r.buf)) {
+		return 0, fmt.Errorf("invalid count %d", n)
+	}
+	return int(n), nil
+}
+
+func (r *reader) f32() (float64, error) {
+	b, err := r.bytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+}
+
+func (r *reader) f64() (float64, error) {
+	b, err := r.bytes(8)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+}
+
+// String encodings used by JFR
+const (
+	stringNull      = 0
+	stringEmpty     = 1
+	stringPool      = 2
+	stringUTF8      = 3
+	stringCharArray = 4
+	stringLatin1    = 5
+)
+
+// string reads an encoded string; constant-pool references are returned as poolRef
+func (r *reader) string(stringTypeID int64) (any, error) {
+	enc, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch enc {
+	case stringNull, stringEmpty:
+		return "", nil
+	case stringPool:
+		idx, err := r.i64()
+		if err != nil {
+			return nil, err
+		}
+		return poolRef{typeID: stringTypeID, index: idx}, nil
+	case stringUTF8:
+		n, err := r.count()
+		if err != nil {
+			return nil, err
+		}
+		b, err := r.bytes(n)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case stringCharArray:
+		n, err := r.count()
+		if err != nil {
+			return nil, err
+		}
+		runes := make([]rune, n)
+		for i := range runes {
+			c, err := r.i16()
+			if err != nil {
+				return nil, err
+			}
+			runes[i] = rune(uint16(c))
+		}
+		return string(runes), nil
+	case stringLatin1:
+		n, err := r.count()
+		if err != nil {
+			return nil, err
+		}
+		b, err := r.bytes(n)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]byte, 0, n)
+		for _, c := range b {
+			out = utf8.AppendRune(out, rune(c))
+		}
+		return string(out), nil
+	default:
+		return nil, fmt.Errorf("unknown string encoding %d", enc)
+	}
+}
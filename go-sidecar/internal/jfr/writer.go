@@ -0,0 +1,277 @@
+package jfr
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Writer builds a single-chunk JFR recording in memory. It supports the subset of the
+// format needed to produce realistic synthetic recordings (simulation mode): composite
+// types, arrays, constant pools and UTF-8 strings, with compressed integers.
+type Writer struct {
+	start   time.Time
+	classes []*Class
+	byName  map[string]*Class
+	events  []byte
+	pools   map[int64][]poolEntry
+	nextIdx map[int64]int64
+}
+
+type poolEntry struct {
+	index int64
+	value []any
+}
+
+// NewWriter creates a writer for a chunk starting at start
+func NewWriter(start time.Time) *Writer {
+	w := &Writer{
+		start:   start,
+		byName:  map[string]*Class{},
+		pools:   map[int64][]poolEntry{},
+		nextIdx: map[int64]int64{},
+	}
+	for _, name := range []string{"boolean", "byte", "char", "short", "int", "long", "float", "double", "java.lang.String"} {
+		w.DefineType(name, "")
+	}
+	return w
+}
+
+// FieldSpec declares a field for DefineType; Type names a previously defined type
+type FieldSpec struct {
+	Name         string
+	Type         string
+	ConstantPool bool
+	Array        bool
+}
+
+// DefineType declares a type; events should use superType "jdk.jfr.Event"
+func (w *Writer) DefineType(name, superType string, fields ...FieldSpec) *Class {
+	cls := &Class{ID: int64(len(w.classes) + 100), Name: name, SuperType: superType}
+	for _, f := range fields {
+		cls.Fields = append(cls.Fields, Field{
+			Name:         f.Name,
+			TypeID:       w.byName[f.Type].ID,
+			ConstantPool: f.ConstantPool,
+			Array:        f.Array,
+		})
+	}
+	w.classes = append(w.classes, cls)
+	w.byName[name] = cls
+	return cls
+}
+
+// Constant adds a constant pool entry for typeName and returns its index.
+// Values are given in field order; constant-pool fields take the referenced index.
+func (w *Writer) Constant(typeName string, values ...any) int64 {
+	cls := w.byName[typeName]
+	w.nextIdx[cls.ID]++
+	idx := w.nextIdx[cls.ID]
+	w.pools[cls.ID] = append(w.pools[cls.ID], poolEntry{index: idx, value: values})
+	return idx
+}
+
+// Ticks converts a wall-clock time to chunk ticks (nanosecond resolution)
+func (w *Writer) Ticks(t time.Time) int64 {
+	return t.Sub(w.start).Nanoseconds()
+}
+
+// Event appends an event of typeName; values are given in field order
+func (w *Writer) Event(typeName string, values ...any) {
+	cls := w.byName[typeName]
+	var body []byte
+	body = appendVarint(body, cls.ID)
+	body = w.appendFields(body, cls, values)
+	w.events = appendSized(w.events, body)
+}
+
+// Bytes encodes the chunk
+func (w *Writer) Bytes() []byte {
+	out := make([]byte, chunkHeaderSize)
+	out = append(out, w.events...)
+
+	cpOffset := len(out)
+	out = appendSized(out, w.constantPoolBody())
+
+	metaOffset := len(out)
+	out = appendSized(out, w.metadataBody())
+
+	copy(out[0:4], magic)
+	binary.BigEndian.PutUint16(out[4:6], 2)
+	binary.BigEndian.PutUint16(out[6:8], 1)
+	binary.BigEndian.PutUint64(out[8:16], uint64(len(out)))
+	binary.BigEndian.PutUint64(out[16:24], uint64(cpOffset))
+	binary.BigEndian.PutUint64(out[24:32], uint64(metaOffset))
+	binary.BigEndian.PutUint64(out[32:40], uint64(w.start.UnixNano()))
+	binary.BigEndian.PutUint64(out[40:48], uint64(time.Since(w.start).Nanoseconds()))
+	binary.BigEndian.PutUint64(out[48:56], 0)
+	binary.BigEndian.PutUint64(out[56:64], uint64(time.Second))
+	binary.BigEndian.PutUint32(out[64:68], featureCompressedInts)
+	return out
+}
+
+func (w *Writer) appendFields(b []byte, cls *Class, values []any) []byte {
+	for i, f := range cls.Fields {
+		var v any
+		if i < len(values) {
+			v = values[i]
+		}
+		if f.Array {
+			arr, _ := v.([]any)
+			b = appendVarint(b, int64(len(arr)))
+			for _, item := range arr {
+				b = w.appendValue(b, f, item)
+			}
+			continue
+		}
+		b = w.appendValue(b, f, v)
+	}
+	return b
+}
+
+func (w *Writer) appendValue(b []byte, f Field, v any) []byte {
+	if f.ConstantPool {
+		idx, _ := v.(int64)
+		return appendVarint(b, idx)
+	}
+
+	cls := w.classes[f.TypeID-100]
+	switch cls.Name {
+	case "boolean":
+		if v == true {
+			return append(b, 1)
+		}
+		return append(b, 0)
+	case "byte":
+		n, _ := v.(int64)
+		return append(b, byte(n))
+	case "char", "short", "int", "long":
+		n, _ := v.(int64)
+		return appendVarint(b, n)
+	case "float":
+		x, _ := v.(float64)
+		return binary.BigEndian.AppendUint32(b, math.Float32bits(float32(x)))
+	case "double":
+		x, _ := v.(float64)
+		return binary.BigEndian.AppendUint64(b, math.Float64bits(x))
+	case "java.lang.String":
+		return appendString(b, v.(string))
+	default:
+		values, _ := v.([]any)
+		return w.appendFields(b, cls, values)
+	}
+}
+
+func (w *Writer) constantPoolBody() []byte {
+	var b []byte
+	b = appendVarint(b, constantPoolEventType)
+	b = appendVarint(b, 0) // start time
+	b = appendVarint(b, 0) // duration
+	b = appendVarint(b, 0) // delta to previous pool
+	b = append(b, 1)       // flush
+
+	ids := make([]int64, 0, len(w.pools))
+	for id := range w.pools {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	b = appendVarint(b, int64(len(ids)))
+	for _, id := range ids {
+		cls := w.classes[id-100]
+		b = appendVarint(b, id)
+		b = appendVarint(b, int64(len(w.pools[id])))
+		for _, e := range w.pools[id] {
+			b = appendVarint(b, e.index)
+			b = w.appendFields(b, cls, e.value)
+		}
+	}
+	return b
+}
+
+func (w *Writer) metadataBody() []byte {
+	strs := []string{}
+	index := map[string]int64{}
+	intern := func(s string) int64 {
+		if i, ok := index[s]; ok {
+			return i
+		}
+		index[s] = int64(len(strs))
+		strs = append(strs, s)
+		return index[s]
+	}
+
+	var tree []byte
+	writeElement := func(name string, attrs [][2]string, children int) {
+		tree = appendVarint(tree, intern(name))
+		tree = appendVarint(tree, int64(len(attrs)))
+		for _, a := range attrs {
+			tree = appendVarint(tree, intern(a[0]))
+			tree = appendVarint(tree, intern(a[1]))
+		}
+		tree = appendVarint(tree, int64(children))
+	}
+
+	writeElement("root", nil, 2)
+	writeElement("metadata", nil, len(w.classes))
+	for _, cls := range w.classes {
+		attrs := [][2]string{{"id", strconv.FormatInt(cls.ID, 10)}, {"name", cls.Name}}
+		if cls.SuperType != "" {
+			attrs = append(attrs, [2]string{"superType", cls.SuperType})
+		}
+		writeElement("class", attrs, len(cls.Fields))
+		for _, f := range cls.Fields {
+			fattrs := [][2]string{{"name", f.Name}, {"class", strconv.FormatInt(f.TypeID, 10)}}
+			if f.ConstantPool {
+				fattrs = append(fattrs, [2]string{"constantPool", "true"})
+			}
+			if f.Array {
+				fattrs = append(fattrs, [2]string{"dimension", "1"})
+			}
+			writeElement("field", fattrs, 0)
+		}
+	}
+	writeElement("region", nil, 0)
+
+	var b []byte
+	b = appendVarint(b, metadataEventType)
+	b = appendVarint(b, 0) // start time
+	b = appendVarint(b, 0) // duration
+	b = appendVarint(b, 1) // metadata id
+	b = appendVarint(b, int64(len(strs)))
+	for _, s := range strs {
+		b = appendString(b, s)
+	}
+	return append(b, tree...)
+}
+
+// appendSized prefixes body with its total size (including the size field itself)
+func appendSized(b, body []byte) []byte {
+	// A fixed 4-byte padded varint keeps the size field length independent of its value
+	size := len(body) + 4
+	return append(append(b,
+		byte(size)|0x80, byte(size>>7)|0x80, byte(size>>14)|0x80, byte(size>>21)&0x7f), body...)
+}
+
+func appendVarint(b []byte, v int64) []byte {
+	u := uint64(v)
+	for i := 0; i < 8; i++ {
+		if u < 0x80 {
+			return append(b, byte(u))
+		}
+		b = append(b, byte(u)|0x80)
+		u >>= 7
+	}
+	return append(b, byte(u))
+}
+
+func appendString(b []byte, s string) []byte {
+	if s == "" {
+		return append(b, stringEmpty)
+	}
+	b = append(b, stringUTF8)
+	b = appendVarint(b, int64(len(s)))
+	return append(b, s...)
+}
@@ -0,0 +1,197 @@
+// Package jfrconv converts JFR recordings to other profile formats. Convert turns the
+// execution samples of a recording into a pprof profile, so JFR CPU profiles open in
+// `go tool pprof` and the tools built around it.
+package jfrconv
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/jfr"
+)
+
+// ErrNoSamples is returned for recordings without execution samples, e.g. ones recorded with
+// method profiling switched off
+var ErrNoSamples = errors.New("recording has no execution samples")
+
+// executionSample is the JFR event of a sampled Java thread; async-profiler writes it too
+const executionSample = "jdk.ExecutionSample"
+
+// Summary describes a converted profile
+type Summary struct {
+	Samples   int           `json:"samples"`
+	Stacks    int           `json:"stacks"` // distinct stack and thread combinations
+	Functions int           `json:"functions"`
+	Start     time.Time     `json:"start"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// ConvertFile converts the recording at path, a .jfr or gzipped .jfr.gz file, see Convert
+func ConvertFile(path string, w io.Writer) (Summary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Summary{}, err
+	}
+	defer f.Close()
+	if !strings.HasSuffix(path, ".gz") {
+		return Convert(f, w)
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return Summary{}, err
+	}
+	return Convert(gz, w)
+}
+
+// Convert reads a JFR recording from r and writes its execution samples to w as a gzipped
+// pprof profile with one "samples/count" value per stack. Samples carry the sampled thread's
+// name as the "thread" label.
+func Convert(r io.Reader, w io.Writer) (Summary, error) {
+	b := newBuilder()
+	err := jfr.Parse(r, func(e *jfr.Event) error {
+		if e.Type() == executionSample {
+			b.add(e)
+		}
+		return nil
+	})
+	if err != nil {
+		return Summary{}, err
+	}
+	if b.samples == 0 {
+		return Summary{}, ErrNoSamples
+	}
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(b.encode()); err != nil {
+		return Summary{}, err
+	}
+	if err := gz.Close(); err != nil {
+		return Summary{}, err
+	}
+	return b.summary(), nil
+}
+
+// sample is a distinct stack (leaf first) and thread with its sample count
+type sample struct {
+	locations []uint64
+	thread    int64 // string table index
+	count     int64
+}
+
+// builder accumulates samples into pprof's tables
+type builder struct {
+	strings   []string
+	stringIDs map[string]int64
+
+	functions   []function
+	functionIDs map[string]uint64
+
+	locations   []location
+	locationIDs map[location]uint64
+
+	stacks     []*sample
+	stackIndex map[string]*sample
+
+	samples    int
+	start, end time.Time
+}
+
+type function struct {
+	name int64
+}
+
+type location struct {
+	function uint64
+	line     int64
+}
+
+func newBuilder() *builder {
+	return &builder{
+		strings:     []string{""}, // pprof reserves index 0 for the empty string
+		stringIDs:   map[string]int64{"": 0},
+		functionIDs: map[string]uint64{},
+		locationIDs: map[location]uint64{},
+		stackIndex:  map[string]*sample{},
+	}
+}
+
+// add records one execution sample
+func (b *builder) add(e *jfr.Event) {
+	thread := b.string(e.Object("sampledThread").String("javaName"))
+	key := binary.AppendUvarint(nil, uint64(thread))
+	var locations []uint64
+	for _, f := range e.Object("stackTrace").Array("frames") {
+		frame, ok := f.(*jfr.Object)
+		if !ok {
+			continue
+		}
+		id := b.location(frame)
+		locations = append(locations, id)
+		key = binary.AppendUvarint(key, id)
+	}
+
+	s, ok := b.stackIndex[string(key)]
+	if !ok {
+		s = &sample{locations: locations, thread: thread}
+		b.stackIndex[string(key)] = s
+		b.stacks = append(b.stacks, s)
+	}
+	s.count++
+	b.samples++
+
+	t := e.StartTime()
+	if b.start.IsZero() || t.Before(b.start) {
+		b.start = t
+	}
+	if t.After(b.end) {
+		b.end = t
+	}
+}
+
+// location returns the ID of a frame's method and line, adding it on first use
+func (b *builder) location(frame *jfr.Object) uint64 {
+	method := frame.Object("method")
+	class := strings.ReplaceAll(method.Object("type").String("name"), "/", ".")
+	name := class + "." + method.String("name")
+	fn, ok := b.functionIDs[name]
+	if !ok {
+		b.functions = append(b.functions, function{name: b.string(name)})
+		fn = uint64(len(b.functions))
+		b.functionIDs[name] = fn
+	}
+
+	loc := location{function: fn, line: frame.Int("lineNumber")}
+	id, ok := b.locationIDs[loc]
+	if !ok {
+		b.locations = append(b.locations, loc)
+		id = uint64(len(b.locations))
+		b.locationIDs[loc] = id
+	}
+	return id
+}
+
+// string returns the string table index of s, adding it on first use
+func (b *builder) string(s string) int64 {
+	if id, ok := b.stringIDs[s]; ok {
+		return id
+	}
+	b.strings = append(b.strings, s)
+	id := int64(len(b.strings) - 1)
+	b.stringIDs[s] = id
+	return id
+}
+
+func (b *builder) summary() Summary {
+	return Summary{
+		Samples:   b.samples,
+		Stacks:    len(b.stacks),
+		Functions: len(b.functions),
+		Start:     b.start,
+		Duration:  b.end.Sub(b.start),
+	}
+}
@@ -0,0 +1,104 @@
+package jfrconv
+
+import "encoding/binary"
+
+// Field numbers of profile.proto (github.com/google/pprof/proto/profile.proto)
+const (
+	profileSampleType    = 1
+	profileSample        = 2
+	profileLocation      = 4
+	profileFunction      = 5
+	profileStringTable   = 6
+	profileTimeNanos     = 9
+	profileDurationNanos = 10
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+	sampleLabel      = 3
+
+	labelKey = 1
+	labelStr = 2
+
+	locationID   = 1
+	locationLine = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID         = 1
+	functionName       = 2
+	functionSystemName = 3
+)
+
+// message is a protobuf message being encoded
+type message []byte
+
+func (m *message) varint(field int, v uint64) {
+	*m = binary.AppendUvarint(*m, uint64(field)<<3)
+	*m = binary.AppendUvarint(*m, v)
+}
+
+// int64 writes a non-zero value; zero is the default and omitted
+func (m *message) int64(field int, v int64) {
+	if v != 0 {
+		m.varint(field, uint64(v))
+	}
+}
+
+func (m *message) bytes(field int, data []byte) {
+	*m = binary.AppendUvarint(*m, uint64(field)<<3|2)
+	*m = binary.AppendUvarint(*m, uint64(len(data)))
+	*m = append(*m, data...)
+}
+
+func (m *message) packed(field int, vs []uint64) {
+	var data []byte
+	for _, v := range vs {
+		data = binary.AppendUvarint(data, v)
+	}
+	m.bytes(field, data)
+}
+
+// encode serializes the profile
+func (b *builder) encode() []byte {
+	var p message
+	threadKey := b.string("thread")
+	var valueType message
+	valueType.int64(valueTypeType, b.string("samples"))
+	valueType.int64(valueTypeUnit, b.string("count"))
+	p.bytes(profileSampleType, valueType)
+
+	for _, s := range b.stacks {
+		var sm, label message
+		sm.packed(sampleLocationID, s.locations)
+		sm.packed(sampleValue, []uint64{uint64(s.count)})
+		label.int64(labelKey, threadKey)
+		label.int64(labelStr, s.thread)
+		sm.bytes(sampleLabel, label)
+		p.bytes(profileSample, sm)
+	}
+	for i, loc := range b.locations {
+		var lm, line message
+		lm.varint(locationID, uint64(i+1))
+		line.varint(lineFunctionID, loc.function)
+		line.int64(lineLine, loc.line)
+		lm.bytes(locationLine, line)
+		p.bytes(profileLocation, lm)
+	}
+	for i, fn := range b.functions {
+		var fm message
+		fm.varint(functionID, uint64(i+1))
+		fm.int64(functionName, fn.name)
+		fm.int64(functionSystemName, fn.name)
+		p.bytes(profileFunction, fm)
+	}
+	for _, s := range b.strings {
+		p.bytes(profileStringTable, []byte(s))
+	}
+	p.int64(profileTimeNanos, b.start.UnixNano())
+	p.int64(profileDurationNanos, b.end.Sub(b.start).Nanoseconds())
+	return p
+}
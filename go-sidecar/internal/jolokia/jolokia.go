@@ -0,0 +1,177 @@
+// Package jolokia is a small client of the Jolokia JMX-over-HTTP agent. It runs a JVM's
+// diagnostic commands (JFR.start, Thread.print, ...) through the DiagnosticCommand MBean, the
+// JMX counterpart of jcmd, so a JVM can be controlled where exec and the attach socket are not
+// available.
+package jolokia
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// diagnosticCommandMBean exposes every diagnostic command as an operation taking String[]
+const diagnosticCommandMBean = "com.sun.management:type=DiagnosticCommand"
+
+// maxResponseSize bounds a reply; thread dumps and class histograms run to a few MiB
+const maxResponseSize = 64 << 20
+
+// ErrOperationFailed marks a request the agent answered with an error, usually an exception
+// thrown by the MBean
+var ErrOperationFailed = errors.New("jolokia operation failed")
+
+// Client sends requests to one JVM's Jolokia agent
+type Client struct {
+	URL      string // agent endpoint, e.g. http://localhost:8778/jolokia
+	User     string // basic auth, when the agent requires it
+	Password string
+	HTTP     *http.Client
+}
+
+// request is a Jolokia exec or read request
+type request struct {
+	Type      string `json:"type"`
+	MBean     string `json:"mbean"`
+	Operation string `json:"operation,omitempty"`
+	Attribute string `json:"attribute,omitempty"`
+	Arguments []any  `json:"arguments,omitempty"`
+}
+
+// response is the agent's reply; errors are reported in status, often with HTTP 200
+type response struct {
+	Status    int             `json:"status"`
+	Value     json.RawMessage `json:"value"`
+	Error     string          `json:"error"`
+	ErrorType string          `json:"error_type"`
+}
+
+// DiagnosticCommand runs a diagnostic command ("JFR.start") with its options ("name=x") and
+// returns its output. A command the MBean rejects returns ErrOperationFailed and the exception
+// message as output.
+func (c *Client) DiagnosticCommand(ctx context.Context, command string, options []string) (string, error) {
+	if options == nil {
+		options = []string{}
+	}
+	value, err := c.do(ctx, request{
+		Type:      "exec",
+		MBean:     diagnosticCommandMBean,
+		Operation: OperationName(command) + "([Ljava.lang.String;)",
+		Arguments: []any{options},
+	})
+	var failed *operationError
+	if errors.As(err, &failed) {
+		return failed.message, err
+	}
+	if err != nil {
+		return "", err
+	}
+	var output string
+	if err := json.Unmarshal(value, &output); err != nil && string(value) != "null" {
+		return "", fmt.Errorf("unexpected reply to %s: %s", command, value)
+	}
+	return output, nil
+}
+
+// PID returns the process ID of the agent's JVM, from RuntimeMXBean's Pid (JDK 10+) or the
+// "<pid>@<host>" in its Name
+func (c *Client) PID(ctx context.Context) (int, error) {
+	for _, attribute := range []string{"Pid", "Name"} {
+		value, err := c.do(ctx, request{Type: "read", MBean: "java.lang:type=Runtime", Attribute: attribute})
+		if err != nil {
+			if errors.As(err, new(*operationError)) {
+				continue // attribute missing on this JDK
+			}
+			return 0, err
+		}
+		text := strings.Trim(string(value), `"`)
+		text, _, _ = strings.Cut(text, "@")
+		if pid, err := strconv.Atoi(text); err == nil && pid > 0 {
+			return pid, nil
+		}
+	}
+	return 0, errors.New("the JVM behind Jolokia reports no PID")
+}
+
+// operationError is an error reply from the agent
+type operationError struct {
+	status  int
+	message string
+}
+
+func (e *operationError) Error() string {
+	return fmt.Sprintf("%s (status %d): %s", ErrOperationFailed, e.status, e.message)
+}
+
+func (e *operationError) Unwrap() error { return ErrOperationFailed }
+
+// do posts one request and returns the reply's value
+func (c *Client) do(ctx context.Context, req request) (json.RawMessage, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.User != "" {
+		httpReq.SetBasicAuth(c.User, c.Password)
+	}
+
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("jolokia request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read jolokia reply: %w", err)
+	}
+
+	var reply response
+	if err := json.Unmarshal(data, &reply); err != nil {
+		return nil, fmt.Errorf("jolokia replied %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	if reply.Status != http.StatusOK {
+		message := reply.Error
+		if message == "" {
+			message = resp.Status
+		}
+		return nil, &operationError{status: reply.Status, message: message}
+	}
+	return reply.Value, nil
+}
+
+// OperationName returns the DiagnosticCommand operation of a command, as the JDK derives it:
+// lower case up to the first '.' or '_', which are dropped and upper-case the next letter
+// ("JFR.start" is jfrStart, "GC.class_histogram" gcClassHistogram)
+func OperationName(command string) string {
+	var b strings.Builder
+	lower, upper := true, false
+	for _, r := range command {
+		switch {
+		case r == '.' || r == '_':
+			lower, upper = false, true
+		case upper:
+			b.WriteRune(unicode.ToUpper(r))
+			upper = false
+		case lower:
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
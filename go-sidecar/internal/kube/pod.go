@@ -0,0 +1,78 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Pod holds the subset of a Pod object the profiler uses
+type Pod struct {
+	Metadata struct {
+		Name      string            `json:"name"`
+		Namespace string            `json:"namespace"`
+		UID       string            `json:"uid"`
+		Labels    map[string]string `json:"labels"`
+	} `json:"metadata"`
+	Spec struct {
+		NodeName string `json:"nodeName"`
+	} `json:"spec"`
+	Status struct {
+		Phase             string            `json:"phase"`
+		ContainerStatuses []ContainerStatus `json:"containerStatuses"`
+	} `json:"status"`
+}
+
+// ContainerStatus maps a container name to its runtime ID
+type ContainerStatus struct {
+	Name        string `json:"name"`
+	ContainerID string `json:"containerID"` // e.g. "containerd://<64 hex>"
+}
+
+// GetPod fetches a pod by namespace and name
+func (c *Client) GetPod(ctx context.Context, namespace, name string) (*Pod, error) {
+	var pod Pod
+	path := fmt.Sprintf("/api/v1/namespaces/%s/pods/%s", url.PathEscape(namespace), url.PathEscape(name))
+	if err := c.Do(ctx, http.MethodGet, path, nil, &pod); err != nil {
+		return nil, err
+	}
+	return &pod, nil
+}
+
+// ContainerID returns the runtime ID (without the "runtime://" scheme) of a named container
+func (p *Pod) ContainerID(container string) (string, bool) {
+	for _, cs := range p.Status.ContainerStatuses {
+		if cs.Name == container && cs.ContainerID != "" {
+			_, id, found := strings.Cut(cs.ContainerID, "://")
+			if !found {
+				id = cs.ContainerID
+			}
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// PodList is a list of pods
+type PodList struct {
+	Items []Pod `json:"items"`
+}
+
+// ListPods lists pods in a namespace ("" for all namespaces) matching a field selector
+func (c *Client) ListPods(ctx context.Context, namespace, fieldSelector string) ([]Pod, error) {
+	path := "/api/v1/pods"
+	if namespace != "" {
+		path = fmt.Sprintf("/api/v1/namespaces/%s/pods", url.PathEscape(namespace))
+	}
+	if fieldSelector != "" {
+		path += "?fieldSelector=" + url.QueryEscape(fieldSelector)
+	}
+
+	var list PodList
+	if err := c.Do(ctx, http.MethodGet, path, nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
@@ -0,0 +1,86 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// UserInfo identifies the caller behind an authenticated token
+type UserInfo struct {
+	Username string              `json:"username"`
+	UID      string              `json:"uid,omitempty"`
+	Groups   []string            `json:"groups,omitempty"`
+	Extra    map[string][]string `json:"extra,omitempty"`
+}
+
+// ResourceAttributes describe the action a SubjectAccessReview checks
+type ResourceAttributes struct {
+	Namespace   string `json:"namespace,omitempty"`
+	Verb        string `json:"verb"`
+	Group       string `json:"group,omitempty"`
+	Resource    string `json:"resource"`
+	Subresource string `json:"subresource,omitempty"`
+	Name        string `json:"name,omitempty"`
+}
+
+// ReviewToken validates a bearer token with the TokenReview API. It returns the token's user and
+// whether the API server accepted it; audiences, when set, must include one the token was issued for.
+func (c *Client) ReviewToken(ctx context.Context, token string, audiences []string) (UserInfo, bool, error) {
+	review := map[string]any{
+		"apiVersion": "authentication.k8s.io/v1",
+		"kind":       "TokenReview",
+		"spec": map[string]any{
+			"token":     token,
+			"audiences": audiences,
+		},
+	}
+	var out struct {
+		Status struct {
+			Authenticated bool     `json:"authenticated"`
+			User          UserInfo `json:"user"`
+			Error         string   `json:"error"`
+		} `json:"status"`
+	}
+	if err := c.post(ctx, "/apis/authentication.k8s.io/v1/tokenreviews", review, &out); err != nil {
+		return UserInfo{}, false, err
+	}
+	return out.Status.User, out.Status.Authenticated, nil
+}
+
+// ReviewAccess asks the SubjectAccessReview API whether user may perform attrs. The reason is
+// the authorizer's explanation, which is often empty.
+func (c *Client) ReviewAccess(ctx context.Context, user UserInfo, attrs ResourceAttributes) (bool, string, error) {
+	review := map[string]any{
+		"apiVersion": "authorization.k8s.io/v1",
+		"kind":       "SubjectAccessReview",
+		"spec": map[string]any{
+			"user":               user.Username,
+			"uid":                user.UID,
+			"groups":             user.Groups,
+			"extra":              user.Extra,
+			"resourceAttributes": attrs,
+		},
+	}
+	var out struct {
+		Status struct {
+			Allowed bool   `json:"allowed"`
+			Denied  bool   `json:"denied"`
+			Reason  string `json:"reason"`
+		} `json:"status"`
+	}
+	if err := c.post(ctx, "/apis/authorization.k8s.io/v1/subjectaccessreviews", review, &out); err != nil {
+		return false, "", err
+	}
+	return out.Status.Allowed && !out.Status.Denied, out.Status.Reason, nil
+}
+
+// post sends a JSON-encoded object to a create endpoint
+func (c *Client) post(ctx context.Context, path string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return c.Do(ctx, http.MethodPost, path, bytes.NewReader(body), out)
+}
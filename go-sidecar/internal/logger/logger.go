@@ -9,6 +9,8 @@ import (
 
 var Log *logrus.Logger
 
+var otlp *otlpHook
+
 // Init initializes the logger with JSON formatting and configurable log level
 func Init() {
 	Log = logrus.New()
@@ -42,7 +44,46 @@ func Init() {
 		Log.SetLevel(logrus.InfoLevel)
 	}
 
+	// Always add trace/span correlation fields when a context is attached
+	Log.AddHook(traceHook{})
+
+	// Optionally export logs via OTLP alongside stdout
+	if otlpEnabled() {
+		endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if endpoint == "" {
+			endpoint = "http://localhost:4318"
+		}
+		serviceName := os.Getenv("OTEL_SERVICE_NAME")
+		if serviceName == "" {
+			serviceName = "profiler-sidecar"
+		}
+
+		otlp = newOTLPHook(endpoint, serviceName)
+		Log.AddHook(otlp)
+		logrus.RegisterExitHandler(Shutdown)
+	}
+
 	Log.WithFields(logrus.Fields{
 		"level": Log.GetLevel().String(),
+		"otlp":  otlp != nil,
 	}).Info("Logger initialized")
 }
+
+// Shutdown flushes any buffered log exports
+func Shutdown() {
+	if otlp != nil {
+		otlp.shutdown()
+	}
+}
+
+// otlpEnabled reports whether OTLP log export is configured
+func otlpEnabled() bool {
+	if strings.ToLower(os.Getenv("OTEL_LOGS_EXPORTER")) == "otlp" {
+		return true
+	}
+	switch strings.ToLower(os.Getenv("LOG_OTLP_ENABLED")) {
+	case "1", "true", "yes":
+		return true
+	}
+	return false
+}
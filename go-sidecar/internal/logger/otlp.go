@@ -0,0 +1,206 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/requestid"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	otlpBatchSize     = 100
+	otlpFlushInterval = 5 * time.Second
+)
+
+// traceHook adds trace_id/span_id fields to entries logged with a span context, and request_id
+// to entries logged while serving an API request
+type traceHook struct{}
+
+func (traceHook) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (traceHook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	sc := trace.SpanContextFromContext(entry.Context)
+	if sc.HasTraceID() {
+		entry.Data["trace_id"] = sc.TraceID().String()
+	}
+	if sc.HasSpanID() {
+		entry.Data["span_id"] = sc.SpanID().String()
+	}
+	if id := requestid.FromContext(entry.Context); id != "" {
+		entry.Data["request_id"] = id
+	}
+	return nil
+}
+
+// otlpHook batches log entries and exports them via OTLP/HTTP (JSON encoding)
+type otlpHook struct {
+	endpoint string
+	resource map[string]any
+	client   *http.Client
+
+	mu      sync.Mutex
+	pending []map[string]any
+	flushCh chan struct{}
+	done    chan struct{}
+}
+
+// newOTLPHook creates a hook exporting to the given OTLP/HTTP base endpoint
+func newOTLPHook(endpoint, serviceName string) *otlpHook {
+	attrs := []map[string]any{stringAttr("service.name", serviceName)}
+	if pod := os.Getenv("POD_NAME"); pod != "" {
+		attrs = append(attrs, stringAttr("k8s.pod.name", pod))
+	}
+	if node := os.Getenv("NODE_NAME"); node != "" {
+		attrs = append(attrs, stringAttr("k8s.node.name", node))
+	}
+
+	h := &otlpHook{
+		endpoint: strings.TrimSuffix(endpoint, "/") + "/v1/logs",
+		resource: map[string]any{"attributes": attrs},
+		client:   &http.Client{Timeout: 10 * time.Second},
+		flushCh:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	go h.run()
+	return h
+}
+
+func (h *otlpHook) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (h *otlpHook) Fire(entry *logrus.Entry) error {
+	attrs := make([]map[string]any, 0, len(entry.Data))
+	record := map[string]any{
+		"timeUnixNano":   strconv.FormatInt(entry.Time.UnixNano(), 10),
+		"severityNumber": severityNumber(entry.Level),
+		"severityText":   strings.ToUpper(entry.Level.String()),
+		"body":           map[string]any{"stringValue": entry.Message},
+	}
+
+	for k, v := range entry.Data {
+		switch k {
+		case "trace_id":
+			record["traceId"] = v
+		case "span_id":
+			record["spanId"] = v
+		default:
+			if err, ok := v.(error); ok {
+				v = err.Error()
+			}
+			attrs = append(attrs, stringAttr(k, fmt.Sprint(v)))
+		}
+	}
+	record["attributes"] = attrs
+
+	h.mu.Lock()
+	h.pending = append(h.pending, record)
+	full := len(h.pending) >= otlpBatchSize
+	h.mu.Unlock()
+
+	if full {
+		select {
+		case h.flushCh <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// run flushes pending entries periodically or when a batch fills up
+func (h *otlpHook) run() {
+	ticker := time.NewTicker(otlpFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			h.flush()
+		case <-h.flushCh:
+			h.flush()
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// flush sends all pending entries to the collector
+func (h *otlpHook) flush() {
+	h.mu.Lock()
+	records := h.pending
+	h.pending = nil
+	h.mu.Unlock()
+
+	if len(records) == 0 {
+		return
+	}
+
+	payload := map[string]any{
+		"resourceLogs": []map[string]any{{
+			"resource": h.resource,
+			"scopeLogs": []map[string]any{{
+				"scope":      map[string]any{"name": "profiler-sidecar"},
+				"logRecords": records,
+			}},
+		}},
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "otlp: failed to encode logs: %v\n", err)
+		return
+	}
+
+	resp, err := h.client.Post(h.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "otlp: failed to export logs: %v\n", err)
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		fmt.Fprintf(os.Stderr, "otlp: collector returned status %d\n", resp.StatusCode)
+	}
+}
+
+// shutdown stops the background flusher and exports remaining entries
+func (h *otlpHook) shutdown() {
+	select {
+	case <-h.done:
+	default:
+		close(h.done)
+	}
+	h.flush()
+}
+
+// severityNumber maps logrus levels to OTLP severity numbers
+func severityNumber(level logrus.Level) int {
+	switch level {
+	case logrus.TraceLevel:
+		return 1
+	case logrus.DebugLevel:
+		return 5
+	case logrus.InfoLevel:
+		return 9
+	case logrus.WarnLevel:
+		return 13
+	case logrus.ErrorLevel:
+		return 17
+	default:
+		return 21
+	}
+}
+
+func stringAttr(key, value string) map[string]any {
+	return map[string]any{"key": key, "value": map[string]any{"stringValue": value}}
+}
@@ -0,0 +1,25 @@
+// Package marker is the completion handshake between the sidecar and the daemon. Once an
+// artifact is completely written, the sidecar creates an empty {file}.done next to it. With
+// completion markers on, the daemon uploads only files that have one, as soon as it appears,
+// instead of waiting for a file to settle and checking that its size stopped changing.
+package marker
+
+import "strings"
+
+// Suffix is appended to an artifact's filename to name its marker
+const Suffix = ".done"
+
+// Path returns the marker of an artifact
+func Path(file string) string {
+	return file + Suffix
+}
+
+// IsMarker reports whether path is a completion marker
+func IsMarker(path string) bool {
+	return strings.HasSuffix(path, Suffix)
+}
+
+// FileOf returns the artifact a marker belongs to
+func FileOf(markerPath string) string {
+	return strings.TrimSuffix(markerPath, Suffix)
+}
@@ -0,0 +1,295 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/events"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "profiler"
+
+var (
+	// UploadLatency measures time from file creation (mtime) to upload completion
+	UploadLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upload_latency_seconds",
+		Help:      "Time from recording file creation to upload completion.",
+		Buckets:   []float64{5, 15, 30, 60, 120, 180, 300, 600, 1200, 3600},
+	}, []string{"destination"})
+
+	// UploadThroughput measures upload throughput per destination
+	UploadThroughput = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upload_throughput_bytes_per_second",
+		Help:      "Upload throughput of individual files.",
+		Buckets:   prometheus.ExponentialBuckets(64*1024, 2, 12),
+	}, []string{"destination"})
+
+	// UploadSize measures the size of uploaded files
+	UploadSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upload_size_bytes",
+		Help:      "Size of uploaded files.",
+		Buckets:   prometheus.ExponentialBuckets(64*1024, 4, 10),
+	}, []string{"destination"})
+
+	// UploadsTotal counts upload attempts by result
+	UploadsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "uploads_total",
+		Help:      "Upload attempts by destination and result.",
+	}, []string{"destination", "result"})
+
+	// UploadTimeoutsTotal counts uploads aborted at their deadline
+	UploadTimeoutsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upload_timeouts_total",
+		Help:      "Uploads aborted because they overran their size-scaled deadline, per destination.",
+	}, []string{"destination"})
+
+	// UploadsInProgress is the number of uploads currently streaming
+	UploadsInProgress = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "uploads_in_progress",
+		Help:      "Number of uploads currently in progress.",
+	})
+
+	// UploadBytesPending is the number of bytes still to be sent by in-flight uploads
+	UploadBytesPending = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "upload_bytes_pending",
+		Help:      "Bytes remaining across in-flight uploads.",
+	})
+)
+
+// Per-namespace storage quota accounting (daemon)
+var (
+	NamespaceUploadedBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "namespace_uploaded_bytes",
+		Help:      "Bytes uploaded per namespace in the current quota period.",
+	}, []string{"namespace"})
+
+	NamespaceQuotaBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "namespace_quota_bytes",
+		Help:      "Configured upload quota per namespace (0 is unlimited).",
+	}, []string{"namespace"})
+
+	UploadsDeferredTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "uploads_deferred_total",
+		Help:      "Uploads postponed by the daemon, by namespace and reason.",
+	}, []string{"namespace", "reason"})
+)
+
+// Replication across fan-out destinations
+var (
+	ReplicationVerifyFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "replication_verify_failures_total",
+		Help:      "Uploads whose copy could not be confirmed at a destination right after upload.",
+	}, []string{"destination"})
+
+	ReplicationMissingObjects = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "replication_missing_objects",
+		Help:      "Objects still missing from a destination after the last reconciliation pass.",
+	}, []string{"destination"})
+
+	ReplicationRepairsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "replication_repairs_total",
+		Help:      "Missing replicas re-shipped by the reconciler, by result.",
+	}, []string{"destination", "result"})
+)
+
+// Sidecar API request metrics
+var (
+	APIRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_requests_total",
+		Help:      "Sidecar API requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	APIRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "api_request_duration_seconds",
+		Help:      "Sidecar API request latency by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route"})
+
+	APIPanicsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_panics_total",
+		Help:      "Sidecar API handler panics recovered by the middleware chain.",
+	})
+
+	APIRateLimitedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_rate_limited_total",
+		Help:      "Profiling requests refused by the per-client or global rate limit.",
+	}, []string{"route", "scope"})
+
+	ScheduledRecordingsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "scheduled_recordings_total",
+		Help:      "Recordings started by cron schedules, by result (started, failed).",
+	}, []string{"result"})
+)
+
+// Sidecar recording lifecycle, from the jobs of /create, schedules and triggers
+var (
+	RecordingsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "recordings_total",
+		Help:      "Recording jobs by engine and event (started, stopped, failed).",
+	}, []string{"engine", "event"})
+
+	ActiveRecordings = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_recordings",
+		Help:      "Recording jobs currently recording.",
+	})
+
+	ProfileBytesWrittenTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "profile_bytes_written_total",
+		Help:      "Bytes of recording and dump files written to the profile directory, by engine.",
+	}, []string{"engine"})
+)
+
+// External command metrics (jcmd, pgrep, perf-map-agent, ...)
+var (
+	CommandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "command_duration_seconds",
+		Help:      "Duration of external commands by command, jcmd operation (e.g. JFR.stop) and result.",
+		Buckets:   []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 20, 30, 60},
+	}, []string{"command", "operation", "result"})
+
+	SlowCommandsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "slow_commands_total",
+		Help:      "External commands that ran longer than SLOW_COMMAND_THRESHOLD.",
+	}, []string{"command", "operation"})
+)
+
+// jcmd circuit breaker metrics
+var (
+	JcmdCircuitOpen = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "jcmd_circuit_open",
+		Help:      "Whether jcmd calls against a JVM are currently failing fast (1) or allowed (0).",
+	}, []string{"pid"})
+
+	JcmdRejectedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jcmd_rejected_total",
+		Help:      "jcmd calls refused because the circuit was open.",
+	})
+
+	// RegistryRegistered is 1 while the sidecar is registered with the central registry
+	RegistryRegistered = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "registry_registered",
+		Help:      "Whether the sidecar is currently registered with the central registry.",
+	})
+
+	RegistryHeartbeatFailuresTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "registry_heartbeat_failures_total",
+		Help:      "Registrations and heartbeats the central registry did not accept.",
+	})
+)
+
+// Collector mode: uploads received from sidecars and spooled before forwarding
+var (
+	CollectorRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "collector_requests_total",
+		Help:      "Uploads received by the collector, by result.",
+	}, []string{"result"})
+	CollectorReceivedBytesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "collector_received_bytes_total",
+		Help:      "Bytes accepted into the collector spool.",
+	})
+	CollectorSpoolBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "collector_spool_bytes",
+		Help:      "Bytes spooled or being received, waiting to be forwarded.",
+	})
+	CollectorSpoolFiles = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "collector_spool_files",
+		Help:      "Spooled files waiting to be forwarded.",
+	})
+	CollectorForwardRetriesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "collector_forward_retries_total",
+		Help:      "Spooled files whose forwarding failed and was scheduled again.",
+	})
+)
+
+// JVM health gauges sampled from the sidecar's telemetry recording
+var (
+	JVMHeapUsed = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "jvm_heap_used_bytes",
+		Help:      "Heap used after the most recent GC in the last telemetry window.",
+	})
+
+	JVMGCPauseP99 = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "jvm_gc_pause_p99_seconds",
+		Help:      "99th percentile GC pause over the last telemetry window.",
+	})
+
+	JVMThreads = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "jvm_threads",
+		Help:      "Active Java threads.",
+	})
+)
+
+var subscribeUploadsOnce sync.Once
+
+// SubscribeUploadEvents records upload metrics from events published on the bus. It may be
+// called by every component that uploads; events are only counted once.
+func SubscribeUploadEvents() {
+	subscribeUploadsOnce.Do(subscribeUploadEvents)
+}
+
+func subscribeUploadEvents() {
+	events.Subscribe(func(e events.Event) {
+		destination, _ := e.Fields["destination"].(string)
+
+		if e.Type == events.UploadFailed {
+			UploadsTotal.WithLabelValues(destination, "failure").Inc()
+			return
+		}
+
+		UploadsTotal.WithLabelValues(destination, "success").Inc()
+
+		if size, ok := e.Fields["size"].(int64); ok {
+			UploadSize.WithLabelValues(destination).Observe(float64(size))
+			if d, ok := e.Fields["duration"].(time.Duration); ok && d > 0 {
+				UploadThroughput.WithLabelValues(destination).Observe(float64(size) / d.Seconds())
+			}
+		}
+		if modified, ok := e.Fields["modified"].(time.Time); ok {
+			UploadLatency.WithLabelValues(destination).Observe(e.Time.Sub(modified).Seconds())
+		}
+	}, events.UploadCompleted, events.UploadFailed)
+}
+
+// Handler returns the Prometheus scrape handler
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,141 @@
+package quota
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/config"
+)
+
+// Tracker counts uploaded bytes per namespace over a rolling period and enforces limits.
+// Counters are persisted so a daemon restart does not reset them.
+type Tracker struct {
+	mu       sync.Mutex
+	path     string
+	period   time.Duration
+	limits   map[string]int64
+	fallback int64 // limit for namespaces without their own; 0 is unlimited
+	state    state
+}
+
+type state struct {
+	PeriodStart time.Time        `json:"periodStart"`
+	Used        map[string]int64 `json:"used"`
+}
+
+// New loads persisted counters from path (if present) and applies the given limits
+func New(path string, period time.Duration, limits map[string]int64, fallback int64) (*Tracker, error) {
+	t := &Tracker{
+		path:     path,
+		period:   period,
+		limits:   limits,
+		fallback: fallback,
+		state:    state{PeriodStart: time.Now(), Used: map[string]int64{}},
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read quota state: %w", err)
+	default:
+		if err := json.Unmarshal(data, &t.state); err != nil {
+			return nil, fmt.Errorf("invalid quota state %s: %w", path, err)
+		}
+		if t.state.Used == nil {
+			t.state.Used = map[string]int64{}
+		}
+	}
+	return t, nil
+}
+
+// Limit returns the quota for a namespace; 0 means unlimited
+func (t *Tracker) Limit(namespace string) int64 {
+	if limit, ok := t.limits[namespace]; ok {
+		return limit
+	}
+	return t.fallback
+}
+
+// Used returns the bytes uploaded by a namespace in the current period
+func (t *Tracker) Used(namespace string) int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollLocked()
+	return t.state.Used[namespace]
+}
+
+// Exceeded reports whether a namespace has used up its quota
+func (t *Tracker) Exceeded(namespace string) bool {
+	limit := t.Limit(namespace)
+	return limit > 0 && t.Used(namespace) >= limit
+}
+
+// Allow reports whether uploading size more bytes keeps a namespace within its quota
+func (t *Tracker) Allow(namespace string, size int64) bool {
+	limit := t.Limit(namespace)
+	return limit == 0 || t.Used(namespace)+size <= limit
+}
+
+// Record adds uploaded bytes to a namespace and persists the counters
+func (t *Tracker) Record(namespace string, size int64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollLocked()
+	t.state.Used[namespace] += size
+	return t.saveLocked()
+}
+
+// PeriodEnd returns when the counters next reset
+func (t *Tracker) PeriodEnd() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollLocked()
+	return t.state.PeriodStart.Add(t.period)
+}
+
+// rollLocked resets the counters once the period has elapsed
+func (t *Tracker) rollLocked() {
+	if t.period > 0 && time.Since(t.state.PeriodStart) >= t.period {
+		t.state = state{PeriodStart: time.Now(), Used: map[string]int64{}}
+	}
+}
+
+// saveLocked writes the counters atomically (write to a temporary file, then rename)
+func (t *Tracker) saveLocked() error {
+	data, err := json.Marshal(t.state)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(t.path), "."+filepath.Base(t.path)+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write quota state: %w", err)
+	}
+	return os.Rename(tmp, t.path)
+}
+
+// ParseLimits parses "namespace=size,..." with sizes such as 500Mi or 10Gi
+func ParseLimits(s string) (map[string]int64, error) {
+	limits := map[string]int64{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		ns, size, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid quota %q: expected namespace=size", pair)
+		}
+		n, err := config.ParseSize(size)
+		if err != nil {
+			return nil, err
+		}
+		limits[strings.TrimSpace(ns)] = n
+	}
+	return limits, nil
+}
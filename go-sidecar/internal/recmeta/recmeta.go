@@ -0,0 +1,101 @@
+package recmeta
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/filetype"
+)
+
+// Extension is the suffix of a recording's companion metadata file: {name}.meta.json next to
+// {name}.jfr. The sidecar writes it when a recording starts; the daemon uploads it alongside.
+const Extension = ".meta.json"
+
+// Object metadata keys set on the uploaded recording
+const (
+	DescriptionKey = "recording-description"
+	TicketKey      = "recording-ticket"
+	RequesterKey   = "recording-requester"
+
+	// LabelKeyPrefix precedes each label's key, so labels cannot overwrite the keys above
+	LabelKeyPrefix = "label-"
+)
+
+// Metadata describes why a recording was taken and by whom
+type Metadata struct {
+	File        string            `json:"file"` // the recording's filename, e.g. "checkout-slow.jfr"
+	Description string            `json:"description,omitempty"`
+	Ticket      string            `json:"ticket,omitempty"`
+	Requester   string            `json:"requester,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"` // caller-defined, e.g. team=payments
+	Pod         string            `json:"pod,omitempty"`
+	Namespace   string            `json:"namespace,omitempty"`
+	Container   string            `json:"container,omitempty"`
+	PID         int               `json:"pid,omitempty"`
+	Duration    string            `json:"duration,omitempty"`
+	StartedAt   time.Time         `json:"startedAt"`
+	RequestID   string            `json:"requestId,omitempty"` // X-Request-ID of the /create call
+}
+
+// IsCompanion reports whether path is a companion metadata file
+func IsCompanion(path string) bool {
+	return strings.HasSuffix(path, Extension)
+}
+
+// CompanionPath returns the metadata file belonging to a recording
+func CompanionPath(recordingPath string) string {
+	ext := filetype.Lookup(recordingPath).Extension
+	if ext == "" {
+		ext = filepath.Ext(recordingPath)
+	}
+	return strings.TrimSuffix(recordingPath, ext) + Extension
+}
+
+// RecordingPath returns the recording a companion file describes
+func (m *Metadata) RecordingPath(companionPath string) string {
+	return filepath.Join(filepath.Dir(companionPath), filepath.Base(m.File))
+}
+
+// ExpectedEnd is when the recording's duration elapses and the JVM writes the file
+func (m *Metadata) ExpectedEnd() time.Time {
+	d, _ := time.ParseDuration(m.Duration)
+	return m.StartedAt.Add(d)
+}
+
+// ObjectMetadata returns the fields set as metadata on the uploaded recording
+func (m *Metadata) ObjectMetadata() map[string]string {
+	metadata := map[string]string{}
+	if m.Description != "" {
+		metadata[DescriptionKey] = m.Description
+	}
+	if m.Ticket != "" {
+		metadata[TicketKey] = m.Ticket
+	}
+	if m.Requester != "" {
+		metadata[RequesterKey] = m.Requester
+	}
+	for key, value := range m.Labels {
+		metadata[LabelKeyPrefix+key] = value
+	}
+	return metadata
+}
+
+// Marshal encodes m as the companion file's contents
+func (m *Metadata) Marshal() ([]byte, error) {
+	return json.MarshalIndent(m, "", "  ")
+}
+
+// Parse decodes a companion file
+func Parse(data []byte) (*Metadata, error) {
+	var m Metadata
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid recording metadata: %w", err)
+	}
+	if m.File == "" || strings.ContainsAny(m.File, `/\`) {
+		return nil, fmt.Errorf("invalid recording metadata: bad file %q", m.File)
+	}
+	return &m, nil
+}
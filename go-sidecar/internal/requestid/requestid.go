@@ -0,0 +1,44 @@
+// Package requestid carries the X-Request-ID that correlates one API request across the
+// sidecar, collector and daemon logs
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+)
+
+// Header is the request and response header carrying the ID
+const Header = "X-Request-ID"
+
+// validID bounds IDs accepted from callers, so they are safe to log and echo back
+var validID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// New returns a random 16-byte hex ID
+func New() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// FromHeader returns the caller's ID when it is well formed, or a new one
+func FromHeader(value string) string {
+	if validID.MatchString(value) {
+		return value
+	}
+	return New()
+}
+
+type contextKey struct{}
+
+// WithID returns a context carrying a request ID
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID ctx carries, or ""
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
@@ -0,0 +1,106 @@
+package sampling
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Target is a pod eligible for profiling
+type Target struct {
+	Pod  string `json:"pod"`
+	Node string `json:"node,omitempty"`
+}
+
+// Stratified selects percent (0-100] of targets, spread across nodes in proportion to their
+// pods, using a seeded RNG. The total is percent of all targets, rounded; each node gets its
+// share rounded down, and the pods left over go to the nodes with the largest remainders
+// (ties broken by the RNG). The result is deterministic for a given seed and target set, so
+// every sidecar receiving the same campaign request computes the same sample.
+func Stratified(targets []Target, percent float64, seed int64) []Target {
+	if percent >= 100 {
+		return targets
+	}
+	if percent <= 0 {
+		return nil
+	}
+
+	byNode := map[string][]Target{}
+	for _, t := range targets {
+		byNode[t.Node] = append(byNode[t.Node], t)
+	}
+
+	nodes := make([]string, 0, len(byNode))
+	for node := range byNode {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+
+	rng := rand.New(rand.NewSource(seed))
+	for _, node := range nodes {
+		pods := byNode[node]
+		sort.Slice(pods, func(i, j int) bool { return pods[i].Pod < pods[j].Pod })
+		rng.Shuffle(len(pods), func(i, j int) { pods[i], pods[j] = pods[j], pods[i] })
+	}
+
+	// Largest remainder: floor each node's exact share, then hand out what is left of the quota
+	quota := int(math.Round(float64(len(targets)) * percent / 100))
+	counts := map[string]int{}
+	remainders := map[string]float64{}
+	for _, node := range nodes {
+		share := float64(len(byNode[node])) * percent / 100
+		counts[node] = int(math.Floor(share))
+		remainders[node] = share - math.Floor(share)
+		quota -= counts[node]
+	}
+	order := append([]string(nil), nodes...)
+	rng.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+	sort.SliceStable(order, func(i, j int) bool { return remainders[order[i]] > remainders[order[j]] })
+	for _, node := range order {
+		if quota <= 0 {
+			break
+		}
+		if counts[node] < len(byNode[node]) {
+			counts[node]++
+			quota--
+		}
+	}
+
+	var selected []Target
+	for _, node := range nodes {
+		selected = append(selected, byNode[node][:counts[node]]...)
+	}
+	return selected
+}
+
+// Contains reports whether pod is among the selected targets
+func Contains(targets []Target, pod string) bool {
+	for _, t := range targets {
+		if t.Pod == pod {
+			return true
+		}
+	}
+	return false
+}
+
+// Sampled decides independently for a single pod, by hashing it with the seed,
+// whether it falls within percent. Used when the full target list is unknown.
+func Sampled(pod string, percent float64, seed int64) bool {
+	if percent >= 100 {
+		return true
+	}
+	if percent <= 0 {
+		return false
+	}
+	h := fnv.New64a()
+	h.Write([]byte(pod))
+	return float64((h.Sum64()^uint64(seed))%10000) < percent*100
+}
+
+// SeedFromString derives a deterministic seed from an identifier
+func SeedFromString(s string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return int64(h.Sum64())
+}
@@ -0,0 +1,115 @@
+package tenant
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// namePattern keeps tenant names usable as a directory and object prefix
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// Tenant is a team sharing the profiler deployment. Recordings created with its token live in
+// their own subdirectory of the pod's profile directory and are uploaded under Prefix (and to
+// Bucket, when set) instead of the shared layout.
+type Tenant struct {
+	Name      string `json:"name"`
+	Token     string `json:"token,omitempty"`
+	TokenFile string `json:"tokenFile,omitempty"` // read instead of Token, e.g. a mounted Secret
+	Prefix    string `json:"prefix,omitempty"`    // object prefix; defaults to Name
+	Bucket    string `json:"bucket,omitempty"`    // overrides GCS_BUCKET for this tenant
+}
+
+// Registry holds the configured tenants
+type Registry struct {
+	tenants []*Tenant
+	byName  map[string]*Tenant
+}
+
+// LoadFromEnv reads TENANTS_FILE; it returns nil when tenancy is not configured
+func LoadFromEnv() (*Registry, error) {
+	path := os.Getenv("TENANTS_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	return Load(path)
+}
+
+// Load reads a JSON array of tenants from path
+func Load(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tenants file: %w", err)
+	}
+
+	var tenants []*Tenant
+	if err := json.Unmarshal(data, &tenants); err != nil {
+		return nil, fmt.Errorf("invalid tenants file %s: %w", path, err)
+	}
+
+	r := &Registry{byName: map[string]*Tenant{}}
+	for _, t := range tenants {
+		if !namePattern.MatchString(t.Name) {
+			return nil, fmt.Errorf("invalid tenant name %q: use lowercase letters, digits and '-'", t.Name)
+		}
+		if _, dup := r.byName[t.Name]; dup {
+			return nil, fmt.Errorf("duplicate tenant %q", t.Name)
+		}
+		if t.TokenFile != "" {
+			token, err := os.ReadFile(t.TokenFile)
+			if err != nil {
+				return nil, fmt.Errorf("tenant %s: failed to read token file: %w", t.Name, err)
+			}
+			t.Token = strings.TrimSpace(string(token))
+		}
+		if t.Prefix == "" {
+			t.Prefix = t.Name
+		}
+		t.Prefix = strings.Trim(t.Prefix, "/")
+		r.tenants = append(r.tenants, t)
+		r.byName[t.Name] = t
+	}
+	return r, nil
+}
+
+// ByToken returns the tenant owning token, comparing against every tenant in constant time
+func (r *Registry) ByToken(token string) (*Tenant, bool) {
+	if token == "" {
+		return nil, false
+	}
+	var match *Tenant
+	for _, t := range r.tenants {
+		if t.Token != "" && subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) == 1 {
+			match = t
+		}
+	}
+	return match, match != nil
+}
+
+// ByName returns the tenant with the given name
+func (r *Registry) ByName(name string) (*Tenant, bool) {
+	t, ok := r.byName[name]
+	return t, ok
+}
+
+// Len returns the number of configured tenants
+func (r *Registry) Len() int {
+	return len(r.tenants)
+}
+
+type contextKey struct{}
+
+// WithTenant returns a context carrying the tenant a request was made as
+func WithTenant(ctx context.Context, t *Tenant) context.Context {
+	return context.WithValue(ctx, contextKey{}, t)
+}
+
+// FromContext returns the request's tenant, or nil for untenanted requests
+func FromContext(ctx context.Context) *Tenant {
+	t, _ := ctx.Value(contextKey{}).(*Tenant)
+	return t
+}
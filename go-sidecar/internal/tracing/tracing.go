@@ -0,0 +1,78 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/oscar-wu_pingcorp/profiler-sidecar"
+
+var provider *sdktrace.TracerProvider
+
+// Init configures the global tracer provider and W3C trace-context propagation.
+// Spans are only exported when OTEL_TRACES_EXPORTER=otlp; otherwise a no-op provider is used
+// but incoming trace context is still propagated.
+func Init(ctx context.Context) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if strings.ToLower(os.Getenv("OTEL_TRACES_EXPORTER")) != "otlp" {
+		return
+	}
+
+	// Endpoint and headers are read from the standard OTEL_EXPORTER_OTLP_* variables
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		logger.Log.WithError(err).Error("Failed to create OTLP trace exporter, tracing disabled")
+		return
+	}
+
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "profiler-sidecar"
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+		semconv.K8SPodName(os.Getenv("POD_NAME")),
+	))
+	if err != nil {
+		res = resource.Default()
+	}
+
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	logger.Log.WithField("service", serviceName).Info("OTLP trace export enabled")
+}
+
+// Shutdown flushes and stops the tracer provider
+func Shutdown(ctx context.Context) {
+	if provider == nil {
+		return
+	}
+	if err := provider.Shutdown(ctx); err != nil {
+		logger.Log.WithError(err).Warn("Failed to shut down tracer provider")
+	}
+}
+
+// Tracer returns the tracer used for profiler spans
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
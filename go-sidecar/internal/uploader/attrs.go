@@ -0,0 +1,27 @@
+package uploader
+
+import (
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// applyObjectAttrs sets configured holds, retention, ACL and caching on a new object
+func (u *GCSUploader) applyObjectAttrs(attrs *storage.ObjectAttrs) {
+	attrs.TemporaryHold = u.opts.TemporaryHold
+	attrs.EventBasedHold = u.opts.EventBasedHold
+
+	if u.opts.RetentionPeriod > 0 {
+		attrs.Retention = &storage.ObjectRetention{
+			Mode:        u.opts.RetentionMode,
+			RetainUntil: time.Now().Add(u.opts.RetentionPeriod),
+		}
+	}
+
+	if u.opts.PredefinedACL != "" {
+		attrs.PredefinedACL = u.opts.PredefinedACL
+	}
+	if u.opts.CacheControl != "" {
+		attrs.CacheControl = u.opts.CacheControl
+	}
+}
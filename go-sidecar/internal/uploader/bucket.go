@@ -0,0 +1,65 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"cloud.google.com/go/storage"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// ensureBucket creates the bucket if it does not already exist
+func (u *GCSUploader) ensureBucket(ctx context.Context) error {
+	bucket := u.bucket(ctx)
+
+	_, err := bucket.Attrs(ctx)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, storage.ErrBucketNotExist) {
+		return fmt.Errorf("failed to get bucket attributes: %w", err)
+	}
+
+	if u.opts.ProjectID == "" {
+		return fmt.Errorf("bucket %s does not exist and GCS_PROJECT_ID is not set", u.bucketName)
+	}
+
+	attrs := &storage.BucketAttrs{
+		Location:     u.opts.BucketLocation,
+		StorageClass: u.opts.BucketStorageClass,
+		UniformBucketLevelAccess: storage.UniformBucketLevelAccess{
+			Enabled: u.opts.UniformAccess,
+		},
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"bucket":         u.bucketName,
+		"project":        u.opts.ProjectID,
+		"location":       attrs.Location,
+		"storage_class":  attrs.StorageClass,
+		"uniform_access": u.opts.UniformAccess,
+	}).Info("Bucket does not exist, creating it")
+
+	if err := bucket.Create(ctx, u.opts.ProjectID, attrs); err != nil {
+		return fmt.Errorf("failed to create bucket %s: %w", u.bucketName, err)
+	}
+
+	return nil
+}
+
+// verifyUniformAccess fails if the bucket does not enforce uniform bucket-level access
+func (u *GCSUploader) verifyUniformAccess(ctx context.Context) error {
+	attrs, err := u.bucket(ctx).Attrs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get bucket attributes: %w", err)
+	}
+
+	if !attrs.UniformBucketLevelAccess.Enabled {
+		return fmt.Errorf("bucket %s does not have uniform bucket-level access enabled", u.bucketName)
+	}
+
+	logger.Log.WithField("bucket", u.bucketName).Info("Verified uniform bucket-level access")
+	return nil
+}
@@ -0,0 +1,171 @@
+package uploader
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/requestid"
+	"github.com/sirupsen/logrus"
+)
+
+// Headers carrying the upload scope and extra object metadata ({prefix}{key}: value) to a
+// collector, which applies them when forwarding
+const (
+	CollectorPrefixHeader   = "X-Upload-Prefix"
+	CollectorBucketHeader   = "X-Upload-Bucket"
+	CollectorMetadataPrefix = "X-Upload-Metadata-"
+)
+
+// CollectorUploader sends files to a central collector (collector mode) instead of an object
+// store, for nodes without object-store egress. The collector spools each file and forwards it
+// with its own uploader, so compression and the object layout are applied there.
+type CollectorUploader struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+// NewCollectorUploader creates an uploader that PUTs files to {baseURL}/v1/recordings/{POD_NAME}/{FILENAME}
+// with token as a bearer token. rootCAs verifies the collector's certificate; nil uses the system pool.
+func NewCollectorUploader(baseURL, token string, rootCAs *x509.CertPool) (*CollectorUploader, error) {
+	if _, err := url.Parse(baseURL); err != nil {
+		return nil, fmt.Errorf("invalid collector URL %q: %w", baseURL, err)
+	}
+	if token == "" {
+		return nil, fmt.Errorf("COLLECTOR_TOKEN is required to upload to a collector")
+	}
+	return &CollectorUploader{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		client: &http.Client{Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: rootCAs, MinVersion: tls.VersionTLS12},
+		}},
+	}, nil
+}
+
+// Upload sends a local file to the collector
+func (u *CollectorUploader) Upload(ctx context.Context, localPath, podName string) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", localPath, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	ctx, cancel, timeout := withUploadDeadline(ctx, info.Size())
+	defer cancel()
+
+	if err := u.send(ctx, file, info.Size(), podName, filepath.Base(localPath)); err != nil {
+		return uploadTimeoutError(ctx, u.baseURL, timeout, err)
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"bytes_written": info.Size(),
+		"collector":     u.baseURL,
+	}).Info("Successfully sent file to collector")
+	return nil
+}
+
+// UploadStream sends data of unknown length to the collector as a chunked request
+func (u *CollectorUploader) UploadStream(ctx context.Context, r io.Reader, podName, filename string) (int64, error) {
+	counter := &countingReader{r: r}
+	if err := u.send(ctx, counter, -1, podName, filepath.Base(filename)); err != nil {
+		return counter.n, err
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"bytes_written": counter.n,
+		"collector":     u.baseURL,
+	}).Info("Successfully streamed to collector")
+	return counter.n, nil
+}
+
+// send PUTs body to the collector; size -1 sends it chunked
+func (u *CollectorUploader) send(ctx context.Context, body io.Reader, size int64, podName, filename string) error {
+	endpoint := u.baseURL + "/v1/recordings/" + url.PathEscape(podName) + "/" + url.PathEscape(filename)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Authorization", "Bearer "+u.token)
+	if id := requestid.FromContext(ctx); id != "" {
+		req.Header.Set(requestid.Header, id)
+	}
+	scope := scopeFrom(ctx)
+	if scope.Prefix != "" {
+		req.Header.Set(CollectorPrefixHeader, scope.Prefix)
+	}
+	if scope.Bucket != "" {
+		req.Header.Set(CollectorBucketHeader, scope.Bucket)
+	}
+	for key, value := range objectMetadataFrom(ctx) {
+		req.Header.Set(CollectorMetadataPrefix+key, value)
+	}
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("collector request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	switch {
+	case resp.StatusCode == http.StatusServiceUnavailable || resp.StatusCode == http.StatusTooManyRequests:
+		// Spool full or too many concurrent uploads; the daemon retries on a later scan
+		return fmt.Errorf("collector is busy (HTTP %d, retry after %s)", resp.StatusCode, retryAfter(resp))
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("collector rejected upload: HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Destination returns the collector URL
+func (u *CollectorUploader) Destination() string {
+	return u.baseURL
+}
+
+// Close releases idle connections to the collector
+func (u *CollectorUploader) Close() error {
+	u.client.CloseIdleConnections()
+	return nil
+}
+
+// retryAfter returns the Retry-After of a response, in seconds, or "unspecified"
+func retryAfter(resp *http.Response) string {
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		if seconds, err := strconv.Atoi(v); err == nil {
+			return strconv.Itoa(seconds) + "s"
+		}
+		return v
+	}
+	return "unspecified"
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
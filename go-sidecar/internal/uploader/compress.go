@@ -0,0 +1,57 @@
+package uploader
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/config"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/filetype"
+)
+
+// compressHeapDumps gzips .hprof files on the way out; heap dumps typically shrink 5-10x
+var compressHeapDumps = config.EnvBool("UPLOAD_COMPRESS_HEAPDUMPS", true)
+
+// Metadata keys describing the uncompressed original of a compressed upload
+const (
+	originalSHA256Key = "original-sha256"
+	originalSizeKey   = "original-size"
+)
+
+// shouldCompress reports whether files of type t are gzipped during upload
+func shouldCompress(t filetype.Type) bool {
+	return compressHeapDumps && t.Name == "heapdump" && t.ContentEncoding == ""
+}
+
+// gzipReader compresses r through a pipe, so memory use is bounded by the copy buffers
+// regardless of file size. Closing the returned reader stops the compressor.
+func gzipReader(r io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		gz := gzip.NewWriter(pw)
+		_, err := io.Copy(gz, r)
+		if closeErr := gz.Close(); err == nil {
+			err = closeErr
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// FileSHA256 returns the hex-encoded SHA-256 of a file's contents
+func FileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to checksum file %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
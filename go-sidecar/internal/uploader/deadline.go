@@ -0,0 +1,56 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/config"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/metrics"
+)
+
+// A stalled connection must not hold an upload open forever: each upload gets a deadline of
+// UPLOAD_TIMEOUT_BASE plus the time the file takes at UPLOAD_MIN_THROUGHPUT, capped at
+// UPLOAD_TIMEOUT_MAX. A timed-out upload fails and the daemon retries it on the next scan.
+var (
+	uploadTimeoutBase   = config.EnvDuration("UPLOAD_TIMEOUT_BASE", time.Minute)
+	uploadMinThroughput = config.EnvSize("UPLOAD_MIN_THROUGHPUT", 1<<20) // bytes per second
+	uploadTimeoutMax    = config.EnvDuration("UPLOAD_TIMEOUT_MAX", 0)
+)
+
+// uploadDeadline returns how long an upload of size bytes may take; 0 means no deadline
+func uploadDeadline(size int64) time.Duration {
+	if uploadTimeoutBase <= 0 && uploadMinThroughput <= 0 {
+		return 0
+	}
+	d := uploadTimeoutBase
+	if uploadMinThroughput > 0 {
+		d += time.Duration(float64(size) / float64(uploadMinThroughput) * float64(time.Second))
+	}
+	if uploadTimeoutMax > 0 && d > uploadTimeoutMax {
+		d = uploadTimeoutMax
+	}
+	return d
+}
+
+// withUploadDeadline bounds an upload of size bytes by its deadline
+func withUploadDeadline(ctx context.Context, size int64) (context.Context, context.CancelFunc, time.Duration) {
+	d := uploadDeadline(size)
+	if d <= 0 {
+		ctx, cancel := context.WithCancel(ctx)
+		return ctx, cancel, 0
+	}
+	ctx, cancel := context.WithTimeout(ctx, d)
+	return ctx, cancel, d
+}
+
+// uploadTimeoutError turns a failure caused by the upload deadline into a timeout error and
+// counts it; other errors are returned unchanged
+func uploadTimeoutError(ctx context.Context, destination string, timeout time.Duration, err error) error {
+	if err == nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	metrics.UploadTimeoutsTotal.WithLabelValues(destination).Inc()
+	return fmt.Errorf("upload timed out after %s: %w", timeout, err)
+}
@@ -0,0 +1,110 @@
+package uploader
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/config"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+)
+
+const simulationUploadDir = "/tmp/jfr-uploaded" // Local upload target in simulation mode
+
+// NewFromConfig creates the GCS uploader for GCS_BUCKET, or a local uploader writing to
+// SIMULATION_UPLOAD_DIR when simulate is set. UPLOAD_DESTINATIONS fans uploads out to a
+// comma-separated list of gs://BUCKET, file:///DIR and https://COLLECTOR destinations instead.
+// GCS options come from the environment, the file stability delay from cfg; completion markers
+// already guarantee a file is complete, so they skip the stability check.
+func NewFromConfig(ctx context.Context, cfg *config.Config, simulate bool) (Uploader, error) {
+	opts := OptionsFromEnv()
+	if err := config.EnvError(); err != nil {
+		return nil, err
+	}
+	opts.StabilityDelay = cfg.StabilityDelay
+	if cfg.CompletionMarkers {
+		opts.StabilityDelay = 0
+	}
+
+	if spec := os.Getenv("UPLOAD_DESTINATIONS"); spec != "" {
+		return newMultiFromSpec(ctx, spec, opts)
+	}
+
+	if simulate {
+		dir := config.Env("SIMULATION_UPLOAD_DIR", simulationUploadDir)
+		logger.Log.WithField("dir", dir).Info("Simulation mode: uploading to local directory instead of GCS")
+		return NewLocalUploader(dir)
+	}
+
+	bucketName := os.Getenv("GCS_BUCKET")
+	if bucketName == "" {
+		return nil, fmt.Errorf("GCS_BUCKET environment variable is required")
+	}
+
+	return NewGCSUploader(ctx, bucketName, opts)
+}
+
+// newMultiFromSpec builds a fan-out uploader from destination URIs
+func newMultiFromSpec(ctx context.Context, spec string, opts Options) (Uploader, error) {
+	var uploaders []Uploader
+	closeAll := func() {
+		for _, u := range uploaders {
+			u.Close()
+		}
+	}
+
+	for _, uri := range strings.Split(spec, ",") {
+		uri = strings.TrimSpace(uri)
+		var u Uploader
+		var err error
+		switch {
+		case strings.HasPrefix(uri, "gs://"):
+			u, err = NewGCSUploader(ctx, strings.TrimSuffix(strings.TrimPrefix(uri, "gs://"), "/"), opts)
+		case strings.HasPrefix(uri, "file://"):
+			u, err = NewLocalUploader(strings.TrimPrefix(uri, "file://"))
+		case strings.HasPrefix(uri, "https://"), strings.HasPrefix(uri, "http://"):
+			u, err = newCollectorFromEnv(uri)
+		default:
+			err = fmt.Errorf("unsupported upload destination %q (use gs://BUCKET, file:///DIR or https://COLLECTOR)", uri)
+		}
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		uploaders = append(uploaders, u)
+	}
+
+	if len(uploaders) == 1 {
+		return uploaders[0], nil
+	}
+	logger.Log.WithField("destinations", spec).Info("Fanning uploads out to multiple destinations")
+	return NewMultiUploader(uploaders...), nil
+}
+
+// newCollectorFromEnv creates an uploader for a collector URL, authenticating with COLLECTOR_TOKEN
+// (or the contents of COLLECTOR_TOKEN_FILE) and trusting COLLECTOR_CA_FILE when set
+func newCollectorFromEnv(uri string) (Uploader, error) {
+	token := os.Getenv("COLLECTOR_TOKEN")
+	if path := os.Getenv("COLLECTOR_TOKEN_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read collector token file: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	var rootCAs *x509.CertPool
+	if path := os.Getenv("COLLECTOR_CA_FILE"); path != "" {
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read collector CA file: %w", err)
+		}
+		rootCAs = x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in collector CA file %s", path)
+		}
+	}
+	return NewCollectorUploader(uri, token, rootCAs)
+}
@@ -5,30 +5,61 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
+	"strconv"
 	"time"
 
 	"cloud.google.com/go/storage"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/filetype"
 	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/marker"
 	"github.com/sirupsen/logrus"
 )
 
 type GCSUploader struct {
 	client     *storage.Client
 	bucketName string
+	opts       Options
+	metadata   metadataTemplates
 }
 
 // NewGCSUploader creates a new GCS uploader
-func NewGCSUploader(ctx context.Context, bucketName string) (*GCSUploader, error) {
-	client, err := storage.NewClient(ctx)
+func NewGCSUploader(ctx context.Context, bucketName string, opts Options) (*GCSUploader, error) {
+	if opts.RequireUniformAccess && opts.PredefinedACL != "" {
+		return nil, fmt.Errorf("predefined ACLs cannot be used with uniform bucket-level access")
+	}
+
+	metadata, err := loadMetadataTemplates(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newStorageClient(ctx, bucketName, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create GCS client: %w", err)
 	}
 
-	return &GCSUploader{
+	u := &GCSUploader{
 		client:     client,
 		bucketName: bucketName,
-	}, nil
+		opts:       opts,
+		metadata:   metadata,
+	}
+
+	if opts.CreateBucket {
+		if err := u.ensureBucket(ctx); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+
+	if opts.RequireUniformAccess {
+		if err := u.verifyUniformAccess(ctx); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+
+	return u, nil
 }
 
 // Upload uploads a file to GCS and returns nil on success
@@ -46,52 +77,158 @@ func (u *GCSUploader) Upload(ctx context.Context, localPath, podName string) err
 		return fmt.Errorf("failed to get file info: %w", err)
 	}
 
-	// Wait a bit and check if file is still being written
-	// (size should be stable)
-	time.Sleep(2 * time.Second)
-	newInfo, err := file.Stat()
-	if err != nil {
-		return fmt.Errorf("failed to re-check file info: %w", err)
+	// Wait a bit and check if file is still being written (size should be stable). A completion
+	// marker already proves the sidecar finished the file.
+	if _, err := os.Stat(marker.Path(localPath)); err != nil {
+		time.Sleep(u.opts.StabilityDelay)
+		newInfo, err := file.Stat()
+		if err != nil {
+			return fmt.Errorf("failed to re-check file info: %w", err)
+		}
+		if newInfo.Size() != fileInfo.Size() {
+			return fmt.Errorf("file is still being written (size changed)")
+		}
 	}
 
-	if newInfo.Size() != fileInfo.Size() {
-		return fmt.Errorf("file is still being written (size changed)")
-	}
+	// Construct GCS object path: [{TYPE_PREFIX}/]{POD_NAME}/{FILENAME}
+	objectPath := ObjectPath(ctx, localPath, podName)
+	gcsPath := fmt.Sprintf("gs://%s/%s", u.bucketFor(ctx), objectPath)
 
-	// Construct GCS object path: {POD_NAME}/{FILENAME}
-	filename := filepath.Base(localPath)
-	objectPath := fmt.Sprintf("%s/%s", podName, filename)
+	// Abort (rather than finalize) the object if the upload overruns its deadline
+	ctx, cancel, timeout := withUploadDeadline(ctx, fileInfo.Size())
+	defer cancel()
 
 	// Create GCS object writer
-	obj := u.client.Bucket(u.bucketName).Object(objectPath)
+	obj := u.bucket(ctx).Object(objectPath)
 	writer := obj.NewWriter(ctx)
-	writer.ContentType = "application/octet-stream"
+	fileType := filetype.Detect(localPath)
+	writer.ContentType = fileType.ContentType
+	writer.ContentEncoding = fileType.ContentEncoding
+	u.applyObjectAttrs(&writer.ObjectAttrs)
+	if writer.Metadata, err = u.metadata.renderFor(ctx, localPath, podName); err != nil {
+		return err
+	}
+
+	compress := shouldCompress(fileType)
+	if compress {
+		// Record the original's checksum up front so the object is complete when it lands
+		sum, err := FileSHA256(localPath)
+		if err != nil {
+			return err
+		}
+		if writer.Metadata == nil {
+			writer.Metadata = map[string]string{}
+		}
+		writer.Metadata[originalSHA256Key] = sum
+		writer.Metadata[originalSizeKey] = strconv.FormatInt(fileInfo.Size(), 10)
+		writer.ContentEncoding = "gzip"
+	}
 
 	// Stream file to GCS
 	logger.Log.WithFields(logrus.Fields{
 		"local_path": localPath,
-		"gcs_path":   fmt.Sprintf("gs://%s/%s", u.bucketName, objectPath),
+		"gcs_path":   gcsPath,
 		"size_bytes": fileInfo.Size(),
+		"type":       fileType.Name,
+		"compressed": compress,
 	}).Info("Uploading file to GCS")
 
-	bytesWritten, err := io.Copy(writer, file)
+	var source io.Reader
+	source, done := trackProgress(file, localPath, gcsPath, fileInfo.Size())
+	defer done()
+	if compress {
+		gz := gzipReader(source)
+		defer gz.Close()
+		source = gz
+	}
+
+	bytesWritten, err := io.Copy(writer, source)
 	if err != nil {
+		cancel()
 		writer.Close()
-		return fmt.Errorf("failed to upload file: %w", err)
+		return uploadTimeoutError(ctx, u.destination(ctx), timeout, fmt.Errorf("failed to upload file: %w", err))
 	}
 
 	// Close the writer to finalize the upload
 	if err := writer.Close(); err != nil {
-		return fmt.Errorf("failed to finalize upload: %w", err)
+		return uploadTimeoutError(ctx, u.destination(ctx), timeout, fmt.Errorf("failed to finalize upload: %w", err))
 	}
 
 	logger.Log.WithFields(logrus.Fields{
 		"bytes_written": bytesWritten,
-		"gcs_path":      fmt.Sprintf("gs://%s/%s", u.bucketName, objectPath),
+		"gcs_path":      gcsPath,
 	}).Info("Successfully uploaded file to GCS")
 	return nil
 }
 
+// UploadStream uploads everything read from r to GCS as {POD_NAME}/{FILENAME}
+func (u *GCSUploader) UploadStream(ctx context.Context, r io.Reader, podName, filename string) (int64, error) {
+	objectPath := ObjectPath(ctx, filename, podName)
+	gcsPath := fmt.Sprintf("gs://%s/%s", u.bucketFor(ctx), objectPath)
+
+	// Cancelling the context aborts the upload instead of finalizing a partial object
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	writer := u.bucket(ctx).Object(objectPath).NewWriter(ctx)
+	fileType := filetype.Lookup(filename)
+	writer.ContentType = fileType.ContentType
+	writer.ContentEncoding = fileType.ContentEncoding
+	u.applyObjectAttrs(&writer.ObjectAttrs)
+	metadata, err := u.metadata.renderFor(ctx, filename, podName)
+	if err != nil {
+		return 0, err
+	}
+	writer.Metadata = metadata
+
+	logger.Log.WithField("gcs_path", gcsPath).Info("Streaming upload to GCS")
+
+	source, done := trackProgress(r, filename, gcsPath, 0)
+	defer done()
+
+	bytesWritten, err := io.Copy(writer, source)
+	if err != nil {
+		cancel()
+		writer.Close()
+		return bytesWritten, fmt.Errorf("failed to stream upload: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return bytesWritten, fmt.Errorf("failed to finalize upload: %w", err)
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"bytes_written": bytesWritten,
+		"gcs_path":      gcsPath,
+	}).Info("Successfully streamed upload to GCS")
+	return bytesWritten, nil
+}
+
+// Destination returns the bucket URI uploads are written to
+func (u *GCSUploader) Destination() string {
+	return fmt.Sprintf("gs://%s", u.bucketName)
+}
+
+func (u *GCSUploader) destination(ctx context.Context) string {
+	return fmt.Sprintf("gs://%s", u.bucketFor(ctx))
+}
+
+// bucketFor returns the scope's bucket, or the uploader's own
+func (u *GCSUploader) bucketFor(ctx context.Context) string {
+	if b := scopeFrom(ctx).Bucket; b != "" {
+		return b
+	}
+	return u.bucketName
+}
+
+// bucket returns the bucket handle, billed to the user project if configured
+func (u *GCSUploader) bucket(ctx context.Context) *storage.BucketHandle {
+	bucket := u.client.Bucket(u.bucketFor(ctx))
+	if u.opts.UserProject != "" {
+		bucket = bucket.UserProject(u.opts.UserProject)
+	}
+	return bucket
+}
+
 // Close closes the GCS client
 func (u *GCSUploader) Close() error {
 	return u.client.Close()
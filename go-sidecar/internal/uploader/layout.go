@@ -0,0 +1,38 @@
+package uploader
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/config"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/filetype"
+)
+
+// layoutByType prefixes object names with the artifact type (jfr/, heapdumps/, ...) so
+// lifecycle and access policies can differ per type
+var layoutByType = config.EnvBool("UPLOAD_LAYOUT_BY_TYPE", false)
+
+// otherPrefix holds files of unknown type when laying out by type
+const otherPrefix = "other"
+
+// ObjectPath returns the destination-relative object name for a local file:
+// {POD_NAME}/{FILENAME}, or {TYPE_PREFIX}/{POD_NAME}/{FILENAME} with UPLOAD_LAYOUT_BY_TYPE.
+// A tenant scope on ctx adds its prefix in front. Files compressed during upload get a .gz suffix.
+func ObjectPath(ctx context.Context, localPath, podName string) string {
+	fileType := filetype.Detect(localPath)
+	filename := filepath.Base(localPath)
+	if shouldCompress(fileType) {
+		filename += ".gz"
+	}
+	tenantPrefix := scopeFrom(ctx).Prefix
+	if !layoutByType {
+		return path.Join(tenantPrefix, podName, filename)
+	}
+
+	prefix := fileType.Prefix
+	if prefix == "" {
+		prefix = otherPrefix
+	}
+	return path.Join(tenantPrefix, prefix, podName, filename)
+}
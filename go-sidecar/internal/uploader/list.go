@@ -0,0 +1,101 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/filetype"
+	"google.golang.org/api/iterator"
+)
+
+// ObjectInfo describes an uploaded object
+type ObjectInfo struct {
+	Name            string            `json:"name"` // object name relative to the destination
+	URI             string            `json:"uri"`
+	Size            int64             `json:"size"`
+	Uploaded        time.Time         `json:"uploaded"`
+	ContentType     string            `json:"contentType,omitempty"`
+	ContentEncoding string            `json:"contentEncoding,omitempty"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+}
+
+// Lister is implemented by uploaders that can enumerate what they have uploaded
+type Lister interface {
+	ListPod(ctx context.Context, podName string) ([]ObjectInfo, error)
+}
+
+// podPrefixes returns the object prefixes a pod's uploads can live under
+func podPrefixes(ctx context.Context, podName string) []string {
+	tenantPrefix := scopeFrom(ctx).Prefix
+	if !layoutByType {
+		return []string{path.Join(tenantPrefix, podName) + "/"}
+	}
+	var prefixes []string
+	for _, p := range append(filetype.Prefixes(), otherPrefix) {
+		prefixes = append(prefixes, path.Join(tenantPrefix, p, podName)+"/")
+	}
+	return prefixes
+}
+
+// ListPod lists objects uploaded for a pod, newest first
+func (u *GCSUploader) ListPod(ctx context.Context, podName string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	bucketName := u.bucketFor(ctx)
+	for _, prefix := range podPrefixes(ctx, podName) {
+		it := u.bucket(ctx).Objects(ctx, &storage.Query{Prefix: prefix})
+		for {
+			attrs, err := it.Next()
+			if errors.Is(err, iterator.Done) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to list gs://%s/%s: %w", bucketName, prefix, err)
+			}
+			objects = append(objects, gcsObjectInfo(bucketName, attrs))
+		}
+	}
+	sortNewestFirst(objects)
+	return objects, nil
+}
+
+// ListPod lists files copied for a pod, newest first
+func (u *LocalUploader) ListPod(ctx context.Context, podName string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	dir := u.root(ctx)
+	for _, prefix := range podPrefixes(ctx, podName) {
+		root := filepath.Join(dir, filepath.FromSlash(prefix))
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(dir, p)
+			objects = append(objects, localObjectInfo(filepath.ToSlash(rel), p, info))
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to list %s: %w", root, err)
+		}
+	}
+	sortNewestFirst(objects)
+	return objects, nil
+}
+
+func sortNewestFirst(objects []ObjectInfo) {
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Uploaded.After(objects[j].Uploaded) })
+}
@@ -0,0 +1,138 @@
+package uploader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/filetype"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// LocalUploader copies files into a local directory instead of GCS (simulation mode)
+type LocalUploader struct {
+	dir string
+}
+
+// NewLocalUploader creates an uploader that writes to dir/{POD_NAME}/{FILENAME}, using the same layout as GCS
+func NewLocalUploader(dir string) (*LocalUploader, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	return &LocalUploader{dir: dir}, nil
+}
+
+// Upload copies a file into the local destination directory
+func (u *LocalUploader) Upload(ctx context.Context, localPath, podName string) error {
+	src, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", localPath, err)
+	}
+	defer src.Close()
+
+	destPath := filepath.Join(u.root(ctx), filepath.FromSlash(ObjectPath(ctx, localPath, podName)))
+	if err := os.MkdirAll(filepath.Dir(destPath), 0o755); err != nil {
+		return fmt.Errorf("failed to create destination directory: %w", err)
+	}
+
+	dst, err := os.Create(destPath)
+	if err != nil {
+		return fmt.Errorf("failed to create destination file: %w", err)
+	}
+
+	var source io.Reader = src
+	if shouldCompress(filetype.Detect(localPath)) {
+		gz := gzipReader(src)
+		defer gz.Close()
+		source = gz
+	}
+
+	// The destination may be a network mount that stalls just like a GCS connection
+	info, err := src.Stat()
+	if err != nil {
+		dst.Close()
+		return fmt.Errorf("failed to get file info: %w", err)
+	}
+	ctx, cancel, timeout := withUploadDeadline(ctx, info.Size())
+	defer cancel()
+
+	bytesWritten, err := io.Copy(dst, contextReader{ctx, source})
+	if err != nil {
+		dst.Close()
+		os.Remove(destPath)
+		return uploadTimeoutError(ctx, u.destination(ctx), timeout, fmt.Errorf("failed to copy file: %w", err))
+	}
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("failed to finalize copy: %w", err)
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"bytes_written": bytesWritten,
+		"dest_path":     destPath,
+	}).Info("Successfully copied file to local destination")
+	return nil
+}
+
+// UploadStream copies everything read from r into the local destination directory
+func (u *LocalUploader) UploadStream(ctx context.Context, r io.Reader, podName, filename string) (int64, error) {
+	destPath := filepath.Join(u.root(ctx), filepath.FromSlash(ObjectPath(ctx, filename, podName)))
+	if err := os.MkdirAll(filepath.Dir(destPath), 0o755); err != nil {
+		return 0, fmt.Errorf("failed to create destination directory: %w", err)
+	}
+
+	dst, err := os.Create(destPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create destination file: %w", err)
+	}
+
+	bytesWritten, err := io.Copy(dst, r)
+	if err != nil {
+		dst.Close()
+		os.Remove(destPath)
+		return bytesWritten, fmt.Errorf("failed to copy stream: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		return bytesWritten, fmt.Errorf("failed to finalize copy: %w", err)
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"bytes_written": bytesWritten,
+		"dest_path":     destPath,
+	}).Info("Successfully streamed to local destination")
+	return bytesWritten, nil
+}
+
+// Destination returns the local directory URI uploads are written to
+func (u *LocalUploader) Destination() string {
+	return "file://" + u.dir
+}
+
+// root returns the directory standing in for the scope's bucket: a subdirectory named after it
+func (u *LocalUploader) root(ctx context.Context) string {
+	return filepath.Join(u.dir, scopeFrom(ctx).Bucket)
+}
+
+func (u *LocalUploader) destination(ctx context.Context) string {
+	return "file://" + u.root(ctx)
+}
+
+// Close is a no-op for the local uploader
+func (u *LocalUploader) Close() error {
+	return nil
+}
+
+// contextReader stops reading once ctx is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,106 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/filetype"
+)
+
+type objectMetadataKey struct{}
+
+// WithObjectMetadata returns a context whose uploads carry metadata in addition to the
+// configured templates, e.g. a recording's description. Keys set here win over templates.
+func WithObjectMetadata(ctx context.Context, metadata map[string]string) context.Context {
+	if len(metadata) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, objectMetadataKey{}, metadata)
+}
+
+func objectMetadataFrom(ctx context.Context) map[string]string {
+	m, _ := ctx.Value(objectMetadataKey{}).(map[string]string)
+	return m
+}
+
+// metadataVars are the fields available to metadata templates, e.g. "{{.Pod}}"
+type metadataVars struct {
+	Pod  string
+	Node string
+	File string
+	Type string
+}
+
+// metadataTemplates holds parsed custom metadata values keyed by metadata key
+type metadataTemplates map[string]*template.Template
+
+// loadMetadataTemplates merges the metadata file (a JSON object) with inline values and
+// parses every value as a template; inline values win over the file
+func loadMetadataTemplates(opts Options) (metadataTemplates, error) {
+	values := map[string]string{}
+	if opts.MetadataFile != "" {
+		data, err := os.ReadFile(opts.MetadataFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read metadata file: %w", err)
+		}
+		if err := json.Unmarshal(data, &values); err != nil {
+			return nil, fmt.Errorf("invalid metadata file %s: %w", opts.MetadataFile, err)
+		}
+	}
+	maps.Copy(values, opts.Metadata)
+
+	tmpls := make(metadataTemplates, len(values))
+	for key, value := range values {
+		t, err := template.New(key).Option("missingkey=error").Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metadata template for %q: %w", key, err)
+		}
+		tmpls[key] = t
+	}
+	return tmpls, nil
+}
+
+// renderFor evaluates the templates for one upload and adds the metadata carried by ctx
+func (m metadataTemplates) renderFor(ctx context.Context, localPath, podName string) (map[string]string, error) {
+	metadata, err := m.render(localPath, podName)
+	if err != nil {
+		return nil, err
+	}
+	if extra := objectMetadataFrom(ctx); len(extra) > 0 {
+		if metadata == nil {
+			metadata = make(map[string]string, len(extra))
+		}
+		maps.Copy(metadata, extra)
+	}
+	return metadata, nil
+}
+
+// render evaluates the templates for one upload
+func (m metadataTemplates) render(localPath, podName string) (map[string]string, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+
+	vars := metadataVars{
+		Pod:  podName,
+		Node: os.Getenv("NODE_NAME"),
+		File: filepath.Base(localPath),
+		Type: filetype.Detect(localPath).Name,
+	}
+
+	metadata := make(map[string]string, len(m))
+	for key, t := range m {
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, vars); err != nil {
+			return nil, fmt.Errorf("failed to render metadata %q: %w", key, err)
+		}
+		metadata[key] = buf.String()
+	}
+	return metadata, nil
+}
@@ -0,0 +1,300 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/metrics"
+)
+
+// MultiUploader fans every upload out to several destinations. An upload only succeeds once
+// each destination has the object, so the daemon keeps and retries the local file otherwise.
+type MultiUploader struct {
+	uploaders []Uploader
+}
+
+// NewMultiUploader creates an uploader that writes to all of uploaders
+func NewMultiUploader(uploaders ...Uploader) *MultiUploader {
+	return &MultiUploader{uploaders: uploaders}
+}
+
+// ReplicationError lists the destinations that do not hold an object after an upload or
+// verification, each with its own reason
+type ReplicationError struct {
+	Object       string
+	Destinations map[string]error // keyed by destination URI
+}
+
+func (e *ReplicationError) Error() string {
+	destinations := slices.Sorted(maps.Keys(e.Destinations))
+	reasons := make([]string, len(destinations))
+	for i, destination := range destinations {
+		reasons[i] = fmt.Sprintf("%s: %v", destination, e.Destinations[destination])
+	}
+	return fmt.Sprintf("%s is not replicated to %d of its destinations: %s", e.Object, len(destinations), strings.Join(reasons, "; "))
+}
+
+func (e *ReplicationError) Unwrap() []error {
+	return slices.Collect(maps.Values(e.Destinations))
+}
+
+// replica is the object a local file is stored as at each destination
+type replica struct {
+	name string
+	size int64 // -1 for compressed copies, whose size differs from the local file
+}
+
+func newReplica(ctx context.Context, localPath, podName string) (replica, error) {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return replica{}, err
+	}
+	r := replica{name: ObjectPath(ctx, localPath, podName), size: info.Size()}
+	if strings.HasSuffix(r.name, ".gz") && !strings.HasSuffix(localPath, ".gz") {
+		r.size = -1
+	}
+	return r, nil
+}
+
+// divergence reports how a destination's copy differs from the replica, or nil if it holds it
+func (r replica) divergence(ctx context.Context, store ObjectStore) error {
+	obj, err := store.Stat(ctx, r.name)
+	switch {
+	case err != nil:
+		return err
+	case r.size >= 0 && obj.Size != r.size:
+		return fmt.Errorf("size %d, expected %d", obj.Size, r.size)
+	}
+	return nil
+}
+
+// Upload ships the file to every destination that does not hold it yet, so a retry after a
+// partial failure only re-ships the missing copies, then verifies each copy. Destinations that
+// cannot be inspected are always written.
+func (m *MultiUploader) Upload(ctx context.Context, localPath, podName string) error {
+	r, err := newReplica(ctx, localPath, podName)
+	if err != nil {
+		return err
+	}
+	failed := map[string]error{}
+	for _, u := range m.uploaders {
+		destination := DestinationFor(ctx, u)
+		store, canVerify := u.(ObjectStore)
+		if canVerify && r.divergence(ctx, store) == nil {
+			logger.Log.WithContext(ctx).WithField("object", r.name).WithField("destination", destination).Debug("Destination already holds the recording")
+			continue
+		}
+		if err := u.Upload(ctx, localPath, podName); err != nil {
+			failed[destination] = err
+			continue
+		}
+		if canVerify {
+			if err := r.divergence(ctx, store); err != nil {
+				metrics.ReplicationVerifyFailuresTotal.WithLabelValues(destination).Inc()
+				failed[destination] = err
+			}
+		}
+	}
+	return replicationError(ctx, r.name, failed)
+}
+
+// Verify confirms the object for a local file exists at every destination. The size is only
+// compared for files stored as-is; compressed copies differ from the local file.
+func (m *MultiUploader) Verify(ctx context.Context, localPath, podName string) error {
+	r, err := newReplica(ctx, localPath, podName)
+	if err != nil {
+		return err
+	}
+	failed := map[string]error{}
+	for _, u := range m.uploaders {
+		store, ok := u.(ObjectStore)
+		if !ok {
+			continue
+		}
+		destination := DestinationFor(ctx, u)
+		if err := r.divergence(ctx, store); err != nil {
+			metrics.ReplicationVerifyFailuresTotal.WithLabelValues(destination).Inc()
+			failed[destination] = err
+		}
+	}
+	return replicationError(ctx, r.name, failed)
+}
+
+// replicationError logs each destination missing the object and returns them as one
+// *ReplicationError, or nil if none is
+func replicationError(ctx context.Context, name string, failed map[string]error) error {
+	if len(failed) == 0 {
+		return nil
+	}
+	for destination, err := range failed {
+		logger.Log.WithContext(ctx).WithError(err).WithField("object", name).WithField("destination", destination).Warn("Destination does not hold the recording")
+	}
+	return &ReplicationError{Object: name, Destinations: failed}
+}
+
+// UploadStream tees the stream into every destination
+func (m *MultiUploader) UploadStream(ctx context.Context, r io.Reader, podName, filename string) (int64, error) {
+	writers := make([]io.Writer, len(m.uploaders))
+	pipes := make([]*io.PipeWriter, len(m.uploaders))
+	errs := make([]error, len(m.uploaders))
+
+	var wg sync.WaitGroup
+	for i, u := range m.uploaders {
+		pr, pw := io.Pipe()
+		writers[i], pipes[i] = pw, pw
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := u.UploadStream(ctx, pr, podName, filename)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", DestinationFor(ctx, u), err)
+			}
+			// Unblock the tee if this destination gave up early
+			pr.CloseWithError(err)
+		}()
+	}
+
+	written, copyErr := io.Copy(io.MultiWriter(writers...), r)
+	for _, pw := range pipes {
+		pw.CloseWithError(copyErr)
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return written, err
+	}
+	return written, copyErr
+}
+
+// ListPod lists the pod's objects at the first destination that supports listing
+func (m *MultiUploader) ListPod(ctx context.Context, podName string) ([]ObjectInfo, error) {
+	for _, u := range m.uploaders {
+		if lister, ok := u.(Lister); ok {
+			return lister.ListPod(ctx, podName)
+		}
+	}
+	return nil, fmt.Errorf("no destination supports listing")
+}
+
+// Destination returns the destination URIs, comma-separated
+func (m *MultiUploader) Destination() string {
+	destinations := make([]string, len(m.uploaders))
+	for i, u := range m.uploaders {
+		destinations[i] = u.Destination()
+	}
+	return strings.Join(destinations, ",")
+}
+
+func (m *MultiUploader) destination(ctx context.Context) string {
+	destinations := make([]string, len(m.uploaders))
+	for i, u := range m.uploaders {
+		destinations[i] = DestinationFor(ctx, u)
+	}
+	return strings.Join(destinations, ",")
+}
+
+// Close closes every destination
+func (m *MultiUploader) Close() error {
+	var errs []error
+	for _, u := range m.uploaders {
+		errs = append(errs, u.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// ReconcileReport summarizes one reconciliation pass
+type ReconcileReport struct {
+	Checked  int            `json:"checked"`
+	Missing  map[string]int `json:"missing"`  // per destination, before repair
+	Repaired map[string]int `json:"repaired"` // per destination
+	Failed   map[string]int `json:"failed"`   // per destination
+}
+
+// Reconcile compares what each destination holds for the given pods and copies objects
+// missing from a destination over from one that has them
+func (m *MultiUploader) Reconcile(ctx context.Context, pods []string) (ReconcileReport, error) {
+	report := ReconcileReport{Missing: map[string]int{}, Repaired: map[string]int{}, Failed: map[string]int{}}
+
+	type holder struct {
+		store ObjectStore
+		info  ObjectInfo
+	}
+	var stores []Uploader
+	for _, u := range m.uploaders {
+		if _, ok := u.(ObjectStore); !ok {
+			continue
+		}
+		if _, ok := u.(Lister); !ok {
+			continue
+		}
+		stores = append(stores, u)
+	}
+	if len(stores) < 2 {
+		return report, nil
+	}
+
+	for _, pod := range pods {
+		present := make([]map[string]bool, len(stores))
+		sources := map[string]holder{}
+		for i, u := range stores {
+			objects, err := u.(Lister).ListPod(ctx, pod)
+			if err != nil {
+				return report, fmt.Errorf("failed to list %s for pod %s: %w", DestinationFor(ctx, u), pod, err)
+			}
+			present[i] = map[string]bool{}
+			for _, obj := range objects {
+				present[i][obj.Name] = true
+				if _, ok := sources[obj.Name]; !ok {
+					sources[obj.Name] = holder{store: u.(ObjectStore), info: obj}
+				}
+			}
+		}
+
+		for name, src := range sources {
+			report.Checked++
+			for i, u := range stores {
+				if present[i][name] {
+					continue
+				}
+				destination := DestinationFor(ctx, u)
+				report.Missing[destination]++
+
+				err := copyObject(ctx, src.store, u.(ObjectStore), name)
+				result := "success"
+				if err != nil {
+					result = "failure"
+					report.Failed[destination]++
+					logger.Log.WithError(err).WithField("object", name).WithField("destination", destination).Warn("Failed to repair missing replica")
+				} else {
+					report.Repaired[destination]++
+					logger.Log.WithField("object", name).WithField("destination", destination).Info("Repaired missing replica")
+				}
+				metrics.ReplicationRepairsTotal.WithLabelValues(destination, result).Inc()
+			}
+		}
+	}
+
+	for _, u := range stores {
+		destination := DestinationFor(ctx, u)
+		metrics.ReplicationMissingObjects.WithLabelValues(destination).Set(float64(report.Missing[destination] - report.Repaired[destination]))
+	}
+	return report, nil
+}
+
+// copyObject re-ships an object's stored bytes from one destination to another
+func copyObject(ctx context.Context, from, to ObjectStore, name string) error {
+	r, info, err := from.Open(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return to.Put(ctx, name, r, info)
+}
@@ -0,0 +1,81 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+)
+
+// countingUploader counts uploads to a local destination and fails them while broken
+type countingUploader struct {
+	*LocalUploader
+	uploads int
+	broken  bool
+}
+
+func (u *countingUploader) Upload(ctx context.Context, localPath, podName string) error {
+	u.uploads++
+	if u.broken {
+		return errors.New("destination unavailable")
+	}
+	return u.LocalUploader.Upload(ctx, localPath, podName)
+}
+
+func newCountingUploader(t *testing.T) *countingUploader {
+	t.Helper()
+	local, err := NewLocalUploader(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &countingUploader{LocalUploader: local}
+}
+
+func TestMultiUploaderRetryOnlyShipsMissingCopies(t *testing.T) {
+	logger.Init()
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "rec.jfr")
+	if err := os.WriteFile(path, []byte("recording"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	healthy, failing, truncated := newCountingUploader(t), newCountingUploader(t), newCountingUploader(t)
+	failing.broken = true
+	m := NewMultiUploader(healthy, failing, truncated)
+
+	err := m.Upload(ctx, path, "pod-a")
+	var replication *ReplicationError
+	if !errors.As(err, &replication) {
+		t.Fatalf("Upload = %v, want a *ReplicationError", err)
+	}
+	if _, ok := replication.Destinations[failing.Destination()]; len(replication.Destinations) != 1 || !ok {
+		t.Errorf("missing destinations = %v, want only %s", replication.Destinations, failing.Destination())
+	}
+
+	// One copy is lost, another corrupted, before the retry
+	failing.broken = false
+	object := filepath.Join(truncated.dir, filepath.FromSlash(ObjectPath(ctx, path, "pod-a")))
+	if err := os.WriteFile(object, []byte("rec"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Upload(ctx, path, "pod-a"); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	for name, tt := range map[string]struct {
+		u    *countingUploader
+		want int
+	}{
+		"healthy":   {healthy, 1},
+		"failing":   {failing, 2},
+		"truncated": {truncated, 2},
+	} {
+		if tt.u.uploads != tt.want {
+			t.Errorf("%s destination: %d uploads, want %d", name, tt.u.uploads, tt.want)
+		}
+	}
+	if err := m.Verify(ctx, path, "pod-a"); err != nil {
+		t.Errorf("Verify after retry: %v", err)
+	}
+}
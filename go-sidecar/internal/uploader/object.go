@@ -0,0 +1,150 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/filetype"
+)
+
+// ErrObjectNotExist is returned for objects missing from a destination
+var ErrObjectNotExist = errors.New("object does not exist")
+
+// ObjectStore is implemented by uploaders whose objects can be inspected and copied by name,
+// which replication verification needs
+type ObjectStore interface {
+	Stat(ctx context.Context, name string) (ObjectInfo, error)
+	// Open returns the object's stored bytes, without undoing any Content-Encoding
+	Open(ctx context.Context, name string) (io.ReadCloser, ObjectInfo, error)
+	// Put writes stored bytes under name with the encoding, type and metadata from info
+	Put(ctx context.Context, name string, r io.Reader, info ObjectInfo) error
+}
+
+func gcsObjectInfo(bucketName string, attrs *storage.ObjectAttrs) ObjectInfo {
+	return ObjectInfo{
+		Name:            attrs.Name,
+		URI:             fmt.Sprintf("gs://%s/%s", bucketName, attrs.Name),
+		Size:            attrs.Size,
+		Uploaded:        attrs.Created,
+		ContentType:     attrs.ContentType,
+		ContentEncoding: attrs.ContentEncoding,
+		Metadata:        attrs.Metadata,
+	}
+}
+
+// Stat returns an object's attributes
+func (u *GCSUploader) Stat(ctx context.Context, name string) (ObjectInfo, error) {
+	attrs, err := u.bucket(ctx).Object(name).Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return ObjectInfo{}, ErrObjectNotExist
+	}
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("failed to stat gs://%s/%s: %w", u.bucketFor(ctx), name, err)
+	}
+	return gcsObjectInfo(u.bucketFor(ctx), attrs), nil
+}
+
+// Open reads an object as stored, skipping decompressive transcoding of gzip objects
+func (u *GCSUploader) Open(ctx context.Context, name string) (io.ReadCloser, ObjectInfo, error) {
+	info, err := u.Stat(ctx, name)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	r, err := u.bucket(ctx).Object(name).ReadCompressed(true).NewReader(ctx)
+	if err != nil {
+		return nil, ObjectInfo{}, fmt.Errorf("failed to read %s: %w", info.URI, err)
+	}
+	return r, info, nil
+}
+
+// Put writes an object with the given attributes plus the uploader's holds, retention and ACL
+func (u *GCSUploader) Put(ctx context.Context, name string, r io.Reader, info ObjectInfo) error {
+	ctx, cancel, timeout := withUploadDeadline(ctx, info.Size)
+	defer cancel()
+
+	writer := u.bucket(ctx).Object(name).NewWriter(ctx)
+	writer.ContentType = info.ContentType
+	writer.ContentEncoding = info.ContentEncoding
+	writer.Metadata = info.Metadata
+	u.applyObjectAttrs(&writer.ObjectAttrs)
+
+	if _, err := io.Copy(writer, r); err != nil {
+		cancel()
+		writer.Close()
+		return uploadTimeoutError(ctx, u.destination(ctx), timeout, fmt.Errorf("failed to write gs://%s/%s: %w", u.bucketFor(ctx), name, err))
+	}
+	if err := writer.Close(); err != nil {
+		return uploadTimeoutError(ctx, u.destination(ctx), timeout, fmt.Errorf("failed to finalize gs://%s/%s: %w", u.bucketFor(ctx), name, err))
+	}
+	return nil
+}
+
+func localObjectInfo(name, path string, info fs.FileInfo) ObjectInfo {
+	obj := ObjectInfo{
+		Name:        name,
+		URI:         "file://" + path,
+		Size:        info.Size(),
+		Uploaded:    info.ModTime(),
+		ContentType: filetype.Lookup(path).ContentType,
+	}
+	if strings.HasSuffix(name, ".gz") {
+		obj.ContentEncoding = "gzip"
+	}
+	return obj
+}
+
+// Stat returns a copied file's attributes
+func (u *LocalUploader) Stat(ctx context.Context, name string) (ObjectInfo, error) {
+	path := filepath.Join(u.root(ctx), filepath.FromSlash(name))
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ObjectInfo{}, ErrObjectNotExist
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return localObjectInfo(name, path, info), nil
+}
+
+// Open opens a copied file
+func (u *LocalUploader) Open(ctx context.Context, name string) (io.ReadCloser, ObjectInfo, error) {
+	info, err := u.Stat(ctx, name)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	f, err := os.Open(filepath.Join(u.root(ctx), filepath.FromSlash(name)))
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	return f, info, nil
+}
+
+// Put writes a file via a hidden temporary so a partial copy is never visible
+func (u *LocalUploader) Put(ctx context.Context, name string, r io.Reader, info ObjectInfo) error {
+	path := filepath.Join(u.root(ctx), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,87 @@
+package uploader
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/config"
+)
+
+// Options holds optional GCS uploader settings
+type Options struct {
+	// Bucket auto-creation (for ephemeral test clusters)
+	CreateBucket       bool
+	ProjectID          string
+	BucketLocation     string
+	BucketStorageClass string
+	UniformAccess      bool
+
+	// Billing project for requester-pays buckets
+	UserProject string
+
+	// Holds and retention applied to uploaded objects
+	TemporaryHold   bool
+	EventBasedHold  bool
+	RetentionPeriod time.Duration
+	RetentionMode   string
+
+	// Access control and caching for uploaded objects
+	PredefinedACL        string
+	RequireUniformAccess bool
+	CacheControl         string
+
+	// Custom object metadata: values may be text/template strings (see metadata.go)
+	Metadata     map[string]string
+	MetadataFile string
+
+	// Client transport (json or grpc) and the number of gRPC connections (0 keeps the library default)
+	Transport    string
+	GRPCPoolSize int
+
+	// How long to wait between two size checks before a file counts as completely written
+	StabilityDelay time.Duration
+}
+
+// OptionsFromEnv loads uploader options from environment variables
+func OptionsFromEnv() Options {
+	return Options{
+		CreateBucket:       config.EnvBool("GCS_CREATE_BUCKET", false),
+		ProjectID:          os.Getenv("GCS_PROJECT_ID"),
+		BucketLocation:     config.Env("GCS_BUCKET_LOCATION", "US"),
+		BucketStorageClass: config.Env("GCS_BUCKET_STORAGE_CLASS", "STANDARD"),
+		UniformAccess:      config.EnvBool("GCS_UNIFORM_ACCESS", true),
+		UserProject:        os.Getenv("GCS_USER_PROJECT"),
+		TemporaryHold:      config.EnvBool("GCS_TEMPORARY_HOLD", false),
+		EventBasedHold:     config.EnvBool("GCS_EVENT_BASED_HOLD", false),
+		RetentionPeriod:    config.EnvDuration("GCS_RETENTION_PERIOD", 0),
+		RetentionMode:      config.Env("GCS_RETENTION_MODE", "Unlocked"),
+
+		PredefinedACL:        os.Getenv("GCS_PREDEFINED_ACL"),
+		RequireUniformAccess: config.EnvBool("GCS_REQUIRE_UNIFORM_ACCESS", false),
+		CacheControl:         os.Getenv("GCS_CACHE_CONTROL"),
+
+		Metadata:     envMap("GCS_METADATA"),
+		MetadataFile: os.Getenv("GCS_METADATA_FILE"),
+
+		Transport:    parseTransport(os.Getenv("GCS_TRANSPORT")),
+		GRPCPoolSize: config.EnvInt("GCS_GRPC_POOL_SIZE", 0),
+	}
+}
+
+// envMap parses a comma-separated list of key=value pairs
+func envMap(key string) map[string]string {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return nil
+	}
+	m := map[string]string{}
+	for _, pair := range strings.Split(v, ",") {
+		k, val, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			continue
+		}
+		m[strings.TrimSpace(k)] = strings.TrimSpace(val)
+	}
+	return m
+}
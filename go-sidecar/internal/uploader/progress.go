@@ -0,0 +1,131 @@
+package uploader
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+const progressLogInterval = 10 * time.Second
+
+// Progress is a point-in-time view of an in-flight upload
+type Progress struct {
+	Path         string    `json:"path"`
+	Destination  string    `json:"destination"`
+	BytesWritten int64     `json:"bytesWritten"`
+	TotalBytes   int64     `json:"totalBytes"` // 0 for streams of unknown length
+	Percent      float64   `json:"percent"`
+	Started      time.Time `json:"started"`
+	ETASeconds   float64   `json:"etaSeconds"`
+}
+
+// tracker counts bytes read through it for one upload
+type tracker struct {
+	r           io.Reader
+	path        string
+	destination string
+	total       int64
+	started     time.Time
+	written     atomic.Int64
+	done        chan struct{}
+}
+
+var (
+	activeMu sync.Mutex
+	active   = map[*tracker]struct{}{}
+)
+
+// trackProgress wraps r so reads are counted, logged periodically and reported by ActiveUploads.
+// The returned function must be called when the upload finishes.
+func trackProgress(r io.Reader, path, destination string, total int64) (io.Reader, func()) {
+	t := &tracker{r: r, path: path, destination: destination, total: total, started: time.Now(), done: make(chan struct{})}
+
+	activeMu.Lock()
+	active[t] = struct{}{}
+	activeMu.Unlock()
+	updateProgressMetrics()
+
+	go func() {
+		ticker := time.NewTicker(progressLogInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-t.done:
+				return
+			case <-ticker.C:
+				p := t.snapshot()
+				logger.Log.WithFields(logrus.Fields{
+					"local_path":    p.Path,
+					"destination":   p.Destination,
+					"bytes_written": p.BytesWritten,
+					"total_bytes":   p.TotalBytes,
+					"percent":       p.Percent,
+					"eta_seconds":   p.ETASeconds,
+				}).Info("Upload in progress")
+				updateProgressMetrics()
+			}
+		}
+	}()
+
+	return t, func() {
+		close(t.done)
+		activeMu.Lock()
+		delete(active, t)
+		activeMu.Unlock()
+		updateProgressMetrics()
+	}
+}
+
+func (t *tracker) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.written.Add(int64(n))
+	return n, err
+}
+
+func (t *tracker) snapshot() Progress {
+	written := t.written.Load()
+	p := Progress{
+		Path:         t.path,
+		Destination:  t.destination,
+		BytesWritten: written,
+		TotalBytes:   t.total,
+		Started:      t.started,
+	}
+	if t.total > 0 {
+		p.Percent = float64(written) * 100 / float64(t.total)
+	}
+	if elapsed := time.Since(t.started).Seconds(); t.total > 0 && written > 0 && elapsed > 0 {
+		p.ETASeconds = float64(t.total-written) / (float64(written) / elapsed)
+	}
+	return p
+}
+
+// ActiveUploads returns the progress of all in-flight uploads, oldest first
+func ActiveUploads() []Progress {
+	activeMu.Lock()
+	list := make([]Progress, 0, len(active))
+	for t := range active {
+		list = append(list, t.snapshot())
+	}
+	activeMu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Started.Before(list[j].Started) })
+	return list
+}
+
+// updateProgressMetrics refreshes the in-flight upload gauges
+func updateProgressMetrics() {
+	var pending int64
+	uploads := ActiveUploads()
+	for _, p := range uploads {
+		pending += max(p.TotalBytes-p.BytesWritten, 0)
+	}
+	metrics.UploadsInProgress.Set(float64(len(uploads)))
+	metrics.UploadBytesPending.Set(float64(pending))
+}
@@ -0,0 +1,35 @@
+package uploader
+
+import "context"
+
+// Scope narrows uploads to a tenant: objects are named {PREFIX}/... and, when Bucket is set,
+// written to that bucket instead of the uploader's own
+type Scope struct {
+	Prefix string
+	Bucket string
+}
+
+type scopeKey struct{}
+
+// WithScope returns a context whose uploads, listings and object paths use scope
+func WithScope(ctx context.Context, scope Scope) context.Context {
+	return context.WithValue(ctx, scopeKey{}, scope)
+}
+
+func scopeFrom(ctx context.Context) Scope {
+	s, _ := ctx.Value(scopeKey{}).(Scope)
+	return s
+}
+
+// scopedDestination is implemented by uploaders whose destination depends on the scope
+type scopedDestination interface {
+	destination(ctx context.Context) string
+}
+
+// DestinationFor returns the destination URI uploads made with ctx are written to
+func DestinationFor(ctx context.Context, u Uploader) string {
+	if s, ok := u.(scopedDestination); ok {
+		return s.destination(ctx)
+	}
+	return u.Destination()
+}
@@ -0,0 +1,78 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/oscar-wu_pingcorp/profiler-sidecar/internal/logger"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GCS transports. The gRPC transport uses DirectPath when the node can reach it (GKE with
+// DirectPath-enabled networking), which gives noticeably higher throughput for large objects.
+const (
+	TransportJSON = "json"
+	TransportGRPC = "grpc"
+)
+
+// grpcProbeTimeout bounds the request that checks the gRPC transport works before it is used
+const grpcProbeTimeout = 10 * time.Second
+
+// newStorageClient creates the storage client for the configured transport. A gRPC client that
+// cannot be created or cannot reach the bucket is replaced by a JSON client, so enabling gRPC
+// never stops uploads.
+func newStorageClient(ctx context.Context, bucketName string, opts Options) (*storage.Client, error) {
+	if opts.Transport != TransportGRPC {
+		return storage.NewClient(ctx)
+	}
+
+	var clientOpts []option.ClientOption
+	if opts.GRPCPoolSize > 0 {
+		clientOpts = append(clientOpts, option.WithGRPCConnectionPool(opts.GRPCPoolSize))
+	}
+	client, err := storage.NewGRPCClient(ctx, clientOpts...)
+	if err == nil {
+		if err = probeGRPC(ctx, client, bucketName, opts); err == nil {
+			logger.Log.WithField("poolSize", opts.GRPCPoolSize).Info("Using gRPC transport for GCS")
+			return client, nil
+		}
+		client.Close()
+	}
+	logger.Log.WithError(err).Warn("gRPC transport for GCS unavailable, falling back to JSON")
+	return storage.NewClient(ctx)
+}
+
+// probeGRPC reads the bucket's attributes over gRPC. Only transport failures count: a denied or
+// missing bucket is answered by the server, so the transport itself works.
+func probeGRPC(ctx context.Context, client *storage.Client, bucketName string, opts Options) error {
+	ctx, cancel := context.WithTimeout(ctx, grpcProbeTimeout)
+	defer cancel()
+
+	bucket := client.Bucket(bucketName)
+	if opts.UserProject != "" {
+		bucket = bucket.UserProject(opts.UserProject)
+	}
+	_, err := bucket.Attrs(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("gRPC probe timed out after %s", grpcProbeTimeout)
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.Unimplemented, codes.DeadlineExceeded:
+		return err
+	}
+	return nil
+}
+
+// parseTransport normalizes GCS_TRANSPORT, treating unknown values as the JSON transport
+func parseTransport(v string) string {
+	if strings.EqualFold(strings.TrimSpace(v), TransportGRPC) {
+		return TransportGRPC
+	}
+	return TransportJSON
+}
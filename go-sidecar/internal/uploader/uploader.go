@@ -0,0 +1,15 @@
+package uploader
+
+import (
+	"context"
+	"io"
+)
+
+// Uploader ships a local file to a remote destination under the pod's prefix
+type Uploader interface {
+	Upload(ctx context.Context, localPath, podName string) error
+	// UploadStream uploads data of unknown length as {POD_NAME}/{FILENAME} without a local copy
+	UploadStream(ctx context.Context, r io.Reader, podName, filename string) (int64, error)
+	Destination() string
+	Close() error
+}
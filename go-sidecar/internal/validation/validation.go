@@ -0,0 +1,216 @@
+package validation
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// maxBodyBytes bounds request bodies; every API request is a small JSON object
+const maxBodyBytes = 1 << 20
+
+// FieldError describes one problem with one field of a request body
+type FieldError struct {
+	Field   string `json:"field"` // JSON path, e.g. "targets[0].pod"; empty for the body itself
+	Message string `json:"message"`
+}
+
+// Errors is the list of problems found in a request body
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	parts := make([]string, len(e))
+	for i, fe := range e {
+		if fe.Field == "" {
+			parts[i] = fe.Message
+		} else {
+			parts[i] = fe.Field + ": " + fe.Message
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Validator is implemented by request types; Validate returns semantic errors (missing fields,
+// bad enum values, out-of-range numbers). It may also normalize defaults.
+type Validator interface {
+	Validate() Errors
+}
+
+// Decode reads a JSON object from the request body into dst (a pointer to a struct) and checks it.
+// Unknown fields and type mismatches are reported for every field rather than stopping at the first;
+// semantic checks run only once the body decodes cleanly. An empty body is treated as {}.
+func Decode(r *http.Request, dst Validator) Errors {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodyBytes+1))
+	if err != nil {
+		return Errors{{Message: fmt.Sprintf("failed to read body: %v", err)}}
+	}
+	if len(body) > maxBodyBytes {
+		return Errors{{Message: fmt.Sprintf("body exceeds %d bytes", maxBodyBytes)}}
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		body = []byte("{}")
+	}
+
+	if errs := decodeObject(body, reflect.ValueOf(dst).Elem(), ""); len(errs) > 0 {
+		return errs
+	}
+	return dst.Validate()
+}
+
+// decodeObject decodes a JSON object field by field into the struct v
+func decodeObject(data []byte, v reflect.Value, path string) Errors {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return Errors{{Field: path, Message: fmt.Sprintf("must be an object, got %s", typeErr.Value)}}
+		}
+		return Errors{{Field: path, Message: fmt.Sprintf("malformed JSON: %v", err)}}
+	}
+
+	fields := jsonFields(v.Type())
+	var errs Errors
+	keys := make([]string, 0, len(raw))
+	for k := range raw {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		idx, ok := fields[key]
+		if !ok {
+			errs = append(errs, FieldError{Field: join(path, key), Message: "unknown field"})
+			continue
+		}
+		field := v.Field(idx)
+		if err := json.Unmarshal(raw[key], field.Addr().Interface()); err != nil {
+			errs = append(errs, fieldError(join(path, key), field.Type(), err))
+		}
+	}
+	return errs
+}
+
+// fieldError converts a decoding error of one field into a FieldError
+func fieldError(path string, t reflect.Type, err error) FieldError {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		if typeErr.Field != "" {
+			path = join(path, typeErr.Field)
+			t = typeErr.Type
+		}
+		return FieldError{Field: path, Message: fmt.Sprintf("must be %s, got %s", typeName(t), typeErr.Value)}
+	}
+	return FieldError{Field: path, Message: err.Error()}
+}
+
+// jsonFields maps JSON names to struct field indexes
+func jsonFields(t reflect.Type) map[string]int {
+	fields := map[string]int{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = i
+	}
+	return fields
+}
+
+// typeName describes a Go type in JSON terms
+func typeName(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
+
+func join(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+// Required returns an error when value is empty
+func Required(field, value string) *FieldError {
+	if value == "" {
+		return &FieldError{Field: field, Message: "is required"}
+	}
+	return nil
+}
+
+// OneOf returns an error when value is not one of the allowed values
+func OneOf(field, value string, allowed ...string) *FieldError {
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+	}
+	return &FieldError{Field: field, Message: fmt.Sprintf("must be one of %s, got %q", strings.Join(allowed, ", "), value)}
+}
+
+// Text returns an error when value is longer than max bytes or contains control characters
+// (line breaks included), so it can be carried in headers and object metadata
+func Text(field, value string, max int) *FieldError {
+	if len(value) > max {
+		return &FieldError{Field: field, Message: fmt.Sprintf("must be at most %d bytes", max)}
+	}
+	for _, r := range value {
+		if unicode.IsControl(r) {
+			return &FieldError{Field: field, Message: "must not contain control characters or line breaks"}
+		}
+	}
+	return nil
+}
+
+// URL returns an error when a non-empty value is not an absolute http(s) URL
+func URL(field, value string) *FieldError {
+	if value == "" {
+		return nil
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &FieldError{Field: field, Message: fmt.Sprintf("must be an http(s) URL, got %q", value)}
+	}
+	return Text(field, value, 512)
+}
+
+// Collect gathers the non-nil results of field checks
+func Collect(checks ...*FieldError) Errors {
+	var errs Errors
+	for _, c := range checks {
+		if c != nil {
+			errs = append(errs, *c)
+		}
+	}
+	return errs
+}
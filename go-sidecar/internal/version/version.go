@@ -0,0 +1,83 @@
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// Set at build time, e.g.
+//
+//	go build -ldflags "-X github.com/oscar-wu_pingcorp/profiler-sidecar/internal/version.version=v1.4.0
+//	  -X github.com/oscar-wu_pingcorp/profiler-sidecar/internal/version.commit=$(git rev-parse HEAD)
+//	  -X github.com/oscar-wu_pingcorp/profiler-sidecar/internal/version.buildDate=$(date -u +%FT%TZ)"
+//
+// Values left empty fall back to the module and VCS information Go embeds in the binary.
+var (
+	version   string
+	commit    string
+	buildDate string
+)
+
+// Info describes the running build
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+}
+
+var (
+	once sync.Once
+	info Info
+)
+
+// Get returns the build's version, commit and date. Each comes from -ldflags when set, otherwise
+// from the embedded build info, and is "unknown" when neither has it.
+func Get() Info {
+	once.Do(func() {
+		info = Info{Version: version, Commit: commit, BuildDate: buildDate, GoVersion: runtime.Version()}
+
+		var revision, modified, vcsTime string
+		if build, ok := debug.ReadBuildInfo(); ok {
+			if v := build.Main.Version; info.Version == "" && v != "" && v != "(devel)" {
+				info.Version = v
+			}
+			for _, s := range build.Settings {
+				switch s.Key {
+				case "vcs.revision":
+					revision = s.Value
+				case "vcs.modified":
+					modified = s.Value
+				case "vcs.time":
+					vcsTime = s.Value
+				}
+			}
+		}
+		if info.Commit == "" {
+			info.Commit = revision
+		}
+		if info.BuildDate == "" {
+			info.BuildDate = vcsTime
+		}
+		// Untagged builds are identified by their revision (suffixed "-dirty" for modified trees)
+		if info.Version == "" && revision != "" {
+			info.Version = revision[:min(len(revision), 12)]
+			if modified == "true" {
+				info.Version += "-dirty"
+			}
+		}
+
+		for _, field := range []*string{&info.Version, &info.Commit, &info.BuildDate} {
+			if *field == "" {
+				*field = "unknown"
+			}
+		}
+	})
+	return info
+}
+
+// String identifies the running build by its version
+func String() string {
+	return Get().Version
+}
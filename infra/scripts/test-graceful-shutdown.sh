@@ -85,7 +85,7 @@ create_long_profile() {
     http_code=$(echo "$response" | tail -n1)
     body=$(echo "$response" | sed '$d')
 
-    if [ "$http_code" = "200" ]; then
+    if [ "$http_code" = "202" ]; then
         print_success "JFR profile created successfully"
         echo "$body" | jq '.'
         # Extract recording name from response